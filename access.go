@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// How long a user's access is remembered before their profile is read again
+const userAccessTTL = time.Hour
+
+// Returned for users outside ALLOWED_EMAIL_DOMAINS trying to change issues
+var errRestricted = errors.New("the user's email domain isn't allowed")
+
+type checkedAccess struct {
+	email     string
+	bot       bool
+	checkedAt time.Time
+}
+
+// Users whose access was checked, by Slack user ID
+var userAccess = struct {
+	sync.Mutex
+	checked map[string]checkedAccess
+}{checked: map[string]checkedAccess{}}
+
+// isTrustedUser reports whether a Slack user may change issues and see full
+// cards. Without ALLOWED_EMAIL_DOMAINS everyone may, as may the bot itself
+// when no user is involved.
+func isTrustedUser(userID string) bool {
+	domains := getConfig().AllowedEmailDomains
+	if len(domains) == 0 || userID == "" || isAdmin(userID) {
+		return true
+	}
+
+	checked, err := checkSlackUser(userID)
+	if err != nil {
+		log.Printf("isTrustedUser: Error reading the profile of %s: %v", userID, err)
+		return false
+	}
+
+	return isAllowedEmail(checked.email, domains)
+}
+
+// checkSlackUser reads the email of a Slack user and whether they are a bot,
+// remembered for userAccessTTL
+func checkSlackUser(userID string) (checkedAccess, error) {
+	userAccess.Lock()
+	checked, ok := userAccess.checked[userID]
+	userAccess.Unlock()
+
+	if ok && time.Since(checked.checkedAt) < userAccessTTL {
+		return checked, nil
+	}
+
+	user, err := getSlackAPIFor(userID).GetUserInfo(userID)
+	if err == nil && user == nil {
+		err = fmt.Errorf("no profile for %s", userID)
+	}
+	if err != nil {
+		// Not remembered, so the next message tries again
+		return checkedAccess{}, err
+	}
+
+	checked = checkedAccess{email: user.Profile.Email, bot: user.IsBot, checkedAt: time.Now()}
+
+	userAccess.Lock()
+	userAccess.checked[userID] = checked
+	userAccess.Unlock()
+
+	return checked, nil
+}
+
+// isAllowedEmail reports whether an email address is in one of the domains
+func isAllowedEmail(email string, domains []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	for _, domain := range domains {
+		if strings.EqualFold(email[at+1:], domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkUserAccess must guard every change a Slack user asks for in Jira,
+// along with checkWritable
+func checkUserAccess(userID string) error {
+	if !isTrustedUser(userID) {
+		return errRestricted
+	}
+
+	return nil
+}
+
+// postRestrictedIssue posts only the key and status of an issue, for users
+// who may not see full cards
+func postRestrictedIssue(ctx context.Context, channel string, user string, threadTimestamp string, issueID string, options ...slack.MsgOption) error {
+	issue, err := fetchJiraIssueFor(ctx, channel, user, issueID)
+	if err != nil {
+		return err
+	}
+
+	return postText(channel, threadTimestamp, formatRestrictedMessage(issue), options...)
+}
+
+func formatRestrictedMessage(issue jiraIssue) string {
+	return fmt.Sprintf("> *%s* :traffic_light: *Status:* %s", issue.Key, issue.Fields.Status.Name)
+}
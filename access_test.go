@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsAllowedEmail(t *testing.T) {
+	domains := []string{"example.com", "example.org"}
+
+	for email, allowed := range map[string]bool{
+		"jane@example.com":        true,
+		"Jane@EXAMPLE.org":        true,
+		"guest@partner.com":       false,
+		"jane@mail.example.com":   false,
+		"example.com@partner.com": false,
+		"":                        false,
+	} {
+		if isAllowedEmail(email, domains) != allowed {
+			t.Errorf("Expected %q allowed to be %v", email, allowed)
+		}
+	}
+}
+
+func TestIsTrustedUserWithoutDomains(t *testing.T) {
+	os.Unsetenv("ALLOWED_EMAIL_DOMAINS")
+
+	if !isTrustedUser("U1") {
+		t.Errorf("Expected everyone to be trusted without allowed domains")
+	}
+}
+
+func TestFormatRestrictedMessage(t *testing.T) {
+	issue := decodeIssue(t, `{"key": "ABC-1", "fields": {"summary": "Secret plans", "status": {"name": "Open"}}}`)
+
+	if text := formatRestrictedMessage(issue); text != "> *ABC-1* :traffic_light: *Status:* Open" {
+		t.Errorf("Unexpected message %q", text)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Action ID of the App Home button toggling accessible cards
+const actionToggleAccessible = "toggle_accessible"
+
+const accessibleUsage = "Usage: `accessible on` sends you cards in plain sentences that read well with a screen reader, `accessible off` goes back to the usual cards."
+
+// Key of the user preferences in the state store
+const userPreferencesStateKey = "user_preferences"
+
+func init() {
+	registerStateKind(userPreferencesStateKey, loadUserPreferences)
+}
+
+// What a user chose for themselves
+type userPreferences struct {
+	// Cards as plain sentences without emoji, in direct messages and
+	// messages only the user sees
+	AccessibleCards bool `json:"accessible_cards"`
+}
+
+// Preferences by Slack user ID
+var userPreferenceStore = struct {
+	sync.Mutex
+	users map[string]userPreferences
+}{users: map[string]userPreferences{}}
+
+func getUserPreferences(userID string) userPreferences {
+	userPreferenceStore.Lock()
+	defer userPreferenceStore.Unlock()
+	refreshSharedUserPreferences()
+
+	return userPreferenceStore.users[userID]
+}
+
+// wantsAccessibleCard reports whether a card in the channel goes to a user
+// who asked for accessible cards. Only direct messages are theirs alone.
+func wantsAccessibleCard(channel string, userID string) bool {
+	return strings.HasPrefix(channel, "D") && userID != "" && getUserPreferences(userID).AccessibleCards
+}
+
+// formatAccessibleMessage renders an issue as sentences that screen readers
+// read in order, with the fields named before their values and no emoji
+func formatAccessibleMessage(issue jiraIssue, requestedKey string) string {
+	sentences := []string{}
+
+	project := getProjectKey(issue.Key)
+	if freeze := activeFreeze(getFreezes(project), project, time.Now()); freeze != nil {
+		sentences = append(sentences, "Change freeze in effect until "+freeze.End.Format(freezeDateLayout)+".")
+	}
+
+	sentences = append(sentences,
+		fmt.Sprintf("%s: %s.", issue.Key, strings.TrimSuffix(issue.Fields.Summary, ".")),
+		fmt.Sprintf("Status: %s.", issue.Fields.Status.Name),
+		fmt.Sprintf("Assignee: %s.", getDisplayName(issue.Fields.Assignee)),
+		fmt.Sprintf("Creator: %s.", getDisplayName(issue.Fields.Reporter)),
+		fmt.Sprintf("Created: <!date^%d^{date} at {time}|%s>.", issue.CreatedAt.Unix(), issue.Fields.Created),
+	)
+	if issue.Key != "" && !strings.EqualFold(issue.Key, requestedKey) {
+		sentences = append(sentences, fmt.Sprintf("Moved from %s.", requestedKey))
+	}
+	sentences = append(sentences, fmt.Sprintf("<%s|Open %s in Jira>", getJiraURL(issue.Key), issue.Key))
+
+	return strings.Join(sentences, "\n")
+}
+
+// formatPreferenceBlocks lets a user toggle accessible cards in the App Home
+func formatPreferenceBlocks(userID string) []slack.Block {
+	state, label := "off", "Turn on"
+	if getUserPreferences(userID).AccessibleCards {
+		state, label = "on", "Turn off"
+	}
+
+	button := slack.NewButtonBlockElement(actionToggleAccessible, "", newPlainText(label))
+
+	return []slack.Block{
+		slack.NewSectionBlock(
+			newMarkdownText(fmt.Sprintf("Screen reader friendly cards in direct messages: %s", state)),
+			nil,
+			slack.NewAccessory(button),
+		),
+	}
+}
+
+func handleToggleAccessible(callback slack.InteractionCallback, action *slack.BlockAction) {
+	enabled := !getUserPreferences(callback.User.ID).AccessibleCards
+
+	if err := setAccessibleCards(callback.User.ID, enabled); err != nil {
+		log.Printf("handleToggleAccessible: Error: %v", err)
+		return
+	}
+
+	publishAppHome(callback.User.ID)
+}
+
+func handleAccessibleCommand(ctx context.Context, message slack.Msg, args []string) {
+	reply := func(text string) {
+		if err := postEphemeral(message.Channel, message.User, text); err != nil {
+			log.Printf("handleAccessibleCommand: Error: %v", err)
+		}
+	}
+
+	if len(args) != 1 || (strings.ToLower(args[0]) != "on" && strings.ToLower(args[0]) != "off") {
+		reply(accessibleUsage)
+		return
+	}
+	enabled := strings.ToLower(args[0]) == "on"
+
+	if err := setAccessibleCards(message.User, enabled); err != nil {
+		log.Printf("handleAccessibleCommand: Error: %v", err)
+		reply("I couldn't save that, try again.")
+		return
+	}
+
+	if enabled {
+		reply("Cards I send you directly are now plain sentences.")
+	} else {
+		reply("Cards I send you directly are back to the usual format.")
+	}
+}
+
+func setAccessibleCards(userID string, enabled bool) error {
+	defer lockSharedState(userPreferencesStateKey)()
+	userPreferenceStore.Lock()
+	defer userPreferenceStore.Unlock()
+	refreshSharedUserPreferences()
+
+	preferences := userPreferenceStore.users[userID]
+	preferences.AccessibleCards = enabled
+	userPreferenceStore.users[userID] = preferences
+
+	recordEvent("preference", map[string]interface{}{
+		"user":             userID,
+		"accessible_cards": enabled,
+	})
+
+	return saveUserPreferences()
+}
+
+// removeUserPreferences forgets what a user chose
+func removeUserPreferences(userID string) error {
+	defer lockSharedState(userPreferencesStateKey)()
+	userPreferenceStore.Lock()
+	defer userPreferenceStore.Unlock()
+	refreshSharedUserPreferences()
+
+	if _, ok := userPreferenceStore.users[userID]; !ok {
+		return nil
+	}
+	delete(userPreferenceStore.users, userID)
+
+	return saveUserPreferences()
+}
+
+// loadUserPreferences restores the preferences saved before the last restart
+func loadUserPreferences() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadUserPreferences: Error: %v", err)
+		return
+	}
+
+	users := map[string]userPreferences{}
+	if ok, err := store.Load(userPreferencesStateKey, &users); err != nil || !ok {
+		if err != nil {
+			log.Printf("loadUserPreferences: Error: %v", err)
+		}
+		return
+	}
+
+	userPreferenceStore.Lock()
+	userPreferenceStore.users = users
+	userPreferenceStore.Unlock()
+}
+
+// refreshSharedUserPreferences reads the preferences again, as other replicas
+// may have changed them. The caller holds the lock of userPreferenceStore.
+func refreshSharedUserPreferences() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedUserPreferences: Error: %v", err)
+		return
+	}
+
+	users := map[string]userPreferences{}
+	if _, err := store.Load(userPreferencesStateKey, &users); err != nil {
+		log.Printf("refreshSharedUserPreferences: Error: %v", err)
+		return
+	}
+
+	userPreferenceStore.users = users
+}
+
+// saveUserPreferences writes the preferences to the state store. The caller
+// holds the lock of userPreferenceStore.
+func saveUserPreferences() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(userPreferencesStateKey, userPreferenceStore.users)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFormatAccessibleMessage(t *testing.T) {
+	issue := decodeIssue(t, `{
+		"key": "ABC-124",
+		"fields": {"summary": "Printer on fire.", "status": {"name": "In Progress"}, "assignee": {"displayName": "Jane Doe"}, "created": "2026-10-01T09:30:00.000+0000"}
+	}`)
+
+	message := formatAccessibleMessage(issue, "ABC-123")
+	for _, expected := range []string{"ABC-124: Printer on fire.\n", "Status: In Progress.\nAssignee: Jane Doe.\nCreator: Unassigned.\n", "Moved from ABC-123."} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("Expected %q in %q", expected, message)
+		}
+	}
+	if strings.Contains(message, ":traffic_light:") || strings.Contains(message, "> ") {
+		t.Errorf("Expected no emoji or quotes, got %q", message)
+	}
+}
+
+func TestAccessibleCardPreference(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "data")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DATA_DIR", dir)
+	defer os.Unsetenv("DATA_DIR")
+	defer func() {
+		userPreferenceStore.Lock()
+		userPreferenceStore.users = map[string]userPreferences{}
+		userPreferenceStore.Unlock()
+	}()
+
+	if err := setAccessibleCards("U1", true); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// As after a restart
+	userPreferenceStore.Lock()
+	userPreferenceStore.users = map[string]userPreferences{}
+	userPreferenceStore.Unlock()
+	loadUserPreferences()
+
+	if !wantsAccessibleCard("D1", "U1") {
+		t.Error("Expected direct messages to the user to be accessible")
+	}
+	if wantsAccessibleCard("C1", "U1") || wantsAccessibleCard("D2", "U2") {
+		t.Error("Expected channels and other users to get the usual cards")
+	}
+
+	issue := decodeIssue(t, `{"key": "ABC-123", "fields": {"summary": "Printer on fire", "status": {"name": "Open"}}}`)
+	if text, blocks := formatIssuePost("D1", "U1", "ABC-123", issue, cohortStable); blocks != nil || !strings.HasPrefix(text, "ABC-123: Printer on fire.") {
+		t.Errorf("Expected an accessible card, got %q", text)
+	}
+
+	if err := purgeUserData("U1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if wantsAccessibleCard("D1", "U1") {
+		t.Error("Expected purging the user to forget the preference")
+	}
+}
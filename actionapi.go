@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Scopes an action API key can be granted
+const (
+	scopeLookup     = "lookup"
+	scopeCard       = "card"
+	scopeCreate     = "create"
+	scopeComment    = "comment"
+	scopeTransition = "transition"
+)
+
+// Every scope a key can be granted
+var actionScopes = []string{scopeLookup, scopeCard, scopeCreate, scopeComment, scopeTransition}
+
+// Issue as returned by the action API
+type actionIssue struct {
+	Key      string `json:"key"`
+	URL      string `json:"url"`
+	Summary  string `json:"summary"`
+	Status   string `json:"status"`
+	Reporter string `json:"reporter,omitempty"`
+	Assignee string `json:"assignee,omitempty"`
+}
+
+type actionCardRequest struct {
+	Channel string `json:"channel"`
+	Issue   string `json:"issue"`
+}
+
+type actionCreateRequest struct {
+	Project     string `json:"project"`
+	Type        string `json:"type"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+}
+
+type actionCommentRequest struct {
+	Body string `json:"body"`
+}
+
+type actionTransitionRequest struct {
+	Status string `json:"status"`
+}
+
+type actionError struct {
+	Error string `json:"error"`
+}
+
+func serveActionAPI(addr string) {
+	log.Printf("serveActionAPI: Listening on %s", addr)
+
+	if err := http.ListenAndServe(addr, newActionAPIHandler()); err != nil {
+		log.Printf("serveActionAPI: Error: %v", err)
+	}
+}
+
+func newActionAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/issues", requireScope(scopeCreate, requireWritable(handleActionCreate)))
+	mux.HandleFunc("/api/issues/", routeActionIssue)
+	mux.HandleFunc("/api/cards", requireScope(scopeCard, handleActionCard))
+
+	return mux
+}
+
+// routeActionIssue sends requests under /api/issues/{key} to their handler,
+// each with its own scope
+func routeActionIssue(w http.ResponseWriter, r *http.Request) {
+	_, action := splitActionIssuePath(r.URL.Path)
+
+	switch action {
+	case "":
+		requireScope(scopeLookup, handleActionLookup)(w, r)
+	case "comments":
+		requireScope(scopeComment, requireWritable(handleActionComment))(w, r)
+	case "transitions":
+		requireScope(scopeTransition, requireWritable(handleActionTransition))(w, r)
+	default:
+		writeActionJSON(w, http.StatusNotFound, actionError{"unknown action " + action})
+	}
+}
+
+// splitActionIssuePath reads the issue key and the action from a path like
+// /api/issues/ABC-123/comments
+func splitActionIssuePath(path string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/api/issues/"), "/", 2)
+	if len(parts) == 1 {
+		return strings.ToUpper(parts[0]), ""
+	}
+
+	return strings.ToUpper(parts[0]), parts[1]
+}
+
+// getActionIssueKey returns the issue key of the request, answering with 400
+// if it isn't one
+func getActionIssueKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	issueID, _ := splitActionIssuePath(r.URL.Path)
+	if len(extractIssueIDs(issueID)) != 1 {
+		writeActionJSON(w, http.StatusBadRequest, actionError{"invalid issue key"})
+		return "", false
+	}
+
+	return issueID, true
+}
+
+// requireScope only lets requests through whose bearer key grants the scope
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		scopes, ok := getConfig().ActionAPIKeys[key]
+		if key == "" || !ok {
+			writeActionJSON(w, http.StatusUnauthorized, actionError{"invalid API key"})
+			return
+		}
+
+		if !hasActionScope(scopes, scope) {
+			writeActionJSON(w, http.StatusForbidden, actionError{"API key lacks the " + scope + " scope"})
+			return
+		}
+
+		// Only tell callers with a valid key about maintenance
+		if activeMaintenance(getConfig().MaintenanceWindows, time.Now()) != nil {
+			writeActionJSON(w, http.StatusServiceUnavailable, actionError{"Jira is under maintenance"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// requireWritable turns away requests that change Jira in read-only mode
+func requireWritable(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := checkWritable(); err != nil {
+			writeActionJSON(w, http.StatusForbidden, actionError{err.Error()})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func hasActionScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GET /api/issues/{key}
+func handleActionLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeActionJSON(w, http.StatusMethodNotAllowed, actionError{"use GET"})
+		return
+	}
+
+	issueID, ok := getActionIssueKey(w, r)
+	if !ok {
+		return
+	}
+
+	issue, err := fetchJiraIssue(context.Background(), issueID)
+	if err != nil {
+		log.Printf("handleActionLookup: Error fetching %s: %v", issueID, err)
+		writeActionJSON(w, getStatusForError(err), actionError{"could not fetch issue: " + string(getErrorKind(err))})
+		return
+	}
+
+	writeActionJSON(w, http.StatusOK, newActionIssue(issue))
+}
+
+// POST /api/cards with {"channel": "C123", "issue": "ABC-123"}
+func handleActionCard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeActionJSON(w, http.StatusMethodNotAllowed, actionError{"use POST"})
+		return
+	}
+
+	var request actionCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Channel == "" || request.Issue == "" {
+		writeActionJSON(w, http.StatusBadRequest, actionError{"channel and issue are required"})
+		return
+	}
+
+	if err := postIssue(context.Background(), request.Channel, "", "", strings.ToUpper(request.Issue)); err != nil {
+		log.Printf("handleActionCard: Error posting %s: %v", request.Issue, err)
+		writeActionJSON(w, getStatusForError(err), actionError{"could not post card: " + string(getErrorKind(err))})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/issues with {"project": "ABC", "type": "Task", "summary": "..."}
+func handleActionCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeActionJSON(w, http.StatusMethodNotAllowed, actionError{"use POST"})
+		return
+	}
+
+	var request actionCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Project == "" || request.Type == "" || request.Summary == "" {
+		writeActionJSON(w, http.StatusBadRequest, actionError{"project, type and summary are required"})
+		return
+	}
+
+	project := strings.ToUpper(request.Project)
+	key, err := createJiraIssue(context.Background(), getBot().jira, project, request.Type, request.Summary, request.Description)
+	if err != nil {
+		log.Printf("handleActionCreate: Error creating a %s issue: %v", project, err)
+		writeActionJSON(w, getStatusForError(err), actionError{"could not create issue: " + string(getErrorKind(err))})
+		return
+	}
+
+	writeActionJSON(w, http.StatusCreated, actionIssue{Key: key, URL: getJiraURL(key), Summary: request.Summary})
+}
+
+// POST /api/issues/{key}/comments with {"body": "..."}
+func handleActionComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeActionJSON(w, http.StatusMethodNotAllowed, actionError{"use POST"})
+		return
+	}
+
+	issueID, ok := getActionIssueKey(w, r)
+	if !ok {
+		return
+	}
+
+	var request actionCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Body) == "" {
+		writeActionJSON(w, http.StatusBadRequest, actionError{"body is required"})
+		return
+	}
+
+	if err := getBot().jira.AddComment(context.Background(), issueID, newJiraBody(issueID, request.Body)); err != nil {
+		log.Printf("handleActionComment: Error commenting on %s: %v", issueID, err)
+		writeActionJSON(w, getStatusForError(err), actionError{"could not comment: " + string(getErrorKind(err))})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/issues/{key}/transitions with {"status": "In Review"}, naming the
+// transition or the status it leads to
+func handleActionTransition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeActionJSON(w, http.StatusMethodNotAllowed, actionError{"use POST"})
+		return
+	}
+
+	issueID, ok := getActionIssueKey(w, r)
+	if !ok {
+		return
+	}
+
+	var request actionTransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Status == "" {
+		writeActionJSON(w, http.StatusBadRequest, actionError{"status is required"})
+		return
+	}
+
+	ctx := context.Background()
+	transitions, err := getJiraTransitions(ctx, getBot().jira, issueID)
+	if err != nil {
+		log.Printf("handleActionTransition: Error listing transitions of %s: %v", issueID, err)
+		writeActionJSON(w, getStatusForError(err), actionError{"could not list transitions: " + string(getErrorKind(err))})
+		return
+	}
+
+	transition := findJiraTransition(transitions, request.Status)
+	if transition == nil {
+		writeActionJSON(w, http.StatusConflict, actionError{"no transition to " + request.Status + " from the issue's status"})
+		return
+	}
+
+	if err := transitionJiraIssue(ctx, getBot().jira, issueID, transition.ID); err != nil {
+		log.Printf("handleActionTransition: Error moving %s: %v", issueID, err)
+		writeActionJSON(w, getStatusForError(err), actionError{"could not transition issue: " + string(getErrorKind(err))})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newActionIssue(issue jiraIssue) actionIssue {
+	result := actionIssue{
+		Key:     issue.Key,
+		URL:     getJiraURL(issue.Key),
+		Summary: issue.Fields.Summary,
+	}
+
+	if issue.Fields.Status != nil {
+		result.Status = issue.Fields.Status.Name
+	}
+	if issue.Fields.Reporter != nil {
+		result.Reporter = issue.Fields.Reporter.DisplayName
+	}
+	if issue.Fields.Assignee != nil {
+		result.Assignee = issue.Fields.Assignee.DisplayName
+	}
+
+	return result
+}
+
+// getStatusForError picks the HTTP status telling API clients what failed
+func getStatusForError(err error) int {
+	switch getErrorKind(err) {
+	case errorKindNotFound:
+		return http.StatusNotFound
+	case errorKindForbidden:
+		return http.StatusForbidden
+	case errorKindRateLimited:
+		return http.StatusTooManyRequests
+	case errorKindTimeout:
+		return http.StatusGatewayTimeout
+	case errorKindBadConfig:
+		return http.StatusInternalServerError
+	}
+
+	return http.StatusBadGateway
+}
+
+func writeActionJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// parseActionAPIKeys reads keys in the form "key1=lookup,card;key2=lookup".
+// Keys without scopes are left out and returned as errors, which don't name
+// the key.
+func parseActionAPIKeys(value string) (map[string][]string, []error) {
+	keys := map[string][]string{}
+	errs := []error{}
+
+	for i, entry := range strings.Split(value, ";") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if parts[0] == "" {
+			continue
+		}
+		if len(parts) != 2 {
+			errs = append(errs, fmt.Errorf("key %d has no scopes, add them like key=lookup,card", i+1))
+			continue
+		}
+
+		keys[parts[0]] = parseList(parts[1])
+	}
+
+	return keys, errs
+}
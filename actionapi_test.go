@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseActionAPIKeys(t *testing.T) {
+	result, errs := parseActionAPIKeys("abc=lookup,card; def=lookup;ghi")
+
+	if len(result) != 2 {
+		t.Fatalf("Expected two keys, got %v", len(result))
+	}
+	if len(errs) != 1 || strings.Contains(errs[0].Error(), "ghi") {
+		t.Errorf("Expected an error for the key without scopes that doesn't name it, got %v", errs)
+	}
+
+	if len(result["abc"]) != 2 || result["abc"][1] != scopeCard {
+		t.Errorf("Expected abc to have lookup and card, got %v", result["abc"])
+	}
+}
+
+func TestActionAPIRejectsUnknownKey(t *testing.T) {
+	os.Setenv("ACTION_API_KEYS", "abc=lookup")
+	defer os.Unsetenv("ACTION_API_KEYS")
+
+	request := httptest.NewRequest("GET", "/api/issues/ABC-123", nil)
+	request.Header.Set("Authorization", "Bearer xyz")
+	response := httptest.NewRecorder()
+
+	newActionAPIHandler().ServeHTTP(response, request)
+
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %v", response.Code)
+	}
+}
+
+func TestActionAPIRejectsMissingScope(t *testing.T) {
+	os.Setenv("ACTION_API_KEYS", "abc=lookup")
+	defer os.Unsetenv("ACTION_API_KEYS")
+
+	request := httptest.NewRequest("POST", "/api/cards", strings.NewReader(`{"channel":"C1","issue":"ABC-1"}`))
+	request.Header.Set("Authorization", "Bearer abc")
+	response := httptest.NewRecorder()
+
+	newActionAPIHandler().ServeHTTP(response, request)
+
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %v", response.Code)
+	}
+}
+
+func TestActionAPIRejectsInvalidIssueKey(t *testing.T) {
+	os.Setenv("ACTION_API_KEYS", "abc=lookup")
+	defer os.Unsetenv("ACTION_API_KEYS")
+
+	request := httptest.NewRequest("GET", "/api/issues/nope", nil)
+	request.Header.Set("Authorization", "Bearer abc")
+	response := httptest.NewRecorder()
+
+	newActionAPIHandler().ServeHTTP(response, request)
+
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %v", response.Code)
+	}
+}
+
+func TestActionAPIAuthenticatesBeforeMaintenance(t *testing.T) {
+	now := time.Now()
+	os.Setenv("ACTION_API_KEYS", "abc=lookup")
+	os.Setenv("JIRA_MAINTENANCE", now.Add(-time.Hour).Format(time.RFC3339)+".."+now.Add(time.Hour).Format(time.RFC3339))
+	defer os.Unsetenv("ACTION_API_KEYS")
+	defer os.Unsetenv("JIRA_MAINTENANCE")
+
+	for key, expected := range map[string]int{"xyz": http.StatusUnauthorized, "abc": http.StatusServiceUnavailable} {
+		request := httptest.NewRequest("GET", "/api/issues/ABC-123", nil)
+		request.Header.Set("Authorization", "Bearer "+key)
+		response := httptest.NewRecorder()
+
+		newActionAPIHandler().ServeHTTP(response, request)
+
+		if response.Code != expected {
+			t.Errorf("Expected %d for key %s, got %d", expected, key, response.Code)
+		}
+	}
+}
+
+func TestActionAPITransitionsIssue(t *testing.T) {
+	var transitionID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/ABC-1/transitions" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == "GET" {
+			w.Write([]byte(`{"transitions": [{"id": "11", "name": "Start progress", "to": {"name": "In Progress"}}, {"id": "21", "name": "Review", "to": {"name": "In Review"}}]}`))
+			return
+		}
+
+		var body struct {
+			Transition struct {
+				ID string `json:"id"`
+			} `json:"transition"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		transitionID = body.Transition.ID
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	os.Setenv("ACTION_API_KEYS", "abc=transition")
+	os.Setenv("JIRA_BASEURL", server.URL)
+	os.Setenv("JIRA_DEPLOYMENT", "server")
+	defer os.Unsetenv("ACTION_API_KEYS")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+	defer setBot(nil)
+
+	for status, expected := range map[string]int{"in review": http.StatusNoContent, "Done": http.StatusConflict} {
+		request := httptest.NewRequest("POST", "/api/issues/abc-1/transitions", strings.NewReader(`{"status": "`+status+`"}`))
+		request.Header.Set("Authorization", "Bearer abc")
+		response := httptest.NewRecorder()
+
+		newActionAPIHandler().ServeHTTP(response, request)
+
+		if response.Code != expected {
+			t.Errorf("Expected %d moving to %s, got %d: %s", expected, status, response.Code, response.Body.String())
+		}
+	}
+
+	if transitionID != "21" {
+		t.Errorf("Expected transition 21, got %q", transitionID)
+	}
+}
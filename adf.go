@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// A node of an Atlassian Document Format document, which Jira Cloud's v3 API
+// uses for descriptions and comments
+type adfNode struct {
+	Type    string                 `json:"type"`
+	Text    string                 `json:"text,omitempty"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+	Marks   []adfMark              `json:"marks,omitempty"`
+	Content []adfNode              `json:"content,omitempty"`
+	Version int                    `json:"version,omitempty"`
+}
+
+type adfMark struct {
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// Rich text from Jira as Slack mrkdwn. It decodes from both the plain strings
+// of the v2 API and the ADF documents of the v3 API.
+type jiraText string
+
+func (t *jiraText) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*t = jiraText(text)
+		return nil
+	}
+
+	var document adfNode
+	if err := json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	*t = jiraText(formatADF(document))
+
+	return nil
+}
+
+// newJiraBody turns plain text into a description or comment body for the
+// API version of the instance holding the issue or project
+func newJiraBody(key string, text string) interface{} {
+	if !getJiraInstanceFor(key).isCloud() {
+		return text
+	}
+
+	return newADFDocument(text)
+}
+
+// newADFDocument turns plain text into an ADF document with a paragraph per
+// block of lines
+func newADFDocument(text string) adfNode {
+	document := adfNode{Type: "doc", Version: 1, Content: []adfNode{}}
+
+	for _, block := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+
+		paragraph := adfNode{Type: "paragraph"}
+		for i, line := range strings.Split(block, "\n") {
+			if i > 0 {
+				paragraph.Content = append(paragraph.Content, adfNode{Type: "hardBreak"})
+			}
+			if line != "" {
+				paragraph.Content = append(paragraph.Content, adfNode{Type: "text", Text: line})
+			}
+		}
+		document.Content = append(document.Content, paragraph)
+	}
+
+	return document
+}
+
+// formatADF renders an ADF document as Slack mrkdwn
+func formatADF(document adfNode) string {
+	var result bytes.Buffer
+	writeADF(&result, document, "")
+
+	return strings.TrimSpace(result.String())
+}
+
+// writeADF renders a node, prefixing every line of block nodes, e.g. with
+// "> " inside quotes
+func writeADF(result *bytes.Buffer, node adfNode, prefix string) {
+	switch node.Type {
+	case "text":
+		result.WriteString(formatADFText(node))
+
+	case "hardBreak":
+		result.WriteString("\n" + prefix)
+
+	case "mention":
+		result.WriteString(getADFAttr(node, "text"))
+
+	case "emoji":
+		result.WriteString(getADFAttr(node, "shortName"))
+
+	case "inlineCard", "blockCard":
+		result.WriteString("<" + getADFAttr(node, "url") + ">")
+
+	case "paragraph", "heading":
+		result.WriteString(prefix)
+		if node.Type == "heading" {
+			result.WriteString("*")
+		}
+		writeADFChildren(result, node, prefix)
+		if node.Type == "heading" {
+			result.WriteString("*")
+		}
+		result.WriteString("\n")
+
+	case "codeBlock":
+		result.WriteString(prefix + "```")
+		writeADFChildren(result, node, prefix)
+		result.WriteString("```\n")
+
+	case "blockquote":
+		for _, child := range node.Content {
+			writeADF(result, child, prefix+"> ")
+		}
+
+	case "bulletList", "orderedList":
+		for i, item := range node.Content {
+			bullet := "• "
+			if node.Type == "orderedList" {
+				bullet = fmt.Sprintf("%d. ", i+1)
+			}
+
+			var itemText bytes.Buffer
+			for _, child := range item.Content {
+				writeADF(&itemText, child, prefix+"   ")
+			}
+			result.WriteString(prefix + bullet + strings.TrimPrefix(itemText.String(), prefix+"   "))
+		}
+
+	case "rule":
+		result.WriteString(prefix + "———\n")
+
+	default:
+		writeADFChildren(result, node, prefix)
+	}
+}
+
+func writeADFChildren(result *bytes.Buffer, node adfNode, prefix string) {
+	for _, child := range node.Content {
+		writeADF(result, child, prefix)
+	}
+}
+
+// formatADFText applies a text node's marks in mrkdwn
+func formatADFText(node adfNode) string {
+	text := node.Text
+
+	for _, mark := range node.Marks {
+		switch mark.Type {
+		case "strong":
+			text = "*" + text + "*"
+		case "em":
+			text = "_" + text + "_"
+		case "strike":
+			text = "~" + text + "~"
+		case "code":
+			text = "`" + text + "`"
+		case "link":
+			if href, ok := mark.Attrs["href"].(string); ok {
+				text = "<" + href + "|" + text + ">"
+			}
+		}
+	}
+
+	return text
+}
+
+func getADFAttr(node adfNode, name string) string {
+	value, _ := node.Attrs[name].(string)
+
+	return value
+}
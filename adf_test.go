@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestJiraTextDecodesPlainAndADFBodies(t *testing.T) {
+	var comments []struct {
+		Body jiraText `json:"body"`
+	}
+	json.Unmarshal([]byte(`[
+		{"body": "plain *text*"},
+		{"body": {"type": "doc", "version": 1, "content": [
+			{"type": "paragraph", "content": [
+				{"type": "text", "text": "Fixed in "},
+				{"type": "text", "text": "PR 7", "marks": [{"type": "link", "attrs": {"href": "https://github.com/org/repo/pull/7"}}]},
+				{"type": "text", "text": ", thanks "},
+				{"type": "mention", "attrs": {"id": "a1", "text": "@Ada"}}
+			]},
+			{"type": "bulletList", "content": [
+				{"type": "listItem", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "one", "marks": [{"type": "strong"}]}]}]},
+				{"type": "listItem", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "two"}]}]}
+			]},
+			{"type": "blockquote", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "quoted"}]}]}
+		]}}
+	]`), &comments)
+
+	if comments[0].Body != "plain *text*" {
+		t.Errorf("Unexpected plain body %q", comments[0].Body)
+	}
+
+	expected := "Fixed in <https://github.com/org/repo/pull/7|PR 7>, thanks @Ada\n• *one*\n• two\n> quoted"
+	if string(comments[1].Body) != expected {
+		t.Errorf("Unexpected ADF body %q", comments[1].Body)
+	}
+}
+
+func TestNewADFDocument(t *testing.T) {
+	document := newADFDocument("first\nline\n\nsecond")
+
+	expected := adfNode{Type: "doc", Version: 1, Content: []adfNode{
+		{Type: "paragraph", Content: []adfNode{{Type: "text", Text: "first"}, {Type: "hardBreak"}, {Type: "text", Text: "line"}}},
+		{Type: "paragraph", Content: []adfNode{{Type: "text", Text: "second"}}},
+	}}
+	if !reflect.DeepEqual(document, expected) {
+		t.Errorf("Unexpected document %+v", document)
+	}
+
+	if formatADF(document) != "first\nline\nsecond" {
+		t.Errorf("Expected the document to render back, got %q", formatADF(document))
+	}
+}
+
+func TestIsJiraCloud(t *testing.T) {
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+
+	os.Setenv("JIRA_BASEURL", "https://example.atlassian.net")
+	if !isJiraCloud() || getJiraAPIPath() != "/rest/api/3" {
+		t.Errorf("Expected atlassian.net to be Jira Cloud")
+	}
+
+	os.Setenv("JIRA_DEPLOYMENT", "server")
+	if isJiraCloud() {
+		t.Errorf("Expected JIRA_DEPLOYMENT to win over the base URL")
+	}
+
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	os.Unsetenv("JIRA_DEPLOYMENT")
+	if isJiraCloud() || getJiraAPIPath() != "/rest/api/2" {
+		t.Errorf("Expected other hosts to be Jira Server")
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Slack schedules messages at most this far ahead
+const maxAnnouncementDelay = 120 * 24 * time.Hour
+
+const announceUsage = "Usage: `announce <version or JQL> at <time> [in #channel]`, `announce list` or `announce cancel <id>`. " +
+	"Times look like `16:00`, `tomorrow 9:30` or `2026-12-01 10:00`, in your time zone."
+
+// A channel link as Slack sends it, like <#C024BE91L|general>
+var slackChannelLink = regexp.MustCompile(`^<#([A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+// Operators that tell JQL from a version name
+var jqlOperator = regexp.MustCompile(`(?i)[=~<>]|\b(in|is|was|changed)\b`)
+
+// Slack escapes these characters in message text
+var slackUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// Key of the scheduled announcements in the state store
+const announcementsStateKey = "announcements"
+
+func init() {
+	registerStateKind(announcementsStateKey, loadAnnouncements)
+}
+
+// An announcement asked for with "@JiraBot announce"
+type announcement struct {
+	Title   string    `json:"title"`
+	JQL     string    `json:"jql"`
+	Channel string    `json:"channel"`
+	PostAt  time.Time `json:"post_at"`
+	User    string    `json:"user"`
+}
+
+// Announcements the bot scheduled and Slack didn't post yet, by scheduled
+// message ID, so their authors can cancel them
+var announcements = struct {
+	sync.Mutex
+	scheduled map[string]announcement
+}{scheduled: map[string]announcement{}}
+
+// handleAnnounceCommand schedules, lists and cancels announcements of the
+// issues in a version or matching a query
+func handleAnnounceCommand(ctx context.Context, message slack.Msg, args []string) {
+	reply := func(text string) {
+		if err := postEphemeral(message.Channel, message.User, text); err != nil {
+			log.Printf("handleAnnounceCommand: Error: %v", err)
+		}
+	}
+
+	if len(args) == 0 {
+		reply(announceUsage)
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "list":
+		reply(listAnnouncements(message.User))
+		return
+	case "cancel":
+		if len(args) != 2 {
+			reply(announceUsage)
+			return
+		}
+		reply(cancelAnnouncement(args[1], message.User))
+		return
+	}
+
+	request, err := parseAnnouncement(args, message.Channel, time.Now(), getUserLocation(message.User))
+	if err != nil {
+		reply(":warning: " + err.Error() + "\n" + announceUsage)
+		return
+	}
+	request.User = message.User
+
+	if err := validateJQL(request.JQL); err != nil {
+		reply(":warning: " + err.Error())
+		return
+	}
+
+	jira, err := getJiraServiceFor(message.Channel, message.User)
+	if err != nil {
+		reply(describeError(getErrorKind(err), "the announcement"))
+		return
+	}
+
+	result, err := searchJiraIssues(jira, request.JQL)
+	if err != nil {
+		log.Printf("handleAnnounceCommand: Error searching %q: %v", request.JQL, err)
+		reply(describeJQLError(request.JQL, err))
+		return
+	}
+
+	channel, id, err := getSlackAPIFor(request.Channel).ScheduleMessage(
+		request.Channel,
+		strconv.FormatInt(request.PostAt.Unix(), 10),
+		slack.MsgOptionText(formatAnnouncement(request, result), false),
+		slack.MsgOptionUsername(getConfig().Username),
+	)
+	if err != nil {
+		log.Printf("handleAnnounceCommand: Error scheduling in %s: %v", request.Channel, err)
+		reply(fmt.Sprintf(":warning: I couldn't schedule that in <#%s>. Am I a member of the channel?", request.Channel))
+		return
+	}
+	request.Channel = channel
+
+	if err := rememberAnnouncement(id, request, time.Now()); err != nil {
+		log.Printf("handleAnnounceCommand: Error saving %s: %v", id, err)
+	}
+
+	recordEvent("announcement", map[string]interface{}{
+		"channel": channel,
+		"user":    message.User,
+		"id":      id,
+		"jql":     request.JQL,
+		"post_at": request.PostAt.Unix(),
+	})
+
+	reply(fmt.Sprintf(":calendar: I'll announce %s in <#%s> %s. Cancel it with `announce cancel %s`.",
+		request.Title, channel, formatSlackDate(request.PostAt), id))
+}
+
+// parseAnnouncement reads "<version or JQL> at <time> [in #channel]". Times
+// are in the given location and announcements go to the given channel unless
+// another is named.
+func parseAnnouncement(args []string, channel string, now time.Time, location *time.Location) (announcement, error) {
+	at, in := -1, len(args)
+	for i, arg := range args {
+		switch strings.ToLower(arg) {
+		case "at":
+			at, in = i, len(args)
+		case "in":
+			if at >= 0 {
+				in = i
+			}
+		}
+	}
+	if at <= 0 {
+		return announcement{}, errors.New("tell me what to announce and when")
+	}
+
+	result := announcement{Channel: channel}
+
+	if in < len(args) {
+		if in != len(args)-2 {
+			return announcement{}, errors.New("name a single channel, like #general")
+		}
+
+		match := slackChannelLink.FindStringSubmatch(args[in+1])
+		if match == nil {
+			return announcement{}, fmt.Errorf("I don't know the channel %s", args[in+1])
+		}
+		result.Channel = match[1]
+	}
+
+	postAt, err := parseAnnouncementTime(strings.Join(args[at+1:in], " "), now, location)
+	if err != nil {
+		return announcement{}, err
+	}
+	if !postAt.After(now) {
+		return announcement{}, errors.New("that time has passed")
+	}
+	if postAt.Sub(now) > maxAnnouncementDelay {
+		return announcement{}, errors.New("Slack schedules messages at most 120 days ahead")
+	}
+	result.PostAt = postAt
+
+	// Quoted versions may contain words like "in"
+	query := strings.TrimSpace(slackUnescaper.Replace(strings.Join(args[:at], " ")))
+	quoted := len(query) > 1 && strings.HasPrefix(query, `"`) && strings.HasSuffix(query, `"`)
+	if !quoted && jqlOperator.MatchString(query) {
+		result.Title = "`" + query + "`"
+		result.JQL = query
+	} else {
+		version := strings.Trim(query, `"`)
+		result.Title = "*" + version + "*"
+		result.JQL = `fixVersion = "` + strings.Replace(version, `"`, `\"`, -1) + `"`
+	}
+
+	return result, nil
+}
+
+// parseAnnouncementTime reads "16:00", "tomorrow 9:30" or "2026-12-01 10:00".
+// A bare time of day means its next occurrence.
+func parseAnnouncementTime(value string, now time.Time, location *time.Location) (time.Time, error) {
+	now = now.In(location)
+	fields := strings.Fields(strings.ToLower(value))
+
+	if len(fields) == 2 {
+		day, err := time.ParseInLocation("2006-01-02", fields[0], location)
+		if fields[0] == "tomorrow" {
+			day, err = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location), nil
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("I don't understand the date %s", fields[0])
+		}
+
+		clock, err := time.Parse("15:04", fields[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("I don't understand the time %s", fields[1])
+		}
+
+		return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, location), nil
+	}
+
+	if len(fields) == 1 {
+		clock, err := time.Parse("15:04", fields[0])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("I don't understand the time %s", fields[0])
+		}
+
+		result := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+		if !result.After(now) {
+			result = result.AddDate(0, 0, 1)
+		}
+
+		return result, nil
+	}
+
+	return time.Time{}, errors.New("tell me when to announce it")
+}
+
+// formatAnnouncement lists the issues found when the announcement was
+// scheduled
+func formatAnnouncement(request announcement, result jiraSearchResult) string {
+	lines := []string{":mega: " + request.Title}
+
+	if len(result.Issues) == 0 {
+		lines = append(lines, "No issues yet.")
+	}
+	lines = append(lines, formatSearchResult(request.JQL, result)...)
+
+	return strings.Join(lines, "\n")
+}
+
+// listAnnouncements shows the messages the bot has scheduled
+func listAnnouncements(user string) string {
+	scheduled, _, err := getSlackAPIFor(user).GetScheduledMessages(&slack.GetScheduledMessagesParameters{})
+	if err != nil {
+		log.Printf("listAnnouncements: Error: %v", err)
+		return ":warning: I couldn't fetch the scheduled announcements from Slack."
+	}
+
+	if len(scheduled) == 0 {
+		return "No announcements are scheduled."
+	}
+
+	announcements.Lock()
+	defer announcements.Unlock()
+
+	lines := []string{"*Scheduled announcements*"}
+	for _, message := range scheduled {
+		title := strings.SplitN(message.Text, "\n", 2)[0]
+		author := ""
+		if request, ok := announcements.scheduled[message.ID]; ok {
+			title = request.Title
+			author = fmt.Sprintf(" by <@%s>", request.User)
+		}
+
+		lines = append(lines, fmt.Sprintf("> `%s` %s in <#%s> %s%s",
+			message.ID, title, message.Channel, formatSlackDate(time.Unix(int64(message.PostAt), 0)), author))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// cancelAnnouncement deletes a scheduled announcement. Admins can cancel any
+// of them, everyone else only their own.
+func cancelAnnouncement(id string, user string) string {
+	scheduled, _, err := getSlackAPIFor(user).GetScheduledMessages(&slack.GetScheduledMessagesParameters{})
+	if err != nil {
+		log.Printf("cancelAnnouncement: Error: %v", err)
+		return ":warning: I couldn't fetch the scheduled announcements from Slack."
+	}
+
+	channel := ""
+	for _, message := range scheduled {
+		if message.ID == id {
+			channel = message.Channel
+		}
+	}
+	if channel == "" {
+		return fmt.Sprintf("No announcement `%s` is scheduled.", id)
+	}
+
+	announcements.Lock()
+	request, ok := announcements.scheduled[id]
+	announcements.Unlock()
+
+	if !isAdmin(user) && (!ok || request.User != user) {
+		return "Only admins can cancel announcements of others."
+	}
+
+	if _, err := getSlackAPIFor(channel).DeleteScheduledMessage(&slack.DeleteScheduledMessageParameters{
+		Channel:            channel,
+		ScheduledMessageID: id,
+	}); err != nil {
+		log.Printf("cancelAnnouncement: Error deleting %s: %v", id, err)
+		return fmt.Sprintf(":warning: I couldn't cancel `%s`.", id)
+	}
+
+	if err := forgetAnnouncements(func(candidate string, request announcement) bool { return candidate == id }); err != nil {
+		log.Printf("cancelAnnouncement: Error saving: %v", err)
+	}
+
+	recordEvent("announcement", map[string]interface{}{
+		"channel":   channel,
+		"user":      user,
+		"id":        id,
+		"cancelled": true,
+	})
+
+	return fmt.Sprintf(":wastebasket: Cancelled `%s`.", id)
+}
+
+// getUserLocation returns a Slack user's time zone, or UTC if it is unknown
+func getUserLocation(userID string) *time.Location {
+	user, err := getSlackAPIFor(userID).GetUserInfo(userID)
+	if err != nil || user == nil || user.TZ == "" {
+		return time.UTC
+	}
+
+	location, err := time.LoadLocation(user.TZ)
+	if err != nil {
+		log.Printf("getUserLocation: Unknown time zone %q: %v", user.TZ, err)
+		return time.UTC
+	}
+
+	return location
+}
+
+// formatSlackDate shows a time in the reader's own time zone
+func formatSlackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", t.Unix(), t.UTC().Format("2006-01-02 15:04 UTC"))
+}
+
+// rememberAnnouncement keeps a scheduled announcement, dropping those Slack
+// posted already
+func rememberAnnouncement(id string, request announcement, now time.Time) error {
+	defer lockSharedState(announcementsStateKey)()
+	announcements.Lock()
+	defer announcements.Unlock()
+	refreshSharedAnnouncements()
+
+	for scheduledID, scheduled := range announcements.scheduled {
+		if scheduled.PostAt.Before(now) {
+			delete(announcements.scheduled, scheduledID)
+		}
+	}
+	announcements.scheduled[id] = request
+
+	return saveAnnouncements()
+}
+
+// forgetAnnouncements drops the announcements forget picks
+func forgetAnnouncements(forget func(id string, request announcement) bool) error {
+	defer lockSharedState(announcementsStateKey)()
+	announcements.Lock()
+	defer announcements.Unlock()
+	refreshSharedAnnouncements()
+
+	changed := false
+	for id, request := range announcements.scheduled {
+		if forget(id, request) {
+			delete(announcements.scheduled, id)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return saveAnnouncements()
+}
+
+// loadAnnouncements restores the announcements saved before the last restart
+func loadAnnouncements() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadAnnouncements: Error: %v", err)
+		return
+	}
+
+	scheduled := map[string]announcement{}
+	if ok, err := store.Load(announcementsStateKey, &scheduled); err != nil || !ok {
+		if err != nil {
+			log.Printf("loadAnnouncements: Error: %v", err)
+		}
+		return
+	}
+
+	announcements.Lock()
+	announcements.scheduled = scheduled
+	announcements.Unlock()
+}
+
+// refreshSharedAnnouncements reads the announcements again, as other replicas
+// may have scheduled some. The caller holds the lock of announcements.
+func refreshSharedAnnouncements() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedAnnouncements: Error: %v", err)
+		return
+	}
+
+	scheduled := map[string]announcement{}
+	if _, err := store.Load(announcementsStateKey, &scheduled); err != nil {
+		log.Printf("refreshSharedAnnouncements: Error: %v", err)
+		return
+	}
+
+	announcements.scheduled = scheduled
+}
+
+// saveAnnouncements writes the announcements to the state store. The caller
+// holds the lock of announcements.
+func saveAnnouncements() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(announcementsStateKey, announcements.scheduled)
+}
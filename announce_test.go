@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAnnouncement(t *testing.T) {
+	location, _ := time.LoadLocation("Europe/Berlin")
+	now := time.Date(2026, 10, 15, 17, 0, 0, 0, location)
+
+	result, err := parseAnnouncement(strings.Fields("2.4 at 16:00 in <#C024BE91L|releases>"), "C1", now, location)
+	if err != nil {
+		t.Fatalf("Expected the announcement to parse, got %v", err)
+	}
+	if result.JQL != `fixVersion = "2.4"` || result.Channel != "C024BE91L" {
+		t.Errorf("Unexpected announcement %+v", result)
+	}
+	if expected := time.Date(2026, 10, 16, 16, 0, 0, 0, location); !result.PostAt.Equal(expected) {
+		t.Errorf("Expected a past time of day to mean tomorrow, got %v", result.PostAt)
+	}
+
+	result, err = parseAnnouncement(strings.Fields("project = ABC AND updated &gt; -7d at 2026-12-01 10:00"), "C1", now, location)
+	if err != nil {
+		t.Fatalf("Expected the announcement to parse, got %v", err)
+	}
+	if result.JQL != "project = ABC AND updated > -7d" || result.Channel != "C1" {
+		t.Errorf("Unexpected announcement %+v", result)
+	}
+	if expected := time.Date(2026, 12, 1, 10, 0, 0, 0, location); !result.PostAt.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, result.PostAt)
+	}
+
+	result, _ = parseAnnouncement(strings.Fields(`"Launch in May" at tomorrow 9:30`), "C1", now, location)
+	if result.JQL != `fixVersion = "Launch in May"` {
+		t.Errorf("Expected a quoted version, got %q", result.JQL)
+	}
+
+	for _, args := range []string{"at 16:00", "2.4 at 2026-10-01 10:00", "2.4 at 2027-06-01 10:00", "2.4 at noon", "2.4 at 16:00 in general"} {
+		if _, err := parseAnnouncement(strings.Fields(args), "C1", now, location); err == nil {
+			t.Errorf("Expected %q to be rejected", args)
+		}
+	}
+}
+
+func TestFormatAnnouncement(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	result := jiraSearchResult{Total: 3, Issues: []jiraLinkedIssue{{Key: "ABC-1"}}}
+	result.Issues[0].Fields.Summary = "Dark mode"
+	result.Issues[0].Fields.Status.Name = "Done"
+
+	expected := ":mega: *2.4*\n" +
+		"• <https://jira.example.com/browse/ABC-1|ABC-1> Dark mode (Done)\n" +
+		"<https://jira.example.com/issues/?jql=fixVersion+%3D+%222.4%22|…and 2 more in Jira>"
+	if text := formatAnnouncement(announcement{Title: "*2.4*", JQL: `fixVersion = "2.4"`}, result); text != expected {
+		t.Errorf("Expected %q, got %q", expected, text)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Transports the bot can receive events over
+const (
+	transportRTM        = "RTM"
+	transportSocketMode = "Socket Mode"
+	transportEventsAPI  = "Events API"
+)
+
+// Action IDs of the App Home buttons
+const (
+	actionToggleSetting = "toggle_setting"
+	actionRefreshHome   = "refresh_home"
+)
+
+// Labels of the settings admins can toggle, see toggleableSettings
+var toggleableSettingLabels = map[string]string{
+	"read_only":            "Read-only mode",
+	"jira_property_config": "Settings from Jira properties",
+}
+
+// State of the connection to Slack, for the App Home
+var connectionStatus = struct {
+	sync.Mutex
+	transport string
+	connected bool
+	since     time.Time
+	lastEvent time.Time
+}{}
+
+func setConnectionStatus(transport string, connected bool) {
+	connectionStatus.Lock()
+	defer connectionStatus.Unlock()
+
+	if connectionStatus.transport != transport || connectionStatus.connected != connected {
+		connectionStatus.since = time.Now()
+	}
+	connectionStatus.transport = transport
+	connectionStatus.connected = connected
+}
+
+func markEventReceived() {
+	connectionStatus.Lock()
+	connectionStatus.lastEvent = time.Now()
+	connectionStatus.Unlock()
+}
+
+// publishAppHome shows admins the bot's status and settings in its App
+// Home, and everyone else how to use it
+func publishAppHome(userID string) {
+	blocks := formatUserHome()
+	if isAdmin(userID) {
+		blocks = formatAdminHome(time.Now())
+	}
+	blocks = append(blocks, formatPreferenceBlocks(userID)...)
+
+	view := slack.HomeTabViewRequest{Type: slack.VTHomeTab, Blocks: slack.Blocks{BlockSet: blocks}}
+	if _, err := getSlackAPIFor(userID).PublishView(userID, view, ""); err != nil {
+		log.Printf("publishAppHome: Error: %v", err)
+	}
+}
+
+func formatUserHome() []slack.Block {
+	return []slack.Block{
+		slack.NewSectionBlock(newMarkdownText(fmt.Sprintf(
+			"Mention a Jira issue like `ABC-123` in a channel I'm in and I'll show what it's about. "+
+				"Mention me with `@%s context ABC-123` for a briefing on an issue.",
+			getConfig().Username,
+		)), nil, nil),
+	}
+}
+
+func formatAdminHome(now time.Time) []slack.Block {
+	config := getConfig()
+
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, "Bot status", false, false)),
+		slack.NewSectionBlock(nil, []*slack.TextBlockObject{
+			newMarkdownText("*Connection*\n" + formatConnectionStatus(now)),
+			newMarkdownText(fmt.Sprintf("*Event queue*\n%d waiting", getEventQueueDepth())),
+			newMarkdownText(fmt.Sprintf("*Message queue*\n%d waiting", getMessageQueueDepth())),
+			newMarkdownText("*Jira API calls this hour*\n" + formatJiraBudgetUsage(config.JiraAPIBudget, now)),
+			newMarkdownText("*Errors*\n" + formatErrorTotals()),
+			newMarkdownText("*Expansions by cohort*\n" + formatCohortStats()),
+		}, nil),
+		slack.NewSectionBlock(newMarkdownText("*Recent errors*\n"+formatRecentErrors()), nil, nil),
+		slack.NewDividerBlock(),
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, "Settings", false, false)),
+	}
+
+	names := []string{}
+	for name := range toggleableSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		enabled := *toggleableSettings[name](&config)
+
+		state, label := "off", "Turn on"
+		if enabled {
+			state, label = "*on*", "Turn off"
+		}
+
+		button := slack.NewButtonBlockElement(actionToggleSetting, name, slack.NewTextBlockObject(slack.PlainTextType, label, false, false))
+		blocks = append(blocks, slack.NewSectionBlock(
+			newMarkdownText(fmt.Sprintf("%s: %s", toggleableSettingLabels[name], state)),
+			nil,
+			slack.NewAccessory(button),
+		))
+	}
+
+	blocks = append(blocks,
+		slack.NewContextBlock("", newMarkdownText("Changed settings last until the bot restarts.")),
+		slack.NewActionBlock("", slack.NewButtonBlockElement(actionRefreshHome, "", slack.NewTextBlockObject(slack.PlainTextType, "Refresh", false, false))),
+	)
+
+	return blocks
+}
+
+func formatConnectionStatus(now time.Time) string {
+	connectionStatus.Lock()
+	defer connectionStatus.Unlock()
+
+	if connectionStatus.transport == "" {
+		return "Not started"
+	}
+
+	state := ":red_circle: disconnected"
+	if connectionStatus.connected {
+		state = ":large_green_circle: connected"
+	}
+
+	text := fmt.Sprintf("%s %s for %s", connectionStatus.transport, state, formatSince(connectionStatus.since, now))
+	if !connectionStatus.lastEvent.IsZero() {
+		text += fmt.Sprintf("\nLast event %s ago", formatSince(connectionStatus.lastEvent, now))
+	}
+
+	return text
+}
+
+func formatJiraBudgetUsage(budget int, now time.Time) string {
+	jiraBudget.Lock()
+	calls := jiraBudget.calls
+	if !now.Truncate(time.Hour).Equal(jiraBudget.hour) {
+		calls = 0
+	}
+	jiraBudget.Unlock()
+
+	if budget <= 0 {
+		return fmt.Sprintf("%d", calls)
+	}
+
+	return fmt.Sprintf("%d of %d", calls, budget)
+}
+
+func formatErrorTotals() string {
+	errorCounts.Lock()
+	defer errorCounts.Unlock()
+
+	total := 0
+	for _, count := range errorCounts.counts {
+		total += count
+	}
+
+	return fmt.Sprintf("%d since start", total)
+}
+
+func formatRecentErrors() string {
+	recent := getRecentErrors()
+	if len(recent) == 0 {
+		return "None"
+	}
+
+	lines := []string{}
+	for _, e := range recent {
+		lines = append(lines, fmt.Sprintf(
+			"• <!date^%d^{date_short} {time}|%s> %s (%s): %s",
+			e.Time.Unix(),
+			e.Time.Format(time.RFC3339),
+			e.Subject,
+			e.Kind,
+			truncateText(e.Err.Error(), 200),
+		))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatSince renders how long ago something happened, to the second
+func formatSince(since time.Time, now time.Time) string {
+	return now.Sub(since).Truncate(time.Second).String()
+}
+
+// handleToggleSetting flips a setting for an admin who pressed its button
+func handleToggleSetting(callback slack.InteractionCallback, action *slack.BlockAction) {
+	if !isAdmin(callback.User.ID) {
+		log.Printf("handleToggleSetting: Ignoring %s, not an admin", callback.User.ID)
+		return
+	}
+
+	config := getConfig()
+	setting, ok := toggleableSettings[action.Value]
+	if !ok {
+		log.Printf("handleToggleSetting: Unknown setting %q", action.Value)
+		return
+	}
+	value := !*setting(&config)
+
+	if err := setRuntimeOverride(action.Value, value); err != nil {
+		log.Printf("handleToggleSetting: Error: %v", err)
+		return
+	}
+
+	log.Printf("handleToggleSetting: %s set %s to %v", callback.User.ID, action.Value, value)
+	recordEvent("admin", map[string]interface{}{
+		"user":    callback.User.ID,
+		"setting": action.Value,
+		"value":   value,
+	})
+
+	publishAppHome(callback.User.ID)
+}
+
+func handleRefreshHome(callback slack.InteractionCallback, action *slack.BlockAction) {
+	publishAppHome(callback.User.ID)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestRuntimeOverrideWinsOverEnvironment(t *testing.T) {
+	os.Setenv("READ_ONLY", "false")
+	defer os.Unsetenv("READ_ONLY")
+	defer func() { runtimeOverrides.values = map[string]bool{} }()
+
+	if err := setRuntimeOverride("read_only", true); err != nil {
+		t.Fatalf("Expected read_only to be toggleable, got %v", err)
+	}
+	if !getConfig().ReadOnly {
+		t.Errorf("Expected the runtime override to win")
+	}
+
+	if err := setRuntimeOverride("slack_api_key", true); err == nil {
+		t.Errorf("Expected other settings to be rejected")
+	}
+}
+
+func TestHandleToggleSettingIgnoresNonAdmins(t *testing.T) {
+	defer func() { runtimeOverrides.values = map[string]bool{} }()
+
+	callback := slack.InteractionCallback{User: slack.User{ID: "U1"}}
+	handleToggleSetting(callback, &slack.BlockAction{ActionID: actionToggleSetting, Value: "read_only"})
+
+	if getConfig().ReadOnly {
+		t.Errorf("Expected non-admins not to change settings")
+	}
+}
+
+func TestFormatAdminHome(t *testing.T) {
+	setConnectionStatus(transportSocketMode, true)
+	defer func() { connectionStatus.transport = "" }()
+
+	blocks := formatAdminHome(time.Now())
+
+	toggles := []string{}
+	for _, block := range blocks {
+		if section, ok := block.(*slack.SectionBlock); ok && section.Accessory != nil {
+			toggles = append(toggles, section.Text.Text)
+		}
+	}
+	if len(toggles) != len(toggleableSettings) {
+		t.Errorf("Expected a toggle per setting, got %v", toggles)
+	}
+
+	status := blocks[1].(*slack.SectionBlock).Fields[0].Text
+	if !strings.Contains(status, "Socket Mode :large_green_circle: connected") {
+		t.Errorf("Unexpected connection status %q", status)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const archiveDateLayout = "2006-01-02"
+
+// Events buffered for the archive before new ones are dropped
+const archiveBufferSize = 10000
+
+// Most archive files of a day, one per start of the bot
+const maxArchiveSegments = 1000
+
+// fileArchive appends events to gzip compressed files of JSON lines, one per
+// day and start of the bot, purging files past the retention. A bot that is
+// stopped leaves its last gzip member unfinished, which readers can't read
+// past, so a restarted bot writes to a file of its own. Events are written by
+// a goroutine of their own, so senders never wait for the disk.
+type fileArchive struct {
+	sync.Mutex
+	dir           string
+	retentionDays int
+	events        chan archiveItem
+
+	// The file of the day written to, and whether it is open
+	day    string
+	path   string
+	file   *os.File
+	writer *gzip.Writer
+}
+
+// An event to archive, or a marker closing flushed once every event queued
+// before it is written
+type archiveItem struct {
+	event   botEvent
+	flushed chan struct{}
+}
+
+func newFileArchive(dir string, retentionDays int) *fileArchive {
+	archive := &fileArchive{dir: dir, retentionDays: retentionDays, events: make(chan archiveItem, archiveBufferSize)}
+	go archive.run()
+
+	return archive
+}
+
+func (a *fileArchive) Send(event botEvent) {
+	select {
+	case a.events <- archiveItem{event: event}:
+	default:
+		log.Printf("fileArchive: Buffer full, dropping %s event", event.Kind)
+	}
+}
+
+// QueueDepth returns how many events wait to be written
+func (a *fileArchive) QueueDepth() int {
+	return len(a.events)
+}
+
+func (a *fileArchive) run() {
+	for item := range a.events {
+		a.Lock()
+		if item.flushed == nil {
+			a.write(item.event)
+		}
+
+		// Flush once the queue is empty, so a crash loses as little as
+		// possible without flushing every event of a burst
+		if a.writer != nil && len(a.events) == 0 {
+			a.writer.Flush()
+		}
+		a.Unlock()
+
+		if item.flushed != nil {
+			close(item.flushed)
+		}
+	}
+}
+
+func (a *fileArchive) write(event botEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("fileArchive: Error encoding %s event: %v", event.Kind, err)
+		return
+	}
+
+	if err := a.rotate(event.Time); err != nil {
+		log.Printf("fileArchive: Error opening archive: %v", err)
+		return
+	}
+
+	if _, err := a.writer.Write(append(line, '\n')); err != nil {
+		log.Printf("fileArchive: Error writing %s event: %v", event.Kind, err)
+	}
+}
+
+// drain waits until the events sent so far are written
+func (a *fileArchive) drain() {
+	flushed := make(chan struct{})
+	a.events <- archiveItem{flushed: flushed}
+	<-flushed
+}
+
+// Close writes the queued events and finishes the current archive file
+func (a *fileArchive) Close() error {
+	a.drain()
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.writer == nil {
+		return nil
+	}
+
+	a.writer.Close()
+	a.writer = nil
+
+	return a.file.Close()
+}
+
+// rotate makes sure the archive file of the given day is open, closing the
+// previous day's and purging files past the retention. A file this archive
+// closed properly, like for PurgeUser, is appended a new gzip member, which
+// gzip readers handle.
+func (a *fileArchive) rotate(now time.Time) error {
+	day := now.Format(archiveDateLayout)
+	if a.day == day && a.writer != nil {
+		return nil
+	}
+
+	if a.writer != nil {
+		a.writer.Close()
+		a.file.Close()
+		a.writer = nil
+	}
+
+	if err := os.MkdirAll(a.dir, 0750); err != nil {
+		return err
+	}
+
+	var file *os.File
+	var err error
+	if a.day == day {
+		file, err = os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	} else {
+		file, err = createArchiveSegment(a.dir, day)
+	}
+	if err != nil {
+		return err
+	}
+
+	a.day = day
+	a.path = file.Name()
+	a.file = file
+	a.writer = gzip.NewWriter(file)
+
+	if a.retentionDays > 0 {
+		purgeArchive(a.dir, now.AddDate(0, 0, -a.retentionDays))
+	}
+
+	return nil
+}
+
+// Purge removes archive files past the retention
+func (a *fileArchive) Purge(now time.Time) error {
+	if a.retentionDays > 0 {
+		purgeArchive(a.dir, now.AddDate(0, 0, -a.retentionDays))
+	}
+
+	return nil
+}
+
+// PurgeUser rewrites every archive file without the events of a user. The
+// queued events are written and the current file is closed first, it is
+// reopened by the next event.
+func (a *fileArchive) PurgeUser(userID string) error {
+	a.drain()
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.writer != nil {
+		a.writer.Close()
+		a.file.Close()
+		a.writer = nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(a.dir, "events-*.jsonl.gz"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := filterArchiveFile(path, func(event botEvent) bool {
+			data, _ := event.Data.(map[string]interface{})
+			return data["user"] != userID
+		}); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// createArchiveSegment creates a new archive file of the day, the first
+// one that doesn't exist yet
+func createArchiveSegment(dir string, day string) (*os.File, error) {
+	for segment := 1; segment <= maxArchiveSegments; segment++ {
+		file, err := os.OpenFile(getArchiveSegmentPath(dir, day, segment), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+		if !os.IsExist(err) {
+			return file, err
+		}
+	}
+
+	return nil, fmt.Errorf("more than %d archive files of %s", maxArchiveSegments, day)
+}
+
+// filterArchiveFile keeps only the events of an archive file that pass the
+// filter, replacing the file once the rest is written. A file that was being
+// written when the bot stopped ends in an unfinished gzip member, of which the
+// complete lines are kept. Older bots appended to such files after a restart,
+// so reading goes on with the next member.
+func filterArchiveFile(path string, keep func(event botEvent) bool) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	filtered, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filtered.Name())
+	defer filtered.Close()
+
+	writer := gzip.NewWriter(filtered)
+	if err := filterArchiveMembers(path, data, writer, keep); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := filtered.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(filtered.Name(), path)
+}
+
+// filterArchiveMembers filters the lines of every gzip member of an archive
+// file. A member that ends early or turns out corrupt keeps its complete
+// lines, and reading goes on with the next gzip header after it.
+func filterArchiveMembers(path string, data []byte, writer io.Writer, keep func(event botEvent) bool) error {
+	// Reading from a bytes.Reader, gzip doesn't read past a member
+	reader := bytes.NewReader(data)
+
+	for reader.Len() > 0 {
+		start := len(data) - reader.Len()
+
+		member, err := gzip.NewReader(reader)
+		if err == nil {
+			member.Multistream(false)
+			err = filterArchiveLines(bufio.NewReader(member), writer, keep)
+		}
+		if err == io.EOF {
+			continue
+		}
+		if writeErr, ok := err.(archiveWriteError); ok {
+			return writeErr.error
+		}
+
+		next := bytes.Index(data[start+1:], gzipHeader)
+		if next < 0 {
+			log.Printf("filterArchiveFile: %s ends in an unreadable gzip member, keeping its complete lines: %v", path, err)
+			return nil
+		}
+
+		log.Printf("filterArchiveFile: Skipping an unreadable gzip member of %s: %v", path, err)
+		reader.Seek(int64(start+1+next), io.SeekStart)
+	}
+
+	return nil
+}
+
+// filterArchiveLines copies the lines that pass the filter until reading
+// fails, which is io.EOF at the end of the archive. Every event is written
+// with its newline, so a line without one was cut off and is dropped.
+func filterArchiveLines(lines *bufio.Reader, writer io.Writer, keep func(event botEvent) bool) error {
+	for {
+		line, err := lines.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+
+		var event botEvent
+		if err := json.Unmarshal(line, &event); err == nil && !keep(event) {
+			continue
+		}
+
+		if _, err := writer.Write(line); err != nil {
+			return archiveWriteError{err}
+		}
+	}
+}
+
+// An error writing the filtered archive, unlike those reading it
+type archiveWriteError struct {
+	error
+}
+
+// The first bytes of every gzip member
+var gzipHeader = []byte{0x1f, 0x8b, 0x08}
+
+// getArchivePath returns the first archive file of a day
+func getArchivePath(dir string, day string) string {
+	return getArchiveSegmentPath(dir, day, 1)
+}
+
+// getArchiveSegmentPath returns an archive file of a day. Files of later
+// starts of the bot on the same day are numbered from 2.
+func getArchiveSegmentPath(dir string, day string, segment int) string {
+	if segment == 1 {
+		return filepath.Join(dir, "events-"+day+".jsonl.gz")
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("events-%s.%d.jsonl.gz", day, segment))
+}
+
+// purgeArchive removes archive files of days before the cutoff
+func purgeArchive(dir string, cutoff time.Time) {
+	paths, err := filepath.Glob(filepath.Join(dir, "events-*.jsonl.gz"))
+	if err != nil {
+		log.Printf("purgeArchive: Error: %v", err)
+		return
+	}
+
+	for _, path := range paths {
+		day := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "events-"), ".jsonl.gz")
+		if len(day) > len(archiveDateLayout) {
+			day = day[:len(archiveDateLayout)]
+		}
+
+		date, err := time.Parse(archiveDateLayout, day)
+		if err != nil || !date.Before(cutoff.Truncate(24*time.Hour)) {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			log.Printf("purgeArchive: Error removing %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileArchiveWritesFilePerStart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "archive")
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	day := now.Format(archiveDateLayout)
+
+	// Stopped without Close, like the bot on a restart
+	archive := newFileArchive(dir, 0)
+	archive.Send(botEvent{Time: now, Kind: "mention", Data: map[string]string{"user": "U1"}})
+	archive.drain()
+
+	restarted := newFileArchive(dir, 0)
+	restarted.Send(botEvent{Time: now, Kind: "post", Data: map[string]string{"user": "U2"}})
+	restarted.drain()
+
+	if kinds := readArchiveKinds(t, getArchiveSegmentPath(dir, day, 1)); len(kinds) != 1 || kinds[0] != "mention" {
+		t.Errorf("Expected the mention in the first file, got %v", kinds)
+	}
+	if kinds := readArchiveKinds(t, getArchiveSegmentPath(dir, day, 2)); len(kinds) != 1 || kinds[0] != "post" {
+		t.Errorf("Expected the post in the file of the restarted archive, got %v", kinds)
+	}
+
+	if err := restarted.PurgeUser("U1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if kinds := readArchiveKinds(t, getArchiveSegmentPath(dir, day, 1)); len(kinds) != 0 {
+		t.Errorf("Expected U1's mention to be purged, got %v", kinds)
+	}
+
+	// Events after the purge go to the same file
+	restarted.Send(botEvent{Time: now, Kind: "post", Data: map[string]string{"user": "U1"}})
+	restarted.Close()
+
+	if kinds := readArchiveKinds(t, getArchiveSegmentPath(dir, day, 2)); len(kinds) != 2 {
+		t.Errorf("Expected both posts in the file of the restarted archive, got %v", kinds)
+	}
+}
+
+func TestFilterArchiveFileSkipsUnfinishedMembers(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "archive")
+	defer os.RemoveAll(dir)
+
+	path := getArchivePath(dir, "2026-10-15")
+	file, _ := os.Create(path)
+
+	// A member flushed but never finished, followed by the member an older
+	// bot appended after a restart
+	for i, user := range []string{"U1", "U2"} {
+		writer := gzip.NewWriter(file)
+		line, _ := json.Marshal(botEvent{Kind: "mention", Data: map[string]string{"user": user}})
+		writer.Write(append(line, '\n'))
+		if i == 0 {
+			writer.Flush()
+		} else {
+			writer.Close()
+		}
+	}
+	file.Close()
+
+	if err := filterArchiveFile(path, func(event botEvent) bool { return true }); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if kinds := readArchiveKinds(t, path); len(kinds) != 2 {
+		t.Errorf("Expected the events of both members, got %v", kinds)
+	}
+}
+
+// readArchiveKinds returns the kinds of the events in an archive file
+func readArchiveKinds(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Expected an archive file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Expected a gzip archive: %v", err)
+	}
+
+	kinds := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var event botEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Unexpected archive line %q", scanner.Text())
+		}
+		kinds = append(kinds, event.Kind)
+	}
+	// Files still being written end in an unfinished member
+	if err := scanner.Err(); err != nil && err != io.ErrUnexpectedEOF {
+		t.Fatalf("Could not read %s: %v", path, err)
+	}
+
+	return kinds
+}
+
+func TestPurgeArchiveRemovesOldFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "archive")
+	defer os.RemoveAll(dir)
+
+	for _, day := range []string{"2026-10-01", "2026-10-10", "2026-10-15"} {
+		ioutil.WriteFile(getArchivePath(dir, day), nil, 0640)
+	}
+
+	purgeArchive(dir, time.Date(2026, 10, 10, 12, 0, 0, 0, time.UTC))
+
+	remaining, _ := filepath.Glob(filepath.Join(dir, "*.gz"))
+	if len(remaining) != 2 {
+		t.Errorf("Expected two remaining files, got %v", remaining)
+	}
+}
+
+func TestFileArchivePurgesUser(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "archive")
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+
+	archive := newFileArchive(dir, 0)
+	archive.Send(botEvent{Time: now, Kind: "mention", Data: map[string]string{"user": "U1"}})
+	archive.Send(botEvent{Time: now, Kind: "mention", Data: map[string]string{"user": "U2"}})
+
+	if err := archive.PurgeUser("U1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Events after the purge go to the same file
+	archive.Send(botEvent{Time: now, Kind: "post", Data: map[string]string{"user": "U1"}})
+	archive.Close()
+
+	file, err := os.Open(getArchivePath(dir, now.Format(archiveDateLayout)))
+	if err != nil {
+		t.Fatalf("Expected an archive file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Expected a gzip archive: %v", err)
+	}
+
+	events := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var event botEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Unexpected archive line %q", scanner.Text())
+		}
+		events = append(events, event.Kind+" "+event.Data.(map[string]interface{})["user"].(string))
+	}
+
+	if len(events) != 2 || events[0] != "mention U2" || events[1] != "post U1" {
+		t.Errorf("Expected only U2's mention and the later post, got %v", events)
+	}
+}
+
+func TestFileArchivePurgesUserFromTruncatedFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "archive")
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	path := getArchivePath(dir, now.Format(archiveDateLayout))
+
+	// A member flushed but never closed, as left behind when the bot stops,
+	// ending in half a line
+	file, _ := os.Create(path)
+	writer := gzip.NewWriter(file)
+	for _, user := range []string{"U1", "U2"} {
+		line, _ := json.Marshal(botEvent{Time: now, Kind: "mention", Data: map[string]string{"user": user}})
+		writer.Write(append(line, '\n'))
+	}
+	writer.Write([]byte(`{"kind": "post", "da`))
+	writer.Flush()
+	file.Close()
+
+	archive := newFileArchive(dir, 0)
+	if err := archive.PurgeUser("U1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Expected an archive file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Expected a gzip archive: %v", err)
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil || len(lines) != 1 || !strings.Contains(lines[0], `"U2"`) {
+		t.Errorf("Expected only U2's mention, got %v (%v)", lines, err)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Version of the backup format, raised when a change breaks older bots.
+// Version 1 only carried watches.
+const stateBundleVersion = 2
+
+// Largest backup file the restore command downloads from Slack
+const maxStateBundleSize = 10 << 20
+
+const backupUsage = "Usage: `backup` sends you a backup of my state, `restore <link to a backup file>` replaces my state with it."
+
+// Slack file links, like https://example.slack.com/files/U024BE7LH/F0S43PZDF/state.json
+var slackFileLink = regexp.MustCompile(`^<?https://[^/]+/files/[^/]+/(F[A-Z0-9]+)`)
+
+// Everything the bot keeps in its state store, in a form any store can import
+type stateBundle struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Every kind of state as saved in the state store, by its key
+	State map[string]json.RawMessage `json:"state"`
+	// The watches of version 1 backups
+	Watches map[string]*issueWatch `json:"watches,omitempty"`
+}
+
+// newStateBundle copies every registered kind of state from the state store
+func newStateBundle(now time.Time) (stateBundle, error) {
+	bundle := stateBundle{Version: stateBundleVersion, CreatedAt: now.UTC(), State: map[string]json.RawMessage{}}
+
+	store, err := getStateStore()
+	if err != nil {
+		return bundle, err
+	}
+
+	for _, kind := range stateKinds {
+		var value json.RawMessage
+		ok, err := store.Load(kind.key, &value)
+		if err != nil {
+			return bundle, fmt.Errorf("backing up %s: %v", kind.key, err)
+		}
+		if ok {
+			bundle.State[kind.key] = value
+		}
+	}
+
+	return bundle, nil
+}
+
+func readStateBundle(reader io.Reader) (stateBundle, error) {
+	var bundle stateBundle
+	if err := json.NewDecoder(reader).Decode(&bundle); err != nil {
+		return bundle, fmt.Errorf("not a backup: %v", err)
+	}
+
+	if bundle.Version < 1 || bundle.Version > stateBundleVersion {
+		return bundle, fmt.Errorf("backup version %d is not supported, this bot reads up to version %d", bundle.Version, stateBundleVersion)
+	}
+
+	if bundle.Version == 1 {
+		watches, err := json.Marshal(bundle.Watches)
+		if err != nil {
+			return bundle, err
+		}
+		bundle.State = map[string]json.RawMessage{watchesStateKey: watches}
+		bundle.Watches = nil
+	}
+
+	return bundle, nil
+}
+
+// restoreStateBundle replaces every kind of state the bundle holds with the
+// bundle's, saves it and loads it again. Kinds of state missing from the
+// bundle are left as they are.
+func restoreStateBundle(bundle stateBundle) error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	for _, kind := range stateKinds {
+		value, ok := bundle.State[kind.key]
+		if !ok {
+			continue
+		}
+
+		if err := saveRestoredState(store, kind.key, value); err != nil {
+			return fmt.Errorf("restoring %s: %v", kind.key, err)
+		}
+		kind.load()
+	}
+
+	return nil
+}
+
+func saveRestoredState(store stateStore, key string, value json.RawMessage) error {
+	defer lockSharedState(key)()
+
+	return store.Save(key, value)
+}
+
+// describeStateBundle names the kinds of state in a bundle for messages
+func describeStateBundle(bundle stateBundle) string {
+	keys := []string{}
+	for key := range bundle.State {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return "no state"
+	}
+	sort.Strings(keys)
+
+	return strings.Join(keys, ", ")
+}
+
+// runBackupCommand writes a backup to the file, or to stdout without one
+func runBackupCommand(args []string) error {
+	if !isStatePersistent() {
+		return errors.New("no state store is configured, there is no state to back up")
+	}
+
+	bundle, err := newStateBundle(time.Now())
+	if err != nil {
+		return err
+	}
+
+	output := io.Writer(os.Stdout)
+	if len(args) > 0 {
+		file, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(bundle)
+}
+
+// runRestoreCommand replaces the state in the state store with a backup. The bot
+// should be stopped, or it overwrites the restored state with its own.
+func runRestoreCommand(args []string) error {
+	if !isStatePersistent() {
+		return errors.New("no state store is configured, there is nowhere to restore to")
+	}
+	if len(args) != 1 {
+		return errors.New("usage: jira-bot restore <backup file>")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bundle, err := readStateBundle(file)
+	if err != nil {
+		return err
+	}
+
+	if err := restoreStateBundle(bundle); err != nil {
+		return err
+	}
+
+	log.Printf("runRestoreCommand: Restored %s from %s", describeStateBundle(bundle), bundle.CreatedAt.Format(time.RFC3339))
+
+	return nil
+}
+
+// handleBackupCommand sends an admin a backup as a file in a direct message
+func handleBackupCommand(ctx context.Context, message slack.Msg, args []string) {
+	reply := func(text string) {
+		if err := postEphemeral(message.Channel, message.User, text); err != nil {
+			log.Printf("handleBackupCommand: Error: %v", err)
+		}
+	}
+
+	if !isAdmin(message.User) {
+		reply("Only admins can back up my state.")
+		return
+	}
+
+	bundle, err := newStateBundle(time.Now())
+	if err != nil {
+		log.Printf("handleBackupCommand: Error: %v", err)
+		reply(":warning: I couldn't read my state.")
+		return
+	}
+
+	content, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		log.Printf("handleBackupCommand: Error: %v", err)
+		return
+	}
+
+	im, _, _, err := getSlackAPIFor(message.User).OpenConversation(&slack.OpenConversationParameters{Users: []string{message.User}})
+	if err != nil {
+		log.Printf("handleBackupCommand: Error opening a direct message: %v", err)
+		reply(":warning: I couldn't send you a direct message.")
+		return
+	}
+
+	name := "jira-bot-" + time.Now().UTC().Format("2006-01-02") + ".json"
+	if _, err := getSlackAPIFor(message.User).UploadFileV2(slack.UploadFileV2Parameters{
+		Content:  string(content),
+		FileSize: len(content),
+		Filename: name,
+		Title:    name,
+		Channel:  im.ID,
+	}); err != nil {
+		log.Printf("handleBackupCommand: Error uploading: %v", err)
+		reply(":warning: I couldn't upload the backup.")
+		return
+	}
+
+	recordEvent("backup", map[string]interface{}{"user": message.User})
+	reply(":floppy_disk: I sent you the backup in a direct message.")
+}
+
+// handleRestoreCommand replaces the bot's state with a backup file shared in
+// Slack
+func handleRestoreCommand(ctx context.Context, message slack.Msg, args []string) {
+	reply := func(text string) {
+		if err := postEphemeral(message.Channel, message.User, text); err != nil {
+			log.Printf("handleRestoreCommand: Error: %v", err)
+		}
+	}
+
+	if !isAdmin(message.User) {
+		reply("Only admins can restore my state.")
+		return
+	}
+
+	if len(args) != 1 || !slackFileLink.MatchString(args[0]) {
+		reply(backupUsage)
+		return
+	}
+	fileID := slackFileLink.FindStringSubmatch(args[0])[1]
+
+	file, _, _, err := getSlackAPIFor(message.Channel).GetFileInfo(fileID, 0, 0)
+	if err != nil {
+		log.Printf("handleRestoreCommand: Error reading %s: %v", fileID, err)
+		reply(":warning: I couldn't find that file. Share it in a channel I'm in or with me.")
+		return
+	}
+	if file.Size > maxStateBundleSize {
+		reply(":warning: That file is too large to be a backup.")
+		return
+	}
+
+	var content bytes.Buffer
+	if err := getSlackAPIFor(message.Channel).GetFile(file.URLPrivateDownload, &content); err != nil {
+		log.Printf("handleRestoreCommand: Error downloading %s: %v", fileID, err)
+		reply(":warning: I couldn't download that file.")
+		return
+	}
+
+	bundle, err := readStateBundle(&content)
+	if err != nil {
+		reply(":warning: " + err.Error())
+		return
+	}
+
+	if err := restoreStateBundle(bundle); err != nil {
+		log.Printf("handleRestoreCommand: Error: %v", err)
+		reply(":warning: I restored the backup, but couldn't save it. It is lost on restart.")
+		return
+	}
+
+	recordEvent("restore", map[string]interface{}{"user": message.User, "file": fileID})
+	reply(fmt.Sprintf(":floppy_disk: Restored %s from the backup of %s.", describeStateBundle(bundle), formatSlackDate(bundle.CreatedAt)))
+}
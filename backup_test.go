@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A value of every kind of state, as saved in the state store
+var testStateValues = map[string]string{
+	watchesStateKey:            `{"ABC-1": {"channels": ["C1"], "state": {"status": "Open"}}}`,
+	channelEnablementStateKey:  `{"C1": false}`,
+	channelProjectsStateKey:    `{"C1": ["WEB"]}`,
+	userPreferencesStateKey:    `{"U1": {"accessible_cards": true}}`,
+	issueAliasesStateKey:       `{"OLD-1": {"key": "NEW-1", "seen": "2026-10-15T09:00:00Z"}}`,
+	jiraLinksStateKey:          `{"U1": {}}`,
+	slackInstallationsStateKey: `{"T1": {}}`,
+	announcementsStateKey:      `{"Q1": {"title": "1.0", "user": "U1", "post_at": "2099-01-01T00:00:00Z"}}`,
+	customerViewStateKey:       `{"C1": true}`,
+	issueThreadsStateKey:       `{"ABC-1": [{"channel": "C1", "timestamp": "1600000000.000100", "seen": "2026-10-15T09:00:00Z"}]}`,
+}
+
+// setTestState saves a value for every kind of state and loads it
+func setTestState(t *testing.T, values map[string]string) {
+	store, err := getStateStore()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for _, kind := range stateKinds {
+		value, ok := values[kind.key]
+		if !ok {
+			value = `{}`
+		}
+		if err := store.Save(kind.key, json.RawMessage(value)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		kind.load()
+	}
+}
+
+func TestEveryStateKindIsBackedUp(t *testing.T) {
+	keys := map[string]bool{}
+	for _, kind := range stateKinds {
+		keys[kind.key] = true
+	}
+
+	for key := range testStateValues {
+		if !keys[key] {
+			t.Errorf("Expected %s to be registered for backups", key)
+		}
+	}
+	if len(keys) != len(testStateValues) {
+		t.Errorf("Expected a test value for every kind of state, got %v", keys)
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "data")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DATA_DIR", dir)
+	defer os.Unsetenv("DATA_DIR")
+
+	setTestState(t, testStateValues)
+	defer setTestState(t, nil)
+
+	path := filepath.Join(dir, "backup.json")
+	if err := runBackupCommand([]string{path}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	setTestState(t, map[string]string{watchesStateKey: `{"XYZ-9": {"channels": ["C2"]}}`})
+
+	if err := runRestoreCommand([]string{path}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if !isWatched("ABC-1") || isWatched("XYZ-9") {
+		t.Error("Expected only the backed up watch")
+	}
+	if key := resolveIssueAlias("OLD-1"); key != "NEW-1" {
+		t.Errorf("Expected the backed up alias, got %v", key)
+	}
+	if !getUserPreferences("U1").AccessibleCards {
+		t.Error("Expected the backed up preferences")
+	}
+
+	// Every kind of state is what the next start loads
+	store, _ := getStateStore()
+	for key, expected := range testStateValues {
+		var restored, original interface{}
+		store.Load(key, &restored)
+		json.Unmarshal([]byte(expected), &original)
+
+		if !reflect.DeepEqual(restored, original) {
+			t.Errorf("Expected %s to be restored, got %v", key, restored)
+		}
+	}
+}
+
+func TestReadStateBundleChecksVersion(t *testing.T) {
+	for body, valid := range map[string]bool{
+		`{"version": 1, "watches": {"ABC-1": {"channels": ["C1"]}}}`:            true,
+		`{"version": 2, "state": {"watches": {"ABC-1": {"channels": ["C1"]}}}}`: true,
+		`{"version": 3}`:  false,
+		`{"watches": {}}`: false,
+		`not json`:        false,
+	} {
+		bundle, err := readStateBundle(strings.NewReader(body))
+		if (err == nil) != valid {
+			t.Errorf("Expected %s valid to be %v, got %v", body, valid, err)
+		}
+		if !valid {
+			continue
+		}
+
+		watches := map[string]*issueWatch{}
+		if err := json.Unmarshal(bundle.State[watchesStateKey], &watches); err != nil || !reflect.DeepEqual(watches["ABC-1"].Channels, []string{"C1"}) {
+			t.Errorf("Unexpected watches in %s: %v (%v)", body, watches, err)
+		}
+	}
+}
+
+func TestSlackFileLink(t *testing.T) {
+	for link, fileID := range map[string]string{
+		"<https://example.slack.com/files/U024BE7LH/F0S43PZDF/state.json>":            "F0S43PZDF",
+		"<https://example.slack.com/files/U024BE7LH/F0S43PZDF/state.json|state.json>": "F0S43PZDF",
+		"https://example.slack.com/files/U024BE7LH/F0S43PZDF":                         "F0S43PZDF",
+		"<https://example.com/state.json>":                                            "",
+	} {
+		match := slackFileLink.FindStringSubmatch(link)
+		if (match == nil && fileID != "") || (match != nil && match[1] != fileID) {
+			t.Errorf("Expected file %q in %s, got %v", fileID, link, match)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Slack rejects section texts longer than 3000 characters
+const maxBlockTextLength = 3000
+
+// formatMessageBlocks renders the issue card as Block Kit blocks, which read
+// better on mobile than the mrkdwn card of formatMessage. That card still goes
+// along as the notification text. A menu under the card acts on the issue.
+func formatMessageBlocks(issue jiraIssue, requestedKey string) []slack.Block {
+	blocks := []slack.Block{}
+
+	project := getProjectKey(issue.Key)
+	if freeze := activeFreeze(getFreezes(project), project, time.Now()); freeze != nil {
+		blocks = append(blocks, slack.NewSectionBlock(
+			newMarkdownText(fmt.Sprintf(":no_entry: *Change freeze* in effect until %s", freeze.End.Format(freezeDateLayout))),
+			nil,
+			nil,
+		))
+	}
+
+	header := fmt.Sprintf("*<%s|%s>*%s %s", getJiraURL(issue.Key), issue.Key, formatMobileLink(issue.Key), issue.Fields.Summary)
+	blocks = append(blocks, slack.NewSectionBlock(
+		newMarkdownText(truncateText(header, maxBlockTextLength)),
+		[]*slack.TextBlockObject{
+			newMarkdownText("*Status*\n" + issue.Fields.Status.Name),
+			newMarkdownText("*Assignee*\n" + getDisplayName(issue.Fields.Assignee)),
+			newMarkdownText("*Creator*\n" + getDisplayName(issue.Fields.Reporter)),
+		},
+		nil,
+	))
+
+	details := []slack.MixedElement{newMarkdownText(fmt.Sprintf(
+		":calendar: Created <!date^%d^{date} at {time}|%s>",
+		issue.CreatedAt.Unix(),
+		issue.Fields.Created,
+	))}
+	if note := formatMovedNote(requestedKey, issue); note != "" {
+		details = append(details, newMarkdownText(strings.TrimPrefix(note, "\n> ")))
+	}
+	blocks = append(blocks, slack.NewContextBlock("", details...))
+	blocks = append(blocks, newCardActions(issue.Key))
+
+	return blocks
+}
+
+func newMarkdownText(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, text, false, false)
+}
+
+// formatCompactCard is a single line on the issue, for previews only the
+// person asking sees
+func formatCompactCard(issue jiraIssue, requestedKey string) string {
+	return fmt.Sprintf(
+		"*<%s|%s>* %s · :traffic_light: %s · :bust_in_silhouette: %s%s",
+		getJiraURL(issue.Key),
+		issue.Key,
+		issue.Fields.Summary,
+		issue.Fields.Status.Name,
+		getDisplayName(issue.Fields.Assignee),
+		formatMovedNote(requestedKey, issue),
+	)
+}
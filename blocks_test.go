@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestFormatMessageBlocks(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	issue := decodeIssue(t, `{
+		"key": "NEW-5",
+		"fields": {
+			"summary": "Printer on fire",
+			"status": {"name": "Open"},
+			"reporter": {"displayName": "Jane Doe"},
+			"created": "2015-09-28T18:19:08.000+0100"
+		}
+	}`)
+
+	blocks := formatMessageBlocks(issue, "OLD-12")
+	if len(blocks) != 3 {
+		t.Fatalf("Expected a section, a context and an actions block, got %d blocks", len(blocks))
+	}
+
+	section := blocks[0].(*slack.SectionBlock)
+	if section.Text.Text != "*<https://jira.example.com/browse/NEW-5|NEW-5>* Printer on fire" {
+		t.Errorf("Unexpected header %q", section.Text.Text)
+	}
+
+	fields := []string{}
+	for _, field := range section.Fields {
+		fields = append(fields, field.Text)
+	}
+	expected := []string{"*Status*\nOpen", "*Assignee*\nUnassigned", "*Creator*\nJane Doe"}
+	for i := range expected {
+		if i >= len(fields) || fields[i] != expected[i] {
+			t.Errorf("Unexpected fields %q", fields)
+			break
+		}
+	}
+
+	context := blocks[1].(*slack.ContextBlock)
+	if elements := context.ContextElements.Elements; len(elements) != 2 || elements[1].(*slack.TextBlockObject).Text != "_(moved from OLD-12)_" {
+		t.Errorf("Expected the moved note in the context block, got %v", elements)
+	}
+}
+
+func TestFormatCompactCard(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	issue := decodeIssue(t, `{
+		"key": "ABC-1",
+		"fields": {
+			"summary": "Printer on fire",
+			"status": {"name": "In Progress"},
+			"assignee": {"displayName": "Jane Doe"}
+		}
+	}`)
+
+	expected := "*<https://jira.example.com/browse/ABC-1|ABC-1>* Printer on fire · :traffic_light: In Progress · :bust_in_silhouette: Jane Doe"
+	if text := formatCompactCard(issue, "ABC-1"); text != expected {
+		t.Errorf("Unexpected card %q", text)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// The clients the bot talks to Slack, Jira and the translation provider with
+type jiraBot struct {
+	slack      *slack.Client
+	jira       JiraService
+	translator Translator
+}
+
+// The clients shared by every handler, see getBot
+var sharedBot = struct {
+	sync.Mutex
+	bot *jiraBot
+}{}
+
+func newJiraBot(config BotConfig) *jiraBot {
+	return &jiraBot{
+		slack: slack.New(
+			config.SlackAPIKey,
+			slack.OptionAppLevelToken(config.SlackAppToken),
+		),
+		jira:       newJiraRouter(newRESTJiraService()),
+		translator: newTranslator(config),
+	}
+}
+
+// getBot returns the clients, creating them from the configuration the first
+// time they are needed
+func getBot() *jiraBot {
+	sharedBot.Lock()
+	defer sharedBot.Unlock()
+
+	if sharedBot.bot == nil {
+		sharedBot.bot = newJiraBot(getConfig())
+	}
+
+	return sharedBot.bot
+}
+
+// setBot replaces the clients, e.g. with ones talking to a test server
+func setBot(bot *jiraBot) {
+	sharedBot.Lock()
+	defer sharedBot.Unlock()
+
+	sharedBot.bot = bot
+}
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestGetBotReusesClients(t *testing.T) {
+	defer setBot(nil)
+
+	if getBot() != getBot() || getSlackAPI() != getBot().slack {
+		t.Errorf("Expected the clients to be created once")
+	}
+
+	bot := newJiraBot(BotConfig{SlackAPIKey: "xoxb-test"})
+	setBot(bot)
+
+	if getBot() != bot {
+		t.Errorf("Expected the replaced clients to be used")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Share of the hourly budget after which the bot starts saving calls
+const budgetWarningRatio = 0.8
+
+// Issue cache TTL used while the budget is tight
+const budgetCacheTTL = 15 * time.Minute
+
+// Issues read with one search while the budget is tight
+const maxBatchedIssues = 50
+
+// Jira API calls made in the current hour
+var jiraBudget = struct {
+	sync.Mutex
+	hour   time.Time
+	calls  int
+	warned bool
+}{}
+
+// recordJiraCall counts a call against the hourly budget. It reports whether
+// this call crossed the warning threshold, which happens at most once an hour.
+func recordJiraCall(budget int, now time.Time) bool {
+	jiraBudget.Lock()
+	defer jiraBudget.Unlock()
+
+	if hour := now.Truncate(time.Hour); !hour.Equal(jiraBudget.hour) {
+		jiraBudget.hour = hour
+		jiraBudget.calls = 0
+		jiraBudget.warned = false
+	}
+
+	jiraBudget.calls++
+
+	if budget <= 0 || jiraBudget.warned || float64(jiraBudget.calls) < float64(budget)*budgetWarningRatio {
+		return false
+	}
+	jiraBudget.warned = true
+
+	return true
+}
+
+// countJiraCall records a Jira API call and alerts when the budget gets tight
+func countJiraCall() {
+	if budget := getConfig().JiraAPIBudget; recordJiraCall(budget, time.Now()) {
+		go alertJiraBudget(budget)
+	}
+}
+
+// isJiraBudgetTight reports whether the calls this hour are close to the budget
+func isJiraBudgetTight(budget int, now time.Time) bool {
+	jiraBudget.Lock()
+	defer jiraBudget.Unlock()
+
+	return budget > 0 &&
+		now.Truncate(time.Hour).Equal(jiraBudget.hour) &&
+		float64(jiraBudget.calls) >= float64(budget)*budgetWarningRatio
+}
+
+// searchIssueBatch reads the fields of several issues with a search for
+// `key in (...)`, which costs a call per 50 issues rather than one per issue.
+// It returns the issues Jira sent by their upper case key. Keys that moved or
+// that Jira doesn't know are left out, and their searches may fail.
+func searchIssueBatch(issueKeys []string, fields string) (map[string]json.RawMessage, error) {
+	found := map[string]json.RawMessage{}
+
+	for start := 0; start < len(issueKeys); start += maxBatchedIssues {
+		end := start + maxBatchedIssues
+		if end > len(issueKeys) {
+			end = len(issueKeys)
+		}
+
+		quoted := []string{}
+		for _, issueKey := range issueKeys[start:end] {
+			quoted = append(quoted, strconv.Quote(issueKey))
+		}
+
+		result, err := searchJiraIssueFields(getBot().jira, "key in ("+strings.Join(quoted, ", ")+")", fields, end-start)
+		if err != nil {
+			return found, err
+		}
+		for _, issue := range result.Issues {
+			found[strings.ToUpper(issue.Key)] = issue.Raw
+		}
+	}
+
+	return found, nil
+}
+
+func alertJiraBudget(budget int) {
+	message := fmt.Sprintf(
+		"> :warning: Jira API usage passed %d%% of the hourly budget of %d calls, caching issues for %v",
+		int(budgetWarningRatio*100),
+		budget,
+		budgetCacheTTL,
+	)
+	log.Print("alertJiraBudget: " + message)
+
+	target := getConfig().OpsChannel
+	if target == "" {
+		return
+	}
+
+	channel, err := resolveNotificationTarget(target)
+	if err != nil {
+		log.Printf("alertJiraBudget: Error: %v", err)
+		return
+	}
+
+	if err := postText(channel, "", message); err != nil {
+		log.Printf("alertJiraBudget: Error: %v", err)
+	}
+}
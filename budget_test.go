@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordJiraCallWarnsOncePerHour(t *testing.T) {
+	hour := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 7; i++ {
+		if recordJiraCall(10, hour) {
+			t.Errorf("Expected no warning after %v of 10 calls", i)
+		}
+	}
+
+	if !recordJiraCall(10, hour) {
+		t.Errorf("Expected a warning after 8 of 10 calls")
+	}
+
+	if recordJiraCall(10, hour) {
+		t.Errorf("Expected only one warning per hour")
+	}
+
+	if !isJiraBudgetTight(10, hour) {
+		t.Errorf("Expected the budget to be tight")
+	}
+
+	if isJiraBudgetTight(10, hour.Add(time.Hour)) {
+		t.Errorf("Expected the budget to reset the next hour")
+	}
+}
+
+func TestPrefetchIssueBatchSearchesOnce(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("jql"))
+		w.Write([]byte(`{"issues": [{"key": "ABC-1", "fields": {"summary": "Printer on fire", "status": {"name": "Open"}}}]}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer setBot(nil)
+	defer forgetCachedIssue("ABC-1")
+
+	prefetchIssueBatch([]string{"ABC-1", "ABC-2"})
+
+	if !reflect.DeepEqual(requests, []string{`key in ("ABC-1", "ABC-2")`}) {
+		t.Errorf("Expected a single search, got %v", requests)
+	}
+	if issue, ok := getCachedIssue("ABC-1", time.Minute, time.Now()); !ok || issue.Fields.Summary != "Printer on fire" {
+		t.Errorf("Expected ABC-1 to be cached, got %+v", issue)
+	}
+	if _, ok := getCachedIssue("ABC-2", time.Minute, time.Now()); ok {
+		t.Errorf("Expected the missing issue to be left out")
+	}
+}
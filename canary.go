@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Cohorts expansions are split into. Canary expansions use the next format
+// that is being tried out.
+const (
+	cohortStable = "stable"
+	cohortCanary = "canary"
+)
+
+// Expansions and failures per cohort since the bot started
+var cohortStats = struct {
+	sync.Mutex
+	expansions map[string]int
+	failures   map[string]int
+}{expansions: map[string]int{}, failures: map[string]int{}}
+
+// getCohort puts an expansion into the canary cohort if its channel is a
+// canary channel, or by the configured percentage otherwise. The same issue
+// in the same channel always lands in the same cohort, so a card doesn't
+// change its look between mentions.
+func getCohort(channel string, issueID string) string {
+	config := getConfig()
+
+	for _, c := range config.CanaryChannels {
+		if c == channel {
+			return cohortCanary
+		}
+	}
+
+	if config.CanaryPercent <= 0 {
+		return cohortStable
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(channel + "/" + issueID))
+	if int(h.Sum32()%100) < config.CanaryPercent {
+		return cohortCanary
+	}
+
+	return cohortStable
+}
+
+// getCohortTemplate returns the message template source for a cohort
+func getCohortTemplate(cohort string) string {
+	if cohort == cohortCanary {
+		return getConfig().CanaryTemplate
+	}
+
+	return getConfig().MessageTemplate
+}
+
+// recordExpansion counts an expansion for its cohort and sends it to the
+// event sinks, so the formats can be compared
+func recordExpansion(channel string, issueID string, cohort string, err error) {
+	cohortStats.Lock()
+	cohortStats.expansions[cohort]++
+	if err != nil {
+		cohortStats.failures[cohort]++
+	}
+	cohortStats.Unlock()
+
+	recordEvent("expansion", map[string]interface{}{
+		"channel": channel,
+		"issue":   issueID,
+		"cohort":  cohort,
+		"failed":  err != nil,
+	})
+}
+
+func formatCohortStats() string {
+	cohortStats.Lock()
+	defer cohortStats.Unlock()
+
+	cohorts := []string{}
+	for cohort := range cohortStats.expansions {
+		cohorts = append(cohorts, cohort)
+	}
+	sort.Strings(cohorts)
+
+	if len(cohorts) == 0 {
+		return "No expansions yet"
+	}
+
+	lines := []string{}
+	for _, cohort := range cohorts {
+		lines = append(lines, fmt.Sprintf(
+			"%s: %d, %d failed",
+			cohort,
+			cohortStats.expansions[cohort],
+			cohortStats.failures[cohort],
+		))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestGetCohort(t *testing.T) {
+	os.Setenv("CANARY_CHANNELS", "C1")
+	defer os.Unsetenv("CANARY_CHANNELS")
+	defer os.Unsetenv("CANARY_PERCENT")
+
+	if getCohort("C1", "ABC-1") != cohortCanary {
+		t.Errorf("Expected canary channels to be in the canary cohort")
+	}
+	if getCohort("C2", "ABC-1") != cohortStable {
+		t.Errorf("Expected other channels to be stable without a percentage")
+	}
+
+	os.Setenv("CANARY_PERCENT", "30")
+
+	canaries := 0
+	for i := 0; i < 1000; i++ {
+		issueID := fmt.Sprintf("ABC-%d", i)
+		if getCohort("C2", issueID) != getCohort("C2", issueID) {
+			t.Fatalf("Expected %s to always land in the same cohort", issueID)
+		}
+		if getCohort("C2", issueID) == cohortCanary {
+			canaries++
+		}
+	}
+	if canaries < 200 || canaries > 400 {
+		t.Errorf("Expected about 30%% canaries, got %d of 1000", canaries)
+	}
+}
+
+func TestRecordExpansion(t *testing.T) {
+	defer func() {
+		cohortStats.expansions = map[string]int{}
+		cohortStats.failures = map[string]int{}
+	}()
+
+	recordExpansion("C1", "ABC-1", cohortCanary, nil)
+	recordExpansion("C1", "ABC-2", cohortCanary, errors.New("boom"))
+	recordExpansion("C2", "ABC-1", cohortStable, nil)
+
+	if stats := formatCohortStats(); stats != "canary: 2, 1 failed\nstable: 1, 0 failed" {
+		t.Errorf("Unexpected stats %q", stats)
+	}
+}
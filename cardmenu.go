@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Action IDs of the buttons and menu on issue cards
+const (
+	actionCardMenu    = "card_menu"
+	actionOpenCard    = "open_card"
+	actionOpenCardApp = "open_card_app"
+)
+
+// Items of the card menu, before the issue key in their value
+const (
+	cardMenuComment    = "comment"
+	cardMenuTransition = "transition"
+	cardMenuAssign     = "assign"
+	cardMenuWatch      = "watch"
+	cardMenuRefresh    = "refresh"
+)
+
+// Callback IDs of the modals opened from the card menu
+const (
+	callbackCardComment    = "card_comment"
+	callbackCardTransition = "card_transition"
+)
+
+// Block and action IDs of the inputs in those modals
+const (
+	blockCardInput  = "card_input"
+	actionCardInput = "card_input"
+)
+
+// newCardActions is the row under an issue card. Open in Jira is a button of
+// its own, as Slack allows only five items in a menu.
+func newCardActions(issueKey string) *slack.ActionBlock {
+	menu := slack.NewOverflowBlockElement(
+		actionCardMenu,
+		newCardMenuOption(cardMenuComment, "Comment…", issueKey),
+		newCardMenuOption(cardMenuTransition, "Change status…", issueKey),
+		newCardMenuOption(cardMenuAssign, "Assign to me", issueKey),
+		newCardMenuOption(cardMenuWatch, "Watch in Jira", issueKey),
+		newCardMenuOption(cardMenuRefresh, "Refresh", issueKey),
+	)
+
+	open := slack.NewButtonBlockElement(actionOpenCard, issueKey, newPlainText("Open in Jira"))
+	open.URL = getJiraURL(issueKey)
+
+	if mobileURL := getJiraMobileURL(issueKey); mobileURL != "" {
+		openApp := slack.NewButtonBlockElement(actionOpenCardApp, issueKey, newPlainText("Open in app"))
+		openApp.URL = mobileURL
+
+		return slack.NewActionBlock("", open, openApp, menu)
+	}
+
+	return slack.NewActionBlock("", open, menu)
+}
+
+func newCardMenuOption(item string, label string, issueKey string) *slack.OptionBlockObject {
+	return slack.NewOptionBlockObject(item+" "+issueKey, slack.NewTextBlockObject(slack.PlainTextType, label, false, false), nil)
+}
+
+// handleCardMenu runs what a user picked from a card's menu
+func handleCardMenu(callback slack.InteractionCallback, action *slack.BlockAction) {
+	fields := strings.Fields(action.SelectedOption.Value)
+	if len(fields) != 2 {
+		log.Printf("handleCardMenu: Unexpected value %q", action.SelectedOption.Value)
+		return
+	}
+	item, issueKey := fields[0], fields[1]
+
+	recordEvent("card_menu", map[string]interface{}{
+		"channel": callback.Channel.ID,
+		"user":    callback.User.ID,
+		"issue":   issueKey,
+		"item":    item,
+	})
+
+	if item != cardMenuRefresh {
+		if err := checkUserAccess(callback.User.ID); err != nil {
+			replyToCardAction(callback, issueKey, err, "", false)
+			return
+		}
+	}
+
+	var err error
+	switch item {
+	case cardMenuComment:
+		err = openCommentModal(callback, issueKey)
+	case cardMenuTransition:
+		err = openTransitionModal(callback, issueKey)
+	case cardMenuAssign:
+		err = assignToSlackUser(callback.Channel.ID, issueKey, callback.User.ID)
+		replyToCardAction(callback, issueKey, err, fmt.Sprintf(":bust_in_silhouette: <@%s> took %s.", callback.User.ID, issueKey), true)
+		return
+	case cardMenuWatch:
+		err = watchAsSlackUser(callback.Channel.ID, issueKey, callback.User.ID)
+		replyToCardAction(callback, issueKey, err, fmt.Sprintf(":eyes: You're watching %s in Jira now.", issueKey), false)
+		return
+	case cardMenuRefresh:
+		err = refreshCard(callback, issueKey)
+	default:
+		log.Printf("handleCardMenu: Unknown item %q", item)
+		return
+	}
+
+	if err != nil {
+		replyToCardAction(callback, issueKey, err, "", false)
+	}
+}
+
+// replyToCardAction confirms an action in the card's thread, or only to the
+// user who took it, and explains failures to them
+func replyToCardAction(callback slack.InteractionCallback, issueKey string, err error, confirmation string, public bool) {
+	channel := callback.Channel.ID
+
+	if err != nil {
+		reportError(slack.Msg{Channel: channel}, issueKey, err, false)
+		confirmation = describeCardActionError(err, issueKey)
+		public = false
+	}
+
+	if public {
+		err = postText(channel, getReplyThread(callback.Message.Msg), confirmation)
+	} else {
+		err = postEphemeral(channel, callback.User.ID, confirmation)
+	}
+	if err != nil {
+		log.Printf("replyToCardAction: Error: %v", err)
+	}
+}
+
+func describeCardActionError(err error, issueKey string) string {
+	if errors.Is(err, errReadOnly) {
+		return ":lock: I'm in read-only mode, so I can't change issues in Jira right now."
+	}
+	if errors.Is(err, errRestricted) {
+		return ":lock: Only people with an email address at " + strings.Join(getConfig().AllowedEmailDomains, ", ") + " can do that."
+	}
+	if errors.Is(err, errForeignJiraUsers) {
+		return fmt.Sprintf(":warning: %s is on the %s Jira, I only know the users of the main one.", issueKey, getJiraInstanceFor(issueKey).Name)
+	}
+
+	return describeError(getErrorKind(err), issueKey)
+}
+
+// refreshCard replaces a card with the issue as it is in Jira now
+func refreshCard(callback slack.InteractionCallback, issueKey string) error {
+	channel, user := callback.Channel.ID, callback.User.ID
+
+	forgetCachedIssue(issueKey)
+	issue, err := fetchJiraIssueFor(context.Background(), channel, user, issueKey)
+	if err != nil {
+		return err
+	}
+	if isCustomerViewChannel(channel) {
+		issue = loadCustomerRequest(context.Background(), channel, user, issue)
+	}
+
+	// The card looks like a fresh post of the issue would in the channel
+	text, blocks := formatIssuePost(channel, user, issueKey, issue, getCohort(channel, issueKey))
+	options := []slack.MsgOption{slack.MsgOptionText(truncateText(text, maxMessageLength), false)}
+	if blocks != nil {
+		options = append(options, slack.MsgOptionBlocks(truncateBlocks(blocks)...))
+	}
+
+	_, _, _, err = getSlackAPIFor(channel).UpdateMessage(channel, callback.Message.Timestamp, options...)
+
+	return err
+}
+
+// getJiraUserForSlack finds the Jira account of a Slack user, the linked
+// one if there is one
+func getJiraUserForSlack(slackUserID string) (jiraUser, error) {
+	if link, ok := getJiraLink(slackUserID); ok {
+		return jiraUser{AccountID: link.AccountID, DisplayName: link.DisplayName}, nil
+	}
+
+	slackUser, err := getSlackAPIFor(slackUserID).GetUserInfo(slackUserID)
+	if err != nil {
+		return jiraUser{}, err
+	}
+
+	metadata, err := getJiraMetadata()
+	if err != nil {
+		return jiraUser{}, err
+	}
+
+	user := findJiraUserForSlack(metadata.Users, *slackUser)
+	if user == nil {
+		return jiraUser{}, newBotError(errorKindNotFound, "no Jira user for Slack user %s", slackUserID)
+	}
+
+	return *user, nil
+}
+
+// assignToSlackUser assigns the issue to the user as them, so Jira checks
+// they may, if they linked their account
+func assignToSlackUser(channel string, issueKey string, slackUserID string) error {
+	if err := checkWritable(); err != nil {
+		return err
+	}
+	if getJiraInstanceFor(issueKey).Name != mainJiraInstance {
+		return errForeignJiraUsers
+	}
+
+	jira, err := getJiraServiceFor(channel, slackUserID)
+	if err != nil {
+		return err
+	}
+	user, err := getJiraUserForSlack(slackUserID)
+	if err != nil {
+		return err
+	}
+
+	err = jira.AssignIssue(context.Background(), issueKey, user)
+	if err == nil {
+		forgetCachedIssue(issueKey)
+	}
+
+	return err
+}
+
+// watchAsSlackUser adds the user to the issue's watchers as them
+func watchAsSlackUser(channel string, issueKey string, slackUserID string) error {
+	if err := checkWritable(); err != nil {
+		return err
+	}
+	if getJiraInstanceFor(issueKey).Name != mainJiraInstance {
+		return errForeignJiraUsers
+	}
+
+	jira, err := getJiraServiceFor(channel, slackUserID)
+	if err != nil {
+		return err
+	}
+	user, err := getJiraUserForSlack(slackUserID)
+	if err != nil {
+		return err
+	}
+
+	return jira.AddWatcher(context.Background(), issueKey, user)
+}
+
+// openCommentModal asks for the text of a comment on the issue
+func openCommentModal(callback slack.InteractionCallback, issueKey string) error {
+	if err := checkWritable(); err != nil {
+		return err
+	}
+
+	input := slack.NewPlainTextInputBlockElement(nil, actionCardInput)
+	input.Multiline = true
+
+	return openCardModal(callback, callbackCardComment, issueKey, "Comment on "+issueKey, "Comment",
+		slack.NewInputBlock(blockCardInput, slack.NewTextBlockObject(slack.PlainTextType, "Comment", false, false), nil, input))
+}
+
+// openTransitionModal offers the transitions the issue's workflow allows now
+func openTransitionModal(callback slack.InteractionCallback, issueKey string) error {
+	if err := checkWritable(); err != nil {
+		return err
+	}
+
+	jira, err := getJiraServiceFor(callback.Channel.ID, callback.User.ID)
+	if err != nil {
+		return err
+	}
+
+	transitions, err := getJiraTransitions(context.Background(), jira, issueKey)
+	if err != nil {
+		return err
+	}
+	if len(transitions) == 0 {
+		return newBotError(errorKindForbidden, "no transitions available for %s", issueKey)
+	}
+
+	options := []*slack.OptionBlockObject{}
+	for _, transition := range transitions {
+		options = append(options, slack.NewOptionBlockObject(
+			transition.ID,
+			slack.NewTextBlockObject(slack.PlainTextType, transition.Name+" → "+transition.To.Name, false, false),
+			nil,
+		))
+	}
+
+	blocks := []slack.Block{slack.NewInputBlock(
+		blockCardInput,
+		slack.NewTextBlockObject(slack.PlainTextType, "Transition", false, false),
+		nil,
+		slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, nil, actionCardInput, options...),
+	)}
+
+	// Submitting the modal confirms the transition despite the freeze
+	project := getProjectKey(issueKey)
+	if freeze := activeFreeze(getFreezes(project), project, time.Now()); freeze != nil {
+		warning := formatFreezeWarning(issueKey, *freeze) + " Changing the status moves the issue anyway."
+		blocks = append([]slack.Block{slack.NewSectionBlock(newMarkdownText(warning), nil, nil)}, blocks...)
+	}
+
+	return openCardModal(callback, callbackCardTransition, issueKey, "Change status of "+issueKey, "Change", blocks...)
+}
+
+// openCardModal opens a modal acting on an issue. The modal remembers the
+// issue and the card it came from.
+func openCardModal(callback slack.InteractionCallback, callbackID string, issueKey string, title string, submit string, blocks ...slack.Block) error {
+	_, err := getSlackAPIFor(callback.User.ID).OpenView(callback.TriggerID, slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      callbackID,
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, truncateText(title, 24), false, false),
+		Submit:          slack.NewTextBlockObject(slack.PlainTextType, submit, false, false),
+		Close:           slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+		Blocks:          slack.Blocks{BlockSet: blocks},
+		PrivateMetadata: strings.Join([]string{issueKey, callback.Channel.ID, getReplyThread(callback.Message.Msg)}, " "),
+	})
+
+	return err
+}
+
+// handleCardModalSubmission comments on or transitions the issue once the
+// user submits a modal from the card menu
+func handleCardModalSubmission(callback slack.InteractionCallback) {
+	metadata := strings.Fields(callback.View.PrivateMetadata)
+	if len(metadata) != 3 || callback.View.State == nil {
+		log.Printf("handleCardModalSubmission: Unexpected view %q", callback.View.PrivateMetadata)
+		return
+	}
+	issueKey := metadata[0]
+	callback.Channel.ID = metadata[1]
+	callback.Message.Timestamp = metadata[2]
+
+	input := callback.View.State.Values[blockCardInput][actionCardInput]
+
+	if err := checkUserAccess(callback.User.ID); err != nil {
+		replyToCardAction(callback, issueKey, err, "", false)
+		return
+	}
+
+	jira, err := getJiraServiceFor(callback.Channel.ID, callback.User.ID)
+	if err != nil {
+		replyToCardAction(callback, issueKey, err, "", false)
+		return
+	}
+
+	switch callback.View.CallbackID {
+	case callbackCardComment:
+		// Interactions only carry the user's ID and handle
+		author := callback.User
+		if user, err := getSlackAPIFor(author.ID).GetUserInfo(author.ID); err == nil && user != nil {
+			author = *user
+		}
+
+		err := addSlackComment(context.Background(), jira, issueKey, author, input.Value)
+		replyToCardAction(callback, issueKey, err, fmt.Sprintf(":speech_balloon: <@%s> commented on %s.", callback.User.ID, issueKey), true)
+
+	case callbackCardTransition:
+		err := transitionJiraIssue(context.Background(), jira, issueKey, input.SelectedOption.Value)
+		replyToCardAction(callback, issueKey, err, fmt.Sprintf(":arrow_right: <@%s> moved %s to %s.", callback.User.ID, issueKey, getTransitionTarget(input.SelectedOption)), true)
+	}
+
+	recordEvent("card_menu", map[string]interface{}{
+		"channel": callback.Channel.ID,
+		"user":    callback.User.ID,
+		"issue":   issueKey,
+		"item":    callback.View.CallbackID,
+	})
+}
+
+// getTransitionTarget reads the status from a transition option's label
+func getTransitionTarget(option slack.OptionBlockObject) string {
+	if option.Text == nil {
+		return "the next status"
+	}
+
+	parts := strings.Split(option.Text.Text, " → ")
+
+	return parts[len(parts)-1]
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestNewCardActions(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	elements := newCardActions("NEW-5").Elements.ElementSet
+	if len(elements) != 2 {
+		t.Fatalf("Expected a button and a menu, got %v", elements)
+	}
+
+	if button := elements[0].(*slack.ButtonBlockElement); button.URL != "https://jira.example.com/browse/NEW-5" {
+		t.Errorf("Expected the button to open the issue, got %q", button.URL)
+	}
+
+	menu := elements[1].(*slack.OverflowBlockElement)
+	if len(menu.Options) > 5 {
+		t.Errorf("Slack allows at most 5 menu items, got %d", len(menu.Options))
+	}
+	for _, option := range menu.Options {
+		if !strings.HasSuffix(option.Value, " NEW-5") {
+			t.Errorf("Expected every item to carry the issue key, got %q", option.Value)
+		}
+	}
+}
+
+func TestGetTransitionTarget(t *testing.T) {
+	option := slack.OptionBlockObject{Text: slack.NewTextBlockObject(slack.PlainTextType, "Start review → In Review", false, false)}
+
+	if target := getTransitionTarget(option); target != "In Review" {
+		t.Errorf("Expected In Review, got %q", target)
+	}
+}
+
+func TestNewCardActionsWithMobileLink(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	os.Setenv("JIRA_MOBILE_LINK", "jira://issue?key={key}")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_MOBILE_LINK")
+
+	elements := newCardActions("NEW-5").Elements.ElementSet
+	if len(elements) != 3 {
+		t.Fatalf("Expected two buttons and a menu, got %v", elements)
+	}
+
+	if button := elements[1].(*slack.ButtonBlockElement); button.URL != "jira://issue?key=NEW-5" {
+		t.Errorf("Expected the second button to open the app, got %q", button.URL)
+	}
+}
+
+func TestAssignAsLinkedUser(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	apiURL := jiraOAuthAPIURL
+	jiraOAuthAPIURL = server.URL
+	defer func() { jiraOAuthAPIURL = apiURL }()
+
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	os.Setenv("JIRA_DEPLOYMENT", "cloud")
+	os.Setenv("JIRA_OAUTH_CLIENT_ID", "client")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+	defer os.Unsetenv("JIRA_OAUTH_CLIENT_ID")
+
+	saveJiraLink("U1", jiraLink{AccountID: "A1", CloudID: "cloud-1", AccessToken: "token", Expiry: time.Now().Add(time.Hour)})
+	defer removeJiraLink("U1")
+
+	if err := assignToSlackUser("C1", "ABC-1", "U1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := watchAsSlackUser("C1", "ABC-1", "U1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := []string{
+		"PUT /ex/jira/cloud-1/rest/api/3/issue/ABC-1/assignee Bearer token",
+		"POST /ex/jira/cloud-1/rest/api/3/issue/ABC-1/watchers Bearer token",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the requests as the linked user, got %v", requests)
+	}
+}
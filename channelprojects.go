@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+const projectsUsage = "Usage: `projects` lists the projects I expand issues of in this channel, `projects add WEB` and `projects remove WEB` change them, `projects reset` goes back to the configured ones."
+
+// Key of the project filters set by command in the state store
+const channelProjectsStateKey = "channel_projects"
+
+func init() {
+	registerStateKind(channelProjectsStateKey, loadChannelProjects)
+}
+
+// Projects channels expand issues of, set with the projects command. They
+// replace the configured filter of the channel. An empty list allows every
+// project.
+var channelProjects = struct {
+	sync.Mutex
+	channels map[string][]string
+}{channels: map[string][]string{}}
+
+// getChannelProjects returns the projects a channel expands issues of, or an
+// empty list for all of them
+func getChannelProjects(channel string) []string {
+	channelProjects.Lock()
+	refreshSharedChannelProjects()
+	projects, ok := channelProjects.channels[channel]
+	channelProjects.Unlock()
+	if ok {
+		return projects
+	}
+
+	return getConfig().ChannelProjects[channel]
+}
+
+// filterChannelProjects drops the issues of projects the channel doesn't
+// expand
+func filterChannelProjects(channel string, issueIDs []string) []string {
+	projects := getChannelProjects(channel)
+	if len(projects) == 0 {
+		return issueIDs
+	}
+
+	result := []string{}
+	for _, issueID := range issueIDs {
+		project := getProjectKey(issueID)
+		for _, p := range projects {
+			if strings.EqualFold(p, project) {
+				result = append(result, issueID)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+func handleProjectsCommand(ctx context.Context, message slack.Msg, args []string) {
+	thread := getReplyThread(message)
+	reply := func(text string) {
+		if err := postText(message.Channel, thread, text); err != nil {
+			log.Printf("handleProjectsCommand: Error: %v", err)
+		}
+	}
+
+	if len(args) == 0 {
+		reply(formatChannelProjects(message.Channel))
+		return
+	}
+
+	action := strings.ToLower(args[0])
+	keys := []string{}
+	for _, key := range args[1:] {
+		keys = append(keys, parseList(strings.ToUpper(key))...)
+	}
+	switch {
+	case action == "reset":
+	case (action == "add" || action == "remove") && len(keys) > 0:
+	default:
+		reply(projectsUsage)
+		return
+	}
+
+	if err := updateChannelProjects(message.Channel, action, keys); err != nil {
+		log.Printf("handleProjectsCommand: Error: %v", err)
+		reply(":warning: I couldn't save that, try again.")
+		return
+	}
+
+	recordEvent("channel_projects", map[string]interface{}{
+		"channel":  message.Channel,
+		"user":     message.User,
+		"action":   action,
+		"projects": keys,
+	})
+	reply(formatChannelProjects(message.Channel))
+}
+
+func formatChannelProjects(channel string) string {
+	projects := getChannelProjects(channel)
+	if len(projects) == 0 {
+		return "I expand issues of every project in this channel."
+	}
+
+	return "I only expand issues of " + strings.Join(projects, ", ") + " in this channel."
+}
+
+// updateChannelProjects adds or removes projects of a channel's filter,
+// starting from the configured one, or drops the filter set by command
+func updateChannelProjects(channel string, action string, keys []string) error {
+	defer lockSharedState(channelProjectsStateKey)()
+	channelProjects.Lock()
+	defer channelProjects.Unlock()
+	refreshSharedChannelProjects()
+
+	if action == "reset" {
+		delete(channelProjects.channels, channel)
+		return saveChannelProjects()
+	}
+
+	projects, ok := channelProjects.channels[channel]
+	if !ok {
+		projects = getConfig().ChannelProjects[channel]
+	}
+
+	kept := map[string]bool{}
+	for _, project := range projects {
+		kept[strings.ToUpper(project)] = true
+	}
+	for _, key := range keys {
+		kept[key] = action == "add"
+	}
+
+	updated := []string{}
+	for project, keep := range kept {
+		if keep {
+			updated = append(updated, project)
+		}
+	}
+	sort.Strings(updated)
+	channelProjects.channels[channel] = updated
+
+	return saveChannelProjects()
+}
+
+// parseChannelProjects reads filters in the form "C123=WEB,UX;C456=OPS"
+func parseChannelProjects(value string) map[string][]string {
+	filters := map[string][]string{}
+
+	for _, entry := range strings.Split(value, ";") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if parts[0] == "" {
+			continue
+		}
+		if len(parts) != 2 {
+			log.Printf("parseChannelProjects: Ignoring %q without projects", entry)
+			continue
+		}
+
+		filters[parts[0]] = parseList(strings.ToUpper(parts[1]))
+	}
+
+	return filters
+}
+
+// loadChannelProjects restores the filters set by command
+func loadChannelProjects() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadChannelProjects: Error: %v", err)
+		return
+	}
+
+	channels := map[string][]string{}
+	if ok, err := store.Load(channelProjectsStateKey, &channels); err != nil || !ok {
+		if err != nil {
+			log.Printf("loadChannelProjects: Error: %v", err)
+		}
+		return
+	}
+
+	channelProjects.Lock()
+	channelProjects.channels = channels
+	channelProjects.Unlock()
+}
+
+// refreshSharedChannelProjects reads the filters again, as other replicas may
+// have changed them. The caller holds the lock of channelProjects.
+func refreshSharedChannelProjects() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedChannelProjects: Error: %v", err)
+		return
+	}
+
+	channels := map[string][]string{}
+	if _, err := store.Load(channelProjectsStateKey, &channels); err != nil {
+		log.Printf("refreshSharedChannelProjects: Error: %v", err)
+		return
+	}
+
+	channelProjects.channels = channels
+}
+
+// saveChannelProjects writes the filters to the state store. The caller holds
+// the lock of channelProjects.
+func saveChannelProjects() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(channelProjectsStateKey, channelProjects.channels)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestChannelProjects(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "data")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DATA_DIR", dir)
+	os.Setenv("CHANNEL_PROJECTS", "C1=web,UX; C2=OPS")
+	defer os.Unsetenv("DATA_DIR")
+	defer os.Unsetenv("CHANNEL_PROJECTS")
+	defer func() {
+		channelProjects.Lock()
+		channelProjects.channels = map[string][]string{}
+		channelProjects.Unlock()
+	}()
+
+	issueIDs := []string{"WEB-1", "UX-2", "OPS-3"}
+	if filtered := filterChannelProjects("C1", issueIDs); !reflect.DeepEqual(filtered, []string{"WEB-1", "UX-2"}) {
+		t.Errorf("Expected the configured projects, got %v", filtered)
+	}
+	if filtered := filterChannelProjects("C3", issueIDs); !reflect.DeepEqual(filtered, issueIDs) {
+		t.Errorf("Expected every project in other channels, got %v", filtered)
+	}
+
+	if err := updateChannelProjects("C1", "add", []string{"OPS"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	updateChannelProjects("C1", "remove", []string{"UX"})
+	updateChannelProjects("C2", "remove", []string{"OPS"})
+
+	// As after a restart
+	channelProjects.Lock()
+	channelProjects.channels = map[string][]string{}
+	channelProjects.Unlock()
+	loadChannelProjects()
+
+	if filtered := filterChannelProjects("C1", issueIDs); !reflect.DeepEqual(filtered, []string{"WEB-1", "OPS-3"}) {
+		t.Errorf("Expected the changed projects to survive restarts, got %v", filtered)
+	}
+	if filtered := filterChannelProjects("C2", issueIDs); !reflect.DeepEqual(filtered, issueIDs) {
+		t.Errorf("Expected removing every project to allow all of them, got %v", filtered)
+	}
+
+	updateChannelProjects("C1", "reset", nil)
+	if projects := getChannelProjects("C1"); !reflect.DeepEqual(projects, []string{"WEB", "UX"}) {
+		t.Errorf("Expected the configured projects after a reset, got %v", projects)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// Default channel policies, whether the bot expands issues in channels no
+// list or command decided on
+const (
+	channelPolicyAllow = "allow"
+	channelPolicyDeny  = "deny"
+)
+
+const enableUsage = "Usage: `enable here` lets me expand issues in this channel, `disable here` stops me."
+
+// Key of the channels enabled or disabled by command in the state store
+const channelEnablementStateKey = "channel_enablement"
+
+func init() {
+	registerStateKind(channelEnablementStateKey, loadChannelEnablement)
+}
+
+// Channels enabled (true) or disabled (false) with `enable here` and
+// `disable here`, which win over the configured lists, and the names of
+// channels looked up to match the lists
+var channelEnablement = struct {
+	sync.Mutex
+	channels map[string]bool
+	names    map[string]string
+}{channels: map[string]bool{}, names: map[string]string{}}
+
+// isChannelEnabled reports whether the bot expands issues mentioned in a
+// channel. Direct messages always are, as people ask for them.
+func isChannelEnabled(channel string) bool {
+	if strings.HasPrefix(channel, "D") {
+		return true
+	}
+
+	channelEnablement.Lock()
+	refreshSharedChannelEnablement()
+	enabled, ok := channelEnablement.channels[channel]
+	channelEnablement.Unlock()
+	if ok {
+		return enabled
+	}
+
+	config := getConfig()
+	if len(config.DeniedChannels) == 0 && len(config.AllowedChannels) == 0 {
+		return config.ChannelPolicy != channelPolicyDeny
+	}
+
+	name := getChannelName(channel)
+	if matchChannel(config.DeniedChannels, channel, name) {
+		return false
+	}
+	if matchChannel(config.AllowedChannels, channel, name) {
+		return true
+	}
+
+	return config.ChannelPolicy != channelPolicyDeny
+}
+
+// matchChannel reports whether a pattern like "social-*" or "C123" matches
+// the ID or name of a channel
+func matchChannel(patterns []string, channel string, name string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(pattern, "#")
+		if ok, _ := path.Match(pattern, channel); ok {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(pattern), name); name != "" && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getChannelName returns the name of a channel, or "" if it can't be looked
+// up. Names are kept, as every message would look them up otherwise.
+func getChannelName(channel string) string {
+	channelEnablement.Lock()
+	name, ok := channelEnablement.names[channel]
+	channelEnablement.Unlock()
+	if ok {
+		return name
+	}
+
+	info, err := getChannel(channel)
+	if err != nil || info == nil {
+		log.Printf("getChannelName: Error looking up %s: %v", channel, err)
+		return ""
+	}
+
+	channelEnablement.Lock()
+	channelEnablement.names[channel] = strings.ToLower(info.Name)
+	channelEnablement.Unlock()
+
+	return strings.ToLower(info.Name)
+}
+
+func handleEnableCommand(ctx context.Context, message slack.Msg, args []string) {
+	setChannelEnabledByCommand(message, args, true)
+}
+
+func handleDisableCommand(ctx context.Context, message slack.Msg, args []string) {
+	setChannelEnabledByCommand(message, args, false)
+}
+
+func setChannelEnabledByCommand(message slack.Msg, args []string, enabled bool) {
+	thread := getReplyThread(message)
+	reply := func(text string) {
+		if err := postText(message.Channel, thread, text); err != nil {
+			log.Printf("setChannelEnabledByCommand: Error: %v", err)
+		}
+	}
+
+	if len(args) != 1 || strings.ToLower(args[0]) != "here" {
+		reply(enableUsage)
+		return
+	}
+
+	if err := setChannelEnabled(message.Channel, enabled); err != nil {
+		log.Printf("setChannelEnabledByCommand: Error: %v", err)
+		reply(":warning: I couldn't save that, try again.")
+		return
+	}
+
+	recordEvent("channel_enablement", map[string]interface{}{
+		"channel": message.Channel,
+		"user":    message.User,
+		"enabled": enabled,
+	})
+	if enabled {
+		reply(":white_check_mark: I'll expand issues mentioned in this channel.")
+	} else {
+		reply(":zipper_mouth_face: I'll stop expanding issues in this channel. Say `@JiraBot enable here` to bring me back.")
+	}
+}
+
+// setChannelEnabled enables or disables a channel regardless of the
+// configured lists
+func setChannelEnabled(channel string, enabled bool) error {
+	defer lockSharedState(channelEnablementStateKey)()
+	channelEnablement.Lock()
+	defer channelEnablement.Unlock()
+	refreshSharedChannelEnablement()
+
+	channelEnablement.channels[channel] = enabled
+
+	return saveChannelEnablement()
+}
+
+// loadChannelEnablement restores the channels enabled or disabled by command
+func loadChannelEnablement() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadChannelEnablement: Error: %v", err)
+		return
+	}
+
+	channels := map[string]bool{}
+	if ok, err := store.Load(channelEnablementStateKey, &channels); err != nil || !ok {
+		if err != nil {
+			log.Printf("loadChannelEnablement: Error: %v", err)
+		}
+		return
+	}
+
+	channelEnablement.Lock()
+	channelEnablement.channels = channels
+	channelEnablement.Unlock()
+
+	log.Printf("loadChannelEnablement: %d channels were enabled or disabled", len(channels))
+}
+
+// refreshSharedChannelEnablement reads the channels again, as other replicas
+// may have changed them. The caller holds the lock of channelEnablement.
+func refreshSharedChannelEnablement() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedChannelEnablement: Error: %v", err)
+		return
+	}
+
+	channels := map[string]bool{}
+	if _, err := store.Load(channelEnablementStateKey, &channels); err != nil {
+		log.Printf("refreshSharedChannelEnablement: Error: %v", err)
+		return
+	}
+
+	channelEnablement.channels = channels
+}
+
+// saveChannelEnablement writes the channels to the state store. The caller
+// holds the lock of channelEnablement.
+func saveChannelEnablement() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(channelEnablementStateKey, channelEnablement.channels)
+}
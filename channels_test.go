@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestIsChannelEnabled(t *testing.T) {
+	os.Setenv("ALLOWED_CHANNELS", "eng-*,C9")
+	os.Setenv("DENIED_CHANNELS", "#random,social-*,eng-secret")
+	defer os.Unsetenv("ALLOWED_CHANNELS")
+	defer os.Unsetenv("DENIED_CHANNELS")
+	defer os.Unsetenv("CHANNEL_POLICY")
+
+	channelEnablement.Lock()
+	channelEnablement.names = map[string]string{"C1": "random", "C2": "social-pets", "C3": "eng-web", "C4": "eng-secret", "C5": "general", "C9": "exec"}
+	channelEnablement.Unlock()
+	defer func() {
+		channelEnablement.Lock()
+		channelEnablement.names = map[string]string{}
+		channelEnablement.Unlock()
+	}()
+
+	for channel, expected := range map[string]bool{"C1": false, "C2": false, "C3": true, "C4": false, "C5": true, "C9": true, "D1": true} {
+		if enabled := isChannelEnabled(channel); enabled != expected {
+			t.Errorf("Expected %s to be enabled %v, got %v", channel, expected, enabled)
+		}
+	}
+
+	os.Setenv("CHANNEL_POLICY", "deny")
+	if isChannelEnabled("C5") || !isChannelEnabled("C3") || !isChannelEnabled("D1") {
+		t.Error("Expected only listed channels and direct messages with the deny policy")
+	}
+}
+
+func TestSetChannelEnabled(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "data")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DATA_DIR", dir)
+	os.Setenv("DENIED_CHANNELS", "C1")
+	defer os.Unsetenv("DATA_DIR")
+	defer os.Unsetenv("DENIED_CHANNELS")
+	defer func() {
+		channelEnablement.Lock()
+		channelEnablement.channels = map[string]bool{}
+		channelEnablement.Unlock()
+	}()
+
+	if err := setChannelEnabled("C1", true); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	setChannelEnabled("C2", false)
+
+	// As after a restart
+	channelEnablement.Lock()
+	channelEnablement.channels = map[string]bool{}
+	channelEnablement.Unlock()
+	loadChannelEnablement()
+
+	if !isChannelEnabled("C1") || isChannelEnabled("C2") {
+		t.Error("Expected the commands to win over the lists and survive restarts")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Events buffered for ClickHouse before new ones are dropped
+const clickHouseBufferSize = 10000
+
+// Most events sent to ClickHouse in one insert, and how long they may wait
+const (
+	clickHouseBatchSize     = 500
+	clickHouseFlushInterval = 5 * time.Second
+)
+
+// Inserts and mutations that take longer are given up on, so a hanging server
+// doesn't stall the batches queued behind them
+var clickHouseHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// A row of the ClickHouse events table:
+//
+//	CREATE TABLE jira_bot_events (time DateTime64(3), kind String, data String)
+//	ENGINE = MergeTree ORDER BY (kind, time)
+type clickHouseRow struct {
+	Time string `json:"time"`
+	Kind string `json:"kind"`
+	Data string `json:"data"`
+}
+
+// clickHouseSink streams events to ClickHouse in batches over its HTTP
+// interface.
+type clickHouseSink struct {
+	url           string
+	table         string
+	retentionDays int
+	events        chan botEvent
+}
+
+func newClickHouseSink(serverURL string, table string, retentionDays int) *clickHouseSink {
+	sink := &clickHouseSink{
+		url:           serverURL,
+		table:         table,
+		retentionDays: retentionDays,
+		events:        make(chan botEvent, clickHouseBufferSize),
+	}
+	go sink.run()
+
+	return sink
+}
+
+func (s *clickHouseSink) Send(event botEvent) {
+	select {
+	case s.events <- event:
+	default:
+		log.Printf("clickHouseSink: Buffer full, dropping %s event", event.Kind)
+	}
+}
+
+// QueueDepth returns how many events wait for the next insert
+func (s *clickHouseSink) QueueDepth() int {
+	return len(s.events)
+}
+
+func (s *clickHouseSink) run() {
+	batch := []botEvent{}
+	ticker := time.NewTicker(clickHouseFlushInterval)
+
+	for {
+		select {
+		case event := <-s.events:
+			batch = append(batch, event)
+			if len(batch) < clickHouseBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := s.insert(batch); err != nil {
+			log.Printf("clickHouseSink: Error inserting %d events: %v", len(batch), err)
+		}
+		batch = []botEvent{}
+	}
+}
+
+func (s *clickHouseSink) insert(events []botEvent) error {
+	body, err := encodeClickHouseRows(events)
+	if err != nil {
+		return err
+	}
+
+	return s.exec("INSERT INTO "+s.table+" FORMAT JSONEachRow", body)
+}
+
+// Purge deletes events older than the retention. ClickHouse removes the rows
+// in the background.
+func (s *clickHouseSink) Purge(now time.Time) error {
+	if s.retentionDays <= 0 {
+		return nil
+	}
+
+	cutoff := now.UTC().AddDate(0, 0, -s.retentionDays).Format("2006-01-02 15:04:05")
+
+	return s.exec(fmt.Sprintf("ALTER TABLE %s DELETE WHERE time < '%s'", s.table, cutoff), nil)
+}
+
+// PurgeUser deletes the events of a user, as the user ID of events
+func (s *clickHouseSink) PurgeUser(userID string) error {
+	if !slackIDPattern.MatchString(userID) {
+		return fmt.Errorf("invalid user ID %q", userID)
+	}
+
+	return s.exec(fmt.Sprintf("ALTER TABLE %s DELETE WHERE JSONExtractString(data, 'user') = '%s'", s.table, userID), nil)
+}
+
+// exec runs a query, with the body as its data
+func (s *clickHouseSink) exec(query string, body io.Reader) error {
+	if body == nil {
+		body = &bytes.Buffer{}
+	}
+
+	response, err := clickHouseHTTPClient.Post(s.url+"/?"+url.Values{"query": {query}}.Encode(), "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	return nil
+}
+
+func encodeClickHouseRows(events []botEvent) (*bytes.Buffer, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+
+	for _, event := range events {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		row := clickHouseRow{
+			Time: event.Time.Format("2006-01-02 15:04:05.000"),
+			Kind: event.Kind,
+			Data: string(data),
+		}
+		if err := encoder.Encode(row); err != nil {
+			return nil, err
+		}
+	}
+
+	return &body, nil
+}
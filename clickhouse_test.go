@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEncodeClickHouseRows(t *testing.T) {
+	events := []botEvent{{
+		Time: time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC),
+		Kind: "mention",
+		Data: map[string]string{"issue": "ABC-1"},
+	}}
+
+	body, err := encodeClickHouseRows(events)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := `{"time":"2026-10-15 09:30:00.000","kind":"mention","data":"{\"issue\":\"ABC-1\"}"}` + "\n"
+	if body.String() != expected {
+		t.Errorf("Unexpected rows %s", body.String())
+	}
+}
+
+func TestClickHouseSinkInsertsIntoTable(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	sink := &clickHouseSink{url: server.URL, table: "jira_bot_events"}
+	if err := sink.insert([]botEvent{{Kind: "post"}}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if query != "INSERT INTO jira_bot_events FORMAT JSONEachRow" {
+		t.Errorf("Unexpected query %q", query)
+	}
+}
+
+func TestClickHouseSinkPurges(t *testing.T) {
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+	}))
+	defer server.Close()
+
+	sink := &clickHouseSink{url: server.URL, table: "jira_bot_events", retentionDays: 30}
+	if err := sink.Purge(time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := sink.PurgeUser("U024BE7LH"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := sink.PurgeUser("U1' OR 1=1 --"); err == nil {
+		t.Errorf("Expected an invalid user ID to be rejected")
+	}
+
+	expected := []string{
+		"ALTER TABLE jira_bot_events DELETE WHERE time < '2026-09-15 09:30:00'",
+		"ALTER TABLE jira_bot_events DELETE WHERE JSONExtractString(data, 'user') = 'U024BE7LH'",
+	}
+	if len(queries) != 2 || queries[0] != expected[0] || queries[1] != expected[1] {
+		t.Errorf("Unexpected queries %q", queries)
+	}
+}
+
+func TestClickHouseSinkGivesUpOnHangingServer(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	defer func(timeout time.Duration) { clickHouseHTTPClient.Timeout = timeout }(clickHouseHTTPClient.Timeout)
+	clickHouseHTTPClient.Timeout = 50 * time.Millisecond
+
+	sink := &clickHouseSink{url: server.URL, table: "jira_bot_events"}
+	if err := sink.insert([]botEvent{{Kind: "post"}}); err == nil {
+		t.Error("Expected the insert to time out")
+	}
+}
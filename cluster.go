@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/slack-go/slack"
+)
+
+// How often replicas announce themselves, and how long one may stay silent
+// before its channels move to the others
+const (
+	clusterHeartbeatInterval = 5 * time.Second
+	clusterReplicaTTL        = 15 * time.Second
+)
+
+// How long a replica waits for forwarded events per request, in seconds
+const clusterQueueWait = 5
+
+// How long shared state stays locked at most, and how long replicas wait for
+// a lock before going on without it
+const (
+	clusterLockTTL  = 10 * time.Second
+	clusterLockWait = 5 * time.Second
+)
+
+// Releases a lock only if it still belongs to the replica, not to one that
+// took it over after it expired
+var unlockScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// The live replicas as of the last heartbeat
+var cluster = struct {
+	sync.Mutex
+	self    string
+	members []string
+}{}
+
+func isClusterEnabled() bool {
+	return getConfig().Cluster
+}
+
+// getReplicaID names this replica, by default after its host and process
+func getReplicaID() string {
+	if id := getConfig().ReplicaID; id != "" {
+		return id
+	}
+
+	hostname, _ := os.Hostname()
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func getClusterPool() (*redis.Pool, error) {
+	store, err := getStateStore()
+	if err != nil {
+		return nil, err
+	}
+
+	shared, ok := store.(*redisStore)
+	if !ok {
+		return nil, errors.New("clustering needs the redis state store")
+	}
+
+	return shared.pool, nil
+}
+
+// getShardOwner picks the member responsible for a key by rendezvous
+// hashing, so when a member leaves only its keys move to the others
+func getShardOwner(members []string, key string) string {
+	owner, best := "", uint64(0)
+	for _, member := range members {
+		sum := sha256.Sum256([]byte(member + "/" + key))
+		if score := binary.BigEndian.Uint64(sum[:8]); owner == "" || score > best {
+			owner, best = member, score
+		}
+	}
+
+	return owner
+}
+
+// getKeyOwner returns the replica responsible for a key, like a channel ID or
+// an issue key, or "" if this one handles everything
+func getKeyOwner(key string) string {
+	if !isClusterEnabled() {
+		return ""
+	}
+
+	cluster.Lock()
+	defer cluster.Unlock()
+
+	return getShardOwner(cluster.members, key)
+}
+
+// ownsKey reports whether this replica handles the key
+func ownsKey(key string) bool {
+	owner := getKeyOwner(key)
+
+	cluster.Lock()
+	defer cluster.Unlock()
+
+	return owner == "" || owner == cluster.self
+}
+
+// joinCluster announces the replica and starts taking over its share of the
+// work
+func joinCluster() error {
+	pool, err := getClusterPool()
+	if err != nil {
+		return err
+	}
+
+	if err := sendClusterHeartbeat(pool, time.Now()); err != nil {
+		return err
+	}
+
+	go runClusterHeartbeat(pool)
+	go runClusterQueue(pool)
+
+	return nil
+}
+
+func runClusterHeartbeat(pool *redis.Pool) {
+	for now := range time.Tick(clusterHeartbeatInterval) {
+		if err := sendClusterHeartbeat(pool, now); err != nil {
+			log.Printf("runClusterHeartbeat: Error: %v", err)
+		}
+	}
+}
+
+// sendClusterHeartbeat marks the replica alive and updates the live members.
+// Events forwarded to replicas that died are handed out again.
+func sendClusterHeartbeat(pool *redis.Pool, now time.Time) error {
+	self := getReplicaID()
+	key := redisKeyPrefix + "replicas"
+	expired := now.Add(-clusterReplicaTTL).UnixNano()
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("ZADD", key, now.UnixNano(), self); err != nil {
+		return err
+	}
+
+	members, err := redis.Strings(conn.Do("ZRANGEBYSCORE", key, expired, "+inf"))
+	if err != nil {
+		return err
+	}
+	dead, err := redis.Strings(conn.Do("ZRANGEBYSCORE", key, "-inf", fmt.Sprintf("(%d", expired)))
+	if err != nil {
+		return err
+	}
+	sort.Strings(members)
+
+	cluster.Lock()
+	changed := strings.Join(cluster.members, ",") != strings.Join(members, ",")
+	cluster.self = self
+	cluster.members = members
+	cluster.Unlock()
+
+	if changed {
+		log.Printf("sendClusterHeartbeat: Sharing the work with %d replicas: %s", len(members), strings.Join(members, ", "))
+	}
+
+	for _, replica := range dead {
+		requeueMessages(pool, replica)
+		if _, err := conn.Do("ZREM", key, replica); err != nil {
+			log.Printf("sendClusterHeartbeat: Error removing %s: %v", replica, err)
+		}
+	}
+
+	return nil
+}
+
+func getClusterQueueKey(replica string) string {
+	return redisKeyPrefix + "events:" + replica
+}
+
+// dispatchMessage handles a message Slack delivered to this replica, or
+// hands it to the replica its channel belongs to. With Socket Mode and the
+// Events API Slack delivers each event to only one of the replicas.
+func dispatchMessage(message slack.Msg) {
+	if ownsKey(message.Channel) {
+		submitMessage(message)
+		return
+	}
+
+	if err := forwardMessage(getKeyOwner(message.Channel), message); err != nil {
+		log.Printf("dispatchMessage: Error forwarding, handling the message here: %v", err)
+		submitMessage(message)
+	}
+}
+
+func forwardMessage(replica string, message slack.Msg) error {
+	pool, err := getClusterPool()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	_, err = conn.Do("RPUSH", getClusterQueueKey(replica), data)
+
+	return err
+}
+
+// runClusterQueue handles the messages other replicas forwarded to this one
+func runClusterQueue(pool *redis.Pool) {
+	key := getClusterQueueKey(getReplicaID())
+
+	for {
+		conn := pool.Get()
+		reply, err := redis.Strings(conn.Do("BLPOP", key, clusterQueueWait))
+		conn.Close()
+
+		if err == redis.ErrNil {
+			continue
+		}
+		if err != nil || len(reply) != 2 {
+			log.Printf("runClusterQueue: Error: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		var message slack.Msg
+		if err := json.Unmarshal([]byte(reply[1]), &message); err != nil {
+			log.Printf("runClusterQueue: Error decoding message: %v", err)
+			continue
+		}
+
+		submitMessage(message)
+	}
+}
+
+// requeueMessages dispatches the messages a dead replica didn't get to again.
+// Every replica may notice the death, but each message is popped once.
+func requeueMessages(pool *redis.Pool, replica string) {
+	conn := pool.Get()
+	defer conn.Close()
+
+	count := 0
+	for {
+		data, err := redis.Bytes(conn.Do("LPOP", getClusterQueueKey(replica)))
+		if err != nil {
+			if err != redis.ErrNil {
+				log.Printf("requeueMessages: Error: %v", err)
+			}
+			break
+		}
+
+		var message slack.Msg
+		if err := json.Unmarshal(data, &message); err == nil {
+			go dispatchMessage(message)
+			count++
+		}
+	}
+
+	if count > 0 {
+		log.Printf("requeueMessages: Took over %d messages of %s", count, replica)
+	}
+}
+
+// lockSharedState keeps other replicas from changing the state under the key
+// until the returned function is called. Without a cluster there are none.
+func lockSharedState(key string) func() {
+	if !isClusterEnabled() {
+		return func() {}
+	}
+
+	pool, err := getClusterPool()
+	if err != nil {
+		log.Printf("lockSharedState: Error: %v", err)
+		return func() {}
+	}
+
+	lockKey := redisKeyPrefix + "locks:" + key
+	token := getReplicaID() + "/" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	deadline := time.Now().Add(clusterLockWait)
+
+	for {
+		conn := pool.Get()
+		_, err := redis.String(conn.Do("SET", lockKey, token, "NX", "PX", int64(clusterLockTTL/time.Millisecond)))
+		conn.Close()
+
+		if err == nil {
+			break
+		}
+		if err != redis.ErrNil {
+			log.Printf("lockSharedState: Going on without the lock of %s: %v", key, err)
+			return func() {}
+		}
+		if time.Now().After(deadline) {
+			log.Printf("lockSharedState: Timed out, going on without the lock of %s", key)
+			return func() {}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return func() {
+		conn := pool.Get()
+		defer conn.Close()
+
+		if _, err := unlockScript.Do(conn, lockKey, token); err != nil {
+			log.Printf("lockSharedState: Error unlocking %s: %v", key, err)
+		}
+	}
+}
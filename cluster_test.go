@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGetShardOwnerRebalances(t *testing.T) {
+	members := []string{"bot-a", "bot-b", "bot-c"}
+
+	owners := map[string]string{}
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		channel := fmt.Sprintf("C%04d", i)
+		owners[channel] = getShardOwner(members, channel)
+		counts[owners[channel]]++
+	}
+	for _, member := range members {
+		if counts[member] < 50 {
+			t.Errorf("Expected the channels to be spread, got %v", counts)
+		}
+	}
+
+	// bot-b dies, only its channels move
+	for channel, owner := range owners {
+		moved := getShardOwner([]string{"bot-a", "bot-c"}, channel)
+		if owner != "bot-b" && moved != owner {
+			t.Errorf("Expected %s to stay with %s, moved to %s", channel, owner, moved)
+		}
+		if moved == "bot-b" {
+			t.Errorf("Expected %s to leave the dead replica", channel)
+		}
+	}
+
+	if owner := getShardOwner(nil, "C1"); owner != "" {
+		t.Errorf("Expected no owner without members, got %q", owner)
+	}
+}
+
+func TestOwnsKeyWithoutCluster(t *testing.T) {
+	cluster.Lock()
+	cluster.self, cluster.members = "bot-a", []string{"bot-a", "bot-b"}
+	cluster.Unlock()
+	defer func() {
+		cluster.Lock()
+		cluster.self, cluster.members = "", nil
+		cluster.Unlock()
+	}()
+
+	for i := 0; i < 20; i++ {
+		if !ownsKey(fmt.Sprintf("C%d", i)) {
+			t.Fatal("Expected a single bot to handle every channel")
+		}
+	}
+
+	os.Setenv("CLUSTER", "true")
+	defer os.Unsetenv("CLUSTER")
+
+	owned := 0
+	for i := 0; i < 20; i++ {
+		if ownsKey(fmt.Sprintf("C%d", i)) {
+			owned++
+		}
+	}
+	if owned == 0 || owned == 20 {
+		t.Errorf("Expected the replicas to share the channels, this one owns %d of 20", owned)
+	}
+}
+
+func TestValidateClusterNeedsRedis(t *testing.T) {
+	config := BotConfig{SlackAPIKey: "xoxb-1", JiraBaseURL: "https://example.atlassian.net", ClickHouseTable: "jira_bot_events", Cluster: true}
+
+	if problems := validateConfig(config); len(problems) != 1 || !strings.Contains(problems[0].Error(), "CLUSTER") {
+		t.Errorf("Expected the missing redis store to be reported, got %v", problems)
+	}
+
+	config.StateStore = "redis"
+	config.RedisURL = "redis://localhost:6379"
+	if problems := validateConfig(config); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// An issue fetch in progress, shared by everyone asking for the same issue
+type issueCall struct {
+	done  chan struct{}
+	issue jiraIssue
+	err   error
+}
+
+var issueCalls = struct {
+	sync.Mutex
+	calls map[string]*issueCall
+}{calls: map[string]*issueCall{}}
+
+// coalesceIssueFetch runs fetch once for all concurrent callers asking for
+// the same issue, and hands each of them the same result. The fetch has its
+// own timeout, as it mustn't fail for everyone when the caller who started
+// it gives up. Callers stop waiting once their ctx is done.
+func coalesceIssueFetch(ctx context.Context, issueID string, fetch func(context.Context) (jiraIssue, error)) (jiraIssue, error) {
+	issueCalls.Lock()
+	call, ok := issueCalls.calls[issueID]
+	if !ok {
+		call = &issueCall{done: make(chan struct{})}
+		issueCalls.calls[issueID] = call
+		go runIssueCall(issueID, call, fetch)
+	}
+	issueCalls.Unlock()
+
+	select {
+	case <-call.done:
+		return call.issue, call.err
+	case <-ctx.Done():
+		return jiraIssue{}, ctx.Err()
+	}
+}
+
+// runIssueCall fetches the issue for the waiting callers. A panic in fetch
+// is handed to them as an error, so none of them waits forever.
+func runIssueCall(issueID string, call *issueCall, fetch func(context.Context) (jiraIssue, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), getConfig().MessageTimeout)
+	defer cancel()
+
+	defer func() {
+		if e := recover(); e != nil {
+			call.err = fmt.Errorf("fetching %s: %v", issueID, e)
+		}
+
+		issueCalls.Lock()
+		delete(issueCalls.calls, issueID)
+		issueCalls.Unlock()
+		close(call.done)
+	}()
+
+	call.issue, call.err = fetch(ctx)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceIssueFetchSharesConcurrentRequests(t *testing.T) {
+	var fetches int32
+
+	fetch := func(ctx context.Context) (jiraIssue, error) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(100 * time.Millisecond)
+
+		return jiraIssue{Key: "ABC-1"}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]jiraIssue, 5)
+
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = coalesceIssueFetch(context.Background(), "ABC-1", fetch)
+		}(i)
+	}
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("Expected one fetch, got %v", fetches)
+	}
+
+	for i, result := range results {
+		if result.Key != "ABC-1" {
+			t.Errorf("Expected result %v to be ABC-1, got %v", i, result.Key)
+		}
+	}
+}
+
+func TestCoalesceIssueFetchSurvivesPanics(t *testing.T) {
+	_, err := coalesceIssueFetch(context.Background(), "ABC-2", func(ctx context.Context) (jiraIssue, error) {
+		panic("missing field")
+	})
+	if err == nil {
+		t.Error("Expected the panic to be an error")
+	}
+
+	issue, err := coalesceIssueFetch(context.Background(), "ABC-2", func(ctx context.Context) (jiraIssue, error) {
+		return jiraIssue{Key: "ABC-2"}, nil
+	})
+	if err != nil || issue.Key != "ABC-2" {
+		t.Errorf("Expected later fetches to work, got %+v, %v", issue, err)
+	}
+}
+
+func TestCoalesceIssueFetchOutlivesCancelledCaller(t *testing.T) {
+	release := make(chan bool)
+	fetch := func(ctx context.Context) (jiraIssue, error) {
+		<-release
+		return jiraIssue{Key: "ABC-3"}, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := coalesceIssueFetch(ctx, "ABC-3", fetch)
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	second := make(chan jiraIssue)
+	go func() {
+		issue, _ := coalesceIssueFetch(context.Background(), "ABC-3", fetch)
+		second <- issue
+	}()
+
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("Expected the cancelled caller to give up, got %v", err)
+	}
+
+	close(release)
+	if issue := <-second; issue.Key != "ABC-3" {
+		t.Errorf("Expected the other caller to get the issue, got %+v", issue)
+	}
+}
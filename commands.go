@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// A command addressed to the bot, e.g. "@JiraBot context ABC-123"
+type botCommand struct {
+	Name string
+	Args []string
+}
+
+// Handlers of the commands the bot understands, by command name
+var botCommandHandlers = map[string]func(ctx context.Context, message slack.Msg, args []string){
+	"accessible": handleAccessibleCommand,
+	"announce":   handleAnnounceCommand,
+	"backup":     handleBackupCommand,
+	"comment":    handleCommentCommand,
+	"context":    handleContextCommand,
+	"create":     handleCreateCommand,
+	"customer":   handleCustomerCommand,
+	"disable":    handleDisableCommand,
+	"enable":     handleEnableCommand,
+	"errors":     handleErrorsCommand,
+	"link":       handleLinkCommand,
+	"projects":   handleProjectsCommand,
+	"purge":      handlePurgeCommand,
+	"restore":    handleRestoreCommand,
+	"snapshot":   handleSnapshotCommand,
+	"transition": handleTransitionCommand,
+	"unlink":     handleUnlinkCommand,
+	"unwatch":    handleUnwatchCommand,
+	"watch":      handleWatchCommand,
+}
+
+// handleBotCommand runs the command in a message that starts with a mention
+// of the bot. It reports whether the message was a known command.
+func handleBotCommand(ctx context.Context, message slack.Msg) bool {
+	identity, err := getSlackIdentity(message.Channel)
+	if err != nil {
+		log.Printf("handleBotCommand: Error getting the bot identity: %v", err)
+		return false
+	}
+
+	command, ok := parseBotCommand(message.Text, identity.UserID)
+	if !ok {
+		return false
+	}
+
+	handler, ok := botCommandHandlers[command.Name]
+	if !ok {
+		return false
+	}
+
+	log.Printf("handleBotCommand: Running %s", command.Name)
+	recordEvent("command", map[string]interface{}{
+		"channel":   message.Channel,
+		"user":      message.User,
+		"timestamp": message.Timestamp,
+		"command":   command.Name,
+		"args":      command.Args,
+	})
+	handler(ctx, message, command.Args)
+
+	return true
+}
+
+// parseBotCommand reads the command from a message starting with a mention
+// of the bot, like "<@U024BE7LH> context ABC-123".
+func parseBotCommand(text string, botUserID string) (botCommand, bool) {
+	text = strings.TrimSpace(text)
+
+	if botUserID == "" || !strings.HasPrefix(text, "<@"+botUserID) {
+		return botCommand{}, false
+	}
+
+	// Mentions may come as <@U024BE7LH> or <@U024BE7LH|jirabot>
+	end := strings.Index(text, ">")
+	if end < 0 {
+		return botCommand{}, false
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(text[end+1:], ":"))
+	if len(fields) == 0 {
+		return botCommand{}, false
+	}
+
+	return botCommand{Name: strings.ToLower(fields[0]), Args: fields[1:]}, true
+}
+
+// getCommandText returns what follows the command's name in a message
+// starting with a mention of the bot, keeping its line breaks
+func getCommandText(text string) string {
+	text = strings.TrimSpace(text)
+
+	end := strings.Index(text, ">")
+	if !strings.HasPrefix(text, "<@") || end < 0 {
+		return ""
+	}
+
+	text = strings.TrimLeft(strings.TrimPrefix(text[end+1:], ":"), " \t\n")
+	if end := strings.IndexAny(text, " \t\n"); end >= 0 {
+		return strings.TrimSpace(text[end:])
+	}
+
+	return ""
+}
+
+// getReplyThread is the thread replies to the message belong in
+func getReplyThread(message slack.Msg) string {
+	if message.ThreadTimestamp != "" {
+		return message.ThreadTimestamp
+	}
+
+	return message.Timestamp
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBotCommand(t *testing.T) {
+	command, ok := parseBotCommand("<@U024BE7LH>: Context abc-123", "U024BE7LH")
+
+	if !ok {
+		t.Fatalf("Expected a command")
+	}
+
+	if command.Name != "context" || !reflect.DeepEqual(command.Args, []string{"abc-123"}) {
+		t.Errorf("Unexpected command %v", command)
+	}
+}
+
+func TestParseBotCommandWithNamedMention(t *testing.T) {
+	command, ok := parseBotCommand("<@U024BE7LH|jirabot> context ABC-1", "U024BE7LH")
+
+	if !ok || command.Name != "context" {
+		t.Errorf("Expected context command, got %v", command)
+	}
+}
+
+func TestParseBotCommandIgnoresOtherMessages(t *testing.T) {
+	for _, text := range []string{"context ABC-1", "<@U999> context ABC-1", "<@U024BE7LH>", "hey <@U024BE7LH> context"} {
+		if _, ok := parseBotCommand(text, "U024BE7LH"); ok {
+			t.Errorf("Expected %q not to be a command", text)
+		}
+	}
+}
+
+func TestGetCommandText(t *testing.T) {
+	text := getCommandText("<@U024BE7LH>: comment Fixed on staging.\n\nDeploying tomorrow.")
+
+	if text != "Fixed on staging.\n\nDeploying tomorrow." {
+		t.Errorf("Unexpected text %q", text)
+	}
+
+	if text := getCommandText("<@U024BE7LH> comment"); text != "" {
+		t.Errorf("Expected no text, got %q", text)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+const commentUsage = "Reply with `@JiraBot comment <text>` in the thread of an issue I posted to add the text as a comment in Jira."
+
+// Replies of a thread looked at to find the issue it is about
+const maxThreadReplies = 200
+
+// Links, mentions and channels in Slack's message markup
+var slackMarkup = regexp.MustCompile(`<([^>|]+)(?:\|([^>]*))?>`)
+
+// handleCommentCommand adds "@JiraBot comment <text>" replies in the thread of
+// an issue the bot posted as comments on the issue
+func handleCommentCommand(ctx context.Context, message slack.Msg, args []string) {
+	if message.ThreadTimestamp == "" {
+		postEphemeral(message.Channel, message.User, commentUsage)
+		return
+	}
+
+	issueKeys, err := getThreadIssues(message.Channel, message.ThreadTimestamp)
+	if err != nil {
+		log.Printf("handleCommentCommand: Error reading the thread: %v", err)
+		postEphemeral(message.Channel, message.User, ":warning: I couldn't read this thread to find its issue.")
+		return
+	}
+
+	text := getCommandText(message.Text)
+
+	// Threads with several issues need the key of one of them
+	issueKey := ""
+	switch {
+	case len(issueKeys) == 1:
+		issueKey = issueKeys[0]
+	case len(issueKeys) > 1 && len(args) > 0:
+		for _, key := range issueKeys {
+			if strings.EqualFold(args[0], key) {
+				issueKey = key
+				text = strings.TrimSpace(text[len(args[0]):])
+			}
+		}
+	}
+
+	if issueKey == "" {
+		reply := commentUsage
+		if len(issueKeys) > 1 {
+			reply = fmt.Sprintf("This thread has several issues. Name one, like `@JiraBot comment %s <text>`.", issueKeys[0])
+		}
+		postEphemeral(message.Channel, message.User, reply)
+		return
+	}
+
+	if strings.TrimSpace(text) == "" {
+		postEphemeral(message.Channel, message.User, commentUsage)
+		return
+	}
+
+	if err := checkUserAccess(message.User); err != nil {
+		postEphemeral(message.Channel, message.User, describeCardActionError(err, issueKey))
+		return
+	}
+
+	author := slack.User{ID: message.User}
+	if user, err := getSlackAPIFor(message.User).GetUserInfo(message.User); err == nil && user != nil {
+		author = *user
+	}
+
+	jira, err := getJiraServiceFor(message.Channel, message.User)
+	if err == nil {
+		err = addSlackComment(ctx, jira, issueKey, author, formatSlackMarkup(text))
+	}
+	if err != nil {
+		reportError(message, issueKey, err, false)
+		postEphemeral(message.Channel, message.User, describeCardActionError(err, issueKey))
+		return
+	}
+
+	recordEvent("comment", map[string]interface{}{
+		"channel":   message.Channel,
+		"user":      message.User,
+		"timestamp": message.Timestamp,
+		"issue":     issueKey,
+	})
+
+	if err := getSlackAPIFor(message.Channel).AddReaction("speech_balloon", slack.NewRefToMessage(message.Channel, message.Timestamp)); err != nil {
+		log.Printf("handleCommentCommand: Error confirming the comment on %s: %v", issueKey, err)
+	}
+}
+
+// getThreadIssues returns the issues the bot posted in a thread, by the first
+// key in each of its messages
+func getThreadIssues(channel string, thread string) ([]string, error) {
+	identity, err := getSlackIdentity(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, _, _, err := getSlackAPIFor(channel).GetConversationReplies(&slack.GetConversationRepliesParameters{
+		ChannelID: channel,
+		Timestamp: thread,
+		Limit:     maxThreadReplies,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	posts := []slack.Msg{}
+	for _, message := range messages {
+		if isBotPost(message.Msg, identity) {
+			posts = append(posts, message.Msg)
+		}
+	}
+
+	return getPostedIssues(posts), nil
+}
+
+func isBotPost(message slack.Msg, identity *slack.AuthTestResponse) bool {
+	return (identity.BotID != "" && message.BotID == identity.BotID) ||
+		(identity.UserID != "" && message.User == identity.UserID)
+}
+
+// getPostedIssues returns the issue each message is about, once
+func getPostedIssues(posts []slack.Msg) []string {
+	seen := map[string]bool{}
+	result := []string{}
+
+	for _, post := range posts {
+		issueIDs := extractIssueIDs(post.Text)
+		if len(issueIDs) > 0 && !seen[issueIDs[0]] {
+			seen[issueIDs[0]] = true
+			result = append(result, issueIDs[0])
+		}
+	}
+
+	return result
+}
+
+// formatSlackMarkup turns Slack's markup into plain text for Jira. Links keep
+// their target and mentions become names.
+func formatSlackMarkup(text string) string {
+	text = slackMarkup.ReplaceAllStringFunc(text, func(match string) string {
+		parts := slackMarkup.FindStringSubmatch(match)
+		target, label := parts[1], parts[2]
+
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if label != "" {
+				return "@" + label
+			}
+			if user, err := getSlackAPIFor(target[1:]).GetUserInfo(target[1:]); err == nil && user != nil {
+				return "@" + user.Name
+			}
+			return target
+		case strings.HasPrefix(target, "#"):
+			if label != "" {
+				return "#" + label
+			}
+			return target
+		case strings.HasPrefix(target, "!"):
+			// Special mentions like <!here> or <!subteam^S1|@team>
+			if label != "" {
+				return label
+			}
+			return "@" + strings.TrimPrefix(target, "!")
+		case label != "" && label != target:
+			return label + " (" + target + ")"
+		}
+
+		return target
+	})
+
+	return slackUnescaper.Replace(text)
+}
+
+// addSlackComment comments on the issue as the bot, naming the Slack user who
+// wrote the comment
+func addSlackComment(ctx context.Context, jira JiraService, issueKey string, author slack.User, text string) error {
+	if err := checkWritable(); err != nil {
+		return err
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("empty comment for %s", issueKey)
+	}
+
+	return jira.AddComment(ctx, issueKey, newJiraBody(issueKey, formatSlackComment(author, text)))
+}
+
+// formatSlackComment attributes a comment to its Slack author
+func formatSlackComment(author slack.User, text string) string {
+	name := author.RealName
+	if name == "" {
+		name = author.Name
+	}
+	if name == "" {
+		name = author.ID
+	}
+
+	return fmt.Sprintf("%s\n\n— %s, via Slack", text, name)
+}
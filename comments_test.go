@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestFormatSlackComment(t *testing.T) {
+	author := slack.User{ID: "U1", Name: "jane", RealName: "Jane Doe"}
+
+	if text := formatSlackComment(author, "Fixed on staging"); text != "Fixed on staging\n\n— Jane Doe, via Slack" {
+		t.Errorf("Unexpected comment %q", text)
+	}
+
+	author.RealName = ""
+	if text := formatSlackComment(author, "Fixed"); text != "Fixed\n\n— jane, via Slack" {
+		t.Errorf("Expected the handle without a real name, got %q", text)
+	}
+}
+
+func TestGetPostedIssues(t *testing.T) {
+	issueKeys := getPostedIssues([]slack.Msg{
+		{Text: "> <https://jira.example.com/browse/ABC-1|ABC-1> :traffic_light: *Status:* Open, blocked by DEF-2"},
+		{Text: ":speech_balloon: <@U1> commented on ABC-1."},
+		{Text: "> *XYZ-9* :traffic_light: *Status:* Done"},
+		{Text: "Nothing to see here"},
+	})
+
+	if !reflect.DeepEqual(issueKeys, []string{"ABC-1", "XYZ-9"}) {
+		t.Errorf("Unexpected issues %v", issueKeys)
+	}
+}
+
+func TestIsBotPost(t *testing.T) {
+	identity := &slack.AuthTestResponse{UserID: "UBOT", BotID: "BBOT"}
+
+	if !isBotPost(slack.Msg{BotID: "BBOT"}, identity) || !isBotPost(slack.Msg{User: "UBOT"}, identity) {
+		t.Errorf("Expected the bot's own messages to be its posts")
+	}
+
+	if isBotPost(slack.Msg{User: "U1"}, identity) || isBotPost(slack.Msg{BotID: "BOTHER"}, identity) {
+		t.Errorf("Expected messages of others not to be the bot's posts")
+	}
+}
+
+func TestFormatSlackMarkup(t *testing.T) {
+	text := formatSlackMarkup("See <https://example.com/log|the log> &amp; <https://example.com>, cc <@U1|jane> <!here> in <#C1|ops>")
+
+	if text != "See the log (https://example.com/log) & https://example.com, cc @jane @here in #ops" {
+		t.Errorf("Unexpected text %q", text)
+	}
+}
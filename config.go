@@ -0,0 +1,779 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration for the bot
+type BotConfig struct {
+	Username      string `yaml:"username"`
+	SlackAPIKey   string `yaml:"slack_api_key"`
+	SlackAppToken string `yaml:"slack_app_token"`
+
+	// Address to receive Events API requests on instead of using a
+	// websocket, and the secret they are signed with
+	EventsAPIAddr      string `yaml:"events_api_addr"`
+	SlackSigningSecret string `yaml:"slack_signing_secret"`
+
+	// OAuth app credentials and the listen address of the install flow, to
+	// install the bot to more workspaces than the one of SLACK_API_KEY
+	SlackClientID     string `yaml:"slack_client_id"`
+	SlackClientSecret string `yaml:"slack_client_secret"`
+	SlackRedirectURL  string `yaml:"slack_redirect_url"`
+	SlackInstallAddr  string `yaml:"slack_install_addr"`
+	// IDs of the teams the app may be installed to
+	SlackAllowedTeams []string `yaml:"slack_allowed_teams"`
+
+	JiraUsername string         `yaml:"jira_username"`
+	JiraPassword string         `yaml:"jira_password"`
+	JiraBaseURL  string         `yaml:"jira_base_url"`
+	Freezes      []FreezeWindow `yaml:"freezes"`
+
+	// How the bot signs in to Jira: "basic" with username and password (the
+	// default), "api_token" with the account's email as username and an API
+	// token, or "pat" with a personal access token
+	JiraAuth     string `yaml:"jira_auth"`
+	JiraAPIToken string `yaml:"jira_api_token"`
+	JiraPAT      string `yaml:"jira_pat"`
+
+	// OAuth app users link their Jira Cloud accounts with, so lookups respect
+	// their permissions. The callback is served on the address. Unlinked users
+	// get the bot's view ("service", the default) or are refused ("refuse"),
+	// which the channel lists override per channel.
+	JiraOAuthClientID        string   `yaml:"jira_oauth_client_id"`
+	JiraOAuthClientSecret    string   `yaml:"jira_oauth_client_secret"`
+	JiraOAuthRedirectURL     string   `yaml:"jira_oauth_redirect_url"`
+	JiraOAuthAddr            string   `yaml:"jira_oauth_addr"`
+	JiraOAuthUnlinked        string   `yaml:"jira_oauth_unlinked"`
+	JiraOAuthRefuseChannels  []string `yaml:"jira_oauth_refuse_channels"`
+	JiraOAuthServiceChannels []string `yaml:"jira_oauth_service_channels"`
+
+	// Either "cloud" or "server" (which includes Data Center), guessed from
+	// the base URL if unset
+	JiraDeployment string `yaml:"jira_deployment"`
+
+	// Further Jira servers holding the issues of some projects. Issues of
+	// other projects are on the one above.
+	JiraInstances []JiraInstance `yaml:"jira_instances"`
+
+	// Link opening an issue in Jira's mobile app, with {key} in place of the
+	// issue key
+	JiraMobileLink string `yaml:"jira_mobile_link"`
+
+	// Regular expression for short links to issues, like go/J-1234, which are
+	// followed to find the issue key
+	ShortLinkPattern string `yaml:"short_link_pattern"`
+
+	// Go text/template replacing the default issue card
+	MessageTemplate string `yaml:"message_template"`
+
+	// Template tried out on the canary cohort, which holds the canary
+	// channels and a percentage of expansions elsewhere
+	CanaryTemplate string   `yaml:"canary_template"`
+	CanaryChannels []string `yaml:"canary_channels"`
+	CanaryPercent  int      `yaml:"canary_percent"`
+
+	// Bundled card templates ("formal", "compact" or "emoji-heavy") by
+	// channel, used there instead of the message template
+	CardProfiles map[string]string `yaml:"card_profiles"`
+
+	// Whether cards for mentions go into a thread on the mentioning message,
+	// channels where they always or never do, and whether threaded cards are
+	// also sent to the channel
+	ReplyInThread      bool     `yaml:"reply_in_thread"`
+	ThreadedChannels   []string `yaml:"threaded_channels"`
+	UnthreadedChannels []string `yaml:"unthreaded_channels"`
+	ReplyBroadcast     bool     `yaml:"reply_broadcast"`
+
+	// Machine translation of cards: the provider ("deepl" or "google"), its
+	// API key, and the language of each channel that wants translations
+	TranslationProvider string            `yaml:"translation_provider"`
+	TranslationAPIKey   string            `yaml:"translation_api_key"`
+	ChannelLanguages    map[string]string `yaml:"channel_languages"`
+
+	// Projects whose issues the bot expands by channel, like #frontend only
+	// expanding WEB and UX issues. Channels not listed expand every project.
+	ChannelProjects map[string][]string `yaml:"channel_projects"`
+
+	// Channels the bot expands issues in, as patterns like "social-*" that
+	// match channel names or IDs, and whether it does in channels neither
+	// list matches: "allow" (the default) or "deny"
+	AllowedChannels []string `yaml:"allowed_channels"`
+	DeniedChannels  []string `yaml:"denied_channels"`
+	ChannelPolicy   string   `yaml:"channel_policy"`
+
+	// Incident channels, as patterns like AllowedChannels, where the end of a
+	// huddle prompts for a follow-up ticket
+	IncidentChannels []string `yaml:"incident_channels"`
+
+	// Channels where only customer-safe fields are rendered
+	CustomerViewChannels []string `yaml:"customer_view_channels"`
+
+	// Email domains of the Slack users who may change issues and see full
+	// cards. Others only get keys and statuses. Empty allows everyone.
+	AllowedEmailDomains []string `yaml:"allowed_email_domains"`
+
+	// Listen address and keys (mapped to their scopes) of the action API
+	ActionAPIAddr string              `yaml:"action_api_addr"`
+	ActionAPIKeys map[string][]string `yaml:"action_api_keys"`
+
+	// Listen address and admin token of the pprof and expvar endpoints
+	DebugAddr  string `yaml:"debug_addr"`
+	DebugToken string `yaml:"debug_token"`
+
+	// Listen address and secret of the Jira webhook endpoint, and the
+	// channels it notifies
+	JiraWebhookAddr   string        `yaml:"jira_webhook_addr"`
+	JiraWebhookSecret string        `yaml:"jira_webhook_secret"`
+	JiraWebhookRules  []WebhookRule `yaml:"jira_webhook_rules"`
+
+	// Where the bot keeps state, like the issues channels follow: files or an
+	// SQLite database in the data directory, or Redis
+	StateStore string `yaml:"state_store"`
+	DataDir    string `yaml:"data_dir"`
+	RedisURL   string `yaml:"redis_url"`
+
+	// Runs the bot as one of several replicas sharing the channels, which
+	// needs the redis state store. The replica ID defaults to host and PID.
+	Cluster   bool   `yaml:"cluster"`
+	ReplicaID string `yaml:"replica_id"`
+
+	// Runs the bot as one of an active and a standby instance sharing the
+	// redis state store. Only the active one handles events, the standby
+	// takes over when its heartbeat goes stale.
+	Failover bool `yaml:"failover"`
+
+	// How often followed issues are checked for changes
+	WatchPollInterval time.Duration `yaml:"watch_poll_interval"`
+
+	// Whether text files shared in channels are scanned for issue keys, and
+	// the largest file scanned in bytes
+	FileScan        bool `yaml:"file_scan"`
+	FileScanMaxSize int  `yaml:"file_scan_max_size"`
+
+	// Messages handled at the same time, and how long one may take before
+	// its Jira requests are given up on
+	MessageWorkers int           `yaml:"message_workers"`
+	MessageTimeout time.Duration `yaml:"message_timeout"`
+
+	// Disables every write operation against Jira
+	ReadOnly bool `yaml:"read_only"`
+
+	// Periods in which Jira is unavailable
+	MaintenanceWindows []MaintenanceWindow `yaml:"maintenance"`
+
+	// Jira API calls allowed per hour (0 means unlimited) and where to alert
+	// when the bot gets close to it, a channel ID, user email or @name
+	JiraAPIBudget int    `yaml:"jira_api_budget"`
+	OpsChannel    string `yaml:"ops_channel"`
+
+	// How long fetched issues are reused for
+	JiraCacheTTL time.Duration `yaml:"jira_cache_ttl"`
+
+	// How many of the most mentioned issues are refreshed, and how often
+	PrefetchTop      int           `yaml:"prefetch_top"`
+	PrefetchInterval time.Duration `yaml:"prefetch_interval"`
+
+	// How often the instance's fields, statuses, priorities and users are
+	// synced (0 fetches them on demand)
+	JiraMetadataSyncInterval time.Duration `yaml:"jira_metadata_sync_interval"`
+
+	// Projects whose issues get a remote link to the Slack messages
+	// mentioning them
+	DiscussionLinkProjects []string `yaml:"jira_discussion_link_projects"`
+
+	// Reads settings Jira admins stored on their projects and issues
+	JiraPropertyConfig bool `yaml:"jira_property_config"`
+
+	// Where processed events and bot actions are archived, and for how many
+	// days (0 keeps them forever)
+	ArchiveDir           string `yaml:"archive_dir"`
+	ArchiveRetentionDays int    `yaml:"archive_retention_days"`
+
+	// ClickHouse HTTP endpoint and table events are streamed to, and for how
+	// many days they are kept (0 keeps them forever)
+	ClickHouseURL           string `yaml:"clickhouse_url"`
+	ClickHouseTable         string `yaml:"clickhouse_table"`
+	ClickHouseRetentionDays int    `yaml:"clickhouse_retention_days"`
+
+	// Longest time issues and other Jira content stay cached, whatever their
+	// TTL (0 keeps them until they expire)
+	CacheRetention time.Duration `yaml:"cache_retention"`
+
+	// Slack user IDs allowed to run admin commands
+	AdminUsers []string `yaml:"admin_users"`
+
+	// Environment variables that couldn't be parsed, reported by validateConfig
+	parseErrors []error
+}
+
+// Settings read from the --config file, environment variables override them
+var fileConfig BotConfig
+
+// Settings admins can toggle from the App Home, see setRuntimeOverride
+var toggleableSettings = map[string]func(config *BotConfig) *bool{
+	"read_only":            func(config *BotConfig) *bool { return &config.ReadOnly },
+	"jira_property_config": func(config *BotConfig) *bool { return &config.JiraPropertyConfig },
+}
+
+// Settings toggled at runtime. They win over the file and the environment
+// until the bot restarts.
+var runtimeOverrides = struct {
+	sync.Mutex
+	values map[string]bool
+}{values: map[string]bool{}}
+
+// Table names that are safe to put into a ClickHouse query
+var clickHouseTablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+func getConfig() BotConfig {
+	config := fileConfig
+
+	if config.Username == "" {
+		config.Username = "JiraBot"
+	}
+	if config.ClickHouseTable == "" {
+		config.ClickHouseTable = "jira_bot_events"
+	}
+	if config.WatchPollInterval == 0 {
+		config.WatchPollInterval = 5 * time.Minute
+	}
+	if config.FileScanMaxSize == 0 {
+		config.FileScanMaxSize = 1 << 20
+	}
+	if config.MessageWorkers == 0 {
+		config.MessageWorkers = 8
+	}
+	if config.MessageTimeout == 0 {
+		config.MessageTimeout = 30 * time.Second
+	}
+
+	for name, setting := range map[string]*string{
+		"SLACK_API_KEY":            &config.SlackAPIKey,
+		"SLACK_APP_TOKEN":          &config.SlackAppToken,
+		"EVENTS_API_ADDR":          &config.EventsAPIAddr,
+		"SLACK_SIGNING_SECRET":     &config.SlackSigningSecret,
+		"SLACK_CLIENT_ID":          &config.SlackClientID,
+		"SLACK_CLIENT_SECRET":      &config.SlackClientSecret,
+		"SLACK_REDIRECT_URL":       &config.SlackRedirectURL,
+		"SLACK_INSTALL_ADDR":       &config.SlackInstallAddr,
+		"JIRA_BASEURL":             &config.JiraBaseURL,
+		"JIRA_USERNAME":            &config.JiraUsername,
+		"JIRA_PASSWORD":            &config.JiraPassword,
+		"JIRA_DEPLOYMENT":          &config.JiraDeployment,
+		"JIRA_AUTH":                &config.JiraAuth,
+		"JIRA_API_TOKEN":           &config.JiraAPIToken,
+		"JIRA_PAT":                 &config.JiraPAT,
+		"JIRA_OAUTH_CLIENT_ID":     &config.JiraOAuthClientID,
+		"JIRA_OAUTH_CLIENT_SECRET": &config.JiraOAuthClientSecret,
+		"JIRA_OAUTH_REDIRECT_URL":  &config.JiraOAuthRedirectURL,
+		"JIRA_OAUTH_ADDR":          &config.JiraOAuthAddr,
+		"JIRA_OAUTH_UNLINKED":      &config.JiraOAuthUnlinked,
+		"JIRA_MOBILE_LINK":         &config.JiraMobileLink,
+		"SHORT_LINK_PATTERN":       &config.ShortLinkPattern,
+		"ACTION_API_ADDR":          &config.ActionAPIAddr,
+		"CHANNEL_POLICY":           &config.ChannelPolicy,
+		"TRANSLATION_PROVIDER":     &config.TranslationProvider,
+		"TRANSLATION_API_KEY":      &config.TranslationAPIKey,
+		"DEBUG_ADDR":               &config.DebugAddr,
+		"DEBUG_TOKEN":              &config.DebugToken,
+		"JIRA_WEBHOOK_ADDR":        &config.JiraWebhookAddr,
+		"JIRA_WEBHOOK_SECRET":      &config.JiraWebhookSecret,
+		"OPS_CHANNEL":              &config.OpsChannel,
+		"MESSAGE_TEMPLATE":         &config.MessageTemplate,
+		"CANARY_TEMPLATE":          &config.CanaryTemplate,
+		"ARCHIVE_DIR":              &config.ArchiveDir,
+		"DATA_DIR":                 &config.DataDir,
+		"STATE_STORE":              &config.StateStore,
+		"REDIS_URL":                &config.RedisURL,
+		"REPLICA_ID":               &config.ReplicaID,
+		"CLICKHOUSE_URL":           &config.ClickHouseURL,
+		"CLICKHOUSE_TABLE":         &config.ClickHouseTable,
+	} {
+		*setting = getEnvDefault(name, *setting)
+	}
+
+	for name, setting := range map[string]*bool{
+		"REPLY_IN_THREAD":      &config.ReplyInThread,
+		"REPLY_BROADCAST":      &config.ReplyBroadcast,
+		"CLUSTER":              &config.Cluster,
+		"FAILOVER":             &config.Failover,
+		"READ_ONLY":            &config.ReadOnly,
+		"JIRA_PROPERTY_CONFIG": &config.JiraPropertyConfig,
+		"FILE_SCAN":            &config.FileScan,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				config.parseErrors = append(config.parseErrors, fmt.Errorf("%s must be true or false, not %q", name, value))
+				continue
+			}
+			*setting = parsed
+		}
+	}
+	for name, setting := range map[string]*int{
+		"CANARY_PERCENT":            &config.CanaryPercent,
+		"JIRA_API_BUDGET":           &config.JiraAPIBudget,
+		"PREFETCH_TOP":              &config.PrefetchTop,
+		"ARCHIVE_RETENTION_DAYS":    &config.ArchiveRetentionDays,
+		"FILE_SCAN_MAX_SIZE":        &config.FileScanMaxSize,
+		"MESSAGE_WORKERS":           &config.MessageWorkers,
+		"CLICKHOUSE_RETENTION_DAYS": &config.ClickHouseRetentionDays,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				config.parseErrors = append(config.parseErrors, fmt.Errorf("%s must be a whole number, not %q", name, value))
+				continue
+			}
+			*setting = parsed
+		}
+	}
+	for name, setting := range map[string]*time.Duration{
+		"JIRA_CACHE_TTL":              &config.JiraCacheTTL,
+		"PREFETCH_INTERVAL":           &config.PrefetchInterval,
+		"JIRA_METADATA_SYNC_INTERVAL": &config.JiraMetadataSyncInterval,
+		"WATCH_POLL_INTERVAL":         &config.WatchPollInterval,
+		"MESSAGE_TIMEOUT":             &config.MessageTimeout,
+		"CACHE_RETENTION":             &config.CacheRetention,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				config.parseErrors = append(config.parseErrors, fmt.Errorf("%s must be a duration like 30s or 5m, not %q", name, value))
+				continue
+			}
+			*setting = parsed
+		}
+	}
+
+	if value := os.Getenv("JIRA_FREEZES"); value != "" {
+		var errs []error
+		config.Freezes, errs = parseFreezes(value)
+		config.addParseErrors("JIRA_FREEZES", errs)
+	}
+	if value := os.Getenv("CANARY_CHANNELS"); value != "" {
+		config.CanaryChannels = parseList(value)
+	}
+	if value := os.Getenv("CARD_PROFILES"); value != "" {
+		config.CardProfiles = parseCardProfiles(value)
+	}
+	if value := os.Getenv("THREADED_CHANNELS"); value != "" {
+		config.ThreadedChannels = parseList(value)
+	}
+	if value := os.Getenv("UNTHREADED_CHANNELS"); value != "" {
+		config.UnthreadedChannels = parseList(value)
+	}
+	if value := os.Getenv("CHANNEL_LANGUAGES"); value != "" {
+		config.ChannelLanguages = parseChannelLanguages(value)
+	}
+	if value := os.Getenv("CHANNEL_PROJECTS"); value != "" {
+		config.ChannelProjects = parseChannelProjects(value)
+	}
+	if value := os.Getenv("ALLOWED_CHANNELS"); value != "" {
+		config.AllowedChannels = parseList(value)
+	}
+	if value := os.Getenv("DENIED_CHANNELS"); value != "" {
+		config.DeniedChannels = parseList(value)
+	}
+	if value := os.Getenv("INCIDENT_CHANNELS"); value != "" {
+		config.IncidentChannels = parseList(value)
+	}
+	if value := os.Getenv("SLACK_ALLOWED_TEAMS"); value != "" {
+		config.SlackAllowedTeams = parseList(value)
+	}
+	if value := os.Getenv("CUSTOMER_VIEW_CHANNELS"); value != "" {
+		config.CustomerViewChannels = parseList(value)
+	}
+	if value := os.Getenv("ALLOWED_EMAIL_DOMAINS"); value != "" {
+		config.AllowedEmailDomains = parseList(value)
+	}
+	if value := os.Getenv("ACTION_API_KEYS"); value != "" {
+		var errs []error
+		config.ActionAPIKeys, errs = parseActionAPIKeys(value)
+		config.addParseErrors("ACTION_API_KEYS", errs)
+	}
+	if value := os.Getenv("JIRA_WEBHOOK_RULES"); value != "" {
+		var errs []error
+		config.JiraWebhookRules, errs = parseWebhookRules(value)
+		config.addParseErrors("JIRA_WEBHOOK_RULES", errs)
+	}
+	if value := os.Getenv("JIRA_INSTANCES"); value != "" {
+		var errs []error
+		config.JiraInstances, errs = parseJiraInstances(value)
+		config.addParseErrors("JIRA_INSTANCES", errs)
+	}
+	if value := os.Getenv("JIRA_OAUTH_REFUSE_CHANNELS"); value != "" {
+		config.JiraOAuthRefuseChannels = parseList(value)
+	}
+	if value := os.Getenv("JIRA_OAUTH_SERVICE_CHANNELS"); value != "" {
+		config.JiraOAuthServiceChannels = parseList(value)
+	}
+	if value := os.Getenv("JIRA_MAINTENANCE"); value != "" {
+		var errs []error
+		config.MaintenanceWindows, errs = parseMaintenanceWindows(value)
+		config.addParseErrors("JIRA_MAINTENANCE", errs)
+	}
+	if value := os.Getenv("JIRA_DISCUSSION_LINK_PROJECTS"); value != "" {
+		config.DiscussionLinkProjects = parseList(value)
+	}
+	if value := os.Getenv("ADMIN_USERS"); value != "" {
+		config.AdminUsers = parseList(value)
+	}
+
+	runtimeOverrides.Lock()
+	for name, value := range runtimeOverrides.values {
+		*toggleableSettings[name](&config) = value
+	}
+	runtimeOverrides.Unlock()
+
+	return config
+}
+
+// addParseErrors keeps the entries of a setting that couldn't be read for
+// validateConfig, naming the setting
+func (config *BotConfig) addParseErrors(name string, errs []error) {
+	for _, err := range errs {
+		config.parseErrors = append(config.parseErrors, fmt.Errorf("%s: %v", name, err))
+	}
+}
+
+// setRuntimeOverride changes a toggleable setting until the bot restarts
+func setRuntimeOverride(name string, value bool) error {
+	if _, ok := toggleableSettings[name]; !ok {
+		return fmt.Errorf("%s can't be changed at runtime", name)
+	}
+
+	runtimeOverrides.Lock()
+	runtimeOverrides.values[name] = value
+	runtimeOverrides.Unlock()
+
+	return nil
+}
+
+// loadConfigFile reads a YAML config file. Unknown settings are rejected so
+// typos don't go unnoticed.
+func loadConfigFile(path string) (BotConfig, error) {
+	var config BotConfig
+
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return config, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// validateConfig lists every problem with the configuration, so they can all
+// be fixed in one go
+func validateConfig(config BotConfig) []error {
+	problems := []error{}
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	problems = append(problems, config.parseErrors...)
+
+	if config.SlackAPIKey == "" {
+		problem("slack_api_key (SLACK_API_KEY) is required")
+	}
+	if config.SlackAppToken != "" && !strings.HasPrefix(config.SlackAppToken, "xapp-") {
+		problem("slack_app_token (SLACK_APP_TOKEN) must be an app-level token starting with xapp-")
+	}
+	if config.EventsAPIAddr != "" && config.SlackSigningSecret == "" {
+		problem("slack_signing_secret (SLACK_SIGNING_SECRET) is required with events_api_addr")
+	}
+	if config.SlackClientID != "" {
+		if config.SlackClientSecret == "" || config.SlackRedirectURL == "" || config.SlackInstallAddr == "" {
+			problem("slack_client_secret (SLACK_CLIENT_SECRET), slack_redirect_url (SLACK_REDIRECT_URL) and slack_install_addr (SLACK_INSTALL_ADDR) are required with slack_client_id")
+		}
+		// Anyone with the install link could add the bot to their workspace
+		if len(config.SlackAllowedTeams) == 0 {
+			problem("slack_allowed_teams (SLACK_ALLOWED_TEAMS) is required with slack_client_id, listing the IDs of the teams the app may be installed to")
+		}
+		// Only one workspace can be reached over RTM
+		if config.SlackAppToken == "" && config.EventsAPIAddr == "" {
+			problem("slack_client_id (SLACK_CLIENT_ID) needs slack_app_token (SLACK_APP_TOKEN) or events_api_addr (EVENTS_API_ADDR)")
+		}
+	}
+
+	if config.JiraBaseURL == "" {
+		problem("jira_base_url (JIRA_BASEURL) is required")
+	} else if u, err := url.Parse(config.JiraBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problem("jira_base_url (JIRA_BASEURL) %q is not an http(s) URL", config.JiraBaseURL)
+	}
+
+	if config.JiraDeployment != "" && config.JiraDeployment != jiraDeploymentCloud && config.JiraDeployment != jiraDeploymentServer {
+		problem("jira_deployment (JIRA_DEPLOYMENT) %q must be %s or %s", config.JiraDeployment, jiraDeploymentCloud, jiraDeploymentServer)
+	}
+
+	switch config.JiraAuth {
+	case "", jiraAuthBasic:
+	case jiraAuthAPIToken:
+		if config.JiraUsername == "" {
+			problem("jira_username (JIRA_USERNAME) is required with api_token auth, set it to the account's email")
+		}
+		if config.JiraAPIToken == "" {
+			problem("jira_api_token (JIRA_API_TOKEN) is required with api_token auth")
+		}
+	case jiraAuthPAT:
+		if config.JiraPAT == "" {
+			problem("jira_pat (JIRA_PAT) is required with pat auth")
+		}
+	default:
+		problem("jira_auth (JIRA_AUTH) %q must be %s, %s or %s", config.JiraAuth, jiraAuthBasic, jiraAuthAPIToken, jiraAuthPAT)
+	}
+
+	names := map[string]bool{mainJiraInstance: true}
+	for _, instance := range config.JiraInstances {
+		if instance.Name == "" || names[instance.Name] {
+			problem("jira_instances (JIRA_INSTANCES) need unique names other than %s, got %q", mainJiraInstance, instance.Name)
+		}
+		names[instance.Name] = true
+
+		if u, err := url.Parse(instance.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("jira_instances (JIRA_INSTANCES) %s needs an http(s) base URL, got %q", instance.Name, instance.BaseURL)
+		}
+		if instance.Deployment != "" && instance.Deployment != jiraDeploymentCloud && instance.Deployment != jiraDeploymentServer {
+			problem("jira_instances (JIRA_INSTANCES) %s deployment %q must be %s or %s", instance.Name, instance.Deployment, jiraDeploymentCloud, jiraDeploymentServer)
+		}
+		switch instance.Auth {
+		case "", jiraAuthBasic:
+		case jiraAuthAPIToken:
+			if instance.Username == "" || instance.APIToken == "" {
+				problem("jira_instances (JIRA_INSTANCES) %s needs a username and an API token with api_token auth", instance.Name)
+			}
+		case jiraAuthPAT:
+			if instance.PAT == "" {
+				problem("jira_instances (JIRA_INSTANCES) %s needs a personal access token with pat auth", instance.Name)
+			}
+		default:
+			problem("jira_instances (JIRA_INSTANCES) %s auth %q must be %s, %s or %s", instance.Name, instance.Auth, jiraAuthBasic, jiraAuthAPIToken, jiraAuthPAT)
+		}
+
+		if len(instance.Projects) == 0 && instance.ProjectPattern == "" {
+			problem("jira_instances (JIRA_INSTANCES) %s needs projects or a project pattern", instance.Name)
+		}
+		if _, err := regexp.Compile(instance.ProjectPattern); err != nil {
+			problem("jira_instances (JIRA_INSTANCES) %s project pattern is invalid: %v", instance.Name, err)
+		}
+	}
+
+	if config.JiraOAuthClientID != "" {
+		if config.JiraOAuthClientSecret == "" {
+			problem("jira_oauth_client_secret (JIRA_OAUTH_CLIENT_SECRET) is required with jira_oauth_client_id")
+		}
+		if u, err := url.Parse(config.JiraOAuthRedirectURL); err != nil || u.Scheme == "" {
+			problem("jira_oauth_redirect_url (JIRA_OAUTH_REDIRECT_URL) %q must be the URL of the callback", config.JiraOAuthRedirectURL)
+		}
+		if config.JiraOAuthAddr == "" {
+			problem("jira_oauth_addr (JIRA_OAUTH_ADDR) is required with jira_oauth_client_id to receive the callback")
+		}
+	}
+	if config.JiraOAuthUnlinked != "" && config.JiraOAuthUnlinked != jiraUnlinkedService && config.JiraOAuthUnlinked != jiraUnlinkedRefuse {
+		problem("jira_oauth_unlinked (JIRA_OAUTH_UNLINKED) %q must be %s or %s", config.JiraOAuthUnlinked, jiraUnlinkedService, jiraUnlinkedRefuse)
+	}
+
+	if config.JiraMobileLink != "" {
+		if u, err := url.Parse(config.JiraMobileLink); err != nil || u.Scheme == "" || !strings.Contains(config.JiraMobileLink, "{key}") {
+			problem("jira_mobile_link (JIRA_MOBILE_LINK) %q must be a URL containing {key}", config.JiraMobileLink)
+		}
+	}
+
+	if config.ShortLinkPattern != "" {
+		if _, err := regexp.Compile(config.ShortLinkPattern); err != nil {
+			problem("short_link_pattern (SHORT_LINK_PATTERN) is invalid: %v", err)
+		}
+	}
+
+	for _, domain := range config.AllowedEmailDomains {
+		if domain == "" || strings.ContainsAny(domain, "@ ") {
+			problem("allowed_email_domains (ALLOWED_EMAIL_DOMAINS) %q must be a domain like example.com", domain)
+		}
+	}
+
+	if config.DebugAddr != "" && len(config.DebugToken) < 16 {
+		problem("debug_token (DEBUG_TOKEN) of at least 16 characters is required with debug_addr")
+	}
+	if config.JiraWebhookAddr != "" && config.JiraWebhookSecret == "" {
+		problem("jira_webhook_secret (JIRA_WEBHOOK_SECRET) is required with jira_webhook_addr")
+	}
+	if len(config.JiraWebhookRules) > 0 && config.JiraWebhookAddr == "" {
+		problem("jira_webhook_rules (JIRA_WEBHOOK_RULES) need jira_webhook_addr (JIRA_WEBHOOK_ADDR) to receive events")
+	}
+	for i, rule := range config.JiraWebhookRules {
+		if rule.Channel == "" {
+			problem("jira_webhook_rules[%d] needs a channel", i)
+		}
+		for _, kind := range rule.Events {
+			if !containsFold(webhookEventKinds, kind) {
+				problem("jira_webhook_rules[%d] has unknown event %q, use %s", i, kind, strings.Join(webhookEventKinds, ", "))
+			}
+		}
+	}
+
+	if config.MessageTemplate != "" {
+		if _, err := parseMessageTemplate(config.MessageTemplate); err != nil {
+			problem("message_template (MESSAGE_TEMPLATE) is invalid: %v", err)
+		}
+	}
+	switch config.TranslationProvider {
+	case "":
+		if len(config.ChannelLanguages) > 0 {
+			problem("channel_languages (CHANNEL_LANGUAGES) need translation_provider (TRANSLATION_PROVIDER)")
+		}
+	case translationProviderDeepL, translationProviderGoogle:
+		if config.TranslationAPIKey == "" {
+			problem("translation_api_key (TRANSLATION_API_KEY) is required with translation_provider")
+		}
+	default:
+		problem("translation_provider (TRANSLATION_PROVIDER) must be %s or %s", translationProviderDeepL, translationProviderGoogle)
+	}
+	if config.ChannelPolicy != "" && config.ChannelPolicy != channelPolicyAllow && config.ChannelPolicy != channelPolicyDeny {
+		problem("channel_policy (CHANNEL_POLICY) must be %s or %s", channelPolicyAllow, channelPolicyDeny)
+	}
+	for _, pattern := range append(append([]string{}, config.AllowedChannels...), config.DeniedChannels...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problem("channel pattern %q in allowed_channels (ALLOWED_CHANNELS) or denied_channels (DENIED_CHANNELS) is invalid", pattern)
+		}
+	}
+	for _, pattern := range config.IncidentChannels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problem("channel pattern %q in incident_channels (INCIDENT_CHANNELS) is invalid", pattern)
+		}
+	}
+	for channel, profile := range config.CardProfiles {
+		if _, ok := cardProfiles[profile]; !ok {
+			problem("card_profiles (CARD_PROFILES) has unknown profile %q for %s, use one of %s", profile, channel, strings.Join(getCardProfileNames(), ", "))
+		}
+	}
+	if config.CanaryTemplate != "" {
+		if _, err := parseMessageTemplate(config.CanaryTemplate); err != nil {
+			problem("canary_template (CANARY_TEMPLATE) is invalid: %v", err)
+		}
+	}
+	if config.CanaryPercent < 0 || config.CanaryPercent > 100 {
+		problem("canary_percent (CANARY_PERCENT) must be between 0 and 100")
+	}
+
+	for i, freeze := range config.Freezes {
+		if freeze.End.Before(freeze.Start) {
+			problem("freezes[%d] ends on %s, before it starts on %s", i, freeze.End.Format(freezeDateLayout), freeze.Start.Format(freezeDateLayout))
+		}
+	}
+	for i, window := range config.MaintenanceWindows {
+		if !window.End.After(window.Start) {
+			problem("maintenance[%d] ends at %s, not after it starts at %s", i, window.End.Format(time.RFC3339), window.Start.Format(time.RFC3339))
+		}
+	}
+
+	for _, scopes := range config.ActionAPIKeys {
+		for _, scope := range scopes {
+			if !hasActionScope(actionScopes, scope) {
+				problem("action_api_keys: unknown scope %q, use %s", scope, strings.Join(actionScopes, ", "))
+			}
+		}
+	}
+
+	if config.JiraAPIBudget < 0 {
+		problem("jira_api_budget (JIRA_API_BUDGET) must not be negative")
+	}
+	if config.PrefetchTop < 0 {
+		problem("prefetch_top (PREFETCH_TOP) must not be negative")
+	}
+	if config.ArchiveRetentionDays < 0 {
+		problem("archive_retention_days (ARCHIVE_RETENTION_DAYS) must not be negative")
+	}
+	if config.ClickHouseRetentionDays < 0 {
+		problem("clickhouse_retention_days (CLICKHOUSE_RETENTION_DAYS) must not be negative")
+	}
+	if config.JiraCacheTTL < 0 {
+		problem("jira_cache_ttl (JIRA_CACHE_TTL) must not be negative")
+	}
+	switch config.StateStore {
+	case "":
+	case stateStoreFile, stateStoreSQLite:
+		if config.DataDir == "" {
+			problem("data_dir (DATA_DIR) is required with the %s state store", config.StateStore)
+		}
+	case stateStoreRedis:
+		if config.RedisURL == "" {
+			problem("redis_url (REDIS_URL) is required with the redis state store")
+		}
+	default:
+		problem("state_store (STATE_STORE) %q must be %s, %s or %s", config.StateStore, stateStoreFile, stateStoreSQLite, stateStoreRedis)
+	}
+	if config.Cluster && config.StateStore != stateStoreRedis {
+		problem("cluster (CLUSTER) needs the redis state store (STATE_STORE=redis)")
+	}
+	if config.Failover && config.StateStore != stateStoreRedis {
+		problem("failover (FAILOVER) needs the redis state store (STATE_STORE=redis)")
+	}
+	if config.Failover && config.Cluster {
+		problem("failover (FAILOVER) and cluster (CLUSTER) can't be combined, replicas already take over from each other")
+	}
+	if config.WatchPollInterval < 0 {
+		problem("watch_poll_interval (WATCH_POLL_INTERVAL) must not be negative")
+	}
+	if config.FileScanMaxSize < 0 {
+		problem("file_scan_max_size (FILE_SCAN_MAX_SIZE) must not be negative")
+	}
+	if config.MessageWorkers < 0 {
+		problem("message_workers (MESSAGE_WORKERS) must not be negative")
+	}
+	if config.MessageTimeout < 0 {
+		problem("message_timeout (MESSAGE_TIMEOUT) must not be negative")
+	}
+	if config.CacheRetention < 0 {
+		problem("cache_retention (CACHE_RETENTION) must not be negative")
+	}
+	if config.PrefetchTop > 0 && config.PrefetchInterval <= 0 {
+		problem("prefetch_interval (PREFETCH_INTERVAL) is required with prefetch_top")
+	}
+
+	if !clickHouseTablePattern.MatchString(config.ClickHouseTable) {
+		problem("clickhouse_table (CLICKHOUSE_TABLE) %q is not a valid table name", config.ClickHouseTable)
+	}
+
+	return problems
+}
+
+func getEnvDefault(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// parseList splits a comma separated setting, dropping empty entries
+func parseList(value string) []string {
+	result := []string{}
+
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
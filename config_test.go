@@ -0,0 +1,249 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bot.yaml")
+	ioutil.WriteFile(path, []byte("jira_base_url: https://example.atlassian.net\njira_cache_ttl: 1m\nadmin_users: [U1, U2]\n"), 0600)
+
+	config, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("Expected the config to load, got %v", err)
+	}
+	if config.JiraBaseURL != "https://example.atlassian.net" || config.JiraCacheTTL != time.Minute || len(config.AdminUsers) != 2 {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	ioutil.WriteFile(path, []byte("jira_base_urll: https://example.atlassian.net\n"), 0600)
+
+	if _, err := loadConfigFile(path); err == nil || !strings.Contains(err.Error(), "jira_base_urll") {
+		t.Errorf("Expected an error naming the unknown setting, got %v", err)
+	}
+}
+
+func TestGetConfigEnvOverridesFile(t *testing.T) {
+	fileConfig = BotConfig{JiraBaseURL: "https://file.example.com", JiraAPIBudget: 100, ReadOnly: true}
+	defer func() { fileConfig = BotConfig{} }()
+
+	os.Setenv("JIRA_BASEURL", "https://env.example.com")
+	os.Setenv("READ_ONLY", "false")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("READ_ONLY")
+
+	config := getConfig()
+
+	if config.JiraBaseURL != "https://env.example.com" || config.ReadOnly {
+		t.Errorf("Expected environment variables to win, got %+v", config)
+	}
+	if config.JiraAPIBudget != 100 {
+		t.Errorf("Expected settings without an environment variable to come from the file, got %d", config.JiraAPIBudget)
+	}
+	if config.Username != "JiraBot" || config.ClickHouseTable != "jira_bot_events" {
+		t.Errorf("Expected defaults for unset settings, got %q and %q", config.Username, config.ClickHouseTable)
+	}
+}
+
+func TestGetConfigReportsMalformedValues(t *testing.T) {
+	os.Setenv("READ_ONLY", "yes")
+	os.Setenv("JIRA_API_BUDGET", "lots")
+	os.Setenv("MESSAGE_TIMEOUT", "10")
+	defer os.Unsetenv("READ_ONLY")
+	defer os.Unsetenv("JIRA_API_BUDGET")
+	defer os.Unsetenv("MESSAGE_TIMEOUT")
+
+	config := getConfig()
+	if config.MessageTimeout != 30*time.Second {
+		t.Errorf("Expected a malformed setting to keep its default, got %v", config.MessageTimeout)
+	}
+
+	problems := []string{}
+	for _, problem := range validateConfig(config) {
+		problems = append(problems, problem.Error())
+	}
+	for _, name := range []string{"READ_ONLY", "JIRA_API_BUDGET", "MESSAGE_TIMEOUT"} {
+		if !strings.Contains(strings.Join(problems, "\n"), name) {
+			t.Errorf("Expected a problem naming %s, got %v", name, problems)
+		}
+	}
+}
+
+func TestGetConfigReportsMalformedEntries(t *testing.T) {
+	settings := map[string]string{
+		"JIRA_FREEZES":       "2026-12-20..2027-01-03=WEB;2026-12-24",
+		"JIRA_MAINTENANCE":   "tonight",
+		"JIRA_WEBHOOK_RULES": "C1",
+		"JIRA_INSTANCES":     "on-prem",
+		"ACTION_API_KEYS":    "secret",
+	}
+	for name, value := range settings {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	config := getConfig()
+	if len(config.Freezes) != 1 {
+		t.Errorf("Expected the well-formed freeze to be kept, got %v", config.Freezes)
+	}
+
+	problems := []string{}
+	for _, problem := range validateConfig(config) {
+		problems = append(problems, problem.Error())
+	}
+	for name := range settings {
+		if !strings.Contains(strings.Join(problems, "\n"), name+":") {
+			t.Errorf("Expected a problem naming %s, got %v", name, problems)
+		}
+	}
+	if strings.Contains(strings.Join(problems, "\n"), "secret") {
+		t.Errorf("Expected the problems not to show the API key, got %v", problems)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	config := BotConfig{
+		SlackAPIKey:     "xoxb-1",
+		JiraBaseURL:     "https://example.atlassian.net",
+		ClickHouseTable: "jira_bot_events",
+	}
+	if problems := validateConfig(config); len(problems) != 0 {
+		t.Errorf("Expected a valid config, got %v", problems)
+	}
+
+	config.JiraBaseURL = "example.atlassian.net"
+	config.EventsAPIAddr = ":3000"
+	config.ClickHouseTable = "events; DROP TABLE users"
+	config.Freezes = []FreezeWindow{{Start: time.Date(2027, 1, 3, 0, 0, 0, 0, time.UTC), End: time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC)}}
+	config.ActionAPIKeys = map[string][]string{"secret": {"lookup", "admin"}}
+
+	problems := validateConfig(config)
+	if len(problems) != 5 {
+		t.Fatalf("Expected 5 problems, got %v", problems)
+	}
+	if !strings.Contains(problems[0].Error(), "slack_signing_secret") {
+		t.Errorf("Expected the missing signing secret first, got %v", problems[0])
+	}
+}
+
+func TestValidateConfigAcceptsEveryActionScope(t *testing.T) {
+	config := BotConfig{
+		SlackAPIKey:     "xoxb-1",
+		JiraBaseURL:     "https://example.atlassian.net",
+		ClickHouseTable: "jira_bot_events",
+		ActionAPIKeys:   map[string][]string{"secret": {"lookup", "card", "create", "comment", "transition"}},
+	}
+
+	if problems := validateConfig(config); len(problems) != 0 {
+		t.Errorf("Expected every scope to be valid, got %v", problems)
+	}
+}
+
+func TestValidateMobileLink(t *testing.T) {
+	config := BotConfig{SlackAPIKey: "xoxb-1", JiraBaseURL: "https://example.atlassian.net", ClickHouseTable: "jira_bot_events", JiraMobileLink: "jira://issue"}
+
+	if problems := validateConfig(config); len(problems) != 1 || !strings.Contains(problems[0].Error(), "{key}") {
+		t.Errorf("Expected the missing {key} to be reported, got %v", problems)
+	}
+}
+
+func TestValidateAllowedEmailDomains(t *testing.T) {
+	config := BotConfig{SlackAPIKey: "xoxb-1", JiraBaseURL: "https://example.atlassian.net", ClickHouseTable: "jira_bot_events", AllowedEmailDomains: []string{"example.com", "@partner.com"}}
+
+	if problems := validateConfig(config); len(problems) != 1 || !strings.Contains(problems[0].Error(), "@partner.com") {
+		t.Errorf("Expected the domain with an @ to be reported, got %v", problems)
+	}
+}
+
+func TestValidateStateStore(t *testing.T) {
+	config := BotConfig{SlackAPIKey: "xoxb-1", JiraBaseURL: "https://example.atlassian.net", ClickHouseTable: "jira_bot_events"}
+
+	for store, expected := range map[string]string{"sqlite": "DATA_DIR", "redis": "REDIS_URL", "mongo": "STATE_STORE", "file": "DATA_DIR"} {
+		config.StateStore = store
+		if problems := validateConfig(config); len(problems) != 1 || !strings.Contains(problems[0].Error(), expected) {
+			t.Errorf("Expected %s to be reported for %s, got %v", expected, store, problems)
+		}
+	}
+
+	config.StateStore = "sqlite"
+	config.DataDir = "/var/lib/jira-bot"
+	if problems := validateConfig(config); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
+
+func TestValidateFailover(t *testing.T) {
+	config := BotConfig{SlackAPIKey: "xoxb-1", JiraBaseURL: "https://example.atlassian.net", ClickHouseTable: "jira_bot_events", Failover: true}
+
+	if problems := validateConfig(config); len(problems) != 1 || !strings.Contains(problems[0].Error(), "STATE_STORE=redis") {
+		t.Errorf("Expected failover to need redis, got %v", problems)
+	}
+
+	config.StateStore = "redis"
+	config.RedisURL = "redis://localhost:6379"
+	if problems := validateConfig(config); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+
+	config.Cluster = true
+	if problems := validateConfig(config); len(problems) != 1 {
+		t.Errorf("Expected failover and cluster to be exclusive, got %v", problems)
+	}
+}
+
+func TestValidateSlackInstall(t *testing.T) {
+	config := BotConfig{SlackAPIKey: "xoxb-1", JiraBaseURL: "https://example.atlassian.net", ClickHouseTable: "jira_bot_events", SlackClientID: "123.456"}
+
+	if problems := validateConfig(config); len(problems) != 3 {
+		t.Errorf("Expected the install settings, allowed teams and a way to receive events to be required, got %v", problems)
+	}
+
+	config.SlackAllowedTeams = []string{"T1"}
+	config.SlackClientSecret = "secret"
+	config.SlackRedirectURL = "https://bot.example.com/slack/oauth/callback"
+	config.SlackInstallAddr = ":3002"
+	config.SlackAppToken = "xapp-1"
+	if problems := validateConfig(config); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
+
+func TestValidateJiraInstances(t *testing.T) {
+	config := BotConfig{SlackAPIKey: "xoxb-1", JiraBaseURL: "https://example.atlassian.net", ClickHouseTable: "jira_bot_events"}
+
+	config.JiraInstances = []JiraInstance{{Name: "onprem", BaseURL: "https://jira.example.com", Auth: "pat", PAT: "pat-1", Projects: []string{"OPS"}}}
+	if problems := validateConfig(config); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+
+	config.JiraInstances = append(config.JiraInstances, JiraInstance{Name: "onprem", BaseURL: "jira.example.com", Auth: "pat", ProjectPattern: "(OPS"})
+	if problems := validateConfig(config); len(problems) != 4 {
+		t.Errorf("Expected the name, URL, token and pattern to be reported, got %v", problems)
+	}
+}
+
+func TestValidateJiraAuth(t *testing.T) {
+	config := BotConfig{SlackAPIKey: "xoxb-1", JiraBaseURL: "https://example.atlassian.net", ClickHouseTable: "jira_bot_events"}
+
+	for auth, expected := range map[string]int{"basic": 0, "api_token": 2, "pat": 1, "oauth": 1} {
+		config.JiraAuth = auth
+		if problems := validateConfig(config); len(problems) != expected {
+			t.Errorf("Expected %d problems with %s auth, got %v", expected, auth, problems)
+		}
+	}
+
+	config.JiraAuth = "api_token"
+	config.JiraUsername = "bot@example.com"
+	config.JiraAPIToken = "token"
+	if problems := validateConfig(config); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
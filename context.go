@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Number of comments included in a context pack
+const contextCommentCount = 3
+
+// Longest comment excerpt included in a context pack
+const contextCommentLength = 300
+
+// The parts of an issue the context pack needs beyond the card
+type issueContext struct {
+	Fields struct {
+		Comment struct {
+			Comments []jiraComment `json:"comments"`
+		} `json:"comment"`
+		IssueLinks []jiraIssueLink `json:"issuelinks"`
+	} `json:"fields"`
+}
+
+type jiraComment struct {
+	Author struct {
+		DisplayName string `json:"displayName"`
+	} `json:"author"`
+	Body    jiraText `json:"body"`
+	Created string   `json:"created"`
+}
+
+type jiraIssueLink struct {
+	Type struct {
+		Inward  string `json:"inward"`
+		Outward string `json:"outward"`
+	} `json:"type"`
+	InwardIssue  *jiraLinkedIssue `json:"inwardIssue"`
+	OutwardIssue *jiraLinkedIssue `json:"outwardIssue"`
+}
+
+type jiraLinkedIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary string `json:"summary"`
+		Status  struct {
+			Name string `json:"name"`
+		} `json:"status"`
+	} `json:"fields"`
+	// The issue as Jira sent it, with every field that was asked for
+	Raw json.RawMessage `json:"-"`
+}
+
+func (issue *jiraLinkedIssue) UnmarshalJSON(data []byte) error {
+	// A type without the method, so decoding doesn't recurse
+	type plainLinkedIssue jiraLinkedIssue
+
+	var decoded plainLinkedIssue
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*issue = jiraLinkedIssue(decoded)
+	issue.Raw = append(json.RawMessage{}, data...)
+
+	return nil
+}
+
+// handleContextCommand answers "@JiraBot context ABC-123" with a thread
+// briefing on the issue: its card, latest comments, linked issues, pull
+// requests and the Slack discussions linked from it. Customer channels only
+// get the card.
+func handleContextCommand(ctx context.Context, message slack.Msg, args []string) {
+	thread := getReplyThread(message)
+
+	issueIDs := extractIssueIDs(strings.Join(args, " "))
+	if len(issueIDs) != 1 {
+		if err := postText(message.Channel, thread, "Usage: `context ABC-123`"); err != nil {
+			log.Printf("handleContextCommand: Error: %v", err)
+		}
+		return
+	}
+	issueID := issueIDs[0]
+
+	if err := checkUserAccess(message.User); err != nil {
+		postEphemeral(message.Channel, message.User, describeCardActionError(err, issueID))
+		return
+	}
+
+	if err := postIssue(ctx, message.Channel, message.User, thread, issueID); err != nil {
+		reportError(message, issueID, err, false)
+		return
+	}
+
+	// Customers only get the customer card, comments and links are internal
+	if isCustomerViewChannel(message.Channel) {
+		return
+	}
+
+	jira, err := getJiraServiceFor(message.Channel, message.User)
+	if err != nil {
+		reportError(message, "the context of "+issueID, err, false)
+		return
+	}
+
+	var details issueContext
+	if err := jira.GetIssueFields(ctx, issueID, "comment,issuelinks", &details); err != nil {
+		reportError(message, "the context of "+issueID, err, false)
+		return
+	}
+
+	links, err := jira.GetRemoteLinks(ctx, issueID)
+	if err != nil {
+		log.Printf("handleContextCommand: Error fetching remote links of %s: %v", issueID, err)
+	}
+	links = append(links, getSlackDiscussions(issueID, links)...)
+
+	for _, section := range formatIssueContext(details, links) {
+		if err := postText(message.Channel, thread, section); err != nil {
+			log.Printf("handleContextCommand: Error: %v", err)
+			return
+		}
+	}
+}
+
+// formatIssueContext renders each part of the context pack as its own message
+func formatIssueContext(details issueContext, links []remoteLink) []string {
+	sections := []string{}
+
+	comments := details.Fields.Comment.Comments
+	if len(comments) > contextCommentCount {
+		comments = comments[len(comments)-contextCommentCount:]
+	}
+	if len(comments) > 0 {
+		var section bytes.Buffer
+		section.WriteString(":speech_balloon: *Latest comments*")
+		for _, c := range comments {
+			body := truncateText(strings.Replace(string(c.Body), "\n", " ", -1), contextCommentLength)
+			section.WriteString(fmt.Sprintf("\n> *%s:* %s", c.Author.DisplayName, body))
+		}
+		sections = append(sections, section.String())
+	}
+
+	if len(details.Fields.IssueLinks) > 0 {
+		var section bytes.Buffer
+		section.WriteString(":link: *Linked issues*")
+		for _, l := range details.Fields.IssueLinks {
+			relation, linked := l.Type.Outward, l.OutwardIssue
+			if linked == nil {
+				relation, linked = l.Type.Inward, l.InwardIssue
+			}
+			if linked == nil {
+				continue
+			}
+			section.WriteString(fmt.Sprintf(
+				"\n> %s <%s|%s> %s (%s)",
+				relation,
+				getJiraURL(linked.Key),
+				linked.Key,
+				linked.Fields.Summary,
+				linked.Fields.Status.Name,
+			))
+		}
+		sections = append(sections, section.String())
+	}
+
+	var pulls, discussions bytes.Buffer
+	for _, l := range links {
+		line := fmt.Sprintf("\n> <%s|%s>", l.Object.URL, l.Object.Title)
+		switch {
+		case isSlackLink(l.Object.URL):
+			discussions.WriteString(line)
+		case isPullRequestLink(l.Object.URL):
+			pulls.WriteString(line)
+		}
+	}
+	if pulls.Len() > 0 {
+		sections = append(sections, ":twisted_rightwards_arrows: *Pull requests*"+pulls.String())
+	}
+	if discussions.Len() > 0 {
+		sections = append(sections, ":speech_balloon: *Slack discussions*"+discussions.String())
+	}
+
+	if len(sections) == 0 {
+		sections = append(sections, "No comments, linked issues or discussions yet.")
+	}
+
+	return sections
+}
+
+// getSlackDiscussions links the threads the bot saw the issue mentioned in,
+// the latest first, leaving out those Jira already links
+func getSlackDiscussions(issueID string, known []remoteLink) []remoteLink {
+	linked := map[string]bool{}
+	for _, l := range known {
+		linked[l.Object.URL] = true
+	}
+
+	discussions := []remoteLink{}
+	threads := getIssueThreads(issueID)
+	for i := len(threads) - 1; i >= 0; i-- {
+		thread := threads[i]
+
+		teamURL, err := getSlackTeamURL(thread.Channel)
+		if err != nil {
+			log.Printf("getSlackDiscussions: Error getting the workspace URL: %v", err)
+			continue
+		}
+
+		permalink := getSlackPermalink(teamURL, thread.Channel, thread.Timestamp)
+		if linked[permalink] {
+			continue
+		}
+
+		title := "Slack discussion"
+		if channel, err := getChannel(thread.Channel); err == nil && channel != nil {
+			title += " in #" + channel.Name
+		}
+		discussions = append(discussions, newSlackRemoteLink(permalink, title))
+	}
+
+	return discussions
+}
+
+func isSlackLink(url string) bool {
+	return strings.Contains(url, ".slack.com/archives/")
+}
+
+func isPullRequestLink(url string) bool {
+	return strings.Contains(url, "/pull/") ||
+		strings.Contains(url, "/pull-requests/") ||
+		strings.Contains(url, "/merge_requests/")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestFormatIssueContext(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	var details issueContext
+	json.Unmarshal([]byte(`{
+		"fields": {
+			"comment": {"comments": [
+				{"author": {"displayName": "A"}, "body": "first"},
+				{"author": {"displayName": "B"}, "body": "second"},
+				{"author": {"displayName": "C"}, "body": "third\nline"},
+				{"author": {"displayName": "D"}, "body": "fourth"}
+			]},
+			"issuelinks": [
+				{"type": {"inward": "is blocked by", "outward": "blocks"}, "outwardIssue": {"key": "ABC-2", "fields": {"summary": "Other", "status": {"name": "Open"}}}}
+			]
+		}
+	}`), &details)
+
+	links := []remoteLink{
+		newSlackRemoteLink("https://example.slack.com/archives/C1/p1", "Slack discussion in #dev"),
+		{Object: remoteLinkObject{URL: "https://github.com/org/repo/pull/7", Title: "Fix it"}},
+		{Object: remoteLinkObject{URL: "https://example.com/docs", Title: "Docs"}},
+	}
+
+	result := formatIssueContext(details, links)
+
+	expected := []string{
+		":speech_balloon: *Latest comments*\n> *B:* second\n> *C:* third line\n> *D:* fourth",
+		":link: *Linked issues*\n> blocks <https://jira.example.com/browse/ABC-2|ABC-2> Other (Open)",
+		":twisted_rightwards_arrows: *Pull requests*\n> <https://github.com/org/repo/pull/7|Fix it>",
+		":speech_balloon: *Slack discussions*\n> <https://example.slack.com/archives/C1/p1|Slack discussion in #dev>",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Unexpected context %#v", result)
+	}
+}
+
+func TestContextCommandInCustomerChannel(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		w.Write([]byte(`{"key": "ABC-1", "fields": {"summary": "Printer on fire", "status": {"name": "Open"}}}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	os.Setenv("CUSTOMER_VIEW_CHANNELS", "C1")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("CUSTOMER_VIEW_CHANNELS")
+	defer setBot(nil)
+	defer forgetCachedIssue("ABC-1")
+
+	handleContextCommand(context.Background(), slack.Msg{Channel: "C1", User: "U1"}, []string{"ABC-1"})
+
+	if len(requests) != 1 {
+		t.Errorf("Expected only the card to be fetched, got %v", requests)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// IDs of the create issue button, message shortcut and modal
+const (
+	actionOpenCreateIssue = "open_create_issue"
+	shortcutCreateIssue   = "create_issue"
+	callbackCreateIssue   = "create_issue"
+)
+
+// Block IDs of the create issue modal's inputs, each with an action of the
+// same ID
+const (
+	blockCreateProject     = "project"
+	blockCreateIssueType   = "issue_type"
+	blockCreateSummary     = "summary"
+	blockCreateDescription = "description"
+)
+
+// Project keys as typed in commands
+var projectKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]+$`)
+
+// Slack allows this many options in a select menu
+const maxSelectOptions = 100
+
+// Jira rejects longer summaries
+const maxSummaryLength = 255
+
+// Slack limits the initial values of inputs to 3000 characters, so messages
+// are cut well before that when prefilling a description
+const maxPrefillDescriptionLength = 2500
+
+// What the create issue modal starts with, and where to confirm the new issue
+type createIssuePrefill struct {
+	Project     string `json:"project,omitempty"`
+	Summary     string `json:"summary,omitempty"`
+	Description string `json:"description,omitempty"`
+	Channel     string `json:"channel"`
+	Thread      string `json:"thread,omitempty"`
+}
+
+// handleCreateCommand answers "@JiraBot create [ABC] [summary]". Mentions
+// can't open a modal, so the user gets a button that does.
+func handleCreateCommand(ctx context.Context, message slack.Msg, args []string) {
+	prefill := createIssuePrefill{Channel: message.Channel, Thread: getReplyThread(message)}
+	prefill.Project, prefill.Summary = parseCreateArgs(args)
+
+	// Button values are limited to 2000 characters
+	prefill.Summary = truncateText(prefill.Summary, maxSummaryLength)
+
+	value, err := json.Marshal(prefill)
+	if err != nil {
+		log.Printf("handleCreateCommand: Error: %v", err)
+		return
+	}
+
+	button := slack.NewButtonBlockElement(actionOpenCreateIssue, string(value), newPlainText("Create issue"))
+	text := "Fill in the issue in a form:"
+
+	if err := postEphemeral(message.Channel, message.User, text, slack.MsgOptionBlocks(
+		slack.NewSectionBlock(newMarkdownText(text), nil, slack.NewAccessory(button.WithStyle(slack.StylePrimary))),
+	)); err != nil {
+		log.Printf("handleCreateCommand: Error: %v", err)
+	}
+}
+
+// parseCreateArgs reads an optional project key and summary
+func parseCreateArgs(args []string) (string, string) {
+	if len(args) > 0 && isJiraProjectKey(args[0]) {
+		return args[0], strings.Join(args[1:], " ")
+	}
+
+	return "", strings.Join(args, " ")
+}
+
+// isJiraProjectKey reports whether Jira has a project with the key. Until
+// the projects have been fetched, any upper case word counts.
+func isJiraProjectKey(value string) bool {
+	return projectKeyPattern.MatchString(value) && len(filterKnownIssueIDs([]string{value + "-1"})) == 1
+}
+
+func handleOpenCreateIssue(callback slack.InteractionCallback, action *slack.BlockAction) {
+	var prefill createIssuePrefill
+	if err := json.Unmarshal([]byte(action.Value), &prefill); err != nil {
+		log.Printf("handleOpenCreateIssue: Unexpected value %q", action.Value)
+		return
+	}
+
+	openCreateIssueModal(callback.TriggerID, callback.User.ID, prefill)
+}
+
+// handleCreateShortcut opens the create issue modal for the message the
+// shortcut was used on
+func handleCreateShortcut(callback slack.InteractionCallback) {
+	prefill := createIssuePrefill{
+		Channel:     callback.Channel.ID,
+		Thread:      getReplyThread(callback.Message.Msg),
+		Description: slackUnescaper.Replace(callback.Message.Text),
+	}
+	prefill.Summary = strings.SplitN(prefill.Description, "\n", 2)[0]
+
+	if issueIDs := extractIssueIDs(callback.Message.Text); len(issueIDs) > 0 {
+		prefill.Project = getProjectKey(issueIDs[0])
+	}
+
+	if teamURL, err := getSlackTeamURL(callback.Channel.ID); err == nil {
+		prefill.Description += "\n\nFrom Slack: " + getSlackPermalink(teamURL, callback.Channel.ID, callback.Message.Timestamp)
+	}
+
+	openCreateIssueModal(callback.TriggerID, callback.User.ID, prefill)
+}
+
+// handleSlashCreate answers "/jira create [ABC] [summary]"
+func handleSlashCreate(command slack.SlashCommand, args []string) {
+	prefill := createIssuePrefill{Channel: command.ChannelID}
+	prefill.Project, prefill.Summary = parseCreateArgs(args)
+
+	openCreateIssueModal(command.TriggerID, command.UserID, prefill)
+}
+
+func openCreateIssueModal(triggerID string, user string, prefill createIssuePrefill) {
+	if err := checkWritable(); err != nil {
+		postEphemeral(prefill.Channel, user, describeCardActionError(err, "the issue"))
+		return
+	}
+	if err := checkUserAccess(user); err != nil {
+		postEphemeral(prefill.Channel, user, describeCardActionError(err, "the issue"))
+		return
+	}
+
+	metadata, err := getJiraMetadata()
+	if err != nil {
+		log.Printf("openCreateIssueModal: Error fetching issue types: %v", err)
+	}
+
+	prefill.Summary = truncateText(prefill.Summary, maxSummaryLength)
+	prefill.Description = truncateText(prefill.Description, maxPrefillDescriptionLength)
+
+	private, _ := json.Marshal(createIssuePrefill{Channel: prefill.Channel, Thread: prefill.Thread})
+
+	_, err = getSlackAPIFor(user).OpenView(triggerID, slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      callbackCreateIssue,
+		Title:           newPlainText("Create issue"),
+		Submit:          newPlainText("Create"),
+		Close:           newPlainText("Cancel"),
+		Blocks:          slack.Blocks{BlockSet: formatCreateIssueBlocks(prefill, getJiraProjectKeys(), metadata.IssueTypes)},
+		PrivateMetadata: string(private),
+	})
+	if err != nil {
+		log.Printf("openCreateIssueModal: Error: %v", err)
+	}
+}
+
+// formatCreateIssueBlocks builds the modal's inputs. Projects and issue types
+// are picked from menus where Slack allows menus that long.
+func formatCreateIssueBlocks(prefill createIssuePrefill, projects []string, issueTypes []jiraIssueType) []slack.Block {
+	names := []string{}
+	for _, issueType := range issueTypes {
+		if !issueType.Subtask {
+			names = append(names, issueType.Name)
+		}
+	}
+
+	summary := slack.NewPlainTextInputBlockElement(nil, blockCreateSummary)
+	summary.InitialValue = prefill.Summary
+	summary.MaxLength = maxSummaryLength
+
+	description := slack.NewPlainTextInputBlockElement(nil, blockCreateDescription)
+	description.InitialValue = prefill.Description
+	description.Multiline = true
+
+	descriptionBlock := slack.NewInputBlock(blockCreateDescription, newPlainText("Description"), nil, description)
+	descriptionBlock.Optional = true
+
+	return []slack.Block{
+		slack.NewInputBlock(blockCreateProject, newPlainText("Project"), nil, newChoiceInput(blockCreateProject, projects, prefill.Project)),
+		slack.NewInputBlock(blockCreateIssueType, newPlainText("Issue type"), nil, newChoiceInput(blockCreateIssueType, names, "Task")),
+		slack.NewInputBlock(blockCreateSummary, newPlainText("Summary"), nil, summary),
+		descriptionBlock,
+	}
+}
+
+// newChoiceInput is a select menu of the choices, or a text input if there
+// are too many of them or none are known
+func newChoiceInput(actionID string, choices []string, initial string) slack.BlockElement {
+	if len(choices) == 0 || len(choices) > maxSelectOptions {
+		input := slack.NewPlainTextInputBlockElement(nil, actionID)
+		input.InitialValue = initial
+		return input
+	}
+
+	options := []*slack.OptionBlockObject{}
+	var initialOption *slack.OptionBlockObject
+	for _, choice := range choices {
+		option := slack.NewOptionBlockObject(choice, newPlainText(choice), nil)
+		if strings.EqualFold(choice, initial) {
+			initialOption = option
+		}
+		options = append(options, option)
+	}
+
+	menu := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, nil, actionID, options...)
+	menu.InitialOption = initialOption
+
+	return menu
+}
+
+func newPlainText(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.PlainTextType, text, false, false)
+}
+
+// handleCreateIssueSubmission creates the issue filled in the modal and
+// confirms it where the user asked for it
+func handleCreateIssueSubmission(callback slack.InteractionCallback) {
+	var target createIssuePrefill
+	if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &target); err != nil || callback.View.State == nil {
+		log.Printf("handleCreateIssueSubmission: Unexpected view %q", callback.View.PrivateMetadata)
+		return
+	}
+
+	if err := checkUserAccess(callback.User.ID); err != nil {
+		postEphemeral(target.Channel, callback.User.ID, describeCardActionError(err, "the issue"))
+		return
+	}
+
+	state := callback.View.State
+	project := strings.ToUpper(getViewValue(state, blockCreateProject))
+	summary := getViewValue(state, blockCreateSummary)
+
+	// Interactions only carry the user's ID and handle
+	author := callback.User
+	if user, err := getSlackAPIFor(author.ID).GetUserInfo(author.ID); err == nil && user != nil {
+		author = *user
+	}
+
+	jira, err := getJiraServiceFor(target.Channel, callback.User.ID)
+	if err != nil {
+		postEphemeral(target.Channel, callback.User.ID, describeCardActionError(err, "the issue"))
+		return
+	}
+
+	issueKey, err := createJiraIssue(context.Background(), jira, project, getViewValue(state, blockCreateIssueType), summary,
+		formatSlackComment(author, getViewValue(state, blockCreateDescription)))
+	if err != nil {
+		reportError(slack.Msg{Channel: target.Channel}, "a new "+project+" issue", err, false)
+		if err := postEphemeral(target.Channel, callback.User.ID, describeCreateError(err, project)); err != nil {
+			log.Printf("handleCreateIssueSubmission: Error: %v", err)
+		}
+		return
+	}
+
+	log.Printf("handleCreateIssueSubmission: %s created %s", callback.User.ID, issueKey)
+	recordEvent("create", map[string]interface{}{
+		"channel": target.Channel,
+		"user":    callback.User.ID,
+		"issue":   issueKey,
+	})
+
+	text := fmt.Sprintf(":sparkles: <@%s> created <%s|%s> %s", callback.User.ID, getJiraURL(issueKey), issueKey, summary)
+	if err := postText(target.Channel, target.Thread, text); err != nil {
+		log.Printf("handleCreateIssueSubmission: Error confirming %s: %v", issueKey, err)
+		postEphemeral(target.Channel, callback.User.ID, text)
+	}
+}
+
+// getViewValue reads an input of a submitted modal, whether it is a text
+// input or a menu
+func getViewValue(state *slack.ViewState, blockID string) string {
+	input := state.Values[blockID][blockID]
+	if input.SelectedOption.Value != "" {
+		return input.SelectedOption.Value
+	}
+
+	return strings.TrimSpace(input.Value)
+}
+
+// createJiraIssue files an issue as the bot and returns its key
+func createJiraIssue(ctx context.Context, jira JiraService, project string, issueType string, summary string, description string) (string, error) {
+	if err := checkWritable(); err != nil {
+		return "", err
+	}
+
+	fields := map[string]interface{}{
+		"project":   map[string]string{"key": project},
+		"issuetype": map[string]string{"name": issueType},
+		"summary":   summary,
+	}
+	if description != "" {
+		fields["description"] = newJiraBody(project, description)
+	}
+
+	return jira.CreateIssue(ctx, fields)
+}
+
+// describeCreateError passes on what Jira didn't like about the issue, like
+// a missing required field
+func describeCreateError(err error, project string) string {
+	var requestError *jiraRequestError
+	if errors.As(err, &requestError) && requestError.StatusCode == 400 && len(requestError.Messages) > 0 {
+		return ":warning: Jira couldn't create the issue:\n> " + strings.Join(requestError.Messages, "\n> ")
+	}
+
+	return describeCardActionError(err, "a new "+project+" issue")
+}
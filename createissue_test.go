@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestParseCreateArgs(t *testing.T) {
+	jiraProjects.keys = map[string]bool{"WEB": true}
+	defer func() { jiraProjects.keys = nil }()
+
+	if project, summary := parseCreateArgs(strings.Fields("WEB Login is broken")); project != "WEB" || summary != "Login is broken" {
+		t.Errorf("Unexpected project %q and summary %q", project, summary)
+	}
+	if project, summary := parseCreateArgs(strings.Fields("OPS Disk full")); project != "" || summary != "OPS Disk full" {
+		t.Errorf("Expected unknown projects to be part of the summary, got %q and %q", project, summary)
+	}
+}
+
+func TestFormatCreateIssueBlocks(t *testing.T) {
+	issueTypes := []jiraIssueType{{ID: "1", Name: "Bug"}, {ID: "2", Name: "Task"}, {ID: "3", Name: "Sub-task", Subtask: true}}
+	prefill := createIssuePrefill{Project: "WEB", Summary: "Login is broken"}
+
+	blocks := formatCreateIssueBlocks(prefill, []string{"OPS", "WEB"}, issueTypes)
+	if len(blocks) != 4 {
+		t.Fatalf("Expected 4 inputs, got %d", len(blocks))
+	}
+
+	project := blocks[0].(*slack.InputBlock).Element.(*slack.SelectBlockElement)
+	if len(project.Options) != 2 || project.InitialOption == nil || project.InitialOption.Value != "WEB" {
+		t.Errorf("Expected a project menu starting at WEB, got %+v", project)
+	}
+
+	issueType := blocks[1].(*slack.InputBlock).Element.(*slack.SelectBlockElement)
+	if len(issueType.Options) != 2 || issueType.InitialOption.Value != "Task" {
+		t.Errorf("Expected a menu of the issue types without sub-tasks, got %+v", issueType)
+	}
+
+	// Without known projects the project is typed in
+	blocks = formatCreateIssueBlocks(prefill, nil, issueTypes)
+	if input, ok := blocks[0].(*slack.InputBlock).Element.(*slack.PlainTextInputBlockElement); !ok || input.InitialValue != "WEB" {
+		t.Errorf("Expected a text input for the project, got %+v", blocks[0])
+	}
+}
+
+func TestCreateJiraIssue(t *testing.T) {
+	var body map[string]map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if body["fields"]["summary"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors": {"summary": "You must specify a summary of the issue."}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": "10000", "key": "WEB-42"}`)
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	os.Setenv("JIRA_DEPLOYMENT", "server")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+
+	key, err := createJiraIssue(context.Background(), newRESTJiraService(), "WEB", "Bug", "Login is broken", "Since the deploy")
+	if err != nil || key != "WEB-42" {
+		t.Fatalf("Expected WEB-42, got %q and %v", key, err)
+	}
+	if body["fields"]["description"] != "Since the deploy" {
+		t.Errorf("Unexpected fields %v", body["fields"])
+	}
+
+	_, err = createJiraIssue(context.Background(), newRESTJiraService(), "WEB", "Bug", "", "")
+	if text := describeCreateError(err, "WEB"); !strings.Contains(text, "You must specify a summary") {
+		t.Errorf("Expected Jira's reason, got %q", text)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+const customerUsage = "Usage: `customer on` shows issues in this channel as the customers of a service desk see them, `customer off` shows the full cards again."
+
+// Key of the channels switched to or from the customer view in the state store
+const customerViewStateKey = "customer_view"
+
+// Comments and participants read of a service desk request
+const maxServiceDeskValues = 50
+
+// Members of a customer channel checked against a request's participants.
+// Requests aren't shown in bigger channels.
+const maxCustomerChannelMembers = 1000
+
+func init() {
+	registerStateKind(customerViewStateKey, loadCustomerViews)
+}
+
+// Channels switched to (true) or from (false) the customer view with the
+// customer command, which wins over CUSTOMER_VIEW_CHANNELS
+var customerViews = struct {
+	sync.Mutex
+	channels map[string]bool
+}{channels: map[string]bool{}}
+
+// What the customers of a Jira Service Management request see of it
+type serviceDeskRequest struct {
+	// Public comments, oldest first
+	Comments []serviceDeskComment
+	// Whether everyone in the channel may see the request in the portal
+	Shared bool
+}
+
+type serviceDeskComment struct {
+	Body   string   `json:"body"`
+	Public bool     `json:"public"`
+	Author jiraUser `json:"author"`
+}
+
+// isCustomerViewChannel reports whether issues in the channel get the
+// customer card
+func isCustomerViewChannel(channel string) bool {
+	customerViews.Lock()
+	refreshSharedCustomerViews()
+	enabled, ok := customerViews.channels[channel]
+	customerViews.Unlock()
+	if ok {
+		return enabled
+	}
+
+	return containsString(getConfig().CustomerViewChannels, channel)
+}
+
+// handleCustomerCommand switches the channel to or from the customer view on
+// "@JiraBot customer on" or "off". Only admins may, as the full cards show
+// internal people and comments.
+func handleCustomerCommand(ctx context.Context, message slack.Msg, args []string) {
+	thread := getReplyThread(message)
+	reply := func(text string) {
+		if err := postText(message.Channel, thread, text); err != nil {
+			log.Printf("handleCustomerCommand: Error: %v", err)
+		}
+	}
+
+	if len(args) != 1 || (strings.ToLower(args[0]) != "on" && strings.ToLower(args[0]) != "off") {
+		reply(customerUsage)
+		return
+	}
+	if !isAdmin(message.User) {
+		reply("Only admins can change how issues are shown here.")
+		return
+	}
+
+	enabled := strings.ToLower(args[0]) == "on"
+	if err := setCustomerView(message.Channel, enabled); err != nil {
+		log.Printf("handleCustomerCommand: Error: %v", err)
+		reply(":warning: I couldn't save that, try again.")
+		return
+	}
+
+	recordEvent("customer_view", map[string]interface{}{
+		"channel": message.Channel,
+		"user":    message.User,
+		"enabled": enabled,
+	})
+	if enabled {
+		reply(":busts_in_silhouette: I'll show service desk requests here as their customers see them, and nothing of other issues but their key.")
+	} else {
+		reply(":card_index: I'll show full cards here again.")
+	}
+}
+
+// setCustomerView switches a channel to or from the customer view regardless
+// of CUSTOMER_VIEW_CHANNELS
+func setCustomerView(channel string, enabled bool) error {
+	defer lockSharedState(customerViewStateKey)()
+	customerViews.Lock()
+	defer customerViews.Unlock()
+	refreshSharedCustomerViews()
+
+	customerViews.channels[channel] = enabled
+
+	return saveCustomerViews()
+}
+
+// loadCustomerViews restores the channels switched by command
+func loadCustomerViews() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadCustomerViews: Error: %v", err)
+		return
+	}
+
+	channels := map[string]bool{}
+	if ok, err := store.Load(customerViewStateKey, &channels); err != nil || !ok {
+		if err != nil {
+			log.Printf("loadCustomerViews: Error: %v", err)
+		}
+		return
+	}
+
+	customerViews.Lock()
+	customerViews.channels = channels
+	customerViews.Unlock()
+
+	log.Printf("loadCustomerViews: %d channels were switched", len(channels))
+}
+
+// refreshSharedCustomerViews reads the channels again, as other replicas may
+// have switched them. The caller holds the lock of customerViews.
+func refreshSharedCustomerViews() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedCustomerViews: Error: %v", err)
+		return
+	}
+
+	channels := map[string]bool{}
+	if _, err := store.Load(customerViewStateKey, &channels); err != nil {
+		log.Printf("refreshSharedCustomerViews: Error: %v", err)
+		return
+	}
+	customerViews.channels = channels
+}
+
+// saveCustomerViews persists the channels. The caller holds the lock of
+// customerViews.
+func saveCustomerViews() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(customerViewStateKey, customerViews.channels)
+}
+
+// loadCustomerRequest adds what customers see of a service desk request to
+// the issue, for its card in a customer channel. Requests that couldn't be
+// read stay hidden.
+func loadCustomerRequest(ctx context.Context, channel string, user string, issue jiraIssue) jiraIssue {
+	if !isServiceDeskRequest(issue) {
+		return issue
+	}
+
+	jira, err := getJiraServiceFor(channel, user)
+	if err != nil {
+		log.Printf("loadCustomerRequest: Error: %v", err)
+		return issue
+	}
+
+	comments, err := jira.GetRequestComments(ctx, issue.Key)
+	if err != nil {
+		log.Printf("loadCustomerRequest: Error reading the comments of %s: %v", issue.Key, err)
+		return issue
+	}
+	participants, err := jira.GetRequestParticipants(ctx, issue.Key)
+	if err != nil {
+		log.Printf("loadCustomerRequest: Error reading the participants of %s: %v", issue.Key, err)
+		return issue
+	}
+
+	request := &serviceDeskRequest{Comments: []serviceDeskComment{}}
+	for _, comment := range comments {
+		if comment.Public {
+			request.Comments = append(request.Comments, comment)
+		}
+	}
+
+	if issue.Fields.Reporter != nil {
+		participants = append(participants, *issue.Fields.Reporter)
+	}
+	request.Shared = isSharedWithChannel(channel, participants)
+
+	issue.Request = request
+	return issue
+}
+
+// isSharedWithChannel reports whether everyone in the channel may see a
+// request in the customer portal, following its visibility rules: agents,
+// who are the trusted users of ALLOWED_EMAIL_DOMAINS, see every request,
+// customers only those they reported or take part in. Customers are matched
+// to the people of the request by email.
+func isSharedWithChannel(channel string, people []jiraUser) bool {
+	emails := map[string]bool{}
+	for _, person := range people {
+		if person.EmailAddress != "" {
+			emails[strings.ToLower(person.EmailAddress)] = true
+		}
+	}
+
+	members := []string{}
+	cursor := ""
+	for {
+		page, next, err := getSlackAPIFor(channel).GetUsersInConversation(&slack.GetUsersInConversationParameters{
+			ChannelID: channel,
+			Cursor:    cursor,
+			Limit:     200,
+		})
+		if err != nil {
+			log.Printf("isSharedWithChannel: Error listing the members of %s: %v", channel, err)
+			return false
+		}
+
+		members = append(members, page...)
+		if len(members) > maxCustomerChannelMembers {
+			log.Printf("isSharedWithChannel: %s has more than %d members", channel, maxCustomerChannelMembers)
+			return false
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	// Without ALLOWED_EMAIL_DOMAINS everyone is trusted, so nobody is known
+	// to be an agent
+	agents := len(getConfig().AllowedEmailDomains) > 0
+
+	for _, member := range members {
+		checked, err := checkSlackUser(member)
+		if err != nil {
+			log.Printf("isSharedWithChannel: Error reading the profile of %s: %v", member, err)
+			return false
+		}
+
+		if checked.bot || (agents && isTrustedUser(member)) {
+			continue
+		}
+		if checked.email == "" || !emails[strings.ToLower(checked.email)] {
+			return false
+		}
+	}
+
+	return true
+}
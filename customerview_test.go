@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestCustomerViewCommandWinsOverConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "customerview")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DATA_DIR", dir)
+	os.Setenv("CUSTOMER_VIEW_CHANNELS", "C1")
+	defer os.Unsetenv("DATA_DIR")
+	defer os.Unsetenv("CUSTOMER_VIEW_CHANNELS")
+	defer func() {
+		customerViews.Lock()
+		customerViews.channels = map[string]bool{}
+		customerViews.Unlock()
+	}()
+
+	if !isCustomerViewChannel("C1") || isCustomerViewChannel("C2") {
+		t.Fatalf("Expected only the configured channel to get the customer view")
+	}
+
+	if err := setCustomerView("C1", false); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := setCustomerView("C2", true); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	customerViews.Lock()
+	customerViews.channels = map[string]bool{}
+	customerViews.Unlock()
+	loadCustomerViews()
+
+	if isCustomerViewChannel("C1") || !isCustomerViewChannel("C2") {
+		t.Errorf("Expected the switched channels to be restored")
+	}
+}
+
+func TestLoadCustomerRequestKeepsPublicComments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/servicedeskapi/request/HELP-42/comment":
+			if r.URL.Query().Get("public") != "true" || r.URL.Query().Get("internal") != "false" {
+				t.Errorf("Expected only public comments to be asked for, got %v", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"values": [
+				{"body": "We're on it", "public": true, "author": {"displayName": "Jane Agent"}},
+				{"body": "Customer is on the old plan", "public": false, "author": {"displayName": "John Agent"}}
+			]}`))
+		case "/rest/servicedeskapi/request/HELP-42/participant":
+			w.Write([]byte(`{"values": [{"displayName": "Pat Participant", "emailAddress": "pat@customer.example.org"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	os.Setenv("JIRA_DEPLOYMENT", "server")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+	setBot(&jiraBot{jira: newJiraRouter(newRESTJiraService())})
+	defer setBot(nil)
+
+	issue := decodeIssue(t, `{
+		"key": "HELP-42",
+		"fields": {
+			"summary": "Cannot reset my password",
+			"status": {"name": "Open"},
+			"project": {"key": "HELP", "projectTypeKey": "service_desk"}
+		}
+	}`)
+
+	issue = loadCustomerRequest(context.Background(), "C1", "U1", issue)
+	if issue.Request == nil {
+		t.Fatalf("Expected the request to be read")
+	}
+	if len(issue.Request.Comments) != 1 || issue.Request.Comments[0].Body != "We're on it" {
+		t.Errorf("Expected only the public comment, got %+v", issue.Request.Comments)
+	}
+
+	internal := decodeIssue(t, `{"key": "OPS-7", "fields": {"project": {"key": "OPS", "projectTypeKey": "software"}}}`)
+	if loadCustomerRequest(context.Background(), "C1", "U1", internal).Request != nil {
+		t.Errorf("Expected internal issues not to be read as requests")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const snapshotUsage = "Usage: `snapshot goroutine` sends you a dump of every goroutine's stack, `snapshot heap` a heap profile for `go tool pprof`."
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+}
+
+// serveDebug serves pprof and expvar for admins with the debug token. The
+// handlers are registered on a mux of their own, as importing the packages
+// adds them to http.DefaultServeMux without any protection.
+func serveDebug(addr string) {
+	log.Printf("serveDebug: Listening on %s", addr)
+
+	if err := http.ListenAndServe(addr, newDebugHandler()); err != nil {
+		log.Printf("serveDebug: Error: %v", err)
+	}
+}
+
+func newDebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return requireDebugToken(mux)
+}
+
+// requireDebugToken only lets requests through that carry the debug token
+// as bearer token
+func requireDebugToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := getConfig().DebugToken
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			log.Print("requireDebugToken: Rejecting request without a valid token")
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// captureSnapshot writes a goroutine dump as text, or a heap profile in the
+// format pprof reads, and returns it with a file name
+func captureSnapshot(kind string, now time.Time) ([]byte, string, error) {
+	var buffer bytes.Buffer
+	name := "jira-bot-" + kind + "-" + now.UTC().Format("20060102-150405")
+
+	switch kind {
+	case "goroutine":
+		if err := runtimepprof.Lookup("goroutine").WriteTo(&buffer, 2); err != nil {
+			return nil, "", err
+		}
+		name += ".txt"
+	case "heap":
+		runtime.GC()
+		if err := runtimepprof.Lookup("heap").WriteTo(&buffer, 0); err != nil {
+			return nil, "", err
+		}
+		name += ".pb.gz"
+	default:
+		return nil, "", fmt.Errorf("unknown snapshot %q", kind)
+	}
+
+	return buffer.Bytes(), name, nil
+}
+
+// handleSnapshotCommand sends an admin a goroutine dump or heap profile as
+// a file in a direct message
+func handleSnapshotCommand(ctx context.Context, message slack.Msg, args []string) {
+	reply := func(text string) {
+		if err := postEphemeral(message.Channel, message.User, text); err != nil {
+			log.Printf("handleSnapshotCommand: Error: %v", err)
+		}
+	}
+
+	if !isAdmin(message.User) {
+		reply("Only admins can take snapshots.")
+		return
+	}
+	if len(args) != 1 {
+		reply(snapshotUsage)
+		return
+	}
+
+	content, name, err := captureSnapshot(strings.ToLower(args[0]), time.Now())
+	if err != nil {
+		reply(snapshotUsage)
+		return
+	}
+
+	im, _, _, err := getSlackAPIFor(message.User).OpenConversation(&slack.OpenConversationParameters{Users: []string{message.User}})
+	if err != nil {
+		log.Printf("handleSnapshotCommand: Error opening a direct message: %v", err)
+		reply(":warning: I couldn't send you a direct message.")
+		return
+	}
+
+	if _, err := getSlackAPIFor(message.User).UploadFileV2(slack.UploadFileV2Parameters{
+		Content:  string(content),
+		FileSize: len(content),
+		Filename: name,
+		Title:    name,
+		Channel:  im.ID,
+	}); err != nil {
+		log.Printf("handleSnapshotCommand: Error uploading: %v", err)
+		reply(":warning: I couldn't upload the snapshot.")
+		return
+	}
+
+	recordEvent("snapshot", map[string]interface{}{"user": message.User, "kind": args[0]})
+	reply(":camera: I sent you the snapshot in a direct message.")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugHandlerRequiresToken(t *testing.T) {
+	os.Setenv("DEBUG_TOKEN", "0123456789abcdef")
+	defer os.Unsetenv("DEBUG_TOKEN")
+
+	handler := newDebugHandler()
+	for token, expected := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "0123456789abcdef": http.StatusOK} {
+		request := httptest.NewRequest("GET", "/debug/vars", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != expected {
+			t.Errorf("Expected %d with token %q, got %d", expected, token, response.Code)
+		}
+		if expected == http.StatusOK && !strings.Contains(response.Body.String(), `"goroutines"`) {
+			t.Errorf("Expected the goroutine count, got %s", response.Body.String())
+		}
+	}
+}
+
+func TestCaptureSnapshot(t *testing.T) {
+	content, name, err := captureSnapshot("goroutine", time.Now())
+	if err != nil || !strings.HasSuffix(name, ".txt") || !strings.Contains(string(content), "TestCaptureSnapshot") {
+		t.Errorf("Expected a dump with this test's goroutine, got %q, %v", name, err)
+	}
+
+	if _, name, err := captureSnapshot("heap", time.Now()); err != nil || !strings.HasSuffix(name, ".pb.gz") {
+		t.Errorf("Expected a heap profile, got %q, %v", name, err)
+	}
+	if _, _, err := captureSnapshot("cpu", time.Now()); err == nil {
+		t.Error("Expected unknown snapshots to be rejected")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Kinds of failures, each explained differently to users
+type errorKind string
+
+const (
+	errorKindNotFound    errorKind = "not_found"
+	errorKindForbidden   errorKind = "forbidden"
+	errorKindRateLimited errorKind = "rate_limited"
+	errorKindTimeout     errorKind = "timeout"
+	errorKindBadConfig   errorKind = "bad_config"
+	errorKindUnlinked    errorKind = "unlinked"
+	errorKindUnknown     errorKind = "unknown"
+)
+
+// An error that knows what kind of failure it is
+type botError struct {
+	Kind errorKind
+	Err  error
+}
+
+func (e *botError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *botError) Unwrap() error {
+	return e.Err
+}
+
+func newBotError(kind errorKind, format string, args ...interface{}) error {
+	return &botError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// How many of the latest failures are kept for the App Home
+const maxRecentErrors = 5
+
+type recentError struct {
+	Time    time.Time
+	Kind    errorKind
+	Subject string
+	Err     error
+}
+
+// Failures per kind since the bot started, and the latest ones
+var errorCounts = struct {
+	sync.Mutex
+	counts map[errorKind]int
+	recent []recentError
+}{counts: map[errorKind]int{}}
+
+func getErrorKind(err error) errorKind {
+	var typed *botError
+	if errors.As(err, &typed) {
+		return typed.Kind
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errorKindTimeout
+	}
+
+	return errorKindUnknown
+}
+
+func getErrorKindForStatus(status int) errorKind {
+	switch status {
+	case http.StatusNotFound:
+		return errorKindNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errorKindForbidden
+	case http.StatusTooManyRequests:
+		return errorKindRateLimited
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return errorKindTimeout
+	}
+
+	return errorKindUnknown
+}
+
+// reportError logs and counts a failure and explains it to the user whose
+// message caused it. Passive expansions don't explain missing issues, as most
+// of those are false positives like "UTF-8".
+func reportError(message slack.Msg, subject string, err error, passive bool) {
+	kind := getErrorKind(err)
+	log.Printf("reportError: %s failed (%s): %v", subject, kind, err)
+
+	errorCounts.Lock()
+	errorCounts.counts[kind]++
+	errorCounts.recent = append(errorCounts.recent, recentError{Time: time.Now(), Kind: kind, Subject: subject, Err: err})
+	if len(errorCounts.recent) > maxRecentErrors {
+		errorCounts.recent = errorCounts.recent[1:]
+	}
+	errorCounts.Unlock()
+
+	if (passive && kind == errorKindNotFound) || message.User == "" {
+		return
+	}
+
+	if err := postEphemeral(message.Channel, message.User, describeError(kind, subject)); err != nil {
+		log.Printf("reportError: Error: %v", err)
+	}
+}
+
+func describeError(kind errorKind, subject string) string {
+	switch kind {
+	case errorKindNotFound:
+		return fmt.Sprintf(":mag: I couldn't find %s in Jira, or I'm not allowed to see it.", subject)
+	case errorKindForbidden:
+		return fmt.Sprintf(":lock: Jira didn't let me access %s.", subject)
+	case errorKindRateLimited:
+		return fmt.Sprintf(":hourglass: Jira is rate limiting me, try %s again in a minute.", subject)
+	case errorKindTimeout:
+		return fmt.Sprintf(":hourglass: Jira took too long to answer for %s, try again later.", subject)
+	case errorKindBadConfig:
+		return ":wrench: My Jira connection isn't configured correctly, please tell an admin."
+	case errorKindUnlinked:
+		return fmt.Sprintf(":link: Link your Jira account with `@JiraBot link` first, so I look up %s as you.", subject)
+	}
+
+	return fmt.Sprintf(":warning: Something went wrong with %s.", subject)
+}
+
+// handleErrorsCommand shows admins how many failures of each kind happened
+func handleErrorsCommand(ctx context.Context, message slack.Msg, args []string) {
+	if !isAdmin(message.User) {
+		postEphemeral(message.Channel, message.User, "Only admins can see error counts.")
+		return
+	}
+
+	if err := postEphemeral(message.Channel, message.User, formatErrorCounts()); err != nil {
+		log.Printf("handleErrorsCommand: Error: %v", err)
+	}
+}
+
+func formatErrorCounts() string {
+	errorCounts.Lock()
+	defer errorCounts.Unlock()
+
+	if len(errorCounts.counts) == 0 {
+		return "No errors since the bot started."
+	}
+
+	kinds := []string{}
+	for kind := range errorCounts.counts {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+
+	text := "*Errors since the bot started*"
+	for _, kind := range kinds {
+		text += fmt.Sprintf("\n> %s: %d", kind, errorCounts.counts[errorKind(kind)])
+	}
+
+	return text
+}
+
+func isAdmin(userID string) bool {
+	for _, admin := range getConfig().AdminUsers {
+		if admin == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getRecentErrors returns the latest failures, the newest first
+func getRecentErrors() []recentError {
+	errorCounts.Lock()
+	defer errorCounts.Unlock()
+
+	result := []recentError{}
+	for i := len(errorCounts.recent) - 1; i >= 0; i-- {
+		result = append(result, errorCounts.recent[i])
+	}
+
+	return result
+}
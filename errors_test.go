@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGetErrorKind(t *testing.T) {
+	wrapped := fmt.Errorf("fetching: %w", newBotError(errorKindForbidden, "no access"))
+
+	if kind := getErrorKind(wrapped); kind != errorKindForbidden {
+		t.Errorf("Expected forbidden, got %v", kind)
+	}
+
+	if kind := getErrorKind(errors.New("boom")); kind != errorKindUnknown {
+		t.Errorf("Expected unknown, got %v", kind)
+	}
+}
+
+func TestGetErrorKindForStatus(t *testing.T) {
+	expected := map[int]errorKind{
+		http.StatusNotFound:            errorKindNotFound,
+		http.StatusUnauthorized:        errorKindForbidden,
+		http.StatusTooManyRequests:     errorKindRateLimited,
+		http.StatusGatewayTimeout:      errorKindTimeout,
+		http.StatusInternalServerError: errorKindUnknown,
+	}
+
+	for status, kind := range expected {
+		if result := getErrorKindForStatus(status); result != kind {
+			t.Errorf("Expected %v for %v, got %v", kind, status, result)
+		}
+	}
+}
+
+func TestFormatErrorCounts(t *testing.T) {
+	errorCounts.Lock()
+	errorCounts.counts = map[errorKind]int{errorKindTimeout: 2, errorKindNotFound: 5}
+	errorCounts.Unlock()
+
+	result := formatErrorCounts()
+
+	if result != "*Errors since the bot started*\n> not_found: 5\n> timeout: 2" {
+		t.Errorf("Unexpected error counts %q", result)
+	}
+}
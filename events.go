@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// An event the bot processed, or an action it took
+type botEvent struct {
+	Time time.Time   `json:"time"`
+	Kind string      `json:"kind"`
+	Data interface{} `json:"data"`
+}
+
+// A destination for bot events, like the file archive or an analytics
+// database. Send must not block on slow destinations.
+type eventSink interface {
+	Send(event botEvent)
+}
+
+// Sinks that buffer events before sending them on
+type queuedSink interface {
+	QueueDepth() int
+}
+
+// Sinks that keep events and can delete them again
+type purgeableSink interface {
+	// Purge deletes the events past the sink's retention
+	Purge(now time.Time) error
+	// PurgeUser deletes the events of a Slack user
+	PurgeUser(userID string) error
+}
+
+// The sinks events go to, set up once at startup
+var eventSinks []eventSink
+
+// setupEventSinks creates a sink for every configured destination
+func setupEventSinks() {
+	config := getConfig()
+
+	if config.ArchiveDir != "" {
+		eventSinks = append(eventSinks, newFileArchive(config.ArchiveDir, config.ArchiveRetentionDays))
+		log.Printf("setupEventSinks: Archiving events to %s", config.ArchiveDir)
+	}
+
+	if config.ClickHouseURL != "" {
+		eventSinks = append(eventSinks, newClickHouseSink(config.ClickHouseURL, config.ClickHouseTable, config.ClickHouseRetentionDays))
+		log.Printf("setupEventSinks: Streaming events to ClickHouse table %s", config.ClickHouseTable)
+	}
+}
+
+// recordEvent hands an event to every sink
+func recordEvent(kind string, data interface{}) {
+	event := botEvent{Time: time.Now().UTC(), Kind: kind, Data: data}
+
+	for _, sink := range eventSinks {
+		sink.Send(event)
+	}
+}
+
+// getEventQueueDepth returns how many events wait to be sent on
+func getEventQueueDepth() int {
+	depth := 0
+
+	for _, sink := range eventSinks {
+		if queued, ok := sink.(queuedSink); ok {
+			depth += queued.QueueDepth()
+		}
+	}
+
+	return depth
+}
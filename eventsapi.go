@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Requests signed longer ago than this are rejected as possible replays
+const maxSignatureAge = 5 * time.Minute
+
+// runEventsAPI receives Slack Events API payloads over HTTP instead of a
+// websocket, for environments where long-lived connections are blocked.
+func runEventsAPI(addr string) {
+	log.Printf("runEventsAPI: Listening on %s", addr)
+	setConnectionStatus(transportEventsAPI, true)
+
+	if err := http.ListenAndServe(addr, newSlackHandler()); err != nil {
+		log.Fatalf("runEventsAPI: Error: %v", err)
+	}
+}
+
+func newSlackHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slack/events", requireSlackSignature(handleSlackEvents))
+	mux.HandleFunc("/slack/interactions", requireSlackSignature(handleSlackInteractions))
+	mux.HandleFunc("/slack/commands", requireSlackSignature(handleSlackCommands))
+
+	return mux
+}
+
+// requireSlackSignature only lets requests through that carry a valid
+// X-Slack-Signature for the configured signing secret. The verified body is
+// put back for the next handler.
+func requireSlackSignature(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "could not read body", http.StatusBadRequest)
+			return
+		}
+
+		if !verifySlackSignature(
+			getConfig().SlackSigningSecret,
+			r.Header.Get("X-Slack-Request-Timestamp"),
+			r.Header.Get("X-Slack-Signature"),
+			body,
+			time.Now(),
+		) {
+			log.Print("requireSlackSignature: Rejecting request with invalid signature")
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+// verifySlackSignature checks a request signature as described in
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(secret string, timestamp string, signature string, body []byte, now time.Time) bool {
+	if secret == "" || timestamp == "" || signature == "" {
+		return false
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func handleSlackEvents(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "could not read body", http.StatusBadRequest)
+		return
+	}
+
+	// Slack checks the endpoint by asking it to echo a challenge
+	var envelope struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if envelope.Type == slackevents.URLVerification {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(envelope.Challenge))
+		return
+	}
+
+	// Retries of events we already got would post duplicate cards
+	if r.Header.Get("X-Slack-Retry-Num") != "" {
+		log.Printf("handleSlackEvents: Ignoring retry (%s)", r.Header.Get("X-Slack-Retry-Reason"))
+		return
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		log.Printf("handleSlackEvents: Error parsing event: %v", err)
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	// Answer right away, Slack retries events that take longer than 3 seconds
+	go handleEventsAPIEvent(event)
+	go handleHuddlePayload(body)
+}
+
+// handleSlackInteractions receives button presses and other interactions,
+// which Slack posts as a form with a JSON payload
+func handleSlackInteractions(w http.ResponseWriter, r *http.Request) {
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(r.FormValue("payload")), &callback); err != nil {
+		log.Printf("handleSlackInteractions: Error parsing payload: %v", err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	// Answer right away, Slack shows an error for interactions that take
+	// longer than 3 seconds
+	go handleInteraction(callback)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signSlackRequest(secret string, timestamp string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1531420618, 0)
+	body := []byte("token=xyz&team_id=T1")
+	signature := signSlackRequest("secret", "1531420618", string(body))
+
+	if !verifySlackSignature("secret", "1531420618", signature, body, now) {
+		t.Errorf("Expected valid signature to be accepted")
+	}
+
+	if verifySlackSignature("other", "1531420618", signature, body, now) {
+		t.Errorf("Expected signature for another secret to be rejected")
+	}
+
+	if verifySlackSignature("secret", "1531420618", signature, []byte("tampered"), now) {
+		t.Errorf("Expected signature of another body to be rejected")
+	}
+
+	if verifySlackSignature("secret", "1531420618", signature, body, now.Add(maxSignatureAge+time.Second)) {
+		t.Errorf("Expected stale signature to be rejected")
+	}
+
+	if verifySlackSignature("", "1531420618", signature, body, now) {
+		t.Errorf("Expected signatures to be rejected without a secret")
+	}
+}
+
+func TestSlackEventsAnswersURLVerification(t *testing.T) {
+	os.Setenv("SLACK_SIGNING_SECRET", "secret")
+	defer os.Unsetenv("SLACK_SIGNING_SECRET")
+
+	body := `{"token":"xyz","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P","type":"url_verification"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	request := httptest.NewRequest("POST", "/slack/events", strings.NewReader(body))
+	request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	request.Header.Set("X-Slack-Signature", signSlackRequest("secret", timestamp, body))
+	response := httptest.NewRecorder()
+
+	newSlackHandler().ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK || response.Body.String() != "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P" {
+		t.Errorf("Expected challenge to be echoed, got %v %q", response.Code, response.Body.String())
+	}
+}
+
+func TestSlackEventsRejectsUnsignedRequests(t *testing.T) {
+	os.Setenv("SLACK_SIGNING_SECRET", "secret")
+	defer os.Unsetenv("SLACK_SIGNING_SECRET")
+
+	request := httptest.NewRequest("POST", "/slack/events", strings.NewReader(`{"type":"url_verification"}`))
+	response := httptest.NewRecorder()
+
+	newSlackHandler().ServeHTTP(response, request)
+
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %v", response.Code)
+	}
+}
+
+func TestSlackCommandsRequireSignature(t *testing.T) {
+	os.Setenv("SLACK_SIGNING_SECRET", "secret")
+	defer os.Unsetenv("SLACK_SIGNING_SECRET")
+
+	body := "command=%2Fjira&text=help&channel_id=C1&user_id=U1"
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	request := httptest.NewRequest("POST", "/slack/commands", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+
+	newSlackHandler().ServeHTTP(response, request)
+
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a signature, got %v", response.Code)
+	}
+
+	request = httptest.NewRequest("POST", "/slack/commands", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	request.Header.Set("X-Slack-Signature", signSlackRequest("secret", timestamp, body))
+	response = httptest.NewRecorder()
+
+	newSlackHandler().ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected a signed command to be accepted, got %v", response.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Renews the lease of the active instance only if it still holds it
+var renewLeaseScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`)
+
+// Returned when the active instance must stop, so the standby doesn't post
+// alongside it
+var errLeaseLost = errors.New("another instance took over")
+
+func getActiveLeaseKey() string {
+	return redisKeyPrefix + "active"
+}
+
+// acquireActiveLease renews the lease of the active instance if this one
+// holds it, or takes it if it expired. It reports whether this instance is
+// the active one.
+func acquireActiveLease(pool *redis.Pool, self string) (bool, error) {
+	ttl := int64(clusterReplicaTTL / time.Millisecond)
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	renewed, err := redis.Int(renewLeaseScript.Do(conn, getActiveLeaseKey(), self, ttl))
+	if err != nil {
+		return false, err
+	}
+	if renewed == 1 {
+		return true, nil
+	}
+
+	_, err = redis.String(conn.Do("SET", getActiveLeaseKey(), self, "NX", "PX", ttl))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// waitUntilActive stands by until the active instance's heartbeat goes
+// stale, then takes over and keeps the lease for as long as the process
+// runs
+func waitUntilActive() error {
+	pool, err := getClusterPool()
+	if err != nil {
+		return err
+	}
+
+	self := getReplicaID()
+	standingBy := false
+	for {
+		active, err := acquireActiveLease(pool, self)
+		if err != nil {
+			log.Printf("waitUntilActive: Error: %v", err)
+		} else if active {
+			break
+		} else if !standingBy {
+			log.Printf("waitUntilActive: Standing by as %s while another instance is active", self)
+			standingBy = true
+		}
+
+		time.Sleep(clusterHeartbeatInterval)
+	}
+
+	log.Printf("waitUntilActive: %s is the active instance", self)
+	go keepActiveLease(pool, self)
+
+	return nil
+}
+
+// keepActiveLease renews the lease and stops the process once it can't be
+// sure to hold it anymore
+func keepActiveLease(pool *redis.Pool, self string) {
+	renewed := time.Now()
+	for now := range time.Tick(clusterHeartbeatInterval) {
+		active, err := acquireActiveLease(pool, self)
+		if active {
+			renewed = now
+		}
+		if err != nil {
+			log.Printf("keepActiveLease: Error: %v", err)
+		}
+
+		if err := checkActiveLease(active, err, renewed, now); err != nil {
+			log.Fatalf("keepActiveLease: Stopping: %v", err)
+		}
+	}
+}
+
+// checkActiveLease tells the active instance to stop if another one took
+// over, or before the lease it failed to renew expires and the standby takes
+// over
+func checkActiveLease(active bool, err error, renewed time.Time, now time.Time) error {
+	if active {
+		return nil
+	}
+	if err == nil {
+		return errLeaseLost
+	}
+	if now.Sub(renewed) >= clusterReplicaTTL-clusterHeartbeatInterval {
+		return errors.New("the lease could not be renewed: " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckActiveLease(t *testing.T) {
+	renewed := time.Now()
+	unreachable := errors.New("connection refused")
+
+	if err := checkActiveLease(true, nil, renewed, renewed.Add(time.Hour)); err != nil {
+		t.Errorf("Expected a renewed lease to be kept, got %v", err)
+	}
+	if err := checkActiveLease(false, nil, renewed, renewed); err != errLeaseLost {
+		t.Errorf("Expected to stop once another instance holds the lease, got %v", err)
+	}
+	if err := checkActiveLease(false, unreachable, renewed, renewed.Add(clusterHeartbeatInterval)); err != nil {
+		t.Errorf("Expected a failed renewal to be retried, got %v", err)
+	}
+	if err := checkActiveLease(false, unreachable, renewed, renewed.Add(clusterReplicaTTL-clusterHeartbeatInterval)); err == nil {
+		t.Error("Expected to stop before the standby may take over")
+	}
+}
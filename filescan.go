@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Types of files besides text/* whose contents are scanned for issue keys
+var scannedFileMimetypes = map[string]bool{
+	"application/json":       true,
+	"application/xml":        true,
+	"application/x-yaml":     true,
+	"application/javascript": true,
+}
+
+// handleFileShared scans a text file shared in a channel for issue keys and
+// posts their cards in the file's thread
+func handleFileShared(ctx context.Context, event *slackevents.FileSharedEvent) {
+	config := getConfig()
+	if !config.FileScan || !isChannelEnabled(event.ChannelID) {
+		return
+	}
+	// Like the backups and snapshots the bot sends
+	if identity, err := getSlackIdentity(event.ChannelID); err == nil && identity.UserID == event.UserID {
+		return
+	}
+
+	api := getSlackAPIFor(event.ChannelID)
+	file, _, _, err := api.GetFileInfo(event.FileID, 0, 0)
+	if err != nil || file == nil {
+		log.Printf("handleFileShared: Error reading %s: %v", event.FileID, err)
+		return
+	}
+	if !isScannedFile(*file) {
+		return
+	}
+	if file.Size > config.FileScanMaxSize {
+		log.Printf("handleFileShared: Skipping %s, %d bytes is over the limit", file.ID, file.Size)
+		return
+	}
+
+	var content bytes.Buffer
+	if err := api.GetFile(file.URLPrivateDownload, &content); err != nil {
+		log.Printf("handleFileShared: Error downloading %s: %v", file.ID, err)
+		return
+	}
+
+	issueIDs := extractFileIssueIDs(event.ChannelID, content.String())
+	if len(issueIDs) == 0 {
+		return
+	}
+
+	thread := getFileShareThread(*file, event.ChannelID)
+	if thread == "" {
+		log.Printf("handleFileShared: %s isn't shared in %s", file.ID, event.ChannelID)
+		return
+	}
+
+	recordEvent("file_mention", map[string]interface{}{
+		"channel": event.ChannelID,
+		"user":    event.UserID,
+		"file":    file.ID,
+		"issues":  issueIDs,
+	})
+
+	post := postIssue
+	if !isTrustedUser(event.UserID) {
+		post = postRestrictedIssue
+	}
+	for _, issueID := range issueIDs {
+		if ctx.Err() != nil {
+			log.Printf("handleFileShared: Out of time, skipping %s", issueID)
+			continue
+		}
+		recordMention(issueID, time.Now())
+
+		if err := post(ctx, event.ChannelID, event.UserID, thread, issueID); err != nil {
+			reportError(slack.Msg{Channel: event.ChannelID, User: event.UserID}, issueID, err, true)
+		}
+	}
+}
+
+// isScannedFile reports whether a file is text, like a log or a snippet
+func isScannedFile(file slack.File) bool {
+	mimetype := strings.ToLower(strings.SplitN(file.Mimetype, ";", 2)[0])
+
+	return strings.HasPrefix(mimetype, "text/") || scannedFileMimetypes[mimetype] || file.Filetype == "text"
+}
+
+// extractFileIssueIDs finds the keys of issues the channel expands in a
+// file, line by line, as a single line can't crowd out the others
+func extractFileIssueIDs(channel string, content string) []string {
+	issueIDs := []string{}
+
+	for _, line := range strings.Split(content, "\n") {
+		found := filterChannelProjects(channel, filterKnownIssueIDs(extractIssueIDs(line)))
+		issueIDs = mergeIssueIDs(issueIDs, found)
+		if len(issueIDs) >= maxIssueIDsPerMessage {
+			break
+		}
+	}
+
+	return issueIDs
+}
+
+// getFileShareThread returns the thread of the message sharing the file in
+// the channel, or the message itself to start one
+func getFileShareThread(file slack.File, channel string) string {
+	shares := file.Shares.Public[channel]
+	if len(shares) == 0 {
+		shares = file.Shares.Private[channel]
+	}
+	if len(shares) == 0 {
+		return ""
+	}
+
+	share := shares[len(shares)-1]
+	if share.ThreadTs != "" {
+		return share.ThreadTs
+	}
+
+	return share.Ts
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestExtractFileIssueIDs(t *testing.T) {
+	jiraProjects.keys = map[string]bool{"ABC": true, "OPS": true}
+	defer func() { jiraProjects.keys = nil }()
+
+	// Keys of unknown projects early in a log don't crowd out the real ones
+	content := strings.Repeat("charset UTF-8 x86-64 SHA-256 ISO-8601 TLS-13 CVE-2024 RFC-1 PR-2 V-3 ID-4 IP-5\n", 50) +
+		"ERROR ABC-12 failed\nretrying ops-7 and ABC-12\n"
+
+	if issueIDs := extractFileIssueIDs("C1", content); !reflect.DeepEqual(issueIDs, []string{"ABC-12", "OPS-7"}) {
+		t.Errorf("Expected ABC-12 and OPS-7, got %v", issueIDs)
+	}
+}
+
+func TestIsScannedFile(t *testing.T) {
+	for _, test := range []struct {
+		file     slack.File
+		expected bool
+	}{
+		{slack.File{Mimetype: "text/plain"}, true},
+		{slack.File{Mimetype: "text/x-log; charset=utf-8"}, true},
+		{slack.File{Mimetype: "application/json"}, true},
+		{slack.File{Filetype: "text"}, true},
+		{slack.File{Mimetype: "image/png"}, false},
+		{slack.File{Mimetype: "application/zip"}, false},
+	} {
+		if isScannedFile(test.file) != test.expected {
+			t.Errorf("Expected scanning %+v to be %v", test.file, test.expected)
+		}
+	}
+}
+
+func TestGetFileShareThread(t *testing.T) {
+	file := slack.File{Shares: slack.Share{
+		Public:  map[string][]slack.ShareFileInfo{"C1": {{Ts: "1.1"}}, "C2": {{Ts: "2.2", ThreadTs: "2.0"}}},
+		Private: map[string][]slack.ShareFileInfo{"G1": {{Ts: "3.3"}}},
+	}}
+
+	for channel, expected := range map[string]string{"C1": "1.1", "C2": "2.0", "G1": "3.3", "C3": ""} {
+		if thread := getFileShareThread(file, channel); thread != expected {
+			t.Errorf("Expected the thread %q in %s, got %q", expected, channel, thread)
+		}
+	}
+}
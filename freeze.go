@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const freezeDateLayout = "2006-01-02"
+
+// A change freeze, optionally limited to a set of projects
+type FreezeWindow struct {
+	Start    time.Time
+	End      time.Time
+	Projects []string
+}
+
+// Active reports whether the freeze covers the project at the given time.
+// Both the start and the end date are inclusive.
+func (f FreezeWindow) Active(project string, now time.Time) bool {
+	if now.Before(f.Start) || !now.Before(f.End.AddDate(0, 0, 1)) {
+		return false
+	}
+
+	if len(f.Projects) == 0 {
+		return true
+	}
+
+	for _, p := range f.Projects {
+		if strings.EqualFold(p, project) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseFreezes reads freeze windows in the form
+// "2026-12-20..2027-01-03=WEB,OPS;2027-03-01..2027-03-02".
+// Entries without a project list apply to every project. Malformed entries
+// are left out and returned as errors.
+func parseFreezes(value string) ([]FreezeWindow, []error) {
+	freezes := []FreezeWindow{}
+	errs := []error{}
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		dates, projects := entry, ""
+		if i := strings.Index(entry, "="); i >= 0 {
+			dates, projects = entry[:i], entry[i+1:]
+		}
+
+		bounds := strings.SplitN(dates, "..", 2)
+		if len(bounds) != 2 {
+			errs = append(errs, fmt.Errorf("freeze %q must look like 2026-12-20..2027-01-03=WEB", entry))
+			continue
+		}
+
+		start, err := time.Parse(freezeDateLayout, strings.TrimSpace(bounds[0]))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("freeze %q has an invalid start date: %v", entry, err))
+			continue
+		}
+		end, err := time.Parse(freezeDateLayout, strings.TrimSpace(bounds[1]))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("freeze %q has an invalid end date: %v", entry, err))
+			continue
+		}
+
+		freeze := FreezeWindow{Start: start, End: end}
+		for _, p := range strings.Split(projects, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				freeze.Projects = append(freeze.Projects, strings.ToUpper(p))
+			}
+		}
+
+		freezes = append(freezes, freeze)
+	}
+
+	return freezes, errs
+}
+
+// activeFreeze returns the freeze covering the project right now, if any
+func activeFreeze(freezes []FreezeWindow, project string, now time.Time) *FreezeWindow {
+	for i := range freezes {
+		if freezes[i].Active(project, now) {
+			return &freezes[i]
+		}
+	}
+
+	return nil
+}
+
+func getProjectKey(issueKey string) string {
+	if i := strings.LastIndex(issueKey, "-"); i >= 0 {
+		return issueKey[:i]
+	}
+
+	return issueKey
+}
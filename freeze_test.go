@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFreezes(t *testing.T) {
+	result, errs := parseFreezes("2026-12-20..2027-01-03=web, OPS; 2027-03-01..2027-03-02")
+
+	if len(result) != 2 || len(errs) != 0 {
+		t.Fatalf("Expected two freezes, got %v and %v", len(result), errs)
+	}
+
+	if len(result[0].Projects) != 2 || result[0].Projects[0] != "WEB" || result[0].Projects[1] != "OPS" {
+		t.Errorf("Expected projects [WEB OPS], got %v", result[0].Projects)
+	}
+
+	if len(result[1].Projects) != 0 {
+		t.Errorf("Expected no projects, got %v", result[1].Projects)
+	}
+}
+
+func TestParseFreezesIgnoresMalformed(t *testing.T) {
+	result, errs := parseFreezes("2026-12-20;2026-13-01..2026-13-02;")
+
+	if len(result) != 0 {
+		t.Errorf("Expected no freezes, got %v", len(result))
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected an error for each malformed freeze, got %v", errs)
+	}
+}
+
+func TestFreezeActive(t *testing.T) {
+	freezes, _ := parseFreezes("2026-12-20..2027-01-03=WEB")
+	freeze := freezes[0]
+
+	if !freeze.Active("WEB", time.Date(2027, 1, 3, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected freeze to include its last day")
+	}
+
+	if freeze.Active("WEB", time.Date(2027, 1, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected freeze to be over")
+	}
+
+	if freeze.Active("OPS", time.Date(2026, 12, 24, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected freeze to not cover OPS")
+	}
+}
+
+func TestGetProjectKey(t *testing.T) {
+	if key := getProjectKey("ABC-123"); key != "ABC" {
+		t.Errorf("Expected ABC, got %v", key)
+	}
+}
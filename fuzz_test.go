@@ -0,0 +1,42 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var extractedIssueID = regexp.MustCompile(`^[A-Z0-9_]+-[0-9]+$`)
+
+// Run with "go test -fuzz FuzzExtractIssueIDs"
+func FuzzExtractIssueIDs(f *testing.F) {
+	f.Add("ABC-123")
+	f.Add("ABC-123 DEF-345 abc-123")
+	f.Add("<https://jira.example.com/browse/ABC-123|ABC-123>")
+	f.Add("```ABC-1```  `DEF-2` UTF-8 SHA-256")
+	f.Add("\xff\xfeABC-1\x00" + strings.Repeat("-1", 100))
+	f.Add(strings.Repeat("A-1", maxScannedMessageLength))
+
+	f.Fuzz(func(t *testing.T, message string) {
+		result := extractIssueIDs(message)
+
+		if len(result) > maxIssueIDsPerMessage {
+			t.Errorf("Expected at most %v results, got %v", maxIssueIDsPerMessage, len(result))
+		}
+
+		seen := map[string]bool{}
+		for _, issueID := range result {
+			if !extractedIssueID.MatchString(issueID) || !utf8.ValidString(issueID) {
+				t.Errorf("Unexpected issue ID %q", issueID)
+			}
+			if seen[issueID] {
+				t.Errorf("Duplicate issue ID %q", issueID)
+			}
+			seen[issueID] = true
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run "go test -run Golden -update" to rewrite the golden files after an
+// intended formatting change, then review the diff.
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/golden")
+
+var goldenFormatters = map[string]func(*testing.T, jiraIssue) string{
+	"message":    func(t *testing.T, issue jiraIssue) string { return formatMessage(issue) },
+	"customer":   formatGoldenCustomerMessage,
+	"accessible": func(t *testing.T, issue jiraIssue) string { return formatAccessibleMessage(issue, issue.Key) },
+	"blocks":     formatGoldenBlocks,
+}
+
+func init() {
+	for name, source := range cardProfiles {
+		source := source
+		goldenFormatters["profile-"+name] = func(t *testing.T, issue jiraIssue) string {
+			message, err := formatTemplateMessage(getMessageTemplate(source), issue)
+			if err != nil {
+				t.Fatalf("Could not render the profile: %v", err)
+			}
+			return message
+		}
+	}
+}
+
+// formatGoldenCustomerMessage renders the customer card of a request shared
+// with everyone in the channel
+func formatGoldenCustomerMessage(t *testing.T, issue jiraIssue) string {
+	issue.Request = &serviceDeskRequest{Shared: true}
+
+	return formatCustomerMessage(issue)
+}
+
+// formatGoldenBlocks renders the Block Kit card as the JSON sent to Slack
+func formatGoldenBlocks(t *testing.T, issue jiraIssue) string {
+	var data bytes.Buffer
+
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(formatMessageBlocks(issue, issue.Key)); err != nil {
+		t.Fatalf("Could not encode the blocks: %v", err)
+	}
+
+	return data.String()
+}
+
+// goldenExtension is the extension of the golden files of a formatter
+func goldenExtension(formatter string) string {
+	if formatter == "blocks" {
+		return ".json"
+	}
+
+	return ".txt"
+}
+
+func TestFormattersGolden(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	fixtures, err := filepath.Glob("testdata/issues/*.json")
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("Expected issue fixtures, got %v (%v)", fixtures, err)
+	}
+
+	for _, fixture := range fixtures {
+		issue := loadIssueFixture(t, fixture)
+		name := strings.TrimSuffix(filepath.Base(fixture), ".json")
+
+		for formatter, format := range goldenFormatters {
+			golden := filepath.Join("testdata", "golden", formatter, name+goldenExtension(formatter))
+			format := format
+
+			t.Run(formatter+"/"+name, func(t *testing.T) {
+				checkGolden(t, golden, format(t, issue))
+			})
+		}
+	}
+}
+
+func loadIssueFixture(t *testing.T, path string) jiraIssue {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read fixture: %v", err)
+	}
+
+	return decodeIssue(t, string(data))
+}
+
+func checkGolden(t *testing.T, path string, actual string) {
+	if *updateGolden {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatalf("Could not update golden file: %v", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read golden file, run with -update to create it: %v", err)
+	}
+
+	if actual != string(expected) {
+		t.Errorf("Output differs from %s\nexpected:\n%s\nactual:\n%s", path, expected, actual)
+	}
+}
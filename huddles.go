@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Huddles remembered as prompted before the list starts over
+const maxPromptedHuddles = 1000
+
+// Slack limits button values to 2000 characters, which also hold the rest
+// of the prefill
+const maxHuddleDescriptionLength = 1500
+
+// A huddle as Slack attaches it to the message it starts in a channel
+type huddleRoom struct {
+	ID                 string   `json:"id"`
+	ParticipantHistory []string `json:"participant_history"`
+	DateStart          int64    `json:"date_start"`
+	DateEnd            int64    `json:"date_end"`
+	HasEnded           bool     `json:"has_ended"`
+}
+
+// A huddle that ended, with the channel and message it was started in
+type endedHuddle struct {
+	Channel string
+	Thread  string
+	Room    huddleRoom
+}
+
+// Huddles already prompted for, as Slack updates the message more than once
+var promptedHuddles = struct {
+	sync.Mutex
+	rooms map[string]bool
+}{rooms: map[string]bool{}}
+
+// handleHuddlePayload prompts for a follow-up ticket when an Events API
+// payload says a huddle in an incident channel ended. Slack doesn't send
+// huddles over RTM.
+func handleHuddlePayload(payload []byte) {
+	if len(getConfig().IncidentChannels) == 0 {
+		return
+	}
+
+	huddle, ok := parseEndedHuddle(payload)
+	if !ok || !isIncidentChannel(huddle.Channel) || !markHuddlePrompted(huddle.Room.ID) {
+		return
+	}
+
+	promptHuddleFollowUp(huddle)
+}
+
+// parseEndedHuddle reads the huddle off the update Slack sends for its
+// message once it ended
+func parseEndedHuddle(payload []byte) (endedHuddle, bool) {
+	var envelope struct {
+		Event struct {
+			SubType string `json:"subtype"`
+			Channel string `json:"channel"`
+			Message struct {
+				SubType   string      `json:"subtype"`
+				Timestamp string      `json:"ts"`
+				Room      *huddleRoom `json:"room"`
+			} `json:"message"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return endedHuddle{}, false
+	}
+
+	event := envelope.Event
+	if event.SubType != "message_changed" || event.Message.SubType != "huddle_thread" ||
+		event.Message.Room == nil || !event.Message.Room.HasEnded {
+		return endedHuddle{}, false
+	}
+
+	return endedHuddle{Channel: event.Channel, Thread: event.Message.Timestamp, Room: *event.Message.Room}, true
+}
+
+// isIncidentChannel reports whether huddles in a channel get follow-ups
+func isIncidentChannel(channel string) bool {
+	return matchChannel(getConfig().IncidentChannels, channel, getChannelName(channel))
+}
+
+// markHuddlePrompted reports whether a huddle wasn't prompted for yet, and
+// remembers it was
+func markHuddlePrompted(room string) bool {
+	promptedHuddles.Lock()
+	defer promptedHuddles.Unlock()
+
+	if promptedHuddles.rooms[room] {
+		return false
+	}
+	if len(promptedHuddles.rooms) >= maxPromptedHuddles {
+		promptedHuddles.rooms = map[string]bool{}
+	}
+	promptedHuddles.rooms[room] = true
+
+	return true
+}
+
+// promptHuddleFollowUp posts a button in the huddle's thread that opens the
+// create issue modal with who was in it and for how long
+func promptHuddleFollowUp(huddle endedHuddle) {
+	names := []string{}
+	for _, user := range huddle.Room.ParticipantHistory {
+		names = append(names, getSlackUserName(huddle.Channel, user))
+	}
+
+	prefill := formatHuddlePrefill(huddle, names)
+	if projects := getChannelProjects(huddle.Channel); len(projects) > 0 {
+		prefill.Project = projects[0]
+	}
+
+	value, err := json.Marshal(prefill)
+	if err != nil {
+		log.Printf("promptHuddleFollowUp: Error: %v", err)
+		return
+	}
+
+	button := slack.NewButtonBlockElement(actionOpenCreateIssue, string(value), newPlainText("File follow-up ticket"))
+	text := fmt.Sprintf("The huddle ended after %s. Anything left to follow up on?", formatHuddleDuration(huddle.Room))
+
+	if err := postBlocks(huddle.Channel, huddle.Thread, text, []slack.Block{
+		slack.NewSectionBlock(newMarkdownText(text), nil, slack.NewAccessory(button.WithStyle(slack.StylePrimary))),
+	}); err != nil {
+		log.Printf("promptHuddleFollowUp: Error posting in %s: %v", huddle.Channel, err)
+		return
+	}
+
+	recordEvent("huddle_follow_up", map[string]interface{}{
+		"channel":      huddle.Channel,
+		"thread":       huddle.Thread,
+		"participants": huddle.Room.ParticipantHistory,
+	})
+}
+
+// formatHuddlePrefill fills in the summary and a description naming the
+// participants and the duration of a huddle
+func formatHuddlePrefill(huddle endedHuddle, names []string) createIssuePrefill {
+	start := time.Unix(huddle.Room.DateStart, 0).UTC()
+
+	description := fmt.Sprintf("Huddle on %s, %s long.", start.Format("2006-01-02 15:04 MST"), formatHuddleDuration(huddle.Room))
+	if len(names) > 0 {
+		description += "\n\nParticipants: " + strings.Join(names, ", ")
+	}
+	if teamURL, err := getSlackTeamURL(huddle.Channel); err == nil {
+		description += "\n\nFrom Slack: " + getSlackPermalink(teamURL, huddle.Channel, huddle.Thread)
+	}
+
+	return createIssuePrefill{
+		Summary:     "Follow-up of the huddle on " + start.Format("2006-01-02"),
+		Description: truncateText(description, maxHuddleDescriptionLength),
+		Channel:     huddle.Channel,
+		Thread:      huddle.Thread,
+	}
+}
+
+// formatHuddleDuration rounds how long a huddle took to the minute
+func formatHuddleDuration(room huddleRoom) string {
+	duration := time.Duration(room.DateEnd-room.DateStart) * time.Second
+	if duration < time.Minute {
+		return "less than a minute"
+	}
+
+	return strings.TrimSuffix(duration.Round(time.Minute).String(), "0s")
+}
+
+// getSlackUserName returns the real name of a Slack user, or their ID if it
+// can't be looked up
+func getSlackUserName(channel string, user string) string {
+	info, err := getSlackAPIFor(channel).GetUserInfo(user)
+	if err != nil || info == nil {
+		log.Printf("getSlackUserName: Error looking up %s: %v", user, err)
+		return user
+	}
+	if info.RealName != "" {
+		return info.RealName
+	}
+
+	return info.Name
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestParseEndedHuddle(t *testing.T) {
+	payload := []byte(`{"type": "event_callback", "event": {"type": "message", "subtype": "message_changed", "channel": "C1",
+		"message": {"subtype": "huddle_thread", "ts": "1700000000.000100",
+			"room": {"id": "R1", "participant_history": ["U1", "U2"], "date_start": 1700000000, "date_end": 1700001530, "has_ended": true}}}}`)
+
+	huddle, ok := parseEndedHuddle(payload)
+	if !ok {
+		t.Fatal("Expected an ended huddle")
+	}
+	if huddle.Channel != "C1" || huddle.Thread != "1700000000.000100" || huddle.Room.ID != "R1" || len(huddle.Room.ParticipantHistory) != 2 {
+		t.Errorf("Unexpected huddle %+v", huddle)
+	}
+	if duration := formatHuddleDuration(huddle.Room); duration != "26m" {
+		t.Errorf("Expected 26m, got %s", duration)
+	}
+
+	for _, payload := range []string{
+		`{"event": {"type": "message", "subtype": "huddle_thread", "channel": "C1", "room": {"id": "R1"}}}`,
+		`{"event": {"type": "message", "subtype": "message_changed", "channel": "C1", "message": {"subtype": "huddle_thread", "room": {"id": "R1"}}}}`,
+		`{"event": {"type": "message", "subtype": "message_changed", "channel": "C1", "message": {"text": "edited"}}}`,
+		`not json`,
+	} {
+		if _, ok := parseEndedHuddle([]byte(payload)); ok {
+			t.Errorf("Expected no ended huddle in %s", payload)
+		}
+	}
+}
+
+func TestFormatHuddleDuration(t *testing.T) {
+	for expected, room := range map[string]huddleRoom{
+		"less than a minute": {DateStart: 100, DateEnd: 130},
+		"5m":                 {DateStart: 100, DateEnd: 400},
+		"1h30m":              {DateStart: 100, DateEnd: 5500},
+	} {
+		if duration := formatHuddleDuration(room); duration != expected {
+			t.Errorf("Expected %s, got %s", expected, duration)
+		}
+	}
+}
+
+func TestMarkHuddlePrompted(t *testing.T) {
+	defer func() { promptedHuddles.rooms = map[string]bool{} }()
+
+	if !markHuddlePrompted("R1") {
+		t.Error("Expected the first end of a huddle to prompt")
+	}
+	if markHuddlePrompted("R1") {
+		t.Error("Expected later updates of the huddle not to prompt again")
+	}
+}
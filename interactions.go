@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Handlers for buttons and menus, by action ID
+var blockActionHandlers = map[string]func(callback slack.InteractionCallback, action *slack.BlockAction){
+	actionToggleSetting:     handleToggleSetting,
+	actionRefreshHome:       handleRefreshHome,
+	actionCardMenu:          handleCardMenu,
+	actionOpenCreateIssue:   handleOpenCreateIssue,
+	actionTransitionIssue:   handleTransitionButton,
+	actionConfirmTransition: handleTransitionButton,
+	actionShowOriginal:      handleShowOriginal,
+	actionToggleAccessible:  handleToggleAccessible,
+	// Slack opens the links itself
+	actionOpenCard:    func(slack.InteractionCallback, *slack.BlockAction) {},
+	actionOpenCardApp: func(slack.InteractionCallback, *slack.BlockAction) {},
+}
+
+// Handlers for submitted modals, by callback ID
+var viewSubmissionHandlers = map[string]func(callback slack.InteractionCallback){
+	callbackCardComment:    handleCardModalSubmission,
+	callbackCardTransition: handleCardModalSubmission,
+	callbackCreateIssue:    handleCreateIssueSubmission,
+}
+
+// Handlers for message shortcuts, by callback ID
+var messageShortcutHandlers = map[string]func(callback slack.InteractionCallback){
+	shortcutCreateIssue: handleCreateShortcut,
+}
+
+// handleInteraction dispatches what users did with the bot's buttons and
+// menus, however the payload reached the bot
+func handleInteraction(callback slack.InteractionCallback) {
+	rememberSlackWorkspace(callback.Team.ID, callback.Channel.ID, callback.User.ID)
+
+	switch callback.Type {
+	case slack.InteractionTypeBlockActions:
+		for _, action := range callback.ActionCallback.BlockActions {
+			// Action IDs may carry a suffix after a dot, as Slack needs them
+			// unique within a block
+			handler, ok := blockActionHandlers[strings.SplitN(action.ActionID, ".", 2)[0]]
+			if !ok {
+				log.Printf("handleInteraction: No handler for action %s", action.ActionID)
+				continue
+			}
+
+			handler(callback, action)
+		}
+	case slack.InteractionTypeMessageAction:
+		handler, ok := messageShortcutHandlers[callback.CallbackID]
+		if !ok {
+			log.Printf("handleInteraction: No handler for shortcut %s", callback.CallbackID)
+			return
+		}
+
+		handler(callback)
+	case slack.InteractionTypeViewSubmission:
+		handler, ok := viewSubmissionHandlers[callback.View.CallbackID]
+		if !ok {
+			log.Printf("handleInteraction: No handler for view %s", callback.View.CallbackID)
+			return
+		}
+
+		handler(callback)
+	default:
+		// Ignore other interactions..
+	}
+}
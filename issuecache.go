@@ -0,0 +1,335 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key of the moved issue keys in the state store
+const issueAliasesStateKey = "issue_aliases"
+
+// Key of the Slack threads issues were mentioned in, in the state store
+const issueThreadsStateKey = "issue_threads"
+
+func init() {
+	registerStateKind(issueAliasesStateKey, loadIssueAliases)
+	registerStateKind(issueThreadsStateKey, loadIssueThreads)
+}
+
+// Moved issue keys remembered before the longest unseen are forgotten
+const maxIssueAliases = 10000
+
+// Latest threads remembered per issue
+const maxThreadsPerIssue = 5
+
+// Issues whose threads are remembered before those mentioned longest ago
+// are forgotten
+const maxThreadIssues = 10000
+
+type cachedIssue struct {
+	issue     jiraIssue
+	fetchedAt time.Time
+}
+
+var issueCache = struct {
+	sync.Mutex
+	entries map[string]cachedIssue
+}{entries: map[string]cachedIssue{}}
+
+// The current key Jira resolved an old issue key to, and when
+type issueAlias struct {
+	Key  string    `json:"key"`
+	Seen time.Time `json:"seen"`
+}
+
+// Old issue keys mapped to their current key
+var issueAliases = struct {
+	sync.Mutex
+	keys map[string]issueAlias
+}{keys: map[string]issueAlias{}}
+
+// A Slack thread an issue was mentioned in
+type issueThread struct {
+	Channel   string    `json:"channel"`
+	Timestamp string    `json:"timestamp"`
+	Seen      time.Time `json:"seen"`
+}
+
+var issueThreads = struct {
+	sync.Mutex
+	issues map[string][]issueThread
+}{issues: map[string][]issueThread{}}
+
+// getIssueCacheTTL is the configured TTL, extended while the Jira API budget
+// is tight, but never past the cache retention.
+func getIssueCacheTTL(now time.Time) time.Duration {
+	config := getConfig()
+
+	ttl := config.JiraCacheTTL
+	if isJiraBudgetTight(config.JiraAPIBudget, now) && ttl < budgetCacheTTL {
+		ttl = budgetCacheTTL
+	}
+
+	if config.CacheRetention > 0 && ttl > config.CacheRetention {
+		return config.CacheRetention
+	}
+
+	return ttl
+}
+
+func getCachedIssue(issueID string, ttl time.Duration, now time.Time) (jiraIssue, bool) {
+	issueCache.Lock()
+	defer issueCache.Unlock()
+
+	entry, ok := issueCache.entries[issueID]
+	if !ok || now.Sub(entry.fetchedAt) >= ttl {
+		return jiraIssue{}, false
+	}
+
+	return entry.issue, true
+}
+
+func cacheIssue(issueID string, issue jiraIssue, now time.Time) {
+	issueCache.Lock()
+	defer issueCache.Unlock()
+
+	// Drop entries no TTL would serve anymore
+	for key, entry := range issueCache.entries {
+		if now.Sub(entry.fetchedAt) >= budgetCacheTTL && now.Sub(entry.fetchedAt) >= getConfig().JiraCacheTTL {
+			delete(issueCache.entries, key)
+		}
+	}
+
+	issueCache.entries[issueID] = cachedIssue{issue: issue, fetchedAt: now}
+}
+
+// resolveIssueAlias returns the current key for a key that was seen moving
+func resolveIssueAlias(issueID string) string {
+	issueAliases.Lock()
+	defer issueAliases.Unlock()
+
+	if alias, ok := issueAliases.keys[issueID]; ok {
+		return alias.Key
+	}
+
+	return issueID
+}
+
+// rememberIssueAlias records where a key moved to, and saves the aliases so
+// cards and watches of old keys still find the issue after a restart
+func rememberIssueAlias(oldKey string, currentKey string) {
+	defer lockSharedState(issueAliasesStateKey)()
+	issueAliases.Lock()
+	defer issueAliases.Unlock()
+	refreshSharedIssueAliases()
+
+	now := time.Now().UTC()
+	issueAliases.keys[oldKey] = issueAlias{Key: currentKey, Seen: now}
+
+	// Keys moved more than once point straight at the latest key
+	for old, alias := range issueAliases.keys {
+		if alias.Key == oldKey {
+			issueAliases.keys[old] = issueAlias{Key: currentKey, Seen: now}
+		}
+	}
+
+	pruneIssueAliases(maxIssueAliases)
+
+	if err := saveIssueAliases(); err != nil {
+		log.Printf("rememberIssueAlias: Error: %v", err)
+	}
+}
+
+// pruneIssueAliases forgets the aliases seen longest ago until at most limit
+// are left. The caller holds the lock of issueAliases.
+func pruneIssueAliases(limit int) {
+	for len(issueAliases.keys) > limit {
+		oldest := ""
+		for key, alias := range issueAliases.keys {
+			if oldest == "" || alias.Seen.Before(issueAliases.keys[oldest].Seen) {
+				oldest = key
+			}
+		}
+
+		delete(issueAliases.keys, oldest)
+	}
+}
+
+// loadIssueAliases restores the aliases saved before the last restart
+func loadIssueAliases() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadIssueAliases: Error: %v", err)
+		return
+	}
+
+	keys := map[string]issueAlias{}
+	if ok, err := store.Load(issueAliasesStateKey, &keys); err != nil || !ok {
+		if err != nil {
+			log.Printf("loadIssueAliases: Error: %v", err)
+		}
+		return
+	}
+
+	issueAliases.Lock()
+	issueAliases.keys = keys
+	issueAliases.Unlock()
+}
+
+// refreshSharedIssueAliases reads the aliases again, as other replicas may
+// have seen keys move. The caller holds the lock of issueAliases.
+func refreshSharedIssueAliases() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedIssueAliases: Error: %v", err)
+		return
+	}
+
+	keys := map[string]issueAlias{}
+	if _, err := store.Load(issueAliasesStateKey, &keys); err != nil {
+		log.Printf("refreshSharedIssueAliases: Error: %v", err)
+		return
+	}
+
+	issueAliases.keys = keys
+}
+
+// saveIssueAliases writes the aliases to the state store. The caller holds
+// the lock of issueAliases.
+func saveIssueAliases() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(issueAliasesStateKey, issueAliases.keys)
+}
+
+// forgetCachedIssue drops an issue the bot just changed, so the next card
+// shows the change
+func forgetCachedIssue(issueID string) {
+	issueCache.Lock()
+	defer issueCache.Unlock()
+
+	delete(issueCache.entries, resolveIssueAlias(issueID))
+}
+
+// rememberIssueThread records the thread an issue was mentioned in, so the
+// context pack can point at the discussions of the issue
+func rememberIssueThread(issueID string, channel string, timestamp string) {
+	defer lockSharedState(issueThreadsStateKey)()
+	issueThreads.Lock()
+	defer issueThreads.Unlock()
+	refreshSharedIssueThreads()
+
+	issueKey := strings.ToUpper(resolveIssueAlias(issueID))
+
+	// A thread mentioned again moves to the end as the latest
+	threads := []issueThread{}
+	for _, thread := range issueThreads.issues[issueKey] {
+		if thread.Channel != channel || thread.Timestamp != timestamp {
+			threads = append(threads, thread)
+		}
+	}
+	threads = append(threads, issueThread{Channel: channel, Timestamp: timestamp, Seen: time.Now().UTC()})
+	if len(threads) > maxThreadsPerIssue {
+		threads = threads[len(threads)-maxThreadsPerIssue:]
+	}
+	issueThreads.issues[issueKey] = threads
+
+	pruneIssueThreads(maxThreadIssues)
+
+	if err := saveIssueThreads(); err != nil {
+		log.Printf("rememberIssueThread: Error: %v", err)
+	}
+}
+
+// getIssueThreads returns the threads an issue was mentioned in, the latest
+// last
+func getIssueThreads(issueID string) []issueThread {
+	issueThreads.Lock()
+	defer issueThreads.Unlock()
+	refreshSharedIssueThreads()
+
+	return append([]issueThread{}, issueThreads.issues[strings.ToUpper(resolveIssueAlias(issueID))]...)
+}
+
+// pruneIssueThreads forgets the threads of the issues mentioned longest ago
+// until at most limit issues are left. The caller holds the lock of
+// issueThreads.
+func pruneIssueThreads(limit int) {
+	for len(issueThreads.issues) > limit {
+		oldest, oldestSeen := "", time.Time{}
+		for key, threads := range issueThreads.issues {
+			seen := time.Time{}
+			if len(threads) > 0 {
+				seen = threads[len(threads)-1].Seen
+			}
+			if oldest == "" || seen.Before(oldestSeen) {
+				oldest, oldestSeen = key, seen
+			}
+		}
+
+		delete(issueThreads.issues, oldest)
+	}
+}
+
+// loadIssueThreads restores the threads saved before the last restart
+func loadIssueThreads() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadIssueThreads: Error: %v", err)
+		return
+	}
+
+	issues := map[string][]issueThread{}
+	if ok, err := store.Load(issueThreadsStateKey, &issues); err != nil || !ok {
+		if err != nil {
+			log.Printf("loadIssueThreads: Error: %v", err)
+		}
+		return
+	}
+
+	issueThreads.Lock()
+	issueThreads.issues = issues
+	issueThreads.Unlock()
+}
+
+// refreshSharedIssueThreads reads the threads again, as other replicas may
+// have seen mentions. The caller holds the lock of issueThreads.
+func refreshSharedIssueThreads() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedIssueThreads: Error: %v", err)
+		return
+	}
+
+	issues := map[string][]issueThread{}
+	if _, err := store.Load(issueThreadsStateKey, &issues); err != nil {
+		log.Printf("refreshSharedIssueThreads: Error: %v", err)
+		return
+	}
+
+	issueThreads.issues = issues
+}
+
+// saveIssueThreads writes the threads to the state store. The caller holds
+// the lock of issueThreads.
+func saveIssueThreads() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(issueThreadsStateKey, issueThreads.issues)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIssueCacheHonorsTTL(t *testing.T) {
+	now := time.Now()
+	cacheIssue("ABC-1", decodeIssue(t, `{"key": "ABC-1"}`), now)
+
+	if _, ok := getCachedIssue("ABC-1", time.Minute, now.Add(30*time.Second)); !ok {
+		t.Errorf("Expected cached issue within TTL")
+	}
+
+	if _, ok := getCachedIssue("ABC-1", time.Minute, now.Add(time.Minute)); ok {
+		t.Errorf("Expected cached issue to expire")
+	}
+
+	if _, ok := getCachedIssue("ABC-1", 0, now); ok {
+		t.Errorf("Expected no caching without TTL")
+	}
+}
+
+func TestResolveIssueAliasFollowsRepeatedMoves(t *testing.T) {
+	rememberIssueAlias("OLD-1", "MID-1")
+	rememberIssueAlias("MID-1", "NEW-1")
+
+	if key := resolveIssueAlias("OLD-1"); key != "NEW-1" {
+		t.Errorf("Expected NEW-1, got %v", key)
+	}
+
+	if key := resolveIssueAlias("ABC-1"); key != "ABC-1" {
+		t.Errorf("Expected ABC-1, got %v", key)
+	}
+}
+
+func TestIssueAliasesSurviveRestart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "data")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DATA_DIR", dir)
+	defer os.Unsetenv("DATA_DIR")
+	defer func() {
+		issueAliases.Lock()
+		issueAliases.keys = map[string]issueAlias{}
+		issueAliases.Unlock()
+	}()
+
+	rememberIssueAlias("OLD-2", "NEW-2")
+
+	// As after a restart
+	issueAliases.Lock()
+	issueAliases.keys = map[string]issueAlias{}
+	issueAliases.Unlock()
+	loadIssueAliases()
+
+	if key := resolveIssueAlias("OLD-2"); key != "NEW-2" {
+		t.Errorf("Expected NEW-2, got %v", key)
+	}
+}
+
+func TestPruneIssueAliasesKeepsRecent(t *testing.T) {
+	defer func() { issueAliases.keys = map[string]issueAlias{} }()
+
+	now := time.Now()
+	issueAliases.keys = map[string]issueAlias{
+		"OLD-1": {Key: "NEW-1", Seen: now.Add(-time.Hour)},
+		"OLD-2": {Key: "NEW-2", Seen: now},
+		"OLD-3": {Key: "NEW-3", Seen: now.Add(-time.Minute)},
+	}
+
+	pruneIssueAliases(2)
+
+	if _, ok := issueAliases.keys["OLD-1"]; ok || len(issueAliases.keys) != 2 {
+		t.Errorf("Expected the alias seen longest ago to go, got %v", issueAliases.keys)
+	}
+}
+
+func TestIssueThreadsKeepTheLatestAndSurviveRestart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "data")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DATA_DIR", dir)
+	defer os.Unsetenv("DATA_DIR")
+	defer func() {
+		issueThreads.Lock()
+		issueThreads.issues = map[string][]issueThread{}
+		issueThreads.Unlock()
+	}()
+
+	for i := 0; i < maxThreadsPerIssue+1; i++ {
+		rememberIssueThread("abc-1", "C1", fmt.Sprintf("1600000000.00000%d", i))
+	}
+	rememberIssueThread("ABC-1", "C1", "1600000000.000001")
+
+	// As after a restart
+	issueThreads.Lock()
+	issueThreads.issues = map[string][]issueThread{}
+	issueThreads.Unlock()
+	loadIssueThreads()
+
+	threads := getIssueThreads("ABC-1")
+	timestamps := []string{}
+	for _, thread := range threads {
+		timestamps = append(timestamps, thread.Timestamp)
+	}
+
+	expected := []string{"1600000000.000002", "1600000000.000003", "1600000000.000004", "1600000000.000005", "1600000000.000001"}
+	if !reflect.DeepEqual(timestamps, expected) {
+		t.Errorf("Expected the latest threads once each, got %v", timestamps)
+	}
+}
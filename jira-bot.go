@@ -1,46 +1,189 @@
 package main
 
 import (
-	"fmt"
 	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/nlopes/slack"
-	gojira "github.com/plouc/go-jira-client"
+	"github.com/slack-go/slack"
 )
 
-// Configuration for the bot
-type BotConfig struct {
-	Username     string
-	SlackAPIKey  string
-	JiraUsername string
-	JiraPassword string
-	JiraBaseURL  string
-}
+// The bot's own Slack identity by workspace, see getSlackIdentity
+var slackIdentity = struct {
+	sync.Mutex
+	responses map[string]*slack.AuthTestResponse
+}{responses: map[string]*slack.AuthTestResponse{}}
+
+// Returned by Jira write operations while the bot runs read-only
+var errReadOnly = errors.New("the bot is in read-only mode")
 
 func main() {
+	configPath := flag.String("config", "", "YAML config file, environment variables override its settings")
+	flag.Parse()
+
+	if *configPath != "" {
+		config, err := loadConfigFile(*configPath)
+		if err != nil {
+			log.Fatalf("main: Error loading config: %v", err)
+		}
+		fileConfig = config
+	}
+
+	if problems := validateConfig(getConfig()); len(problems) > 0 {
+		for _, problem := range problems {
+			log.Printf("main: Config error: %v", problem)
+		}
+		log.Fatalf("main: Found %d config errors, exiting", len(problems))
+	}
+
+	if _, err := getStateStore(); err != nil {
+		log.Fatalf("main: Error opening the state store: %v", err)
+	}
+
+	if flag.NArg() > 0 {
+		runCommand(flag.Arg(0), flag.Args()[1:])
+		return
+	}
+
+	if err := verifyJiraCredentials(); err != nil {
+		log.Fatalf("main: %v", err)
+	}
+
 	api := getSlackAPI()
 
+	if getConfig().Failover {
+		if err := waitUntilActive(); err != nil {
+			log.Fatalf("main: Error waiting to become the active instance: %v", err)
+		}
+	}
+
+	if getConfig().ReadOnly {
+		log.Print("main: Running in read-only mode, Jira writes are disabled")
+	}
+
+	resolveNotificationTargets()
+	setupEventSinks()
+	go runPurges(purgeInterval)
+
+	if err := migrateStateOnStartup(); err != nil {
+		log.Fatalf("main: Error migrating the state: %v", err)
+	}
+	if getConfig().Cluster {
+		if err := joinCluster(); err != nil {
+			log.Fatalf("main: Error joining the cluster: %v", err)
+		}
+	}
+	loadWatches()
+	loadJiraLinks()
+	loadChannelEnablement()
+	loadUserPreferences()
+	loadChannelProjects()
+	loadIssueAliases()
+	loadIssueThreads()
+	loadAnnouncements()
+	loadCustomerViews()
+	if isMultiWorkspace() {
+		loadSlackInstallations()
+	}
+	go runWatchPolling(getConfig().WatchPollInterval)
+
+	if addr := getConfig().ActionAPIAddr; addr != "" {
+		go serveActionAPI(addr)
+	}
+
+	if addr := getConfig().JiraWebhookAddr; addr != "" {
+		go serveJiraWebhooks(addr)
+	}
+
+	if addr := getConfig().JiraOAuthAddr; addr != "" {
+		go serveJiraOAuth(addr)
+	}
+
+	if addr := getConfig().SlackInstallAddr; addr != "" {
+		go serveSlackInstall(addr)
+	}
+
+	if addr := getConfig().DebugAddr; addr != "" {
+		go serveDebug(addr)
+	}
+
+	if config := getConfig(); config.PrefetchTop > 0 && config.PrefetchInterval > 0 {
+		go prefetchHotIssues(config.PrefetchTop, config.PrefetchInterval)
+	}
+
+	go syncJiraProjects(jiraProjectsRefreshInterval)
+
+	if interval := getConfig().JiraMetadataSyncInterval; interval > 0 {
+		go syncJiraMetadata(interval)
+	}
+
+	startMessageWorkers(getConfig().MessageWorkers, getConfig().MessageTimeout)
+
+	if addr := getConfig().EventsAPIAddr; addr != "" {
+		runEventsAPI(addr)
+	} else if getConfig().SlackAppToken != "" {
+		runSocketMode(api)
+	} else {
+		log.Print("main: SLACK_APP_TOKEN is not set, falling back to the deprecated RTM API")
+		runRTM(api)
+	}
+}
+
+// runCommand runs a command given on the command line instead of the bot
+func runCommand(name string, args []string) {
+	var err error
+
+	switch name {
+	case "backup":
+		err = runBackupCommand(args)
+	case "restore":
+		err = runRestoreCommand(args)
+	case "migrate":
+		err = runMigrateCommand(args)
+	default:
+		err = fmt.Errorf("unknown command %q, use backup, restore or migrate", name)
+	}
+
+	if err != nil {
+		log.Fatalf("runCommand: Error: %v", err)
+	}
+}
+
+// runRTM listens for messages over the legacy RTM API. It stays around while
+// installations move to Socket Mode.
+func runRTM(api *slack.Client) {
 	rtm := api.NewRTM()
 	go rtm.ManageConnection()
 
-	log.Print("main: Now listening for events")
+	log.Print("runRTM: Now listening for events")
 
 	for {
 		select {
 		case msg := <-rtm.IncomingEvents:
 			switch ev := msg.Data.(type) {
+			case *slack.ConnectedEvent:
+				setConnectionStatus(transportRTM, true)
+			case *slack.DisconnectedEvent:
+				setConnectionStatus(transportRTM, false)
 			case *slack.MessageEvent:
-				handleIncomingMessage(ev.Msg)
+				markEventReceived()
+				// Every replica gets every message over RTM
+				if ownsKey(ev.Msg.Channel) {
+					submitMessage(ev.Msg)
+				}
 			case *slack.LatencyReport:
-				log.Printf("main: Current latency: %v\n", ev.Value)
+				log.Printf("runRTM: Current latency: %v\n", ev.Value)
 			case *slack.RTMError:
-				log.Printf("main: Error: %s\n", ev.Error())
+				log.Printf("runRTM: Error: %s\n", ev.Error())
 			case *slack.InvalidAuthEvent:
-				log.Print("main: Invalid credentials")
+				log.Print("runRTM: Invalid credentials")
 			default:
 				// Ignore other events..
 			}
@@ -48,67 +191,312 @@ func main() {
 	}
 }
 
-func handleIncomingMessage(message slack.Msg) {
+func handleIncomingMessage(ctx context.Context, message slack.Msg) {
 	messageText := message.Text
+	rememberSlackWorkspace(message.Team, message.Channel, message.User)
 
 	if shouldIgnoreMessage(message) {
 		log.Print("handleMessage: Ignoring message")
 		return
 	}
 
-	matches := extractIssueIDs(messageText)
+	if isEchoOfPostedContent(messageText, time.Now()) {
+		log.Print("handleMessage: Ignoring echo of our own message")
+		return
+	}
+
+	if handleBotCommand(ctx, message) {
+		return
+	}
+
+	if !isChannelEnabled(message.Channel) {
+		return
+	}
+
+	links, scannedText := cutShortLinks(messageText)
+	matches := mergeIssueIDs(filterKnownIssueIDs(extractIssueIDs(scannedText)), resolveShortLinks(links))
+	matches = filterChannelProjects(message.Channel, matches)
+
+	if len(matches) > 0 {
+		recordEvent("mention", map[string]interface{}{
+			"channel":   message.Channel,
+			"user":      message.User,
+			"timestamp": message.Timestamp,
+			"text":      message.Text,
+			"issues":    matches,
+		})
+
+		if window := activeMaintenance(getConfig().MaintenanceWindows, time.Now()); window != nil {
+			log.Print("handleMessage: Jira is under maintenance, skipping lookups")
+			respondWithMaintenanceNotice(message.Channel, *window)
+			return
+		}
+	}
 
 	for i := 0; i < len(matches); i++ {
 		issueID := matches[i]
-		log.Printf("handleMessage: Identified " + issueID + " in message")
+		if ctx.Err() != nil {
+			log.Printf("handleMessage: Out of time, skipping %s", issueID)
+			continue
+		}
+		log.Printf("handleMessage: Identified %s in message", issueID)
+		recordMention(issueID, time.Now())
+
+		respondToIssueMentioned(ctx, message, issueID)
+		rememberIssueThread(issueID, message.Channel, getReplyThread(message))
+
+		if shouldRecordSlackDiscussion(issueID) {
+			go recordSlackDiscussion(message, issueID)
+		}
+	}
+}
+
+func respondToIssueMentioned(ctx context.Context, message slack.Msg, issueID string) {
+	thread, options := "", []slack.MsgOption{}
+	if shouldReplyInThread(message.Channel) {
+		thread = getReplyThread(message)
+		if getConfig().ReplyBroadcast {
+			options = append(options, slack.MsgOptionBroadcast())
+		}
+	}
+
+	post := postIssue
+	if !isTrustedUser(message.User) {
+		post = postRestrictedIssue
+	}
+
+	if err := post(ctx, message.Channel, message.User, thread, issueID, options...); err != nil {
+		reportError(message, issueID, err, true)
+	}
+}
 
-		respondToIssueMentioned(message.Channel, issueID)
+// shouldReplyInThread reports whether cards for mentions in the channel go
+// into a thread on the mentioning message
+func shouldReplyInThread(channel string) bool {
+	config := getConfig()
+
+	for _, c := range config.ThreadedChannels {
+		if c == channel {
+			return true
+		}
+	}
+	for _, c := range config.UnthreadedChannels {
+		if c == channel {
+			return false
+		}
 	}
+
+	return config.ReplyInThread
 }
 
-func respondToIssueMentioned(channel string, issueID string) {
+// postIssue posts the card for an issue to a channel, as a thread reply if a
+// thread timestamp is given. The issue is looked up as the user who asked for
+// it, if any. Formatting an issue that lacks fields like the status panics,
+// so panics are turned into errors here.
+func postIssue(ctx context.Context, channel string, user string, threadTimestamp string, issueID string, options ...slack.MsgOption) (err error) {
+	cohort := getCohort(channel, issueID)
+	defer func() {
+		recordExpansion(channel, issueID, cohort, err)
+	}()
+
 	defer func() {
 		if e := recover(); e != nil {
-			log.Printf("Exception responding to issue %s: %v", issueID, e)
+			err = fmt.Errorf("%v", e)
 		}
 	}()
 
-	api := getSlackAPI()
+	issueData, err := fetchJiraIssueFor(ctx, channel, user, issueID)
+	if err != nil {
+		return err
+	}
+	if isCustomerViewChannel(channel) {
+		issueData = loadCustomerRequest(ctx, channel, user, issueData)
+	}
+
+	text, blocks := formatIssuePost(channel, user, issueID, issueData, cohort)
+	if blocks == nil {
+		return postText(channel, threadTimestamp, text, options...)
+	}
+
+	return postBlocks(channel, threadTimestamp, text, blocks, options...)
+}
+
+// formatIssuePost renders the card for an issue in a channel. Customer
+// channels, direct messages to users who want accessible cards, card profiles
+// and message templates get plain text, all else gets blocks along with the
+// text for notifications.
+func formatIssuePost(channel string, user string, issueID string, issueData jiraIssue, cohort string) (string, []slack.Block) {
+	issueData, translated := translateIssue(channel, issueData)
+	note := formatMovedNote(issueID, issueData)
+	if translated {
+		note += translatedNote
+	}
+
+	if isCustomerViewChannel(channel) {
+		return formatCustomerMessage(issueData) + note, nil
+	}
+
+	if wantsAccessibleCard(channel, user) {
+		text := formatAccessibleMessage(issueData, issueID)
+		if translated {
+			text += "\nMachine translated."
+		}
+		return text, nil
+	}
+
+	if tmpl := getMessageTemplate(getCardTemplate(channel, cohort)); tmpl != nil {
+		message, err := formatTemplateMessage(tmpl, issueData)
+		if err == nil {
+			return message + note, nil
+		}
+		log.Printf("formatIssuePost: Error rendering the message template, using the default: %v", err)
+	}
+
+	blocks := formatMessageBlocks(issueData, issueID)
+	if translated {
+		blocks = addShowOriginalButton(blocks, issueData.Key)
+	}
+
+	return formatMessage(issueData) + note, blocks
+}
+
+// postText posts text, split into several messages if it is too long. The
+// options are added to every message.
+func postText(channel string, threadTimestamp string, text string, options ...slack.MsgOption) error {
+	for _, part := range splitMessage(text, maxMessageLength) {
+		params := slack.PostMessageParameters{
+			Username:        getConfig().Username,
+			Markdown:        true,
+			ThreadTimestamp: threadTimestamp,
+		}
+
+		_, timestamp, err := getSlackAPIFor(channel).PostMessage(channel, append(
+			[]slack.MsgOption{slack.MsgOptionText(part, false), slack.MsgOptionPostMessageParameters(params)},
+			options...,
+		)...)
+		if err != nil {
+			return err
+		}
+
+		recordPost(channel, threadTimestamp, timestamp, part)
+
+		if threadTimestamp == "" {
+			threadTimestamp = timestamp
+		}
+	}
+
+	return nil
+}
 
+// postBlocks posts a Block Kit message. The text is shown in notifications
+// and by clients that can't render blocks. Both the text and the texts of the
+// blocks are shortened to what Slack accepts.
+func postBlocks(channel string, threadTimestamp string, text string, blocks []slack.Block, options ...slack.MsgOption) error {
 	params := slack.PostMessageParameters{
-		Username: getConfig().Username,
-		Markdown: true,
+		Username:        getConfig().Username,
+		Markdown:        true,
+		ThreadTimestamp: threadTimestamp,
 	}
 
-	issueData := getJiraIssue(issueID)
+	text = truncateText(text, maxMessageLength)
 
-	api.PostMessage(channel, formatMessage(issueData), params)
+	_, timestamp, err := getSlackAPIFor(channel).PostMessage(channel, append(
+		[]slack.MsgOption{
+			slack.MsgOptionText(text, false),
+			slack.MsgOptionBlocks(truncateBlocks(blocks)...),
+			slack.MsgOptionPostMessageParameters(params),
+		},
+		options...,
+	)...)
+	if err != nil {
+		return err
+	}
+
+	recordPost(channel, threadTimestamp, timestamp, text)
+
+	return nil
+}
+
+// recordPost remembers a posted message for the loop guard and the event sinks
+func recordPost(channel string, threadTimestamp string, timestamp string, text string) {
+	rememberPostedContent(text, time.Now())
+	recordEvent("post", map[string]interface{}{
+		"channel":   channel,
+		"thread":    threadTimestamp,
+		"timestamp": timestamp,
+		"text":      text,
+	})
+}
+
+// postEphemeral shows a message only to one user in a channel. The options
+// are added to the message, e.g. to attach blocks.
+func postEphemeral(channel string, user string, text string, options ...slack.MsgOption) error {
+	_, err := getSlackAPIFor(channel).PostEphemeral(channel, user, append(
+		[]slack.MsgOption{
+			slack.MsgOptionText(truncateText(text, maxMessageLength), false),
+			slack.MsgOptionPostMessageParameters(slack.PostMessageParameters{
+				Username: getConfig().Username,
+				Markdown: true,
+			}),
+		},
+		options...,
+	)...)
+
+	return err
 }
 
 func getSlackAPI() *slack.Client {
-	return slack.New(getConfig().SlackAPIKey)
+	return getBot().slack
 }
 
-func getChannel(channelID string) (*slack.Channel, error) {
-	api := getSlackAPI()
+// getSlackIdentity returns who the bot is in the workspace of a team,
+// channel or user ID, asking Slack only once per workspace
+func getSlackIdentity(id string) (*slack.AuthTestResponse, error) {
+	team := getSlackWorkspace(id)
+
+	slackIdentity.Lock()
+	defer slackIdentity.Unlock()
 
-	return api.GetChannelInfo(channelID)
+	if response, ok := slackIdentity.responses[team]; ok {
+		return response, nil
+	}
+
+	response, err := getSlackAPIFor(id).AuthTest()
+	if err != nil {
+		return nil, err
+	}
+	slackIdentity.responses[team] = response
+
+	return response, nil
+}
+
+func getChannel(channelID string) (*slack.Channel, error) {
+	return getSlackAPIFor(channelID).GetConversationInfo(&slack.GetConversationInfoInput{ChannelID: channelID})
 }
 
-func formatMessage(issue gojira.Issue) string {
+func formatMessage(issue jiraIssue) string {
 	var message bytes.Buffer
 
+	project := getProjectKey(issue.Key)
+	if freeze := activeFreeze(getFreezes(project), project, time.Now()); freeze != nil {
+		message.WriteString(fmt.Sprintf(
+			"> :no_entry: *Change freeze* in effect until %s\n",
+			freeze.End.Format(freezeDateLayout),
+		))
+	}
+
 	message.WriteString(fmt.Sprintf(
-		"> <%s|%s> :traffic_light: *Status:* %s :memo: *Summary:* %s\n",
+		"> <%s|%s>%s :traffic_light: *Status:* %s :memo: *Summary:* %s\n",
 		getJiraURL(issue.Key),
 		issue.Key,
+		formatMobileLink(issue.Key),
 		issue.Fields.Status.Name,
 		issue.Fields.Summary,
 	))
 	message.WriteString(fmt.Sprintf(
 		"> :bust_in_silhouette: *Creator:* %s, *Assignee:* %s\n",
-		issue.Fields.Reporter.DisplayName,
-		issue.Fields.Assignee.DisplayName,
+		getDisplayName(issue.Fields.Reporter),
+		getDisplayName(issue.Fields.Assignee),
 	))
 	message.WriteString(fmt.Sprintf(
 		"> :calendar: *Created:* <!date^%d^{date} at {time}|%s>",
@@ -119,36 +507,190 @@ func formatMessage(issue gojira.Issue) string {
 	return message.String()
 }
 
-func getJiraURL(issueKey string) string {
-	return getConfig().JiraBaseURL + "/browse/" + issueKey
+// getDisplayName names a user field, which Jira leaves empty for unassigned
+// issues.
+func getDisplayName(user *jiraUser) string {
+	if user == nil {
+		return "Unassigned"
+	}
+
+	return user.DisplayName
+}
+
+// formatMovedNote points out that an issue was looked up by a key it no longer
+// has, which happens when Jira follows a moved issue to its current key.
+func formatMovedNote(requestedKey string, issue jiraIssue) string {
+	if issue.Key == "" || strings.EqualFold(issue.Key, requestedKey) {
+		return ""
+	}
+
+	return fmt.Sprintf("\n> _(moved from %s)_", requestedKey)
 }
 
-func getJiraIssue(issueID string) gojira.Issue {
-	jiraAPIPath := "/rest/api/latest"
-	jiraActivityPath := ""
+// formatCustomerMessage renders a Jira Service Management request with its
+// public comments but without internal people, dates or links, so agents can
+// share it with customers in support channels. Other issues are internal and
+// only named, as are requests not shared with everyone in the channel, see
+// loadCustomerRequest.
+func formatCustomerMessage(issue jiraIssue) string {
+	if !isServiceDeskRequest(issue) {
+		return fmt.Sprintf("> *%s* is an internal issue and isn't shown here", issue.Key)
+	}
+	if issue.Request == nil || !issue.Request.Shared {
+		return fmt.Sprintf("> *%s* isn't shared with everyone in this channel and isn't shown here", issue.Key)
+	}
 
-	jira := gojira.NewJira(
-		getConfig().JiraBaseURL,
-		jiraAPIPath,
-		jiraActivityPath,
-		&gojira.Auth{
-			Login:    getConfig().JiraUsername,
-			Password: getConfig().JiraPassword,
-		},
+	message := fmt.Sprintf(
+		"> *%s* :traffic_light: *Status:* %s :memo: *Summary:* %s",
+		issue.Key,
+		issue.Fields.Status.Name,
+		issue.Fields.Summary,
 	)
 
-	issueData := jira.Issue(issueID)
+	comments := issue.Request.Comments
+	if len(comments) > contextCommentCount {
+		comments = comments[len(comments)-contextCommentCount:]
+	}
+	for _, c := range comments {
+		body := truncateText(strings.Replace(c.Body, "\n", " ", -1), contextCommentLength)
+		message += fmt.Sprintf("\n> :speech_balloon: *%s:* %s", c.Author.DisplayName, body)
+	}
+
+	return message
+}
+
+// isServiceDeskRequest reports whether an issue is a customer request of a
+// Jira Service Management project
+func isServiceDeskRequest(issue jiraIssue) bool {
+	return issue.Fields != nil && issue.Fields.Project != nil && issue.Fields.Project.ProjectTypeKey == "service_desk"
+}
+
+func getJiraURL(issueKey string) string {
+	return getJiraInstanceFor(issueKey).BaseURL + "/browse/" + issueKey
+}
+
+// getJiraMobileURL opens the issue in Jira's mobile app, if a link for it is
+// configured
+func getJiraMobileURL(issueKey string) string {
+	link := getConfig().JiraMobileLink
+	if link == "" {
+		return ""
+	}
+
+	return strings.Replace(link, "{key}", issueKey, -1)
+}
+
+// formatMobileLink follows the web link to an issue with a link to open it in
+// the mobile app
+func formatMobileLink(issueKey string) string {
+	if mobileURL := getJiraMobileURL(issueKey); mobileURL != "" {
+		return fmt.Sprintf(" (<%s|app>)", mobileURL)
+	}
+
+	return ""
+}
+
+// fetchJiraIssue returns an issue from the cache or from Jira. Concurrent
+// fetches of the same issue share a single request, and keys of moved issues
+// are looked up by their current key.
+func fetchJiraIssue(ctx context.Context, issueID string) (jiraIssue, error) {
+	now := time.Now()
+	issueID = resolveIssueAlias(issueID)
+
+	if cached, ok := getCachedIssue(issueID, getIssueCacheTTL(now), now); ok {
+		return cached, nil
+	}
+
+	return coalesceIssueFetch(ctx, issueID, func(ctx context.Context) (jiraIssue, error) {
+		return loadJiraIssue(ctx, issueID)
+	})
+}
+
+// loadJiraIssue fetches an issue from Jira and caches it
+func loadJiraIssue(ctx context.Context, issueID string) (jiraIssue, error) {
+	issue, err := getBot().jira.GetIssue(ctx, issueID)
+	if err != nil {
+		return issue, err
+	}
+
+	if issue.Key != "" && !strings.EqualFold(issue.Key, issueID) {
+		rememberIssueAlias(issueID, strings.ToUpper(issue.Key))
+		issueID = strings.ToUpper(issue.Key)
+	}
+
+	cacheIssue(issueID, issue, time.Now())
+
+	return issue, nil
+}
+
+// checkWritable must guard every operation that changes data in Jira
+func checkWritable() error {
+	if getConfig().ReadOnly {
+		return errReadOnly
+	}
+
+	return nil
+}
+
+// replaceSlackLinks replaces links to Jira issues with the issue key and
+// other links with their label, so keys in unrelated URLs aren't mistaken for
+// issues. Mentions of users and channels are dropped.
+func replaceSlackLinks(message string) string {
+	return slackLinkPattern.ReplaceAllStringFunc(message, func(link string) string {
+		parts := slackLinkPattern.FindStringSubmatch(link)
+		target, label := parts[1], parts[2]
+
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			return " "
+		}
+
+		key := ""
+		if isJiraLink(target) {
+			if match := jiraURLIssuePattern.FindStringSubmatch(target); match != nil {
+				key = match[1]
+			}
+		}
+
+		return " " + key + " " + label + " "
+	})
+}
+
+// isJiraLink reports whether a URL points into one of the Jira instances
+func isJiraLink(target string) bool {
+	for _, instance := range getJiraInstances() {
+		if instance.hasLink(target) {
+			return true
+		}
+	}
 
-	return issueData
+	return false
 }
 
 func shouldIgnoreMessage(message slack.Msg) bool {
 	return message.Username == getConfig().Username || message.SubType == "bot_message"
 }
 
+// Longest message scanned for issue keys, Slack's own limit for message text
+const maxScannedMessageLength = 40000
+
+// Most issues expanded for a single message
+const maxIssueIDsPerMessage = 10
+
+var issueIDPattern = regexp.MustCompile(`\b(\w+)-(\d+)\b`)
+
+// Links in Slack's message markup, <target> or <target|label>
+var slackLinkPattern = regexp.MustCompile(`<([^<>|]*)(?:\|([^<>]*))?>`)
+
+// Where issue keys appear in Jira URLs, like /browse/ABC-123 or a board's
+// ?selectedIssue=ABC-123
+var jiraURLIssuePattern = regexp.MustCompile(`(?:/browse/|/issues/|[?&]selectedIssue=)([A-Za-z][A-Za-z0-9_]*-\d+)`)
+
 func extractIssueIDs(message string) []string {
-	re := regexp.MustCompile(`\b(\w+)-(\d+)\b`)
-	matches := re.FindAllString(message, -1)
+	if len(message) > maxScannedMessageLength {
+		message = message[:maxScannedMessageLength]
+	}
+
+	matches := issueIDPattern.FindAllString(replaceSlackLinks(message), -1)
 
 	// @see http://www.dotnetperls.com/remove-duplicates-slice
 	encountered := map[string]bool{}
@@ -164,18 +706,12 @@ func extractIssueIDs(message string) []string {
 			encountered[matches[v]] = true
 			// Append to result slice.
 			result = append(result, matches[v])
+
+			if len(result) == maxIssueIDsPerMessage {
+				break
+			}
 		}
 	}
 	// Return the new slice.
 	return result
 }
-
-func getConfig() BotConfig {
-	return BotConfig{
-		Username:     "JiraBot",
-		SlackAPIKey:  os.Getenv("SLACK_API_KEY"),
-		JiraBaseURL:  os.Getenv("JIRA_BASEURL"),
-		JiraUsername: os.Getenv("JIRA_USERNAME"),
-		JiraPassword: os.Getenv("JIRA_PASSWORD"),
-	}
-}
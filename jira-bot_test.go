@@ -1,9 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 
-	"github.com/nlopes/slack"
+	"github.com/slack-go/slack"
 )
 
 func TestExtractIssueID(t *testing.T) {
@@ -46,6 +51,27 @@ func TestExtractIssueIDUniques(t *testing.T) {
 	}
 }
 
+func TestExtractIssueIDsLimitsResults(t *testing.T) {
+	message := ""
+	for i := 0; i < maxIssueIDsPerMessage*2; i++ {
+		message += fmt.Sprintf("ABC-%d ", i)
+	}
+
+	result := extractIssueIDs(message)
+
+	if len(result) != maxIssueIDsPerMessage {
+		t.Errorf("Expected %v results, got %v", maxIssueIDsPerMessage, len(result))
+	}
+}
+
+func TestExtractIssueIDsIgnoresTextPastLimit(t *testing.T) {
+	result := extractIssueIDs(strings.Repeat(" ", maxScannedMessageLength) + "ABC-123")
+
+	if len(result) != 0 {
+		t.Errorf("Expected no result, got %v", result)
+	}
+}
+
 func TestIgnoresMessageFromBot(t *testing.T) {
 	messageBot := slack.Msg{
 		SubType: "bot_message",
@@ -65,3 +91,141 @@ func TestDoesNotIgnoreMessageFromUser(t *testing.T) {
 		t.Errorf("Message was from a user, expected to not ignore")
 	}
 }
+
+func decodeIssue(t *testing.T, data string) jiraIssue {
+	var issue jiraIssue
+
+	if err := json.Unmarshal([]byte(data), &issue); err != nil {
+		t.Fatalf("Could not decode issue: %v", err)
+	}
+
+	return issue
+}
+
+func TestFormatCustomerMessageHidesPeople(t *testing.T) {
+	issue := decodeIssue(t, `{
+		"key": "ABC-123",
+		"fields": {
+			"summary": "Printer on fire",
+			"status": {"name": "Open"},
+			"project": {"key": "ABC", "projectTypeKey": "service_desk"},
+			"reporter": {"displayName": "Jane Agent"},
+			"assignee": {"displayName": "John Agent"}
+		}
+	}`)
+
+	issue.Request = &serviceDeskRequest{Shared: true}
+
+	result := formatCustomerMessage(issue)
+
+	if result != "> *ABC-123* :traffic_light: *Status:* Open :memo: *Summary:* Printer on fire" {
+		t.Errorf("Unexpected customer message %v", result)
+	}
+}
+
+func TestFormatCustomerMessageShowsPublicComments(t *testing.T) {
+	issue := decodeIssue(t, `{
+		"key": "ABC-123",
+		"fields": {
+			"summary": "Printer on fire",
+			"status": {"name": "Open"},
+			"project": {"key": "ABC", "projectTypeKey": "service_desk"}
+		}
+	}`)
+	issue.Request = &serviceDeskRequest{Shared: true, Comments: []serviceDeskComment{
+		{Body: "Is it\nstill burning?", Public: true, Author: jiraUser{DisplayName: "Jane Agent"}},
+	}}
+
+	expected := "> *ABC-123* :traffic_light: *Status:* Open :memo: *Summary:* Printer on fire\n> :speech_balloon: *Jane Agent:* Is it still burning?"
+	if result := formatCustomerMessage(issue); result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+
+	issue.Request.Shared = false
+	if result := formatCustomerMessage(issue); strings.Contains(result, "fire") || strings.Contains(result, "burning") {
+		t.Errorf("Expected only the key of a request not shared with the channel, got %v", result)
+	}
+
+	issue.Request = nil
+	if result := formatCustomerMessage(issue); strings.Contains(result, "fire") {
+		t.Errorf("Expected only the key of a request that wasn't checked, got %v", result)
+	}
+}
+
+func TestFormatCustomerMessageHidesInternalIssues(t *testing.T) {
+	issue := decodeIssue(t, `{
+		"key": "ABC-123",
+		"fields": {
+			"summary": "Customer database dump",
+			"status": {"name": "Open"},
+			"project": {"key": "ABC", "projectTypeKey": "software"}
+		}
+	}`)
+
+	if result := formatCustomerMessage(issue); strings.Contains(result, "dump") || !strings.Contains(result, "ABC-123") {
+		t.Errorf("Expected only the key of an internal issue, got %v", result)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	result := parseList(" C1, ,C2,")
+
+	if len(result) != 2 || result[0] != "C1" || result[1] != "C2" {
+		t.Errorf("Expected [C1 C2], got %v", result)
+	}
+}
+
+func TestCheckWritableInReadOnlyMode(t *testing.T) {
+	os.Setenv("READ_ONLY", "true")
+	defer os.Unsetenv("READ_ONLY")
+
+	if checkWritable() != errReadOnly {
+		t.Errorf("Expected writes to be rejected in read-only mode")
+	}
+}
+
+func TestFormatMovedNote(t *testing.T) {
+	issue := decodeIssue(t, `{"key": "NEW-5"}`)
+
+	if note := formatMovedNote("OLD-12", issue); note != "\n> _(moved from OLD-12)_" {
+		t.Errorf("Unexpected moved note %q", note)
+	}
+
+	if note := formatMovedNote("NEW-5", issue); note != "" {
+		t.Errorf("Expected no moved note, got %q", note)
+	}
+}
+
+func TestShouldReplyInThread(t *testing.T) {
+	os.Setenv("THREADED_CHANNELS", "C1")
+	os.Setenv("UNTHREADED_CHANNELS", "C2")
+	defer os.Unsetenv("THREADED_CHANNELS")
+	defer os.Unsetenv("UNTHREADED_CHANNELS")
+	defer os.Unsetenv("REPLY_IN_THREAD")
+
+	if !shouldReplyInThread("C1") || shouldReplyInThread("C3") {
+		t.Errorf("Expected only threaded channels to get thread replies by default")
+	}
+
+	os.Setenv("REPLY_IN_THREAD", "true")
+
+	if !shouldReplyInThread("C3") || shouldReplyInThread("C2") {
+		t.Errorf("Expected every channel but the unthreaded ones to get thread replies")
+	}
+}
+
+func TestExtractIssueIDsFromLinks(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	result := extractIssueIDs(
+		"See <https://jira.example.com/browse/ABC-1|ABC-1>, <https://jira.example.com/browse/DEF-2?focusedCommentId=5>" +
+			" and <https://jira.example.com/secure/RapidBoard.jspa?rapidView=1&selectedIssue=GHI-3|the board>" +
+			" but not <https://github.com/org/repo/pull/UTF-8> or <#C123|ops-2>, just ABC-1 and XYZ-9",
+	)
+
+	expected := []string{"ABC-1", "DEF-2", "GHI-3", "XYZ-9"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Name of the instance configured by JIRA_BASEURL and its siblings
+const mainJiraInstance = "main"
+
+// Returned for issues on other instances than the main one where the bot
+// needs to know Jira users, as it only syncs those of the main one
+var errForeignJiraUsers = errors.New("the issue isn't on the main Jira instance")
+
+// Names of instances, which become part of variable names like
+// JIRA_ONPREM_BASEURL
+var jiraInstanceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// A Jira server besides the main one, holding the issues of some projects,
+// see JIRA_INSTANCES
+type JiraInstance struct {
+	Name       string `yaml:"name"`
+	BaseURL    string `yaml:"base_url"`
+	Deployment string `yaml:"deployment"`
+	Auth       string `yaml:"auth"`
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	APIToken   string `yaml:"api_token"`
+	PAT        string `yaml:"pat"`
+
+	// Keys of the projects on the instance, and a regular expression
+	// matching more of them
+	Projects       []string `yaml:"projects"`
+	ProjectPattern string   `yaml:"project_pattern"`
+}
+
+// parseJiraInstances reads the instances named in JIRA_INSTANCES from
+// variables like JIRA_ONPREM_BASEURL for the instance "onprem". Names that
+// can't be part of a variable name are left out and returned as errors.
+func parseJiraInstances(value string) ([]JiraInstance, []error) {
+	instances := []JiraInstance{}
+	errs := []error{}
+	for _, name := range parseList(value) {
+		if !jiraInstanceNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("instance name %q may only have letters, digits and underscores", name))
+			continue
+		}
+
+		prefix := "JIRA_" + strings.ToUpper(name) + "_"
+		instances = append(instances, JiraInstance{
+			Name:           name,
+			BaseURL:        os.Getenv(prefix + "BASEURL"),
+			Deployment:     os.Getenv(prefix + "DEPLOYMENT"),
+			Auth:           os.Getenv(prefix + "AUTH"),
+			Username:       os.Getenv(prefix + "USERNAME"),
+			Password:       os.Getenv(prefix + "PASSWORD"),
+			APIToken:       os.Getenv(prefix + "API_TOKEN"),
+			PAT:            os.Getenv(prefix + "PAT"),
+			Projects:       parseList(os.Getenv(prefix + "PROJECTS")),
+			ProjectPattern: os.Getenv(prefix + "PROJECT_PATTERN"),
+		})
+	}
+
+	return instances, errs
+}
+
+func getMainJiraInstance() JiraInstance {
+	config := getConfig()
+
+	return JiraInstance{
+		Name:       mainJiraInstance,
+		BaseURL:    config.JiraBaseURL,
+		Deployment: config.JiraDeployment,
+		Auth:       config.JiraAuth,
+		Username:   config.JiraUsername,
+		Password:   config.JiraPassword,
+		APIToken:   config.JiraAPIToken,
+		PAT:        config.JiraPAT,
+	}
+}
+
+// getJiraInstances returns the main instance followed by the others
+func getJiraInstances() []JiraInstance {
+	return append([]JiraInstance{getMainJiraInstance()}, getConfig().JiraInstances...)
+}
+
+// getJiraInstance returns the instance by name, the main one if there is no
+// such instance
+func getJiraInstance(name string) JiraInstance {
+	for _, instance := range getConfig().JiraInstances {
+		if instance.Name == name {
+			return instance
+		}
+	}
+
+	return getMainJiraInstance()
+}
+
+// getJiraInstanceFor returns the instance holding an issue or project, by
+// the project key. Projects no other instance claims are on the main one.
+func getJiraInstanceFor(key string) JiraInstance {
+	project := strings.ToUpper(strings.SplitN(key, "-", 2)[0])
+
+	for _, instance := range getConfig().JiraInstances {
+		if instance.hasProject(project) {
+			return instance
+		}
+	}
+
+	return getMainJiraInstance()
+}
+
+func (instance JiraInstance) hasProject(project string) bool {
+	for _, key := range instance.Projects {
+		if strings.EqualFold(key, project) {
+			return true
+		}
+	}
+
+	if instance.ProjectPattern == "" {
+		return false
+	}
+	pattern, err := regexp.Compile(instance.ProjectPattern)
+
+	return err == nil && pattern.MatchString(project)
+}
+
+// isCloud reports whether the instance is Jira Cloud rather than Jira Server
+// or Data Center, guessing from the base URL unless the deployment is set
+func (instance JiraInstance) isCloud() bool {
+	if instance.Deployment != "" {
+		return instance.Deployment == jiraDeploymentCloud
+	}
+
+	u, err := url.Parse(instance.BaseURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasSuffix(u.Hostname(), ".atlassian.net") || strings.HasSuffix(u.Hostname(), ".jira.com")
+}
+
+// apiPath returns the REST API for the deployment. Jira Cloud's v3 API
+// exchanges descriptions and comments as ADF documents, see jiraText.
+func (instance JiraInstance) apiPath() string {
+	if instance.isCloud() {
+		return "/rest/api/3"
+	}
+
+	return "/rest/api/2"
+}
+
+// authorize signs the request in with the instance's credentials
+func (instance JiraInstance) authorize(request *http.Request) {
+	switch instance.Auth {
+	case jiraAuthAPIToken:
+		request.SetBasicAuth(instance.Username, instance.APIToken)
+	case jiraAuthPAT:
+		request.Header.Set("Authorization", "Bearer "+instance.PAT)
+	default:
+		request.SetBasicAuth(instance.Username, instance.Password)
+	}
+}
+
+// hasLink reports whether a URL points into the instance
+func (instance JiraInstance) hasLink(target string) bool {
+	baseURL := strings.TrimRight(instance.BaseURL, "/")
+
+	return baseURL != "" && strings.HasPrefix(strings.ToLower(target), strings.ToLower(baseURL)+"/")
+}
+
+// doJiraInstanceRequest calls a Jira REST endpoint of the instance. The body is
+// sent as JSON and the response is decoded into result, unless either is nil.
+func doJiraInstanceRequest(ctx context.Context, instance JiraInstance, method string, path string, body interface{}, result interface{}) error {
+	if instance.BaseURL == "" {
+		return newBotError(errorKindBadConfig, "the base URL of the %s Jira instance is not set", instance.Name)
+	}
+
+	return doJiraRequestWith(ctx, instance.BaseURL, instance.authorize, method, path, body, result)
+}
+
+// jiraRouter sends each request to the instance holding the issue. Only the
+// main instance may be reached as a user who linked their account.
+type jiraRouter struct {
+	main JiraService
+}
+
+func newJiraRouter(main JiraService) *jiraRouter {
+	return &jiraRouter{main: main}
+}
+
+func (r *jiraRouter) route(key string) JiraService {
+	instance := getJiraInstanceFor(key)
+	if instance.Name == mainJiraInstance {
+		return r.main
+	}
+
+	return &restJiraService{instance: instance.Name}
+}
+
+func (r *jiraRouter) GetMyself(ctx context.Context) (jiraUser, error) {
+	return r.main.GetMyself(ctx)
+}
+
+func (r *jiraRouter) GetIssue(ctx context.Context, issueKey string) (jiraIssue, error) {
+	return r.route(issueKey).GetIssue(ctx, issueKey)
+}
+
+func (r *jiraRouter) GetIssueFields(ctx context.Context, issueKey string, fields string, result interface{}) error {
+	return r.route(issueKey).GetIssueFields(ctx, issueKey, fields, result)
+}
+
+// SearchIssues runs the query on every instance, as it may name projects of
+// any of them. Jira rejects queries naming projects it doesn't have, which
+// is fine as long as some instance takes the query.
+func (r *jiraRouter) SearchIssues(ctx context.Context, jql string, fields string, maxResults int) (jiraSearchResult, error) {
+	services := []JiraService{r.main}
+	for _, instance := range getConfig().JiraInstances {
+		services = append(services, &restJiraService{instance: instance.Name})
+	}
+
+	result := jiraSearchResult{Issues: []jiraLinkedIssue{}}
+	var rejected error
+	searched := false
+	for _, service := range services {
+		more, err := service.SearchIssues(ctx, jql, fields, maxResults)
+		var requestError *jiraRequestError
+		if errors.As(err, &requestError) && requestError.StatusCode == http.StatusBadRequest {
+			rejected = err
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		searched = true
+		result.Total += more.Total
+		result.Issues = append(result.Issues, more.Issues...)
+	}
+	if !searched {
+		return result, rejected
+	}
+	if len(result.Issues) > maxResults {
+		result.Issues = result.Issues[:maxResults]
+	}
+
+	return result, nil
+}
+
+func (r *jiraRouter) GetTransitions(ctx context.Context, issueKey string) ([]jiraTransition, error) {
+	return r.route(issueKey).GetTransitions(ctx, issueKey)
+}
+
+func (r *jiraRouter) TransitionIssue(ctx context.Context, issueKey string, transitionID string) error {
+	return r.route(issueKey).TransitionIssue(ctx, issueKey, transitionID)
+}
+
+func (r *jiraRouter) AddComment(ctx context.Context, issueKey string, body interface{}) error {
+	return r.route(issueKey).AddComment(ctx, issueKey, body)
+}
+
+func (r *jiraRouter) CreateIssue(ctx context.Context, fields map[string]interface{}) (string, error) {
+	project, _ := fields["project"].(map[string]string)
+
+	return r.route(project["key"]).CreateIssue(ctx, fields)
+}
+
+func (r *jiraRouter) AssignIssue(ctx context.Context, issueKey string, user jiraUser) error {
+	return r.route(issueKey).AssignIssue(ctx, issueKey, user)
+}
+
+func (r *jiraRouter) AddWatcher(ctx context.Context, issueKey string, user jiraUser) error {
+	return r.route(issueKey).AddWatcher(ctx, issueKey, user)
+}
+
+func (r *jiraRouter) GetRemoteLinks(ctx context.Context, issueKey string) ([]remoteLink, error) {
+	return r.route(issueKey).GetRemoteLinks(ctx, issueKey)
+}
+
+func (r *jiraRouter) AddRemoteLink(ctx context.Context, issueKey string, link remoteLink) error {
+	return r.route(issueKey).AddRemoteLink(ctx, issueKey, link)
+}
+
+func (r *jiraRouter) GetRequestComments(ctx context.Context, issueKey string) ([]serviceDeskComment, error) {
+	return r.route(issueKey).GetRequestComments(ctx, issueKey)
+}
+
+func (r *jiraRouter) GetRequestParticipants(ctx context.Context, issueKey string) ([]jiraUser, error) {
+	return r.route(issueKey).GetRequestParticipants(ctx, issueKey)
+}
+
+// GetProperty reads the property from the instance holding the project or
+// issue, as their keys are routed alike
+func (r *jiraRouter) GetProperty(ctx context.Context, entity string, key string, property string, result interface{}) error {
+	return r.route(key).GetProperty(ctx, entity, key, property, result)
+}
+
+// GetProjects lists the projects of every instance
+func (r *jiraRouter) GetProjects(ctx context.Context) ([]jiraProject, error) {
+	projects, err := r.main.GetProjects(ctx)
+	if err != nil {
+		return projects, err
+	}
+
+	for _, instance := range getConfig().JiraInstances {
+		more, err := (&restJiraService{instance: instance.Name}).GetProjects(ctx)
+		if err != nil {
+			return projects, err
+		}
+		projects = append(projects, more...)
+	}
+
+	return projects, nil
+}
+
+// GetInstanceData only reads the main instance, the one whose users Slack
+// users are matched with
+func (r *jiraRouter) GetInstanceData(ctx context.Context) (jiraInstanceData, error) {
+	return r.main.GetInstanceData(ctx)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// A Jira server with one issue that rejects searches for other projects
+func newTestJiraInstance(issueKey string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/2/issue/" + issueKey:
+			w.Write([]byte(`{"key": "` + issueKey + `", "fields": {"summary": "On ` + r.Host + `"}}`))
+		case "/rest/api/2/search":
+			if r.URL.Query().Get("jql") == "project = NOPE" {
+				http.Error(w, `{"errorMessages": ["The value 'NOPE' does not exist for the field 'project'."]}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"total": 1, "issues": [{"key": "` + issueKey + `"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestJiraRouter(t *testing.T) {
+	defer setBot(nil)
+
+	main := newTestJiraInstance("WEB-45")
+	defer main.Close()
+	onprem := newTestJiraInstance("OPS-123")
+	defer onprem.Close()
+
+	os.Setenv("JIRA_BASEURL", main.URL)
+	os.Setenv("JIRA_DEPLOYMENT", "server")
+	os.Setenv("JIRA_INSTANCES", "onprem")
+	os.Setenv("JIRA_ONPREM_BASEURL", onprem.URL)
+	os.Setenv("JIRA_ONPREM_PROJECT_PATTERN", "^OPS|INFRA$")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+	defer os.Unsetenv("JIRA_INSTANCES")
+	defer os.Unsetenv("JIRA_ONPREM_BASEURL")
+	defer os.Unsetenv("JIRA_ONPREM_PROJECT_PATTERN")
+
+	for key, expected := range map[string]string{"OPS-123": "onprem", "ops": "onprem", "INFRA-1": "onprem", "WEB-45": mainJiraInstance, "OPSX-1": "onprem", "DEVOPS-1": mainJiraInstance} {
+		if instance := getJiraInstanceFor(key); instance.Name != expected {
+			t.Errorf("Expected %s on %s, got %s", key, expected, instance.Name)
+		}
+	}
+	if url := getJiraURL("OPS-123"); url != onprem.URL+"/browse/OPS-123" {
+		t.Errorf("Expected a link to the onprem instance, got %s", url)
+	}
+
+	jira := getBot().jira
+	for key, server := range map[string]*httptest.Server{"OPS-123": onprem, "WEB-45": main} {
+		issue, err := jira.GetIssue(context.Background(), key)
+		if err != nil || issue.Fields.Summary != "On "+server.Listener.Addr().String() {
+			t.Errorf("Expected %s from its instance, got %+v, %v", key, issue.Fields, err)
+		}
+	}
+
+	result, err := jira.SearchIssues(context.Background(), "text ~ printer", "summary", 20)
+	if err != nil || result.Total != 2 || len(result.Issues) != 2 {
+		t.Errorf("Expected the results of both instances, got %+v, %v", result, err)
+	}
+	if _, err := jira.SearchIssues(context.Background(), "project = NOPE", "summary", 20); err == nil {
+		t.Error("Expected a query every instance rejects to fail")
+	}
+}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Atlassian's OAuth 2.0 (3LO) endpoints, variables so tests can replace them
+var (
+	jiraOAuthAuthorizeURL = "https://auth.atlassian.com/authorize"
+	jiraOAuthTokenURL     = "https://auth.atlassian.com/oauth/token"
+	jiraOAuthAPIURL       = "https://api.atlassian.com"
+)
+
+// What linked users allow the bot to do as them. offline_access gets a
+// refresh token, so links outlive the hour an access token lasts.
+const jiraOAuthScopes = "read:jira-work write:jira-work read:jira-user offline_access"
+
+// How long an authorization link works
+const jiraOAuthStateTTL = 10 * time.Minute
+
+// Access tokens are refreshed this long before they expire
+const jiraOAuthRefreshMargin = time.Minute
+
+// What happens to users who haven't linked their Jira account, see
+// JIRA_OAUTH_UNLINKED
+const (
+	jiraUnlinkedService = "service"
+	jiraUnlinkedRefuse  = "refuse"
+)
+
+// Key of the linked accounts in the state store
+const jiraLinksStateKey = "jira_links"
+
+func init() {
+	registerStateKind(jiraLinksStateKey, loadJiraLinks)
+}
+
+// Key of the authorizations waiting to be confirmed in Slack
+const jiraPendingLinksStateKey = "jira_pending_links"
+
+// Returned instead of a Jira client for unlinked users in channels that
+// refuse them
+var errJiraLinkRequired = newBotError(errorKindUnlinked, "the user hasn't linked a Jira account")
+
+// A Slack user's Jira account, linked through OAuth
+type jiraLink struct {
+	AccountID    string    `json:"account_id"`
+	DisplayName  string    `json:"display_name"`
+	CloudID      string    `json:"cloud_id"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// An authorization granted in a browser, waiting for the Slack user who
+// asked for the link to confirm it with its code. Whoever opened the link
+// may not be them, e.g. if they posted it in a channel.
+type pendingJiraLink struct {
+	UserID string    `json:"user_id"`
+	Link   jiraLink  `json:"link"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// Linked accounts by Slack user ID. They are saved in the state store.
+var jiraLinks = struct {
+	sync.Mutex
+	users map[string]*jiraLink
+}{users: map[string]*jiraLink{}}
+
+// Atlassian's answer to a token request
+type jiraOAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func isJiraOAuthEnabled() bool {
+	return getConfig().JiraOAuthClientID != ""
+}
+
+// getJiraServiceFor returns the Jira client to act for a Slack user in a
+// channel: their own if they linked their Jira account, otherwise the bot's,
+// unless the channel refuses unlinked users
+func getJiraServiceFor(channel string, userID string) (JiraService, error) {
+	if !isJiraOAuthEnabled() || userID == "" {
+		return getBot().jira, nil
+	}
+
+	_, linked, err := getFreshJiraLink(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if linked {
+		return newJiraRouter(newLinkedJiraService(userID)), nil
+	}
+
+	if getUnlinkedPolicy(channel) == jiraUnlinkedRefuse {
+		return nil, errJiraLinkRequired
+	}
+
+	return getBot().jira, nil
+}
+
+// fetchJiraIssueFor fetches an issue as the Slack user would see it. Only
+// the bot's view is cached, as the cache would show issues to people Jira
+// hides them from.
+func fetchJiraIssueFor(ctx context.Context, channel string, userID string, issueID string) (jiraIssue, error) {
+	jira, err := getJiraServiceFor(channel, userID)
+	if err != nil {
+		return jiraIssue{}, err
+	}
+	if jira == getBot().jira {
+		return fetchJiraIssue(ctx, issueID)
+	}
+
+	return jira.GetIssue(ctx, resolveIssueAlias(issueID))
+}
+
+// getUnlinkedPolicy tells whether unlinked users get the bot's view in the
+// channel or nothing
+func getUnlinkedPolicy(channel string) string {
+	config := getConfig()
+
+	if containsString(config.JiraOAuthRefuseChannels, channel) {
+		return jiraUnlinkedRefuse
+	}
+	if containsString(config.JiraOAuthServiceChannels, channel) {
+		return jiraUnlinkedService
+	}
+	if config.JiraOAuthUnlinked == jiraUnlinkedRefuse {
+		return jiraUnlinkedRefuse
+	}
+
+	return jiraUnlinkedService
+}
+
+// newLinkedJiraService acts in Jira as the Slack user's linked account
+func newLinkedJiraService(userID string) *restJiraService {
+	return &restJiraService{userID: userID}
+}
+
+// doLinkedJiraRequest is doJiraInstanceRequest as a linked user, through
+// Atlassian's API gateway
+func doLinkedJiraRequest(ctx context.Context, userID string, method string, path string, body interface{}, result interface{}) error {
+	link, linked, err := getFreshJiraLink(userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !linked {
+		return errJiraLinkRequired
+	}
+
+	return doJiraRequestWith(ctx, jiraOAuthAPIURL+"/ex/jira/"+link.CloudID, bearerAuth(link.AccessToken), method, path, body, result)
+}
+
+func bearerAuth(token string) func(*http.Request) {
+	return func(request *http.Request) {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// getFreshJiraLink returns the user's link with an access token that is
+// still good, refreshing it if needed. Links whose refresh fails, like after
+// the user revoked access, are dropped.
+func getFreshJiraLink(userID string, now time.Time) (jiraLink, bool, error) {
+	jiraLinks.Lock()
+	link, ok := jiraLinks.users[userID]
+	if ok && link.Expiry.Sub(now) > jiraOAuthRefreshMargin {
+		fresh := *link
+		jiraLinks.Unlock()
+		return fresh, true, nil
+	}
+	jiraLinks.Unlock()
+
+	if !ok && !isClusterEnabled() {
+		return jiraLink{}, false, nil
+	}
+
+	// Atlassian rotates refresh tokens, so only one replica may refresh
+	defer lockSharedState(jiraLinksStateKey)()
+	jiraLinks.Lock()
+	defer jiraLinks.Unlock()
+	refreshSharedJiraLinks()
+
+	link, ok = jiraLinks.users[userID]
+	if !ok {
+		return jiraLink{}, false, nil
+	}
+	if link.Expiry.Sub(now) > jiraOAuthRefreshMargin {
+		return *link, true, nil
+	}
+
+	token, err := requestJiraOAuthToken(map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": link.RefreshToken,
+	})
+	var requestError *jiraRequestError
+	if errors.As(err, &requestError) && requestError.StatusCode >= 400 && requestError.StatusCode < 500 {
+		log.Printf("getFreshJiraLink: Dropping the link of %s: %v", userID, err)
+		delete(jiraLinks.users, userID)
+		saveJiraLinks()
+		return jiraLink{}, false, nil
+	}
+	if err != nil {
+		return jiraLink{}, false, err
+	}
+
+	link.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		link.RefreshToken = token.RefreshToken
+	}
+	link.Expiry = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	if err := saveJiraLinks(); err != nil {
+		log.Printf("getFreshJiraLink: Error: %v", err)
+	}
+
+	return *link, true, nil
+}
+
+// requestJiraOAuthToken asks Atlassian for tokens, with the app's
+// credentials added to the parameters
+func requestJiraOAuthToken(params map[string]string) (jiraOAuthToken, error) {
+	config := getConfig()
+	params["client_id"] = config.JiraOAuthClientID
+	params["client_secret"] = config.JiraOAuthClientSecret
+
+	var token jiraOAuthToken
+	err := doJiraRequestWith(context.Background(), jiraOAuthTokenURL, func(*http.Request) {}, "POST", "", params, &token)
+
+	return token, err
+}
+
+// newJiraOAuthState ties an authorization to the Slack user. It is signed, so
+// the callback can trust it without the bot remembering it.
+func newJiraOAuthState(userID string, now time.Time) string {
+	payload := userID + "." + strconv.FormatInt(now.Add(jiraOAuthStateTTL).Unix(), 10)
+
+	return payload + "." + signJiraOAuthState(payload)
+}
+
+func signJiraOAuthState(payload string) string {
+	mac := hmac.New(sha256.New, []byte(getConfig().JiraOAuthClientSecret))
+	mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseJiraOAuthState returns the Slack user of a state the bot signed
+func parseJiraOAuthState(state string, now time.Time) (string, error) {
+	parts := strings.Split(state, ".")
+	if len(parts) != 3 || !hmac.Equal([]byte(parts[2]), []byte(signJiraOAuthState(parts[0]+"."+parts[1]))) {
+		return "", fmt.Errorf("invalid state %q", state)
+	}
+
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() > expiry {
+		return "", fmt.Errorf("the link for %s expired", parts[0])
+	}
+
+	return parts[0], nil
+}
+
+// getJiraAuthorizeURL sends the user to Atlassian to grant the bot access
+func getJiraAuthorizeURL(userID string, now time.Time) string {
+	config := getConfig()
+
+	query := url.Values{
+		"audience":      {"api.atlassian.com"},
+		"client_id":     {config.JiraOAuthClientID},
+		"scope":         {jiraOAuthScopes},
+		"redirect_uri":  {config.JiraOAuthRedirectURL},
+		"state":         {newJiraOAuthState(userID, now)},
+		"response_type": {"code"},
+		"prompt":        {"consent"},
+	}
+
+	return jiraOAuthAuthorizeURL + "?" + query.Encode()
+}
+
+// handleLinkCommand sends the user a link to connect their Jira account in
+// a direct message, as it must not be shared
+func handleLinkCommand(ctx context.Context, message slack.Msg, args []string) {
+	if !isJiraOAuthEnabled() {
+		postEphemeral(message.Channel, message.User, "Linking Jira accounts isn't set up, I look up issues with my own account.")
+		return
+	}
+	if len(args) > 0 {
+		confirmJiraLink(message, args[0])
+		return
+	}
+
+	im, _, _, err := getSlackAPIFor(message.User).OpenConversation(&slack.OpenConversationParameters{Users: []string{message.User}})
+	if err != nil {
+		log.Printf("handleLinkCommand: Error opening a direct message: %v", err)
+		postEphemeral(message.Channel, message.User, ":warning: I couldn't send you a direct message.")
+		return
+	}
+
+	text := fmt.Sprintf(":link: <%s|Link your Jira account> so I look up issues and change them in Jira as you. The link works for %d minutes.",
+		getJiraAuthorizeURL(message.User, time.Now()), int(jiraOAuthStateTTL.Minutes()))
+	if link, ok := getJiraLink(message.User); ok {
+		text += fmt.Sprintf(" You're linked as %s already, linking again replaces that.", link.DisplayName)
+	}
+
+	if err := postText(im.ID, "", text); err != nil {
+		log.Printf("handleLinkCommand: Error: %v", err)
+		return
+	}
+	if im.ID != message.Channel {
+		postEphemeral(message.Channel, message.User, ":link: I sent you a link in a direct message.")
+	}
+}
+
+// confirmJiraLink saves the link whose code the Jira page showed, if the
+// user is the one who asked for it
+func confirmJiraLink(message slack.Msg, code string) {
+	link, err := claimPendingJiraLink(code, message.User, time.Now())
+	if err != nil {
+		log.Printf("confirmJiraLink: %v", err)
+		postEphemeral(message.Channel, message.User, ":warning: This code is invalid or expired. Ask for a new link with `@JiraBot link`.")
+		return
+	}
+
+	if err := saveJiraLink(message.User, link); err != nil {
+		log.Printf("confirmJiraLink: Error: %v", err)
+		postEphemeral(message.Channel, message.User, ":warning: I couldn't save the link, try again.")
+		return
+	}
+
+	recordEvent("jira_link", map[string]interface{}{"user": message.User})
+	postEphemeral(message.Channel, message.User, fmt.Sprintf(":link: Linked to Jira as %s.", link.DisplayName))
+}
+
+// handleUnlinkCommand forgets the user's Jira account
+func handleUnlinkCommand(ctx context.Context, message slack.Msg, args []string) {
+	text := "You haven't linked a Jira account."
+	if removed, err := removeJiraLink(message.User); err != nil {
+		log.Printf("handleUnlinkCommand: Error: %v", err)
+		text = ":warning: I couldn't unlink your Jira account, try again later."
+	} else if removed {
+		recordEvent("jira_link", map[string]interface{}{"user": message.User, "unlinked": true})
+		text = "I unlinked your Jira account. You can also revoke my access in your Atlassian account settings."
+	}
+
+	postEphemeral(message.Channel, message.User, text)
+}
+
+func serveJiraOAuth(addr string) {
+	log.Printf("serveJiraOAuth: Listening on %s", addr)
+
+	if err := http.ListenAndServe(addr, newJiraOAuthHandler()); err != nil {
+		log.Printf("serveJiraOAuth: Error: %v", err)
+	}
+}
+
+func newJiraOAuthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jira/oauth/callback", handleJiraOAuthCallback)
+
+	return mux
+}
+
+// handleJiraOAuthCallback shows a code to confirm the link in Slack once
+// access was granted, so only the Slack user who asked for the link and
+// opened it themselves can complete it
+func handleJiraOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	userID, err := parseJiraOAuthState(query.Get("state"), time.Now())
+	if err != nil {
+		log.Printf("handleJiraOAuthCallback: %v", err)
+		http.Error(w, "This link is invalid or expired. Ask for a new one with @JiraBot link.", http.StatusBadRequest)
+		return
+	}
+	if reason := query.Get("error"); reason != "" {
+		http.Error(w, "Jira didn't grant access: "+reason, http.StatusForbidden)
+		return
+	}
+
+	link, err := exchangeJiraOAuthCode(query.Get("code"), time.Now())
+	if err != nil {
+		log.Printf("handleJiraOAuthCallback: Error linking %s: %v", userID, err)
+		http.Error(w, "I couldn't link your Jira account, try again.", http.StatusBadGateway)
+		return
+	}
+
+	code, err := savePendingJiraLink(userID, link, time.Now())
+	if err != nil {
+		log.Printf("handleJiraOAuthCallback: Error: %v", err)
+		http.Error(w, "I couldn't save the link, try again.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<p>To finish linking Slack to Jira as %s, send <code>@JiraBot link %s</code> in Slack within %d minutes.</p>"+
+		"<p>If you didn't ask for this link yourself, close this page.</p>",
+		html.EscapeString(link.DisplayName), code, int(jiraOAuthStateTTL.Minutes()))
+}
+
+// exchangeJiraOAuthCode gets tokens for the code of a granted authorization
+// and finds out which account and Jira site they are for
+func exchangeJiraOAuthCode(code string, now time.Time) (jiraLink, error) {
+	token, err := requestJiraOAuthToken(map[string]string{
+		"grant_type":   "authorization_code",
+		"code":         code,
+		"redirect_uri": getConfig().JiraOAuthRedirectURL,
+	})
+	if err != nil {
+		return jiraLink{}, err
+	}
+
+	link := jiraLink{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		Expiry:       now.Add(time.Duration(token.ExpiresIn) * time.Second),
+	}
+
+	var sites []struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := doJiraRequestWith(context.Background(), jiraOAuthAPIURL, bearerAuth(link.AccessToken), "GET", "/oauth/token/accessible-resources", nil, &sites); err != nil {
+		return link, err
+	}
+	for _, site := range sites {
+		if strings.EqualFold(strings.TrimSuffix(site.URL, "/"), strings.TrimSuffix(getConfig().JiraBaseURL, "/")) {
+			link.CloudID = site.ID
+		}
+	}
+	if link.CloudID == "" {
+		return link, fmt.Errorf("the account has no access to %s", getConfig().JiraBaseURL)
+	}
+
+	var user jiraUser
+	if err := doJiraRequestWith(context.Background(), jiraOAuthAPIURL+"/ex/jira/"+link.CloudID, bearerAuth(link.AccessToken), "GET", "/rest/api/3/myself", nil, &user); err != nil {
+		return link, err
+	}
+	link.AccountID = user.AccountID
+	link.DisplayName = user.DisplayName
+
+	return link, nil
+}
+
+func getJiraLink(userID string) (jiraLink, bool) {
+	jiraLinks.Lock()
+	defer jiraLinks.Unlock()
+
+	link, ok := jiraLinks.users[userID]
+	if !ok {
+		return jiraLink{}, false
+	}
+
+	return *link, true
+}
+
+func saveJiraLink(userID string, link jiraLink) error {
+	defer lockSharedState(jiraLinksStateKey)()
+	jiraLinks.Lock()
+	defer jiraLinks.Unlock()
+	refreshSharedJiraLinks()
+
+	jiraLinks.users[userID] = &link
+
+	return saveJiraLinks()
+}
+
+// removeJiraLink forgets the user's account and reports whether there was one
+func removeJiraLink(userID string) (bool, error) {
+	defer lockSharedState(jiraLinksStateKey)()
+	jiraLinks.Lock()
+	defer jiraLinks.Unlock()
+	refreshSharedJiraLinks()
+
+	if _, ok := jiraLinks.users[userID]; !ok {
+		return false, nil
+	}
+	delete(jiraLinks.users, userID)
+
+	return true, saveJiraLinks()
+}
+
+// savePendingJiraLink keeps a granted authorization until the user confirms
+// it, and returns the code to confirm it with
+func savePendingJiraLink(userID string, link jiraLink, now time.Time) (string, error) {
+	random := make([]byte, 5)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := strings.ToUpper(hex.EncodeToString(random))
+
+	defer lockSharedState(jiraPendingLinksStateKey)()
+	pending, err := loadPendingJiraLinks(now)
+	if err != nil {
+		return "", err
+	}
+	pending[code] = pendingJiraLink{UserID: userID, Link: link, Expiry: now.Add(jiraOAuthStateTTL)}
+
+	return code, savePendingJiraLinks(pending)
+}
+
+// claimPendingJiraLink returns the authorization of a code, if it is the
+// user's and didn't expire. A code only works once.
+func claimPendingJiraLink(code string, userID string, now time.Time) (jiraLink, error) {
+	defer lockSharedState(jiraPendingLinksStateKey)()
+	pending, err := loadPendingJiraLinks(now)
+	if err != nil {
+		return jiraLink{}, err
+	}
+
+	link, ok := pending[strings.ToUpper(code)]
+	if !ok || link.UserID != userID {
+		return jiraLink{}, fmt.Errorf("%s has no pending link for %q", userID, code)
+	}
+	delete(pending, strings.ToUpper(code))
+
+	return link.Link, savePendingJiraLinks(pending)
+}
+
+// removePendingJiraLinks forgets the authorizations the user didn't confirm
+func removePendingJiraLinks(userID string) error {
+	defer lockSharedState(jiraPendingLinksStateKey)()
+	pending, err := loadPendingJiraLinks(time.Now())
+	if err != nil {
+		return err
+	}
+	for code, link := range pending {
+		if link.UserID == userID {
+			delete(pending, code)
+		}
+	}
+
+	return savePendingJiraLinks(pending)
+}
+
+// loadPendingJiraLinks reads the authorizations that didn't expire yet
+func loadPendingJiraLinks(now time.Time) (map[string]pendingJiraLink, error) {
+	store, err := getStateStore()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := map[string]pendingJiraLink{}
+	if _, err := store.Load(jiraPendingLinksStateKey, &pending); err != nil {
+		return nil, err
+	}
+	for code, link := range pending {
+		if now.After(link.Expiry) {
+			delete(pending, code)
+		}
+	}
+
+	return pending, nil
+}
+
+func savePendingJiraLinks(pending map[string]pendingJiraLink) error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(jiraPendingLinksStateKey, pending)
+}
+
+// loadJiraLinks restores the accounts linked before the last restart
+func loadJiraLinks() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadJiraLinks: Error: %v", err)
+		return
+	}
+
+	users := map[string]*jiraLink{}
+	if _, err := store.Load(jiraLinksStateKey, &users); err != nil {
+		log.Printf("loadJiraLinks: Error: %v", err)
+		return
+	}
+
+	jiraLinks.Lock()
+	jiraLinks.users = users
+	jiraLinks.Unlock()
+}
+
+// refreshSharedJiraLinks reads the links again, as other replicas may have
+// changed them. The caller holds the lock of jiraLinks.
+func refreshSharedJiraLinks() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedJiraLinks: Error: %v", err)
+		return
+	}
+
+	users := map[string]*jiraLink{}
+	if _, err := store.Load(jiraLinksStateKey, &users); err != nil {
+		log.Printf("refreshSharedJiraLinks: Error: %v", err)
+		return
+	}
+
+	jiraLinks.users = users
+}
+
+// saveJiraLinks writes the links to the state store. The caller holds the
+// lock of jiraLinks.
+func saveJiraLinks() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(jiraLinksStateKey, jiraLinks.users)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJiraOAuthState(t *testing.T) {
+	os.Setenv("JIRA_OAUTH_CLIENT_SECRET", "secret")
+	defer os.Unsetenv("JIRA_OAUTH_CLIENT_SECRET")
+
+	now := time.Now()
+	state := newJiraOAuthState("U123", now)
+
+	if userID, err := parseJiraOAuthState(state, now.Add(time.Minute)); err != nil || userID != "U123" {
+		t.Errorf("Expected U123, got %q, %v", userID, err)
+	}
+	if _, err := parseJiraOAuthState(state, now.Add(jiraOAuthStateTTL+time.Minute)); err == nil {
+		t.Error("Expected an expired state to be rejected")
+	}
+	if _, err := parseJiraOAuthState(strings.Replace(state, "U123", "U999", 1), now); err == nil {
+		t.Error("Expected a state for another user to be rejected")
+	}
+}
+
+func TestGetUnlinkedPolicy(t *testing.T) {
+	os.Setenv("JIRA_OAUTH_REFUSE_CHANNELS", "C1")
+	os.Setenv("JIRA_OAUTH_SERVICE_CHANNELS", "C2")
+	defer os.Unsetenv("JIRA_OAUTH_REFUSE_CHANNELS")
+	defer os.Unsetenv("JIRA_OAUTH_SERVICE_CHANNELS")
+	defer os.Unsetenv("JIRA_OAUTH_UNLINKED")
+
+	for _, test := range []struct {
+		unlinked string
+		channel  string
+		expected string
+	}{
+		{"", "C1", jiraUnlinkedRefuse},
+		{"", "C3", jiraUnlinkedService},
+		{jiraUnlinkedRefuse, "C2", jiraUnlinkedService},
+		{jiraUnlinkedRefuse, "C3", jiraUnlinkedRefuse},
+	} {
+		os.Setenv("JIRA_OAUTH_UNLINKED", test.unlinked)
+		if policy := getUnlinkedPolicy(test.channel); policy != test.expected {
+			t.Errorf("Expected %s in %s with %q, got %s", test.expected, test.channel, test.unlinked, policy)
+		}
+	}
+}
+
+func TestLinkedJiraService(t *testing.T) {
+	defer setBot(nil)
+	setBot(&jiraBot{jira: &fakeJiraService{issue: jiraIssue{Key: "ABC-1", Fields: &jiraIssueFields{Summary: "As the bot"}}}})
+
+	refreshes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			var params map[string]string
+			json.NewDecoder(r.Body).Decode(&params)
+			if params["refresh_token"] == "revoked" {
+				http.Error(w, `{"error": "invalid_grant"}`, http.StatusForbidden)
+				return
+			}
+			refreshes++
+			w.Write([]byte(`{"access_token": "fresh", "refresh_token": "rotated", "expires_in": 3600}`))
+		case "/ex/jira/cloud-1/rest/api/3/issue/ABC-1":
+			if r.Header.Get("Authorization") != "Bearer fresh" {
+				http.Error(w, "", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"key": "ABC-1", "fields": {"summary": "As the user"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tokenURL, apiURL := jiraOAuthTokenURL, jiraOAuthAPIURL
+	jiraOAuthTokenURL, jiraOAuthAPIURL = server.URL+"/oauth/token", server.URL
+	defer func() { jiraOAuthTokenURL, jiraOAuthAPIURL = tokenURL, apiURL }()
+
+	os.Setenv("JIRA_OAUTH_CLIENT_ID", "client")
+	os.Setenv("JIRA_DEPLOYMENT", "cloud")
+	os.Setenv("JIRA_OAUTH_REFUSE_CHANNELS", "C1")
+	defer os.Unsetenv("JIRA_OAUTH_CLIENT_ID")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+	defer os.Unsetenv("JIRA_OAUTH_REFUSE_CHANNELS")
+
+	saveJiraLink("U1", jiraLink{CloudID: "cloud-1", AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now()})
+	saveJiraLink("U2", jiraLink{CloudID: "cloud-1", AccessToken: "stale", RefreshToken: "revoked", Expiry: time.Now()})
+	defer removeJiraLink("U1")
+
+	issue, err := fetchJiraIssueFor(context.Background(), "C1", "U1", "ABC-1")
+	if err != nil || issue.Fields.Summary != "As the user" {
+		t.Fatalf("Expected the issue as the user, got %+v, %v", issue, err)
+	}
+	if link, _ := getJiraLink("U1"); refreshes != 1 || link.RefreshToken != "rotated" {
+		t.Errorf("Expected the token to be refreshed once, got %d refreshes and %+v", refreshes, link)
+	}
+
+	if _, err := fetchJiraIssueFor(context.Background(), "C1", "U2", "ABC-1"); getErrorKind(err) != errorKindUnlinked {
+		t.Errorf("Expected the revoked link to be dropped and the user refused, got %v", err)
+	}
+	if _, ok := getJiraLink("U2"); ok {
+		t.Error("Expected the revoked link to be dropped")
+	}
+
+	issue, err = fetchJiraIssueFor(context.Background(), "C2", "U2", "ABC-1")
+	forgetCachedIssue("ABC-1")
+	if err != nil || issue.Fields.Summary != "As the bot" {
+		t.Errorf("Expected the bot's view elsewhere, got %+v, %v", issue, err)
+	}
+}
+
+func TestPendingJiraLink(t *testing.T) {
+	now := time.Now()
+	code, err := savePendingJiraLink("U1", jiraLink{AccountID: "A1", DisplayName: "Jane"}, now)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expired, _ := savePendingJiraLink("U1", jiraLink{AccountID: "A2"}, now.Add(-2*jiraOAuthStateTTL))
+
+	// Whoever else opened a shared link can't claim it
+	if _, err := claimPendingJiraLink(code, "U2", now); err == nil {
+		t.Error("Expected another user's code to be refused")
+	}
+	if link, err := claimPendingJiraLink(strings.ToLower(code), "U1", now); err != nil || link.AccountID != "A1" {
+		t.Errorf("Expected the link of A1, got %+v, %v", link, err)
+	}
+	if _, err := claimPendingJiraLink(code, "U1", now); err == nil {
+		t.Error("Expected a code to only work once")
+	}
+	if _, err := claimPendingJiraLink(expired, "U1", now); err == nil {
+		t.Error("Expected an expired code to be refused")
+	}
+}
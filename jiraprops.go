@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entity property Jira admins can set on a project or issue to configure the
+// bot for it, e.g. with
+// PUT /rest/api/2/project/WEB/properties/slack-jira-bot
+// {"discussionLinks": true, "freezes": ["2026-12-20..2027-01-03"]}
+const jiraPropertyKey = "slack-jira-bot"
+
+// How long settings read from Jira are reused
+const jiraPropertyTTL = 15 * time.Minute
+
+// Settings read from a project or issue property. Unset settings fall back to
+// the bot's own configuration, issue settings win over project settings.
+type jiraPropertySettings struct {
+	// Whether Slack discussions are linked from the issues
+	DiscussionLinks *bool `json:"discussionLinks"`
+
+	// Change freezes as "start..end", in addition to the configured ones
+	Freezes []string `json:"freezes"`
+}
+
+type cachedPropertySettings struct {
+	settings jiraPropertySettings
+	fetched  time.Time
+}
+
+// Settings read from Jira, keyed by "project/WEB" or "issue/WEB-1"
+var jiraPropertyCache = struct {
+	sync.Mutex
+	entries map[string]cachedPropertySettings
+}{entries: map[string]cachedPropertySettings{}}
+
+// getJiraPropertySettings returns the settings stored on a project or issue.
+// Entities without the property have no settings.
+func getJiraPropertySettings(entity string, key string) jiraPropertySettings {
+	if !getConfig().JiraPropertyConfig {
+		return jiraPropertySettings{}
+	}
+
+	cacheKey := entity + "/" + key
+
+	jiraPropertyCache.Lock()
+	cached, ok := jiraPropertyCache.entries[cacheKey]
+	jiraPropertyCache.Unlock()
+
+	if ok && time.Since(cached.fetched) < jiraPropertyTTL {
+		return cached.settings
+	}
+
+	var property struct {
+		Value jiraPropertySettings `json:"value"`
+	}
+	if err := getBot().jira.GetProperty(context.Background(), entity, key, jiraPropertyKey, &property); err != nil && getErrorKind(err) != errorKindNotFound {
+		log.Printf("getJiraPropertySettings: Error reading %s: %v", cacheKey, err)
+		return cached.settings
+	}
+
+	if _, errs := parseFreezes(strings.Join(property.Value.Freezes, ";")); len(errs) > 0 {
+		log.Printf("getJiraPropertySettings: Ignoring freezes of %s: %v", cacheKey, errs)
+	}
+
+	jiraPropertyCache.Lock()
+	jiraPropertyCache.entries[cacheKey] = cachedPropertySettings{settings: property.Value, fetched: time.Now()}
+	jiraPropertyCache.Unlock()
+
+	return property.Value
+}
+
+// getFreezes returns the configured freezes along with those the project's
+// admins set in Jira
+func getFreezes(project string) []FreezeWindow {
+	freezes := getConfig().Freezes
+
+	settings := getJiraPropertySettings("project", project)
+	// Malformed freezes were logged when the settings were read
+	projectFreezes, _ := parseFreezes(strings.Join(settings.Freezes, ";"))
+	for _, freeze := range projectFreezes {
+		freeze.Projects = []string{project}
+		freezes = append(freezes, freeze)
+	}
+
+	return freezes
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJiraPropertySettings(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		switch r.URL.Path {
+		case "/rest/api/2/project/WEB/properties/slack-jira-bot":
+			fmt.Fprint(w, `{"key": "slack-jira-bot", "value": {"discussionLinks": true, "freezes": ["2026-12-20..2027-01-03"]}}`)
+		case "/rest/api/2/issue/WEB-2/properties/slack-jira-bot":
+			fmt.Fprint(w, `{"key": "slack-jira-bot", "value": {"discussionLinks": false}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	os.Setenv("JIRA_PROPERTY_CONFIG", "true")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_PROPERTY_CONFIG")
+	defer func() { jiraPropertyCache.entries = map[string]cachedPropertySettings{} }()
+
+	if !shouldRecordSlackDiscussion("WEB-1") {
+		t.Errorf("Expected the project property to enable discussion links")
+	}
+	if shouldRecordSlackDiscussion("WEB-2") {
+		t.Errorf("Expected the issue property to win over the project property")
+	}
+
+	freezes := getFreezes("WEB")
+	if len(freezes) != 1 || !freezes[0].Active("WEB", time.Date(2027, 1, 3, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the project's freeze, got %+v", freezes)
+	}
+
+	before := requests
+	shouldRecordSlackDiscussion("WEB-1")
+	if requests != before {
+		t.Errorf("Expected the settings to be cached")
+	}
+}
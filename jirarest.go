@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of Jira installations, see JIRA_DEPLOYMENT
+const (
+	jiraDeploymentCloud  = "cloud"
+	jiraDeploymentServer = "server"
+)
+
+// Ways to sign in to Jira, see JIRA_AUTH. Jira Cloud takes API tokens instead
+// of passwords, Data Center and Server personal access tokens.
+const (
+	jiraAuthBasic    = "basic"
+	jiraAuthAPIToken = "api_token"
+	jiraAuthPAT      = "pat"
+)
+
+// HTTP client for Jira requests, giving up on a hung Jira eventually
+var jiraHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// Error details Jira sends along with a failed request
+type jiraErrorResponse struct {
+	ErrorMessages []string          `json:"errorMessages"`
+	Errors        map[string]string `json:"errors"`
+}
+
+// A Jira request that failed, with the messages Jira gave for it
+type jiraRequestError struct {
+	Method     string
+	Path       string
+	Status     string
+	StatusCode int
+	Messages   []string
+}
+
+func (e *jiraRequestError) Error() string {
+	message := fmt.Sprintf("%s %s: unexpected status %s", e.Method, e.Path, e.Status)
+	if len(e.Messages) > 0 {
+		message += ": " + strings.Join(e.Messages, " ")
+	}
+
+	return message
+}
+
+// doJiraRequestWith sends a request to a Jira API under the base URL, signed
+// in by authorize, like as a user who linked their Jira account
+func doJiraRequestWith(ctx context.Context, baseURL string, authorize func(*http.Request), method string, path string, body interface{}, result interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, baseURL+path, payload)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	authorize(request)
+
+	countJiraCall()
+
+	response, err := jiraHTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return &botError{
+			Kind: getErrorKindForStatus(response.StatusCode),
+			Err:  newJiraRequestError(method, path, response),
+		}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// verifyJiraCredentials asks every Jira instance who the bot is, so bad
+// credentials stop the bot at startup instead of failing every lookup
+func verifyJiraCredentials() error {
+	for _, instance := range getJiraInstances() {
+		var user jiraUser
+		var err error
+		if instance.Name == mainJiraInstance {
+			user, err = getBot().jira.GetMyself(context.Background())
+		} else {
+			user, err = (&restJiraService{instance: instance.Name}).GetMyself(context.Background())
+		}
+
+		if getErrorKind(err) == errorKindForbidden {
+			auth, setting := instance.Auth, "JIRA_AUTH"
+			if auth == "" {
+				auth = jiraAuthBasic
+			}
+			if instance.Name != mainJiraInstance {
+				setting = "JIRA_" + strings.ToUpper(instance.Name) + "_AUTH"
+			}
+			return fmt.Errorf("Jira rejected the %s credentials of the %s instance, check %s and the username, password or token: %v", auth, instance.Name, setting, err)
+		}
+		if err != nil {
+			return fmt.Errorf("could not reach Jira at %s: %v", instance.BaseURL, err)
+		}
+
+		log.Printf("verifyJiraCredentials: Signed in to the %s Jira as %s", instance.Name, user.DisplayName)
+	}
+
+	return nil
+}
+
+// newJiraRequestError collects the messages from a Jira error response
+func newJiraRequestError(method string, path string, response *http.Response) *jiraRequestError {
+	result := &jiraRequestError{
+		Method:     method,
+		Path:       path,
+		Status:     response.Status,
+		StatusCode: response.StatusCode,
+	}
+
+	var details jiraErrorResponse
+	if json.NewDecoder(io.LimitReader(response.Body, 64*1024)).Decode(&details) != nil {
+		return result
+	}
+
+	result.Messages = append(result.Messages, details.ErrorMessages...)
+
+	fields := []string{}
+	for field := range details.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		result.Messages = append(result.Messages, details.Errors[field])
+	}
+
+	return result
+}
+
+// isJiraCloud reports whether the main instance is Jira Cloud rather than
+// Jira Server or Data Center
+func isJiraCloud() bool {
+	return getMainJiraInstance().isCloud()
+}
+
+// getJiraAPIPath returns the REST API of the main instance, see
+// JiraInstance.apiPath
+func getJiraAPIPath() string {
+	return getMainJiraInstance().apiPath()
+}
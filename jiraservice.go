@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Layout of the dates in Jira responses
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// Everything the bot does in Jira goes through a JiraService, so the client
+// can be replaced, e.g. by a fake in tests, and requests reach the right
+// instance as the right user. Requests give up once the ctx is done.
+type JiraService interface {
+	// GetMyself returns the user the bot signs in as
+	GetMyself(ctx context.Context) (jiraUser, error)
+	GetIssue(ctx context.Context, issueKey string) (jiraIssue, error)
+	// GetIssueFields decodes the issue with only the comma separated fields,
+	// or all of them if there are none, into result
+	GetIssueFields(ctx context.Context, issueKey string, fields string, result interface{}) error
+	SearchIssues(ctx context.Context, jql string, fields string, maxResults int) (jiraSearchResult, error)
+	GetTransitions(ctx context.Context, issueKey string) ([]jiraTransition, error)
+	TransitionIssue(ctx context.Context, issueKey string, transitionID string) error
+	AddComment(ctx context.Context, issueKey string, body interface{}) error
+	// CreateIssue files an issue with the fields and returns its key
+	CreateIssue(ctx context.Context, fields map[string]interface{}) (string, error)
+	AssignIssue(ctx context.Context, issueKey string, user jiraUser) error
+	AddWatcher(ctx context.Context, issueKey string, user jiraUser) error
+	GetRemoteLinks(ctx context.Context, issueKey string) ([]remoteLink, error)
+	// GetRequestComments lists the comments customers see on a Jira Service
+	// Management request, oldest first
+	GetRequestComments(ctx context.Context, issueKey string) ([]serviceDeskComment, error)
+	// GetRequestParticipants lists who the request is shared with, besides
+	// its reporter
+	GetRequestParticipants(ctx context.Context, issueKey string) ([]jiraUser, error)
+	AddRemoteLink(ctx context.Context, issueKey string, link remoteLink) error
+	// GetProperty decodes the entity property of a project or issue into
+	// result, see jiraprops.go
+	GetProperty(ctx context.Context, entity string, key string, property string, result interface{}) error
+	GetProjects(ctx context.Context) ([]jiraProject, error)
+	// GetInstanceData fetches the fields, statuses, priorities, issue types
+	// and users of the instance
+	GetInstanceData(ctx context.Context) (jiraInstanceData, error)
+}
+
+// A Jira issue with the fields the bot shows. Templates use these names, see
+// template.go.
+type jiraIssue struct {
+	Id     string           `json:"id"`
+	Key    string           `json:"key"`
+	Self   string           `json:"self"`
+	Expand string           `json:"expand"`
+	Fields *jiraIssueFields `json:"fields"`
+	// Fields.Created as a time, zero if Jira sent none
+	CreatedAt time.Time `json:"-"`
+	// What customers see of a service desk request, only read for the cards
+	// of customer channels, see loadCustomerRequest
+	Request *serviceDeskRequest `json:"-"`
+}
+
+type jiraIssueFields struct {
+	Summary     string    `json:"summary"`
+	Description jiraText  `json:"description"`
+	Reporter    *jiraUser `json:"reporter"`
+	Assignee    *jiraUser `json:"assignee"`
+	Status      *struct {
+		Name string `json:"name"`
+	} `json:"status"`
+	Created string `json:"created"`
+	Project *struct {
+		Key string `json:"key"`
+		// "service_desk" for Jira Service Management projects
+		ProjectTypeKey string `json:"projectTypeKey"`
+	} `json:"project"`
+}
+
+func (issue *jiraIssue) UnmarshalJSON(data []byte) error {
+	// A type without the method, so decoding doesn't recurse
+	type plainIssue jiraIssue
+
+	var decoded plainIssue
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*issue = jiraIssue(decoded)
+
+	if issue.Fields != nil && issue.Fields.Created != "" {
+		issue.CreatedAt, _ = time.Parse(jiraTimeLayout, issue.Fields.Created)
+	}
+
+	return nil
+}
+
+// restJiraService talks to the REST API of a Jira instance, the main one by
+// default, with the configured credentials or as a Slack user who linked
+// their Jira account
+type restJiraService struct {
+	instance string
+	userID   string
+}
+
+func newRESTJiraService() *restJiraService {
+	return &restJiraService{}
+}
+
+func (s *restJiraService) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	if s.userID != "" {
+		return doLinkedJiraRequest(ctx, s.userID, method, path, body, result)
+	}
+
+	return doJiraInstanceRequest(ctx, s.getInstance(), method, path, body, result)
+}
+
+func (s *restJiraService) getInstance() JiraInstance {
+	return getJiraInstance(s.instance)
+}
+
+func (s *restJiraService) GetMyself(ctx context.Context) (jiraUser, error) {
+	var user jiraUser
+	err := s.do(ctx, "GET", s.getInstance().apiPath()+"/myself", nil, &user)
+
+	return user, err
+}
+
+func (s *restJiraService) GetIssue(ctx context.Context, issueKey string) (jiraIssue, error) {
+	var issue jiraIssue
+	err := s.do(ctx, "GET", s.getInstance().apiPath()+"/issue/"+url.PathEscape(issueKey), nil, &issue)
+	if err == nil && issue.Fields == nil {
+		err = newBotError(errorKindNotFound, "issue %s not found", issueKey)
+	}
+
+	return issue, err
+}
+
+func (s *restJiraService) GetIssueFields(ctx context.Context, issueKey string, fields string, result interface{}) error {
+	path := s.getInstance().apiPath() + "/issue/" + url.PathEscape(issueKey)
+	if fields != "" {
+		path += "?fields=" + url.QueryEscape(fields)
+	}
+
+	return s.do(ctx, "GET", path, nil, result)
+}
+
+func (s *restJiraService) SearchIssues(ctx context.Context, jql string, fields string, maxResults int) (jiraSearchResult, error) {
+	query := url.Values{
+		"jql":        {jql},
+		"maxResults": {strconv.Itoa(maxResults)},
+		"fields":     {fields},
+	}
+
+	var result jiraSearchResult
+	err := s.do(ctx, "GET", s.getInstance().apiPath()+"/search?"+query.Encode(), nil, &result)
+
+	return result, err
+}
+
+func (s *restJiraService) GetTransitions(ctx context.Context, issueKey string) ([]jiraTransition, error) {
+	var result struct {
+		Transitions []jiraTransition `json:"transitions"`
+	}
+	err := s.do(ctx, "GET", s.getInstance().apiPath()+"/issue/"+url.PathEscape(issueKey)+"/transitions", nil, &result)
+
+	return result.Transitions, err
+}
+
+func (s *restJiraService) TransitionIssue(ctx context.Context, issueKey string, transitionID string) error {
+	return s.do(ctx, "POST", s.getInstance().apiPath()+"/issue/"+url.PathEscape(issueKey)+"/transitions", map[string]interface{}{
+		"transition": map[string]string{"id": transitionID},
+	}, nil)
+}
+
+func (s *restJiraService) AddComment(ctx context.Context, issueKey string, body interface{}) error {
+	return s.do(ctx, "POST", s.getInstance().apiPath()+"/issue/"+url.PathEscape(issueKey)+"/comment", map[string]interface{}{
+		"body": body,
+	}, nil)
+}
+
+func (s *restJiraService) CreateIssue(ctx context.Context, fields map[string]interface{}) (string, error) {
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := s.do(ctx, "POST", s.getInstance().apiPath()+"/issue", map[string]interface{}{"fields": fields}, &created); err != nil {
+		return "", err
+	}
+
+	return created.Key, nil
+}
+
+func (s *restJiraService) AssignIssue(ctx context.Context, issueKey string, user jiraUser) error {
+	return s.do(ctx, "PUT", s.getInstance().apiPath()+"/issue/"+url.PathEscape(issueKey)+"/assignee", newJiraUserRef(user), nil)
+}
+
+func (s *restJiraService) AddWatcher(ctx context.Context, issueKey string, user jiraUser) error {
+	// The body is just the account ID or user name as a JSON string
+	return s.do(ctx, "POST", s.getInstance().apiPath()+"/issue/"+url.PathEscape(issueKey)+"/watchers", getJiraUserKey(user), nil)
+}
+
+// Remote links, entity properties, projects and the instance data are read
+// through v2 of the API everywhere, as their format didn't change in v3
+
+func (s *restJiraService) GetRemoteLinks(ctx context.Context, issueKey string) ([]remoteLink, error) {
+	links := []remoteLink{}
+	err := s.do(ctx, "GET", "/rest/api/2/issue/"+url.PathEscape(issueKey)+"/remotelink", nil, &links)
+
+	return links, err
+}
+
+func (s *restJiraService) AddRemoteLink(ctx context.Context, issueKey string, link remoteLink) error {
+	return s.do(ctx, "POST", "/rest/api/2/issue/"+url.PathEscape(issueKey)+"/remotelink", link, nil)
+}
+
+// Service desk requests are read through the Jira Service Management API, as
+// only it knows which comments are public
+
+func (s *restJiraService) GetRequestComments(ctx context.Context, issueKey string) ([]serviceDeskComment, error) {
+	query := url.Values{
+		"public":   {"true"},
+		"internal": {"false"},
+		"limit":    {strconv.Itoa(maxServiceDeskValues)},
+	}
+
+	var result struct {
+		Values []serviceDeskComment `json:"values"`
+	}
+	err := s.do(ctx, "GET", "/rest/servicedeskapi/request/"+url.PathEscape(issueKey)+"/comment?"+query.Encode(), nil, &result)
+
+	return result.Values, err
+}
+
+func (s *restJiraService) GetRequestParticipants(ctx context.Context, issueKey string) ([]jiraUser, error) {
+	var result struct {
+		Values []jiraUser `json:"values"`
+	}
+	err := s.do(ctx, "GET", "/rest/servicedeskapi/request/"+url.PathEscape(issueKey)+"/participant?limit="+strconv.Itoa(maxServiceDeskValues), nil, &result)
+
+	return result.Values, err
+}
+
+func (s *restJiraService) GetProperty(ctx context.Context, entity string, key string, property string, result interface{}) error {
+	return s.do(ctx, "GET", "/rest/api/2/"+entity+"/"+url.PathEscape(key)+"/properties/"+url.PathEscape(property), nil, result)
+}
+
+func (s *restJiraService) GetProjects(ctx context.Context) ([]jiraProject, error) {
+	projects := []jiraProject{}
+	err := s.do(ctx, "GET", "/rest/api/2/project", nil, &projects)
+
+	return projects, err
+}
+
+func (s *restJiraService) GetInstanceData(ctx context.Context) (jiraInstanceData, error) {
+	var data jiraInstanceData
+
+	if err := s.do(ctx, "GET", "/rest/api/2/field", nil, &data.Fields); err != nil {
+		return data, err
+	}
+	if err := s.do(ctx, "GET", "/rest/api/2/status", nil, &data.Statuses); err != nil {
+		return data, err
+	}
+	if err := s.do(ctx, "GET", "/rest/api/2/priority", nil, &data.Priorities); err != nil {
+		return data, err
+	}
+	if err := s.do(ctx, "GET", "/rest/api/2/issuetype", nil, &data.IssueTypes); err != nil {
+		return data, err
+	}
+
+	for start := 0; start < maxJiraUsers; start += jiraUsersPageSize {
+		page := []jiraUser{}
+		path := fmt.Sprintf(getJiraUserSearchPath()+"startAt=%d&maxResults=%d", start, jiraUsersPageSize)
+		if err := s.do(ctx, "GET", path, nil, &page); err != nil {
+			return data, err
+		}
+
+		for _, user := range page {
+			if user.Active {
+				data.Users = append(data.Users, user)
+			}
+		}
+
+		if len(page) < jiraUsersPageSize {
+			break
+		}
+	}
+
+	return data, nil
+}
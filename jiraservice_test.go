@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// A JiraService serving a single issue
+type fakeJiraService struct {
+	restJiraService
+	issue jiraIssue
+}
+
+func (s *fakeJiraService) GetIssue(ctx context.Context, issueKey string) (jiraIssue, error) {
+	if issueKey != s.issue.Key {
+		return jiraIssue{}, newBotError(errorKindNotFound, "issue %s not found", issueKey)
+	}
+
+	return s.issue, nil
+}
+
+func TestRESTJiraServiceGetsIssues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/2/issue/ABC-1":
+			w.Write([]byte(`{"key": "ABC-1", "fields": {"summary": "Printer on fire", "status": {"name": "Open"}, "created": "2020-01-02T03:04:05.000+0000", "description": "Smoke"}}`))
+		case "/rest/api/2/issue/ABC-2":
+			w.Write([]byte(`{"key": "ABC-2", "fields": {"summary": "Unexpected", "status": null, "assignee": "nobody"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	os.Setenv("JIRA_DEPLOYMENT", "server")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+
+	service := newRESTJiraService()
+
+	issue, err := service.GetIssue(context.Background(), "ABC-1")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if issue.Fields.Summary != "Printer on fire" || issue.Fields.Status.Name != "Open" || issue.Fields.Description != "Smoke" {
+		t.Errorf("Unexpected issue %+v", issue.Fields)
+	}
+	if issue.CreatedAt.Year() != 2020 {
+		t.Errorf("Expected the creation date to be parsed, got %v", issue.CreatedAt)
+	}
+
+	if _, err := service.GetIssue(context.Background(), "ABC-2"); err == nil {
+		t.Error("Expected an unexpected payload to be an error, not a panic")
+	}
+	if _, err := service.GetIssue(context.Background(), "ABC-3"); getErrorKind(err) != errorKindNotFound {
+		t.Errorf("Expected a missing issue to be not found, got %v", err)
+	}
+}
+
+func TestFetchJiraIssueUsesService(t *testing.T) {
+	defer setBot(nil)
+
+	issue := jiraIssue{Key: "FAKE-1", Fields: &jiraIssueFields{Summary: "From the fake"}}
+	setBot(&jiraBot{jira: &fakeJiraService{issue: issue}})
+
+	fetched, err := fetchJiraIssue(context.Background(), "FAKE-1")
+	forgetCachedIssue("FAKE-1")
+	if err != nil || fetched.Fields.Summary != "From the fake" {
+		t.Errorf("Expected the issue from the fake service, got %+v, %v", fetched, err)
+	}
+
+	if _, err := getBot().jira.SearchIssues(context.Background(), "project = FAKE", "summary", 1); getErrorKind(err) != errorKindBadConfig {
+		t.Errorf("Expected the REST methods without JIRA_BASEURL to fail, got %v", err)
+	}
+}
+
+func TestJiraAuthentication(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if authorization == "Bearer expired" {
+			http.Error(w, `{"errorMessages": ["Token expired"]}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"displayName": "Jira Bot"}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	os.Setenv("JIRA_USERNAME", "bot@example.com")
+	os.Setenv("JIRA_PASSWORD", "secret")
+	os.Setenv("JIRA_API_TOKEN", "token")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_USERNAME")
+	defer os.Unsetenv("JIRA_PASSWORD")
+	defer os.Unsetenv("JIRA_API_TOKEN")
+	defer os.Unsetenv("JIRA_AUTH")
+	defer os.Unsetenv("JIRA_PAT")
+
+	for auth, expected := range map[string]string{
+		"":          "Basic Ym90QGV4YW1wbGUuY29tOnNlY3JldA==",
+		"api_token": "Basic Ym90QGV4YW1wbGUuY29tOnRva2Vu",
+		"pat":       "Bearer pat-1",
+	} {
+		os.Setenv("JIRA_AUTH", auth)
+		os.Setenv("JIRA_PAT", "pat-1")
+
+		if err := verifyJiraCredentials(); err != nil {
+			t.Errorf("Unexpected error with %q auth: %v", auth, err)
+		}
+		if authorization != expected {
+			t.Errorf("Expected %q with %q auth, got %q", expected, auth, authorization)
+		}
+	}
+
+	os.Setenv("JIRA_AUTH", "pat")
+	os.Setenv("JIRA_PAT", "expired")
+	if err := verifyJiraCredentials(); err == nil || !strings.Contains(err.Error(), "rejected the pat credentials") {
+		t.Errorf("Expected the rejected token to be explained, got %v", err)
+	}
+}
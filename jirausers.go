@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Jira Cloud only exposes users by account ID for privacy reasons, while Jira
+// Server and Data Center identify them by name. Everything referring to a
+// Jira user goes through these helpers so both work.
+
+// getJiraUserKey returns what identifies the user on this deployment
+func getJiraUserKey(user jiraUser) string {
+	if isJiraCloud() {
+		return user.AccountID
+	}
+
+	return user.Name
+}
+
+// newJiraUserRef references the user in request bodies, e.g. to assign an
+// issue or to set a reporter
+func newJiraUserRef(user jiraUser) map[string]string {
+	if isJiraCloud() {
+		return map[string]string{"accountId": user.AccountID}
+	}
+
+	return map[string]string{"name": user.Name}
+}
+
+// formatJiraMention mentions the user in wiki markup, as used by the v2 API
+func formatJiraMention(user jiraUser) string {
+	if isJiraCloud() {
+		return fmt.Sprintf("[~accountid:%s]", user.AccountID)
+	}
+
+	return fmt.Sprintf("[~%s]", user.Name)
+}
+
+// newADFMention mentions the user in an ADF document, as used by the v3 API
+func newADFMention(user jiraUser) adfNode {
+	return adfNode{
+		Type:  "mention",
+		Attrs: map[string]interface{}{"id": user.AccountID, "text": "@" + user.DisplayName},
+	}
+}
+
+// getJiraUserSearchPath returns the endpoint listing every user, ready for
+// paging parameters to be appended
+func getJiraUserSearchPath() string {
+	if isJiraCloud() {
+		return "/rest/api/2/users/search?"
+	}
+
+	// Server and Data Center need a query, "." matches everyone
+	return "/rest/api/2/user/search?username=.&"
+}
+
+// findJiraUserForSlack maps a Slack user to their Jira account by email, or
+// by name where Jira Cloud hides emails
+func findJiraUserForSlack(users []jiraUser, slackUser slack.User) *jiraUser {
+	if email := slackUser.Profile.Email; email != "" {
+		for i := range users {
+			if strings.EqualFold(users[i].EmailAddress, email) {
+				return &users[i]
+			}
+		}
+	}
+
+	for i := range users {
+		if users[i].DisplayName != "" && strings.EqualFold(users[i].DisplayName, slackUser.RealName) {
+			return &users[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestJiraUserReferences(t *testing.T) {
+	user := jiraUser{AccountID: "5b10ac8d82e05b22cc7d4ef5", Name: "ada", DisplayName: "Ada Lovelace"}
+
+	os.Setenv("JIRA_DEPLOYMENT", "cloud")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+
+	if formatJiraMention(user) != "[~accountid:5b10ac8d82e05b22cc7d4ef5]" {
+		t.Errorf("Unexpected Cloud mention %q", formatJiraMention(user))
+	}
+	if ref := newJiraUserRef(user); !reflect.DeepEqual(ref, map[string]string{"accountId": "5b10ac8d82e05b22cc7d4ef5"}) {
+		t.Errorf("Unexpected Cloud reference %v", ref)
+	}
+
+	os.Setenv("JIRA_DEPLOYMENT", "server")
+
+	if formatJiraMention(user) != "[~ada]" || getJiraUserKey(user) != "ada" {
+		t.Errorf("Expected Server to use names, got %q", formatJiraMention(user))
+	}
+	if ref := newJiraUserRef(user); !reflect.DeepEqual(ref, map[string]string{"name": "ada"}) {
+		t.Errorf("Unexpected Server reference %v", ref)
+	}
+}
+
+func TestFindJiraUserForSlack(t *testing.T) {
+	users := []jiraUser{
+		{AccountID: "a1", DisplayName: "Ada Lovelace"},
+		{AccountID: "a2", DisplayName: "Grace Hopper", EmailAddress: "grace@example.com"},
+	}
+
+	grace := slack.User{RealName: "G. Hopper", Profile: slack.UserProfile{Email: "Grace@example.com"}}
+	if user := findJiraUserForSlack(users, grace); user == nil || user.AccountID != "a2" {
+		t.Errorf("Expected to match by email, got %v", user)
+	}
+
+	ada := slack.User{RealName: "Ada Lovelace", Profile: slack.UserProfile{Email: "ada@example.com"}}
+	if user := findJiraUserForSlack(users, ada); user == nil || user.AccountID != "a1" {
+		t.Errorf("Expected to match by name when Jira hides the email, got %v", user)
+	}
+}
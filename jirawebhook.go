@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of Jira webhook events rules can pick
+const (
+	webhookCreated      = "created"
+	webhookUpdated      = "updated"
+	webhookTransitioned = "transitioned"
+	webhookCommented    = "commented"
+)
+
+var webhookEventKinds = []string{webhookCreated, webhookUpdated, webhookTransitioned, webhookCommented}
+
+// A channel notified of changes to the issues of some projects or matching a
+// query. Without events it gets all kinds.
+type WebhookRule struct {
+	Channel  string
+	Projects []string
+	JQL      string
+	Events   []string
+}
+
+// The parts of a Jira webhook request the bot uses
+type jiraWebhookEvent struct {
+	WebhookEvent       string `json:"webhookEvent"`
+	IssueEventTypeName string `json:"issue_event_type_name"`
+	User               struct {
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	Issue struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Summary string `json:"summary"`
+			Status  struct {
+				Name string `json:"name"`
+			} `json:"status"`
+			Project struct {
+				Key string `json:"key"`
+			} `json:"project"`
+		} `json:"fields"`
+	} `json:"issue"`
+	Changelog struct {
+		Items []struct {
+			Field      string `json:"field"`
+			FromString string `json:"fromString"`
+			ToString   string `json:"toString"`
+		} `json:"items"`
+	} `json:"changelog"`
+	Comment *struct {
+		Body   jiraText `json:"body"`
+		Author struct {
+			DisplayName string `json:"displayName"`
+		} `json:"author"`
+	} `json:"comment"`
+}
+
+// Comments are cut to this length in notifications
+const maxWebhookCommentLength = 300
+
+func serveJiraWebhooks(addr string) {
+	log.Printf("serveJiraWebhooks: Listening on %s", addr)
+
+	if err := http.ListenAndServe(addr, newJiraWebhookHandler()); err != nil {
+		log.Printf("serveJiraWebhooks: Error: %v", err)
+	}
+}
+
+func newJiraWebhookHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jira/webhooks", requireJiraWebhookSecret(handleJiraWebhook))
+
+	return mux
+}
+
+// requireJiraWebhookSecret only lets requests through that Jira signed with
+// the secret, or that carry it as token parameter for Jira versions that
+// don't sign webhooks
+func requireJiraWebhookSecret(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "could not read body", http.StatusBadRequest)
+			return
+		}
+
+		secret := getConfig().JiraWebhookSecret
+		token := r.URL.Query().Get("token")
+		if !verifyJiraSignature(secret, r.Header.Get("X-Hub-Signature"), body) &&
+			(token == "" || !hmac.Equal([]byte(token), []byte(secret))) {
+			log.Print("requireJiraWebhookSecret: Rejecting request without a valid secret")
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+// verifyJiraSignature checks the "sha256=<hex>" HMAC Jira Cloud sends along
+// with webhooks that have a secret
+func verifyJiraSignature(secret string, signature string, body []byte) bool {
+	if secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// handleJiraWebhook acknowledges a webhook right away and notifies the
+// channels of matching rules afterwards, as JQL rules need a search each
+func handleJiraWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var event jiraWebhookEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		log.Printf("handleJiraWebhook: Error decoding event: %v", err)
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	// Jira delivers the event again after the window, when the bot can look
+	// things up again
+	if window := activeMaintenance(getConfig().MaintenanceWindows, time.Now()); window != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(window.End).Seconds())+1))
+		http.Error(w, "under maintenance", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	kind := getWebhookEventKind(event)
+	if kind == "" || event.Issue.Key == "" {
+		return
+	}
+
+	go notifyWebhookEvent(event, kind)
+
+	// Channels following the issue hear about it right away, not with the
+	// next poll
+	if isWatched(event.Issue.Key) {
+		go checkWatchedIssue(event.Issue.Key)
+	}
+}
+
+// getWebhookEventKind tells what happened to the issue, or "" for events the
+// bot doesn't notify about
+func getWebhookEventKind(event jiraWebhookEvent) string {
+	switch event.WebhookEvent {
+	case "jira:issue_created":
+		return webhookCreated
+	case "comment_created":
+		return webhookCommented
+	case "jira:issue_updated":
+		for _, item := range event.Changelog.Items {
+			if item.Field == "status" {
+				return webhookTransitioned
+			}
+		}
+		if event.IssueEventTypeName == "issue_commented" && event.Comment != nil {
+			return webhookCommented
+		}
+		if len(event.Changelog.Items) > 0 {
+			return webhookUpdated
+		}
+	}
+
+	return ""
+}
+
+func notifyWebhookEvent(event jiraWebhookEvent, kind string) {
+	channels := getWebhookChannels(getConfig().JiraWebhookRules, event, kind)
+	if len(channels) == 0 {
+		return
+	}
+
+	text := formatWebhookEvent(event, kind)
+	for _, target := range channels {
+		channel, err := resolveNotificationTarget(target)
+		if err != nil {
+			log.Printf("notifyWebhookEvent: Error: %v", err)
+			continue
+		}
+
+		if err := postText(channel, "", text); err != nil {
+			log.Printf("notifyWebhookEvent: Error notifying %s of %s: %v", target, event.Issue.Key, err)
+		}
+	}
+
+	recordEvent("webhook", map[string]interface{}{
+		"issue":    event.Issue.Key,
+		"kind":     kind,
+		"channels": channels,
+	})
+}
+
+// getWebhookChannels returns the channels of the rules matching an event,
+// each once
+func getWebhookChannels(rules []WebhookRule, event jiraWebhookEvent, kind string) []string {
+	seen := map[string]bool{}
+	channels := []string{}
+
+	for _, rule := range rules {
+		if seen[rule.Channel] || !rule.matches(event, kind) {
+			continue
+		}
+
+		seen[rule.Channel] = true
+		channels = append(channels, rule.Channel)
+	}
+
+	return channels
+}
+
+// matches reports whether the rule wants the event. Rules with a query ask
+// Jira whether the issue matches it.
+func (rule WebhookRule) matches(event jiraWebhookEvent, kind string) bool {
+	if len(rule.Events) > 0 && !containsFold(rule.Events, kind) {
+		return false
+	}
+
+	project := event.Issue.Fields.Project.Key
+	if project == "" {
+		project = getProjectKey(event.Issue.Key)
+	}
+	if len(rule.Projects) > 0 && !containsFold(rule.Projects, project) {
+		return false
+	}
+
+	if rule.JQL == "" {
+		return true
+	}
+
+	result, err := searchJiraIssues(getBot().jira, fmt.Sprintf("key = %s AND (%s)", event.Issue.Key, rule.JQL))
+	if err != nil {
+		log.Printf("matches: Error checking %s against %q: %v", event.Issue.Key, rule.JQL, err)
+		return false
+	}
+
+	return result.Total > 0
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatWebhookEvent(event jiraWebhookEvent, kind string) string {
+	issue := fmt.Sprintf("*<%s|%s>* %s", getJiraURL(event.Issue.Key), event.Issue.Key, event.Issue.Fields.Summary)
+
+	actor := event.User.DisplayName
+	if event.Comment != nil && event.Comment.Author.DisplayName != "" {
+		actor = event.Comment.Author.DisplayName
+	}
+	if actor == "" {
+		actor = "Someone"
+	}
+
+	switch kind {
+	case webhookCreated:
+		return fmt.Sprintf(":sparkles: %s created %s", actor, issue)
+	case webhookTransitioned:
+		for _, item := range event.Changelog.Items {
+			if item.Field == "status" {
+				return fmt.Sprintf(":arrow_right: %s moved %s from %s to *%s*", actor, issue, item.FromString, item.ToString)
+			}
+		}
+	case webhookCommented:
+		text := fmt.Sprintf(":speech_balloon: %s commented on %s", actor, issue)
+		if event.Comment != nil && event.Comment.Body != "" {
+			text += "\n> " + strings.Replace(truncateText(string(event.Comment.Body), maxWebhookCommentLength), "\n", "\n> ", -1)
+		}
+		return text
+	}
+
+	fields := []string{}
+	for _, item := range event.Changelog.Items {
+		fields = append(fields, item.Field)
+	}
+
+	return fmt.Sprintf(":pencil2: %s changed %s of %s", actor, strings.Join(fields, ", "), issue)
+}
+
+// parseWebhookRules reads rules in the form "C024BE91L=ABC,DEF;C0G9QF9GZ=OPS",
+// notifying a channel of every change to the projects' issues. Rules without
+// projects are left out and returned as errors.
+func parseWebhookRules(value string) ([]WebhookRule, []error) {
+	rules := []WebhookRule{}
+	errs := []error{}
+
+	for _, entry := range strings.Split(value, ";") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if parts[0] == "" {
+			continue
+		}
+		if len(parts) != 2 {
+			errs = append(errs, fmt.Errorf("rule %q must name projects like %s=ABC,DEF", entry, parts[0]))
+			continue
+		}
+
+		rules = append(rules, WebhookRule{Channel: parts[0], Projects: parseList(parts[1])})
+	}
+
+	return rules, errs
+}
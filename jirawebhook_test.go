@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeWebhookEvent(t *testing.T, body string) jiraWebhookEvent {
+	var event jiraWebhookEvent
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		t.Fatalf("Error decoding event: %v", err)
+	}
+
+	return event
+}
+
+func TestGetWebhookEventKind(t *testing.T) {
+	for body, kind := range map[string]string{
+		`{"webhookEvent": "jira:issue_created"}`: webhookCreated,
+		`{"webhookEvent": "comment_created"}`:    webhookCommented,
+		`{"webhookEvent": "jira:issue_updated", "changelog": {"items": [{"field": "status", "fromString": "Open", "toString": "Done"}]}}`:  webhookTransitioned,
+		`{"webhookEvent": "jira:issue_updated", "issue_event_type_name": "issue_commented", "comment": {"body": "LGTM"}}`:                  webhookCommented,
+		`{"webhookEvent": "jira:issue_updated", "changelog": {"items": [{"field": "priority", "fromString": "Low", "toString": "High"}]}}`: webhookUpdated,
+		`{"webhookEvent": "jira:issue_updated"}`:   "",
+		`{"webhookEvent": "jira:worklog_updated"}`: "",
+	} {
+		if got := getWebhookEventKind(decodeWebhookEvent(t, body)); got != kind {
+			t.Errorf("Expected %q for %s, got %q", kind, body, got)
+		}
+	}
+}
+
+func TestFormatWebhookEvent(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	event := decodeWebhookEvent(t, `{
+		"webhookEvent": "jira:issue_updated",
+		"user": {"displayName": "Jane Doe"},
+		"issue": {"key": "ABC-1", "fields": {"summary": "Printer on fire"}},
+		"changelog": {"items": [{"field": "status", "fromString": "Open", "toString": "In Progress"}]}
+	}`)
+
+	expected := ":arrow_right: Jane Doe moved *<https://jira.example.com/browse/ABC-1|ABC-1>* Printer on fire from Open to *In Progress*"
+	if text := formatWebhookEvent(event, webhookTransitioned); text != expected {
+		t.Errorf("Unexpected notification %q", text)
+	}
+
+	event = decodeWebhookEvent(t, `{
+		"webhookEvent": "comment_created",
+		"issue": {"key": "ABC-1", "fields": {"summary": "Printer on fire"}},
+		"comment": {"body": "Extinguished.\nBuying a new one.", "author": {"displayName": "John Roe"}}
+	}`)
+
+	if text := formatWebhookEvent(event, webhookCommented); !strings.HasSuffix(text, "John Roe commented on *<https://jira.example.com/browse/ABC-1|ABC-1>* Printer on fire\n> Extinguished.\n> Buying a new one.") {
+		t.Errorf("Unexpected notification %q", text)
+	}
+}
+
+func TestGetWebhookChannels(t *testing.T) {
+	event := decodeWebhookEvent(t, `{"issue": {"key": "ABC-1", "fields": {"project": {"key": "ABC"}}}}`)
+
+	rules := []WebhookRule{
+		{Channel: "C1", Projects: []string{"abc"}},
+		{Channel: "C2", Projects: []string{"OPS"}},
+		{Channel: "C3", Events: []string{webhookCreated}},
+		{Channel: "C1"},
+		{Channel: "C4", Events: []string{webhookTransitioned}},
+	}
+
+	if channels := getWebhookChannels(rules, event, webhookTransitioned); !reflect.DeepEqual(channels, []string{"C1", "C4"}) {
+		t.Errorf("Unexpected channels %v", channels)
+	}
+}
+
+func TestParseWebhookRules(t *testing.T) {
+	rules, errs := parseWebhookRules("C1=ABC,DEF; C2=OPS;C3")
+
+	expected := []WebhookRule{
+		{Channel: "C1", Projects: []string{"ABC", "DEF"}},
+		{Channel: "C2", Projects: []string{"OPS"}},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Unexpected rules %v", rules)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "C3") {
+		t.Errorf("Expected an error for the rule without projects, got %v", errs)
+	}
+}
+
+func TestJiraWebhooksRequireSecret(t *testing.T) {
+	os.Setenv("JIRA_WEBHOOK_SECRET", "secret")
+	defer os.Unsetenv("JIRA_WEBHOOK_SECRET")
+
+	body := `{"webhookEvent": "jira:worklog_updated"}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(body))
+
+	for target, signature := range map[string]string{
+		"/jira/webhooks":              "sha256=" + hex.EncodeToString(mac.Sum(nil)),
+		"/jira/webhooks?token=secret": "",
+	} {
+		request := httptest.NewRequest("POST", target, strings.NewReader(body))
+		request.Header.Set("X-Hub-Signature", signature)
+		response := httptest.NewRecorder()
+
+		newJiraWebhookHandler().ServeHTTP(response, request)
+
+		if response.Code != http.StatusNoContent {
+			t.Errorf("Expected %s to be accepted, got %d", target, response.Code)
+		}
+	}
+
+	for target, signature := range map[string]string{
+		"/jira/webhooks":             "sha256=0000",
+		"/jira/webhooks?token=wrong": "",
+	} {
+		request := httptest.NewRequest("POST", target, strings.NewReader(body))
+		request.Header.Set("X-Hub-Signature", signature)
+		response := httptest.NewRecorder()
+
+		newJiraWebhookHandler().ServeHTTP(response, request)
+
+		if response.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s to be rejected, got %d", target, response.Code)
+		}
+	}
+}
+
+func TestJiraWebhooksPauseDuringMaintenance(t *testing.T) {
+	now := time.Now().UTC()
+	os.Setenv("JIRA_WEBHOOK_SECRET", "secret")
+	os.Setenv("JIRA_MAINTENANCE", now.Add(-time.Hour).Format(time.RFC3339)+".."+now.Add(time.Hour).Format(time.RFC3339))
+	defer os.Unsetenv("JIRA_WEBHOOK_SECRET")
+	defer os.Unsetenv("JIRA_MAINTENANCE")
+
+	request := httptest.NewRequest("POST", "/jira/webhooks?token=secret", strings.NewReader(`{"webhookEvent": "jira:issue_created", "issue": {"key": "ABC-1"}}`))
+	response := httptest.NewRecorder()
+
+	newJiraWebhookHandler().ServeHTTP(response, request)
+
+	if response.Code != http.StatusServiceUnavailable || response.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected Jira to be asked to retry after the window, got %d", response.Code)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bounds for searches run on behalf of users
+const (
+	maxJQLLength     = 1000
+	maxSearchResults = 20
+	searchTimeout    = 10 * time.Second
+)
+
+// Clauses that narrow a search down far enough to be cheap for Jira
+var boundedJQLClause = regexp.MustCompile(`(?i)\b(project|key|issue|issuekey|parent|sprint|fixversion|filter|epic link|assignee|reporter|labels)\s*(=|in\b|~)|\b(created|updated|resolved)\s*>`)
+
+// Clauses that match (nearly) every issue
+var unboundedJQLClause = regexp.MustCompile(`(?i)\b(project|key|issue|issuekey)\s*(is\s+not\s+empty|!=\s*empty|is\s+not\s+null|!=\s*null)`)
+
+var jqlOrderBy = regexp.MustCompile(`(?i)\border\s+by\b`)
+
+// Parts of the messages Jira explains a broken query with
+var (
+	jqlUnknownField = regexp.MustCompile(`(?i)field '([^']+)' does not exist`)
+	jqlErrorAt      = regexp.MustCompile(`\(line (\d+), character (\d+)\)`)
+)
+
+// validateJQL rejects user supplied JQL that would make Jira scan most of
+// its issues, like "project is not empty order by created". The returned
+// error is meant to be shown to the user.
+func validateJQL(jql string) error {
+	jql = strings.TrimSpace(jql)
+
+	if len(jql) > maxJQLLength {
+		return errors.New("that query is too long, please keep it under 1000 characters")
+	}
+
+	condition := jql
+	if loc := jqlOrderBy.FindStringIndex(jql); loc != nil {
+		condition = strings.TrimSpace(jql[:loc[0]])
+	}
+	if condition == "" {
+		return errors.New("please narrow the query down, e.g. with `project = ABC`")
+	}
+
+	if unboundedJQLClause.MatchString(condition) {
+		return errors.New("queries like `project is not empty` match every issue, please name a project instead")
+	}
+
+	// Every alternative of a top-level OR has to be narrowed down on its own
+	for _, branch := range splitTopLevelOr(condition) {
+		if !boundedJQLClause.MatchString(branch) {
+			return errors.New("please narrow every part of the query down, e.g. with `project = ABC`, `assignee = currentUser()` or `updated > -7d`")
+		}
+	}
+
+	return nil
+}
+
+// splitTopLevelOr splits JQL at OR operators outside of parentheses and
+// quotes.
+func splitTopLevelOr(jql string) []string {
+	branches := []string{}
+	depth := 0
+	var quote rune
+	start := 0
+
+	runes := []rune(jql)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case quote != 0:
+			if r == '\\' {
+				i++
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case depth == 0 && isJQLOrAt(runes, i):
+			branches = append(branches, string(runes[start:i]))
+			start = i + 2
+			i++
+		}
+	}
+
+	return append(branches, string(runes[start:]))
+}
+
+// isJQLOrAt reports whether an OR keyword starts at position i
+func isJQLOrAt(runes []rune, i int) bool {
+	if i+2 > len(runes) || !strings.EqualFold(string(runes[i:i+2]), "or") {
+		return false
+	}
+
+	before := i == 0 || isJQLSeparator(runes[i-1])
+	after := i+2 == len(runes) || isJQLSeparator(runes[i+2])
+
+	return before && after
+}
+
+func isJQLSeparator(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '(' || r == ')'
+}
+
+// describeJQLError explains to the user why their query failed
+func describeJQLError(jql string, err error) string {
+	metadata, metadataErr := getJiraMetadata()
+	if metadataErr != nil {
+		log.Printf("describeJQLError: Error fetching fields: %v", metadataErr)
+	}
+
+	return formatJQLError(jql, err, metadata.Fields)
+}
+
+// formatJQLError quotes the problems Jira found in a query, showing where they
+// are and suggesting field names for the ones Jira doesn't know.
+func formatJQLError(jql string, err error, fields []jiraField) string {
+	var requestError *jiraRequestError
+	if !errors.As(err, &requestError) || requestError.StatusCode != http.StatusBadRequest || len(requestError.Messages) == 0 {
+		return describeError(getErrorKind(err), "that search")
+	}
+
+	lines := []string{":warning: Jira couldn't run that query:"}
+
+	for _, message := range requestError.Messages {
+		lines = append(lines, "> "+message)
+
+		if match := jqlErrorAt.FindStringSubmatch(message); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			character, _ := strconv.Atoi(match[2])
+
+			if excerpt := getJQLExcerpt(jql, line, character); excerpt != "" {
+				lines = append(lines, fmt.Sprintf("The problem is around `%s`", excerpt))
+			}
+		}
+
+		if match := jqlUnknownField.FindStringSubmatch(message); match != nil {
+			if suggestions := suggestJQLFields(match[1], fields); len(suggestions) > 0 {
+				lines = append(lines, "Did you mean "+strings.Join(suggestions, ", ")+"?")
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// getJQLExcerpt returns the query from the 1-based position Jira reported on
+func getJQLExcerpt(jql string, line int, character int) string {
+	queryLines := strings.Split(jql, "\n")
+	if line < 1 || line > len(queryLines) {
+		return ""
+	}
+
+	runes := []rune(queryLines[line-1])
+	if character < 1 || character > len(runes) {
+		return ""
+	}
+
+	excerpt := strings.Replace(string(runes[character-1:]), "`", "'", -1)
+
+	return truncateText(strings.TrimSpace(excerpt), 30)
+}
+
+// suggestJQLFields lists up to three field names close to the unknown one,
+// quoted the way they have to be written in JQL
+func suggestJQLFields(name string, fields []jiraField) []string {
+	name = strings.ToLower(name)
+	maxDistance := len(name)/3 + 1
+
+	// Field names and clause names often only differ in case
+	distances := map[string]int{}
+	spellings := map[string]string{}
+	for _, field := range fields {
+		for _, clause := range append(field.ClauseNames, field.Name) {
+			key := strings.ToLower(clause)
+			if _, ok := spellings[key]; ok {
+				continue
+			}
+			if distance := getEditDistance(name, key); distance <= maxDistance {
+				distances[key] = distance
+				spellings[key] = clause
+			}
+		}
+	}
+
+	candidates := []string{}
+	for key := range distances {
+		candidates = append(candidates, key)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if distances[candidates[i]] != distances[candidates[j]] {
+			return distances[candidates[i]] < distances[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+
+	suggestions := []string{}
+	for _, key := range candidates {
+		if len(suggestions) == 3 {
+			break
+		}
+		clause := spellings[key]
+		if strings.ContainsAny(clause, " -") {
+			clause = `"` + clause + `"`
+		}
+		suggestions = append(suggestions, "`"+clause+"`")
+	}
+
+	return suggestions
+}
+
+// getEditDistance is the Levenshtein distance between two strings
+func getEditDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	previous := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current := make([]int, len(rb)+1)
+		current[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current[j] = current[j-1] + 1
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if previous[j-1]+cost < current[j] {
+				current[j] = previous[j-1] + cost
+			}
+		}
+
+		previous = current
+	}
+
+	return previous[len(rb)]
+}
+
+// The issues a search found, up to maxSearchResults of them
+type jiraSearchResult struct {
+	Total  int               `json:"total"`
+	Issues []jiraLinkedIssue `json:"issues"`
+}
+
+// searchJiraIssues runs a query that passed validateJQL, giving up after the
+// search timeout
+func searchJiraIssues(jira JiraService, jql string) (jiraSearchResult, error) {
+	return searchJiraIssueFields(jira, jql, "summary,status", maxSearchResults)
+}
+
+// searchJiraIssueFields runs a query for the comma separated fields of up to
+// maxResults issues, giving up after the search timeout
+func searchJiraIssueFields(jira JiraService, jql string, fields string, maxResults int) (jiraSearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+	defer cancel()
+
+	return jira.SearchIssues(ctx, jql, fields, maxResults)
+}
+
+// getJiraSearchURL links to a query's results in Jira
+func getJiraSearchURL(jql string) string {
+	return getConfig().JiraBaseURL + "/issues/?jql=" + url.QueryEscape(jql)
+}
+
+// formatSearchResult lists the issues found, linking to the rest in Jira
+func formatSearchResult(jql string, result jiraSearchResult) []string {
+	lines := []string{}
+
+	for _, issue := range result.Issues {
+		lines = append(lines, fmt.Sprintf("• <%s|%s> %s (%s)",
+			getJiraURL(issue.Key), issue.Key, issue.Fields.Summary, issue.Fields.Status.Name))
+	}
+	if result.Total > len(result.Issues) {
+		lines = append(lines, fmt.Sprintf("<%s|…and %d more in Jira>",
+			getJiraSearchURL(jql), result.Total-len(result.Issues)))
+	}
+
+	return lines
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateJQLAcceptsBoundedQueries(t *testing.T) {
+	for _, jql := range []string{
+		"project = ABC",
+		"project in (ABC, DEF) AND status = Open ORDER BY created DESC",
+		"assignee = currentUser() AND resolution = Unresolved",
+		"updated > -7d",
+		"(project = ABC AND labels = x) OR key = DEF-1",
+		`summary ~ "or" AND project = ABC`,
+	} {
+		if err := validateJQL(jql); err != nil {
+			t.Errorf("Expected %q to be accepted, got %v", jql, err)
+		}
+	}
+}
+
+func TestValidateJQLRejectsUnboundedQueries(t *testing.T) {
+	for _, jql := range []string{
+		"",
+		"ORDER BY created",
+		"project is not empty order by created",
+		"status = Open",
+		"project = ABC OR status = Open",
+		"text ~ error",
+		strings.Repeat("project = ABC AND ", 100),
+	} {
+		if err := validateJQL(jql); err == nil {
+			t.Errorf("Expected %q to be rejected", jql)
+		}
+	}
+}
+
+func TestSplitTopLevelOr(t *testing.T) {
+	result := splitTopLevelOr(`a = 1 OR (b = 2 or c = 3) or d ~ "x or y"`)
+
+	expected := []string{"a = 1 ", " (b = 2 or c = 3) ", ` d ~ "x or y"`}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Unexpected branches %#v", result)
+	}
+}
+
+func TestFormatJQLError(t *testing.T) {
+	fields := []jiraField{
+		{ID: "assignee", Name: "Assignee", ClauseNames: []string{"assignee"}},
+		{ID: "customfield_10014", Name: "Epic Link", ClauseNames: []string{"cf[10014]", "Epic Link"}},
+		{ID: "status", Name: "Status", ClauseNames: []string{"status"}},
+	}
+	err := &botError{Kind: errorKindUnknown, Err: &jiraRequestError{
+		StatusCode: 400,
+		Messages: []string{
+			"Field 'asignee' does not exist or you do not have permission to view it.",
+			"Error in the JQL Query: Expecting operator but got 'Open'. (line 1, character 25)",
+		},
+	}}
+
+	message := formatJQLError("project = ABC AND status Open", err, fields)
+
+	for _, expected := range []string{
+		"> Field 'asignee' does not exist",
+		"Did you mean `assignee`?",
+		"The problem is around `Open`",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("Expected %q in %q", expected, message)
+		}
+	}
+}
+
+func TestFormatJQLErrorFallsBackToErrorKind(t *testing.T) {
+	err := newBotError(errorKindRateLimited, "GET /rest/api/2/search: unexpected status 429")
+
+	if message := formatJQLError("project = ABC", err, nil); message != describeError(errorKindRateLimited, "that search") {
+		t.Errorf("Unexpected message %q", message)
+	}
+}
+
+func TestSuggestJQLFieldsQuotesNamesWithSpaces(t *testing.T) {
+	fields := []jiraField{{Name: "Epic Link", ClauseNames: []string{"Epic Link"}}}
+
+	if suggestions := suggestJQLFields("epiclink", fields); !reflect.DeepEqual(suggestions, []string{"`\"Epic Link\"`"}) {
+		t.Errorf("Unexpected suggestions %v", suggestions)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long posted content is remembered for loop detection
+const loopGuardTTL = 10 * time.Minute
+
+// Hashes of lines the bot posted recently, with the time they were posted
+var postedLines = struct {
+	sync.Mutex
+	seen map[uint64]time.Time
+}{seen: map[uint64]time.Time{}}
+
+// rememberPostedContent records a message the bot posted so echoes of it
+// (by Slack, or by other bots quoting it) don't trigger another expansion.
+func rememberPostedContent(text string, now time.Time) {
+	postedLines.Lock()
+	defer postedLines.Unlock()
+
+	for hash, postedAt := range postedLines.seen {
+		if now.Sub(postedAt) > loopGuardTTL {
+			delete(postedLines.seen, hash)
+		}
+	}
+
+	for _, line := range normalizedLines(text) {
+		postedLines.seen[hashLine(line)] = now
+	}
+}
+
+// isEchoOfPostedContent reports whether every line of the text is something
+// the bot posted recently.
+func isEchoOfPostedContent(text string, now time.Time) bool {
+	lines := normalizedLines(text)
+	if len(lines) == 0 {
+		return false
+	}
+
+	postedLines.Lock()
+	defer postedLines.Unlock()
+
+	for _, line := range lines {
+		postedAt, ok := postedLines.seen[hashLine(line)]
+		if !ok || now.Sub(postedAt) > loopGuardTTL {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalizedLines strips quote markers and whitespace, which quoting bots and
+// Slack itself tend to add or remove.
+func normalizedLines(text string) []string {
+	lines := []string{}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		for strings.HasPrefix(line, ">") || strings.HasPrefix(line, "&gt;") {
+			line = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(line, ">"), "&gt;"))
+		}
+
+		if line != "" {
+			lines = append(lines, strings.ToLower(line))
+		}
+	}
+
+	return lines
+}
+
+func hashLine(line string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(line))
+
+	return h.Sum64()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectsEchoOfPostedContent(t *testing.T) {
+	now := time.Now()
+	rememberPostedContent("> <https://jira/browse/ABC-1|ABC-1> *Status:* Open\n> *Creator:* Jane", now)
+
+	if !isEchoOfPostedContent("&gt; <https://jira/browse/ABC-1|ABC-1> *Status:* Open\n&gt; *Creator:* Jane", now) {
+		t.Errorf("Expected escaped quote of posted content to be an echo")
+	}
+
+	if !isEchoOfPostedContent("<https://jira/browse/ABC-1|ABC-1> *Status:* Open", now) {
+		t.Errorf("Expected partial quote of posted content to be an echo")
+	}
+
+	if isEchoOfPostedContent("Can someone look at ABC-1?\n> *Creator:* Jane", now) {
+		t.Errorf("Expected message with new content not to be an echo")
+	}
+}
+
+func TestForgetsPostedContentAfterTTL(t *testing.T) {
+	now := time.Now()
+	rememberPostedContent("> DEF-2 is done", now)
+
+	if isEchoOfPostedContent("> DEF-2 is done", now.Add(loopGuardTTL+time.Second)) {
+		t.Errorf("Expected posted content to be forgotten")
+	}
+}
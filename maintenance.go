@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Jira maintenance window
+type MaintenanceWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Channels already told about a maintenance window, keyed by window start
+var maintenanceNotices = struct {
+	sync.Mutex
+	sent map[time.Time]map[string]bool
+}{sent: map[time.Time]map[string]bool{}}
+
+// parseMaintenanceWindows reads windows in the form
+// "2026-10-20T22:00:00Z..2026-10-21T02:00:00Z;...". Malformed entries are left
+// out and returned as errors.
+func parseMaintenanceWindows(value string) ([]MaintenanceWindow, []error) {
+	windows := []MaintenanceWindow{}
+	errs := []error{}
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(entry, "..", 2)
+		if len(bounds) != 2 {
+			errs = append(errs, fmt.Errorf("window %q must look like 2026-10-20T22:00:00Z..2026-10-21T02:00:00Z", entry))
+			continue
+		}
+
+		start, err := time.Parse(time.RFC3339, strings.TrimSpace(bounds[0]))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("window %q has an invalid start: %v", entry, err))
+			continue
+		}
+		end, err := time.Parse(time.RFC3339, strings.TrimSpace(bounds[1]))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("window %q has an invalid end: %v", entry, err))
+			continue
+		}
+
+		windows = append(windows, MaintenanceWindow{Start: start, End: end})
+	}
+
+	return windows, errs
+}
+
+// activeMaintenance returns the window Jira is in right now, if any
+func activeMaintenance(windows []MaintenanceWindow, now time.Time) *MaintenanceWindow {
+	for i := range windows {
+		if !now.Before(windows[i].Start) && now.Before(windows[i].End) {
+			return &windows[i]
+		}
+	}
+
+	return nil
+}
+
+// shouldSendMaintenanceNotice reports whether the channel still has to be told
+// about the window, remembering that it has been from now on.
+func shouldSendMaintenanceNotice(window MaintenanceWindow, channel string) bool {
+	maintenanceNotices.Lock()
+	defer maintenanceNotices.Unlock()
+
+	// Forget windows that are over
+	for start := range maintenanceNotices.sent {
+		if start.Before(window.Start) {
+			delete(maintenanceNotices.sent, start)
+		}
+	}
+
+	channels, ok := maintenanceNotices.sent[window.Start]
+	if !ok {
+		channels = map[string]bool{}
+		maintenanceNotices.sent[window.Start] = channels
+	}
+
+	if channels[channel] {
+		return false
+	}
+	channels[channel] = true
+
+	return true
+}
+
+func respondWithMaintenanceNotice(channel string, window MaintenanceWindow) {
+	if !shouldSendMaintenanceNotice(window, channel) {
+		return
+	}
+
+	if err := postText(channel, "", formatMaintenanceNotice(window)); err != nil {
+		log.Printf("respondWithMaintenanceNotice: Error: %v", err)
+	}
+}
+
+func formatMaintenanceNotice(window MaintenanceWindow) string {
+	return fmt.Sprintf(
+		"> :construction: Jira is under maintenance until <!date^%d^{date} at {time}|%s>",
+		window.End.Unix(),
+		window.End.Format(time.RFC1123),
+	)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceWindows(t *testing.T) {
+	result, errs := parseMaintenanceWindows("2026-10-20T22:00:00Z..2026-10-21T02:00:00Z; bogus;2026-10-22..2026-10-23")
+
+	if len(result) != 1 {
+		t.Fatalf("Expected one window, got %v", len(result))
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected an error for each malformed window, got %v", errs)
+	}
+
+	if !result[0].End.Equal(time.Date(2026, 10, 21, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected window end %v", result[0].End)
+	}
+}
+
+func TestActiveMaintenance(t *testing.T) {
+	windows, _ := parseMaintenanceWindows("2026-10-20T22:00:00Z..2026-10-21T02:00:00Z")
+
+	if activeMaintenance(windows, time.Date(2026, 10, 21, 1, 0, 0, 0, time.UTC)) == nil {
+		t.Errorf("Expected maintenance to be active")
+	}
+
+	if activeMaintenance(windows, time.Date(2026, 10, 21, 2, 0, 0, 0, time.UTC)) != nil {
+		t.Errorf("Expected maintenance to be over")
+	}
+}
+
+func TestMaintenanceNoticeSentOncePerChannel(t *testing.T) {
+	windows, _ := parseMaintenanceWindows("2026-10-20T22:00:00Z..2026-10-21T02:00:00Z")
+	window := windows[0]
+
+	if !shouldSendMaintenanceNotice(window, "C1") {
+		t.Errorf("Expected first notice to be sent")
+	}
+
+	if shouldSendMaintenanceNotice(window, "C1") {
+		t.Errorf("Expected second notice to be suppressed")
+	}
+
+	if !shouldSendMaintenanceNotice(window, "C2") {
+		t.Errorf("Expected notice for another channel to be sent")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long synced instance data is used before it is fetched again on demand
+const jiraMetadataTTL = time.Hour
+
+// Users fetched per request, and at most in total
+const (
+	jiraUsersPageSize = 1000
+	maxJiraUsers      = 20000
+)
+
+// A field of the Jira instance, as listed by /rest/api/2/field
+type jiraField struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	ClauseNames []string `json:"clauseNames"`
+}
+
+// A status or priority of the Jira instance
+type jiraNamedValue struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// An issue type of the Jira instance
+type jiraIssueType struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Subtask bool   `json:"subtask"`
+}
+
+type jiraUser struct {
+	AccountID    string `json:"accountId"`
+	Name         string `json:"name"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+	Active       bool   `json:"active"`
+}
+
+// Data of the Jira instance that commands, select menus and JQL suggestions
+// are checked against
+type jiraInstanceData struct {
+	Fields     []jiraField
+	Statuses   []jiraNamedValue
+	Priorities []jiraNamedValue
+	IssueTypes []jiraIssueType
+	Users      []jiraUser
+}
+
+var jiraMetadata = struct {
+	sync.Mutex
+	data   jiraInstanceData
+	synced time.Time
+}{}
+
+// getJiraMetadata returns the synced instance data, fetching it if it is
+// missing or out of date. If fetching fails, the stale data comes back along
+// with the error.
+func getJiraMetadata() (jiraInstanceData, error) {
+	jiraMetadata.Lock()
+	defer jiraMetadata.Unlock()
+
+	if !jiraMetadata.synced.IsZero() && time.Since(jiraMetadata.synced) < jiraMetadataTTL {
+		return jiraMetadata.data, nil
+	}
+
+	if err := refreshJiraMetadata(); err != nil {
+		return jiraMetadata.data, err
+	}
+
+	return jiraMetadata.data, nil
+}
+
+// syncJiraMetadata refreshes the instance data every interval, so lookups
+// never have to wait for Jira
+func syncJiraMetadata(interval time.Duration) {
+	log.Printf("syncJiraMetadata: Refreshing fields, statuses, priorities and users every %v", interval)
+
+	for {
+		if isJiraBudgetTight(getConfig().JiraAPIBudget, time.Now()) {
+			log.Print("syncJiraMetadata: Skipping refresh, Jira API budget is tight")
+		} else {
+			jiraMetadata.Lock()
+			if err := refreshJiraMetadata(); err != nil {
+				log.Printf("syncJiraMetadata: Error: %v", err)
+			}
+			jiraMetadata.Unlock()
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// refreshJiraMetadata fetches the instance data. The caller holds the lock.
+func refreshJiraMetadata() error {
+	data, err := getBot().jira.GetInstanceData(context.Background())
+	if err != nil {
+		return err
+	}
+
+	jiraMetadata.data = data
+	jiraMetadata.synced = time.Now()
+
+	return nil
+}
+
+// findJiraValue looks up a status or priority by its name, ignoring case
+func findJiraValue(values []jiraNamedValue, name string) *jiraNamedValue {
+	for i := range values {
+		if strings.EqualFold(values[i].Name, name) {
+			return &values[i]
+		}
+	}
+
+	return nil
+}
+
+// suggestJiraValues lists statuses or priorities starting with what the user
+// typed so far
+func suggestJiraValues(values []jiraNamedValue, prefix string, limit int) []jiraNamedValue {
+	result := []jiraNamedValue{}
+
+	for _, value := range values {
+		if len(result) == limit {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(value.Name), strings.ToLower(prefix)) {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+// suggestJiraUsers lists users whose name, display name or email contains
+// what the user typed so far
+func suggestJiraUsers(users []jiraUser, query string, limit int) []jiraUser {
+	result := []jiraUser{}
+	query = strings.ToLower(query)
+
+	for _, user := range users {
+		if len(result) == limit {
+			break
+		}
+
+		for _, candidate := range []string{user.DisplayName, user.Name, user.EmailAddress} {
+			if candidate != "" && strings.Contains(strings.ToLower(candidate), query) {
+				result = append(result, user)
+				break
+			}
+		}
+	}
+
+	return result
+}
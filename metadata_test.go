@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGetJiraMetadata(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		switch r.URL.Path {
+		case "/rest/api/2/field":
+			fmt.Fprint(w, `[{"id": "assignee", "name": "Assignee", "clauseNames": ["assignee"]}]`)
+		case "/rest/api/2/status":
+			fmt.Fprint(w, `[{"id": "1", "name": "Open"}, {"id": "3", "name": "In Progress"}]`)
+		case "/rest/api/2/priority":
+			fmt.Fprint(w, `[{"id": "2", "name": "High"}]`)
+		case "/rest/api/2/issuetype":
+			fmt.Fprint(w, `[{"id": "10001", "name": "Task"}, {"id": "10002", "name": "Sub-task", "subtask": true}]`)
+		case "/rest/api/2/users/search":
+			fmt.Fprint(w, `[{"accountId": "a1", "displayName": "Ada", "active": true}, {"accountId": "a2", "displayName": "Gone", "active": false}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	os.Setenv("JIRA_DEPLOYMENT", "cloud")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+	defer func() { jiraMetadata.synced = time.Time{} }()
+
+	data, err := getJiraMetadata()
+	if err != nil {
+		t.Fatalf("Expected the metadata to sync, got %v", err)
+	}
+	if len(data.Fields) != 1 || len(data.Statuses) != 2 || len(data.Priorities) != 1 || len(data.IssueTypes) != 2 {
+		t.Errorf("Unexpected metadata %+v", data)
+	}
+	if len(data.Users) != 1 || data.Users[0].AccountID != "a1" {
+		t.Errorf("Expected only active users, got %+v", data.Users)
+	}
+
+	getJiraMetadata()
+	if requests != 5 {
+		t.Errorf("Expected synced data to be reused, got %d requests", requests)
+	}
+}
+
+func TestSuggestJiraValues(t *testing.T) {
+	statuses := []jiraNamedValue{{"1", "Open"}, {"3", "In Progress"}, {"4", "In Review"}}
+
+	if result := suggestJiraValues(statuses, "in", 1); len(result) != 1 || result[0].Name != "In Progress" {
+		t.Errorf("Unexpected suggestions %v", result)
+	}
+	if result := findJiraValue(statuses, "in review"); result == nil || result.ID != "4" {
+		t.Errorf("Expected to find In Review, got %v", result)
+	}
+}
+
+func TestSuggestJiraUsers(t *testing.T) {
+	users := []jiraUser{
+		{AccountID: "a1", DisplayName: "Ada Lovelace", EmailAddress: "ada@example.com"},
+		{AccountID: "a2", DisplayName: "Grace Hopper", EmailAddress: "grace@example.com"},
+	}
+
+	if result := suggestJiraUsers(users, "GRACE", 5); len(result) != 1 || result[0].AccountID != "a2" {
+		t.Errorf("Unexpected suggestions %v", result)
+	}
+}
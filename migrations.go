@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Key of the schema version in the state store
+const schemaStateKey = "schema"
+
+// A change to how the bot keeps state. Down undoes Up, so a bot can be
+// rolled back to an older version along with its state.
+type stateMigration struct {
+	Version     int
+	Description string
+	Up          func(store stateStore) error
+	Down        func(store stateStore) error
+}
+
+// The migrations the state goes through, by ascending version. Add new ones
+// at the end and never change released ones.
+var stateMigrations = []stateMigration{
+	{
+		Version:     1,
+		Description: "Keep the issues channels follow",
+		Up:          func(store stateStore) error { return nil },
+		Down:        func(store stateStore) error { return store.Delete(watchesStateKey) },
+	},
+}
+
+// The schema version of the state in a store
+type stateSchema struct {
+	Version    int       `json:"version"`
+	MigratedAt time.Time `json:"migrated_at"`
+}
+
+// getLatestSchemaVersion returns the version the migrations lead to
+func getLatestSchemaVersion(migrations []stateMigration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].Version
+}
+
+func getSchemaVersion(store stateStore) (int, error) {
+	var schema stateSchema
+	if _, err := store.Load(schemaStateKey, &schema); err != nil {
+		return 0, err
+	}
+
+	return schema.Version, nil
+}
+
+// migrateState moves the state in the store to the target version, up or
+// down, and returns the migrations it ran. The version is saved after each
+// one, so a failed migration can be retried. On a dry run it only returns the
+// migrations it would run.
+func migrateState(store stateStore, migrations []stateMigration, target int, dryRun bool) ([]stateMigration, error) {
+	current, err := getSchemaVersion(store)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := getLatestSchemaVersion(migrations)
+	if current > latest {
+		return nil, fmt.Errorf("the state is at version %d, newer than this bot knows (%d). Roll it back with the newer bot first", current, latest)
+	}
+	if target < 0 || target > latest {
+		return nil, fmt.Errorf("unknown version %d, versions go from 0 to %d", target, latest)
+	}
+
+	steps := []stateMigration{}
+	if target >= current {
+		for _, migration := range migrations {
+			if migration.Version > current && migration.Version <= target {
+				steps = append(steps, migration)
+			}
+		}
+	} else {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if migrations[i].Version <= current && migrations[i].Version > target {
+				steps = append(steps, migrations[i])
+			}
+		}
+	}
+
+	if dryRun {
+		return steps, nil
+	}
+
+	for i, migration := range steps {
+		// Undoing a migration leaves the state at the next lower one
+		run, version := migration.Up, migration.Version
+		if target < current {
+			run, version = migration.Down, target
+			if i+1 < len(steps) {
+				version = steps[i+1].Version
+			}
+		}
+
+		if err := run(store); err != nil {
+			return steps[:i], fmt.Errorf("migration %d (%s): %v", migration.Version, migration.Description, err)
+		}
+		if err := store.Save(schemaStateKey, stateSchema{Version: version, MigratedAt: time.Now().UTC()}); err != nil {
+			return steps[:i], err
+		}
+	}
+
+	return steps, nil
+}
+
+// migrateStateOnStartup brings the state to the latest version before the
+// bot reads it
+func migrateStateOnStartup() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	steps, err := migrateState(store, stateMigrations, getLatestSchemaVersion(stateMigrations), false)
+	for _, migration := range steps {
+		log.Printf("migrateStateOnStartup: Migrated the state to version %d: %s", migration.Version, migration.Description)
+	}
+
+	return err
+}
+
+// runMigrateCommand migrates the state to a version, the latest by default,
+// with "-dry-run" listing the migrations instead of running them
+func runMigrateCommand(args []string) error {
+	dryRun := false
+	target := getLatestSchemaVersion(stateMigrations)
+
+	for _, arg := range args {
+		if arg == "-dry-run" || arg == "--dry-run" {
+			dryRun = true
+			continue
+		}
+
+		version, err := strconv.Atoi(arg)
+		if err != nil {
+			return errors.New("usage: jira-bot migrate [-dry-run] [version]")
+		}
+		target = version
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	current, err := getSchemaVersion(store)
+	if err != nil {
+		return err
+	}
+
+	steps, err := migrateState(store, stateMigrations, target, dryRun)
+	for _, migration := range steps {
+		direction := "up"
+		if target < current {
+			direction = "down"
+		}
+
+		if dryRun {
+			log.Printf("runMigrateCommand: Would migrate %s through %d: %s", direction, migration.Version, migration.Description)
+		} else {
+			log.Printf("runMigrateCommand: Migrated %s through %d: %s", direction, migration.Version, migration.Description)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(steps) == 0 {
+		log.Printf("runMigrateCommand: The state is at version %d already", current)
+	}
+
+	return nil
+}
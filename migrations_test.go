@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// Migrations that count how often they ran in the store
+func newTestMigrations() []stateMigration {
+	step := func(key string, delta int) func(stateStore) error {
+		return func(store stateStore) error {
+			count := 0
+			store.Load(key, &count)
+
+			return store.Save(key, count+delta)
+		}
+	}
+
+	return []stateMigration{
+		{Version: 1, Description: "first", Up: step("first", 1), Down: step("first", -1)},
+		{Version: 3, Description: "third", Up: step("third", 1), Down: step("third", -1)},
+	}
+}
+
+func loadTestCount(t *testing.T, store stateStore, key string) int {
+	count := 0
+	if _, err := store.Load(key, &count); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	return count
+}
+
+func TestMigrateStateUpAndDown(t *testing.T) {
+	store := newMemoryStore()
+	migrations := newTestMigrations()
+
+	if steps, err := migrateState(store, migrations, 3, true); err != nil || len(steps) != 2 {
+		t.Fatalf("Expected a dry run to list both migrations, got %v, %v", steps, err)
+	}
+	if version, _ := getSchemaVersion(store); version != 0 || loadTestCount(t, store, "first") != 0 {
+		t.Fatal("Expected a dry run to leave the state alone")
+	}
+
+	if _, err := migrateState(store, migrations, 3, false); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if steps, _ := migrateState(store, migrations, 3, false); len(steps) != 0 {
+		t.Errorf("Expected migrations to run once, got %v", steps)
+	}
+	if version, _ := getSchemaVersion(store); version != 3 || loadTestCount(t, store, "third") != 1 {
+		t.Errorf("Expected version 3, got %v", version)
+	}
+
+	steps, err := migrateState(store, migrations, 0, false)
+	if err != nil || len(steps) != 2 || steps[0].Version != 3 {
+		t.Fatalf("Expected both migrations to be rolled back newest first, got %v, %v", steps, err)
+	}
+	if version, _ := getSchemaVersion(store); version != 0 || loadTestCount(t, store, "first") != 0 || loadTestCount(t, store, "third") != 0 {
+		t.Errorf("Expected the rollback to undo the migrations, got version %v", version)
+	}
+}
+
+func TestMigrateStateStopsAtFailures(t *testing.T) {
+	store := newMemoryStore()
+	migrations := newTestMigrations()
+	migrations[1].Up = func(stateStore) error { return errors.New("disk full") }
+
+	steps, err := migrateState(store, migrations, 3, false)
+	if err == nil || len(steps) != 1 {
+		t.Fatalf("Expected the second migration to fail, got %v, %v", steps, err)
+	}
+	if version, _ := getSchemaVersion(store); version != 1 {
+		t.Errorf("Expected the first migration to be kept, got version %v", version)
+	}
+}
+
+func TestMigrateStateRejectsNewerState(t *testing.T) {
+	store := newMemoryStore()
+	store.Save(schemaStateKey, stateSchema{Version: 4})
+
+	if _, err := migrateState(store, newTestMigrations(), 3, false); err == nil {
+		t.Error("Expected state of a newer bot to be rejected")
+	}
+	if _, err := migrateState(newMemoryStore(), newTestMigrations(), 5, false); err == nil {
+		t.Error("Expected an unknown version to be rejected")
+	}
+}
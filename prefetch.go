@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mentions older than this don't make an issue hot anymore
+const mentionWindow = time.Hour
+
+// When issues were mentioned within the mention window, and when mentions
+// of every issue were last pruned
+var mentions = struct {
+	sync.Mutex
+	seen   map[string][]time.Time
+	pruned time.Time
+}{seen: map[string][]time.Time{}}
+
+type issueMentions struct {
+	issueID string
+	count   int
+}
+
+type byMentions []issueMentions
+
+func (m byMentions) Len() int      { return len(m) }
+func (m byMentions) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m byMentions) Less(i, j int) bool {
+	if m[i].count != m[j].count {
+		return m[i].count > m[j].count
+	}
+
+	return m[i].issueID < m[j].issueID
+}
+
+// recordMention counts a mention of the issue. Mentions older than the
+// mention window are dropped on the way, as hotIssues only runs with
+// prefetching on.
+func recordMention(issueID string, now time.Time) {
+	mentions.Lock()
+	defer mentions.Unlock()
+
+	if now.Sub(mentions.pruned) >= mentionWindow {
+		for seenID := range mentions.seen {
+			pruneMentions(seenID, now)
+		}
+		mentions.pruned = now
+	}
+
+	pruneMentions(issueID, now)
+	mentions.seen[issueID] = append(mentions.seen[issueID], now)
+}
+
+// pruneMentions drops the mentions of the issue older than the mention
+// window. The caller holds the lock of mentions.
+func pruneMentions(issueID string, now time.Time) {
+	times := mentions.seen[issueID]
+	recent := times[:0]
+	for _, t := range times {
+		if now.Sub(t) < mentionWindow {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent) == 0 {
+		delete(mentions.seen, issueID)
+		return
+	}
+	mentions.seen[issueID] = recent
+}
+
+// hotIssues returns up to k issues mentioned most within the mention window
+func hotIssues(k int, now time.Time) []string {
+	mentions.Lock()
+	counts := []issueMentions{}
+	for issueID := range mentions.seen {
+		pruneMentions(issueID, now)
+		if recent, ok := mentions.seen[issueID]; ok {
+			counts = append(counts, issueMentions{issueID, len(recent)})
+		}
+	}
+	mentions.Unlock()
+
+	sort.Sort(byMentions(counts))
+
+	result := []string{}
+	for i := 0; i < len(counts) && i < k; i++ {
+		result = append(result, counts[i].issueID)
+	}
+
+	return result
+}
+
+// prefetchHotIssues keeps the most mentioned issues fresh in the cache, so
+// expansions during busy periods don't wait for Jira.
+func prefetchHotIssues(k int, interval time.Duration) {
+	log.Printf("prefetchHotIssues: Refreshing the top %d issues every %v", k, interval)
+
+	for range time.Tick(interval) {
+		if activeMaintenance(getConfig().MaintenanceWindows, time.Now()) != nil {
+			continue
+		}
+		if isJiraBudgetTight(getConfig().JiraAPIBudget, time.Now()) {
+			prefetchIssueBatch(hotIssues(k, time.Now()))
+			continue
+		}
+
+		for _, issueID := range hotIssues(k, time.Now()) {
+			if _, err := coalesceIssueFetch(context.Background(), issueID, func(ctx context.Context) (jiraIssue, error) {
+				return loadJiraIssue(ctx, issueID)
+			}); err != nil {
+				log.Printf("prefetchHotIssues: Error refreshing %s: %v", issueID, err)
+			}
+		}
+	}
+}
+
+// prefetchIssueBatch refreshes the issues with as few searches as possible,
+// while the Jira API budget is tight. Issues the searches miss, like those
+// that moved, wait for the next mention.
+func prefetchIssueBatch(issueIDs []string) {
+	issueKeys := []string{}
+	for _, issueID := range issueIDs {
+		issueKeys = append(issueKeys, resolveIssueAlias(issueID))
+	}
+
+	found, err := searchIssueBatch(issueKeys, "*all")
+	if err != nil {
+		log.Printf("prefetchIssueBatch: Error: %v", err)
+	}
+
+	now := time.Now()
+	for _, issueKey := range issueKeys {
+		raw, ok := found[strings.ToUpper(issueKey)]
+		if !ok {
+			continue
+		}
+
+		var issue jiraIssue
+		if err := json.Unmarshal(raw, &issue); err != nil || issue.Fields == nil {
+			log.Printf("prefetchIssueBatch: Error reading %s: %v", issueKey, err)
+			continue
+		}
+		cacheIssue(issueKey, issue, now)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHotIssuesRanksByRecentMentions(t *testing.T) {
+	now := time.Now()
+
+	recordMention("OLD-1", now.Add(-2*mentionWindow))
+	recordMention("OLD-1", now.Add(-2*mentionWindow))
+	recordMention("OLD-1", now.Add(-2*mentionWindow))
+	recordMention("HOT-1", now)
+	recordMention("HOT-1", now)
+	recordMention("HOT-2", now)
+	recordMention("HOT-3", now)
+
+	result := hotIssues(2, now)
+
+	if !reflect.DeepEqual(result, []string{"HOT-1", "HOT-2"}) {
+		t.Errorf("Expected [HOT-1 HOT-2], got %v", result)
+	}
+}
+
+func TestRecordMentionPrunesOldMentions(t *testing.T) {
+	now := time.Now()
+	mentions.Lock()
+	mentions.pruned = now.Add(-2 * mentionWindow)
+	mentions.Unlock()
+
+	recordMention("PRUNE-1", now.Add(-2*mentionWindow))
+	recordMention("PRUNE-2", now.Add(-2*mentionWindow))
+	recordMention("PRUNE-1", now)
+
+	mentions.Lock()
+	defer mentions.Unlock()
+	if len(mentions.seen["PRUNE-1"]) != 1 {
+		t.Errorf("Expected the old mention to be dropped, got %v", mentions.seen["PRUNE-1"])
+	}
+	if _, ok := mentions.seen["PRUNE-2"]; ok {
+		t.Error("Expected issues without recent mentions to be dropped")
+	}
+}
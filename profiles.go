@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+// Message templates bundled with the bot, which channels pick with
+// CARD_PROFILES instead of writing their own
+var cardProfiles = map[string]string{
+	// Terse and without emoji, for channels of people outside engineering
+	"formal": `*{{.Key}}: {{.Fields.Summary}}*
+Status: {{with .Fields.Status}}{{.Name}}{{end}} | Assignee: {{displayName .Fields.Assignee}} | Reporter: {{displayName .Fields.Reporter}}
+<{{.URL}}|View in Jira>`,
+
+	// One line per issue
+	"compact": `<{{.URL}}|{{.Key}}> {{.Fields.Summary}} ({{with .Fields.Status}}{{.Name}}{{end}}, {{displayName .Fields.Assignee}})`,
+
+	"emoji-heavy": `:ticket: <{{.URL}}|{{.Key}}> :memo: {{.Fields.Summary}}
+:traffic_light: {{with .Fields.Status}}{{.Name}}{{end}} :bust_in_silhouette: {{displayName .Fields.Assignee}} :pencil2: {{displayName .Fields.Reporter}}
+:calendar: {{date .CreatedAt}}`,
+}
+
+// getCardProfileNames lists the bundled profiles for messages
+func getCardProfileNames() []string {
+	names := []string{}
+	for name := range cardProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// getChannelProfile returns the profile picked for a channel, or "" for the
+// card of its cohort
+func getChannelProfile(channel string) string {
+	return getConfig().CardProfiles[channel]
+}
+
+// getCardTemplate returns the message template source for a card in a
+// channel. The channel's profile goes before the template of the cohort.
+func getCardTemplate(channel string, cohort string) string {
+	if profile := getChannelProfile(channel); profile != "" {
+		return cardProfiles[profile]
+	}
+
+	return getCohortTemplate(cohort)
+}
+
+// parseCardProfiles reads profiles in the form "C123=formal,C456=compact"
+func parseCardProfiles(value string) map[string]string {
+	profiles := map[string]string{}
+
+	for _, entry := range parseList(value) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			log.Printf("parseCardProfiles: Ignoring %q without a profile", entry)
+			continue
+		}
+
+		profiles[strings.TrimSpace(parts[0])] = strings.ToLower(strings.TrimSpace(parts[1]))
+	}
+
+	return profiles
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the list of Jira projects is fetched again
+const jiraProjectsRefreshInterval = 15 * time.Minute
+
+// Keys of the projects in Jira, nil until they have been fetched
+var jiraProjects = struct {
+	sync.Mutex
+	keys map[string]bool
+}{}
+
+type jiraProject struct {
+	Key string `json:"key"`
+}
+
+// syncJiraProjects keeps the list of project keys up to date, so strings
+// like "UTF-8" or "SHA-256" aren't looked up as issues
+func syncJiraProjects(interval time.Duration) {
+	for {
+		if isJiraBudgetTight(getConfig().JiraAPIBudget, time.Now()) && hasJiraProjects() {
+			log.Print("syncJiraProjects: Skipping refresh, Jira API budget is tight")
+		} else if err := refreshJiraProjects(); err != nil {
+			log.Printf("syncJiraProjects: Error: %v", err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// refreshJiraProjects collects the projects of every Jira instance
+func refreshJiraProjects() error {
+	projects, err := getBot().jira.GetProjects(context.Background())
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]bool{}
+	for _, project := range projects {
+		keys[strings.ToUpper(project.Key)] = true
+	}
+
+	jiraProjects.Lock()
+	jiraProjects.keys = keys
+	jiraProjects.Unlock()
+
+	log.Printf("refreshJiraProjects: Found %d projects", len(keys))
+
+	return nil
+}
+
+// getJiraProjectKeys returns the known project keys in order
+func getJiraProjectKeys() []string {
+	jiraProjects.Lock()
+	defer jiraProjects.Unlock()
+
+	keys := []string{}
+	for key := range jiraProjects.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func hasJiraProjects() bool {
+	jiraProjects.Lock()
+	defer jiraProjects.Unlock()
+
+	return jiraProjects.keys != nil
+}
+
+// filterKnownIssueIDs drops issue keys of projects that don't exist. Until
+// the projects have been fetched every key is kept.
+func filterKnownIssueIDs(issueIDs []string) []string {
+	jiraProjects.Lock()
+	defer jiraProjects.Unlock()
+
+	if jiraProjects.keys == nil {
+		return issueIDs
+	}
+
+	result := []string{}
+	for _, issueID := range issueIDs {
+		if jiraProjects.keys[getProjectKey(issueID)] {
+			result = append(result, issueID)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFilterKnownIssueIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"key": "WEB"}, {"key": "OPS"}]`)
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer func() { jiraProjects.keys = nil }()
+
+	issueIDs := []string{"WEB-1", "UTF-8", "OPS-12", "SHA-256"}
+
+	if result := filterKnownIssueIDs(issueIDs); !reflect.DeepEqual(result, issueIDs) {
+		t.Errorf("Expected every key to be kept before projects are known, got %v", result)
+	}
+
+	if err := refreshJiraProjects(); err != nil {
+		t.Fatalf("Expected the projects to load, got %v", err)
+	}
+
+	if result := filterKnownIssueIDs(issueIDs); !reflect.DeepEqual(result, []string{"WEB-1", "OPS-12"}) {
+		t.Errorf("Unexpected keys %v", result)
+	}
+}
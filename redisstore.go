@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Prefix of the Redis keys, so the bot can share a database
+const redisKeyPrefix = "jira-bot:"
+
+// redisStore keeps each key of state in a Redis string
+type redisStore struct {
+	pool *redis.Pool
+}
+
+func openRedisStore(url string) (*redisStore, error) {
+	pool := &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(url)
+		},
+	}
+
+	// Fail at startup rather than on the first save
+	conn := pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("PING"); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &redisStore{pool: pool}, nil
+}
+
+func (s *redisStore) Load(key string, value interface{}) (bool, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GET", redisKeyPrefix+key))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, value)
+}
+
+func (s *redisStore) Save(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err = conn.Do("SET", redisKeyPrefix+key, data)
+
+	return err
+}
+
+func (s *redisStore) Delete(key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", redisKeyPrefix+key)
+
+	return err
+}
+
+func (s *redisStore) Close() error {
+	return s.pool.Close()
+}
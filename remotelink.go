@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Jira remote link, see
+// https://developer.atlassian.com/server/jira/platform/jira-rest-api-for-remote-issue-links/
+type remoteLink struct {
+	GlobalID string           `json:"globalId"`
+	Object   remoteLinkObject `json:"object"`
+}
+
+type remoteLinkObject struct {
+	URL   string         `json:"url"`
+	Title string         `json:"title"`
+	Icon  remoteLinkIcon `json:"icon"`
+}
+
+type remoteLinkIcon struct {
+	URL   string `json:"url16x16"`
+	Title string `json:"title"`
+}
+
+func shouldRecordSlackDiscussion(issueID string) bool {
+	project := getProjectKey(issueID)
+
+	if enabled := getJiraPropertySettings("issue", issueID).DiscussionLinks; enabled != nil {
+		return *enabled
+	}
+	if enabled := getJiraPropertySettings("project", project).DiscussionLinks; enabled != nil {
+		return *enabled
+	}
+
+	for _, p := range getConfig().DiscussionLinkProjects {
+		if strings.EqualFold(p, project) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordSlackDiscussion adds a remote link to the message that mentioned the
+// issue, so people reading the ticket can find the Slack conversation.
+func recordSlackDiscussion(message slack.Msg, issueID string) {
+	if err := checkWritable(); err != nil {
+		return
+	}
+
+	teamURL, err := getSlackTeamURL(message.Channel)
+	if err != nil {
+		log.Printf("recordSlackDiscussion: Error getting the workspace URL: %v", err)
+		return
+	}
+
+	title := "Slack discussion"
+	if channel, err := getChannel(message.Channel); err == nil && channel != nil {
+		title += " in #" + channel.Name
+	}
+
+	permalink := getSlackPermalink(teamURL, message.Channel, message.Timestamp)
+
+	if err := getBot().jira.AddRemoteLink(context.Background(), issueID, newSlackRemoteLink(permalink, title)); err != nil {
+		log.Printf("recordSlackDiscussion: Error linking %s: %v", issueID, err)
+	}
+}
+
+func newSlackRemoteLink(permalink string, title string) remoteLink {
+	return remoteLink{
+		// Using the permalink as global ID makes linking the same message twice a no-op
+		GlobalID: permalink,
+		Object: remoteLinkObject{
+			URL:   permalink,
+			Title: title,
+			Icon: remoteLinkIcon{
+				URL:   "https://slack.com/favicon.ico",
+				Title: "Slack",
+			},
+		},
+	}
+}
+
+func getSlackPermalink(teamURL string, channel string, timestamp string) string {
+	return fmt.Sprintf(
+		"%sarchives/%s/p%s",
+		teamURL,
+		channel,
+		strings.Replace(timestamp, ".", "", 1),
+	)
+}
+
+// getSlackTeamURL returns the URL of the workspace of a channel
+func getSlackTeamURL(channel string) (string, error) {
+	identity, err := getSlackIdentity(channel)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(identity.URL, "/") {
+		return identity.URL + "/", nil
+	}
+
+	return identity.URL, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestGetSlackPermalink(t *testing.T) {
+	result := getSlackPermalink("https://example.slack.com/", "C024BE91L", "1355517523.000005")
+
+	if result != "https://example.slack.com/archives/C024BE91L/p1355517523000005" {
+		t.Errorf("Unexpected permalink %v", result)
+	}
+}
+
+func TestNewSlackRemoteLink(t *testing.T) {
+	link := newSlackRemoteLink("https://example.slack.com/archives/C1/p1", "Slack discussion in #dev")
+	result, _ := json.Marshal(link)
+
+	expected := `{"globalId":"https://example.slack.com/archives/C1/p1","object":{"url":"https://example.slack.com/archives/C1/p1","title":"Slack discussion in #dev","icon":{"url16x16":"https://slack.com/favicon.ico","title":"Slack"}}}`
+	if string(result) != expected {
+		t.Errorf("Unexpected remote link %s", result)
+	}
+}
+
+func TestShouldRecordSlackDiscussion(t *testing.T) {
+	os.Setenv("JIRA_DISCUSSION_LINK_PROJECTS", "web")
+	defer os.Unsetenv("JIRA_DISCUSSION_LINK_PROJECTS")
+
+	if !shouldRecordSlackDiscussion("WEB-1") {
+		t.Errorf("Expected discussions of WEB issues to be recorded")
+	}
+
+	if shouldRecordSlackDiscussion("OPS-1") {
+		t.Errorf("Expected discussions of OPS issues not to be recorded")
+	}
+}
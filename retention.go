@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// How often stored events and cached content past their retention are purged
+const purgeInterval = time.Hour
+
+const purgeUsage = "Usage: `purge user @someone` deletes the events I stored about a user, `purge expired` applies the retention now."
+
+// Slack user, channel and team IDs
+var slackIDPattern = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+// A user mention as Slack sends it, like <@U024BE7LH> or <@U024BE7LH|jane>
+var slackUserLink = regexp.MustCompile(`^<@([A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+func runPurges(interval time.Duration) {
+	for range time.Tick(interval) {
+		purgeExpired(time.Now())
+	}
+}
+
+// purgeExpired deletes events and cached content past their retention. Of
+// several replicas, one purges the shared sinks and each its own caches.
+func purgeExpired(now time.Time) {
+	for _, sink := range eventSinks {
+		if !ownsKey("purge") {
+			break
+		}
+		if purgeable, ok := sink.(purgeableSink); ok {
+			if err := purgeable.Purge(now); err != nil {
+				log.Printf("purgeExpired: Error: %v", err)
+			}
+		}
+	}
+
+	purgeCaches(now, getConfig().CacheRetention)
+}
+
+// purgeCaches drops cache entries no TTL would serve anymore, or older than
+// the retention if one is set
+func purgeCaches(now time.Time, retention time.Duration) {
+	expired := func(age time.Duration, ttl time.Duration) bool {
+		return age >= ttl || (retention > 0 && age >= retention)
+	}
+
+	issueTTL := budgetCacheTTL
+	if getConfig().JiraCacheTTL > issueTTL {
+		issueTTL = getConfig().JiraCacheTTL
+	}
+
+	issueCache.Lock()
+	for key, entry := range issueCache.entries {
+		if expired(now.Sub(entry.fetchedAt), issueTTL) {
+			delete(issueCache.entries, key)
+		}
+	}
+	issueCache.Unlock()
+
+	shortLinks.Lock()
+	for link, entry := range shortLinks.resolved {
+		if expired(now.Sub(entry.resolvedAt), shortLinkTTL) {
+			delete(shortLinks.resolved, link)
+		}
+	}
+	shortLinks.Unlock()
+
+	userAccess.Lock()
+	for userID, entry := range userAccess.checked {
+		if expired(now.Sub(entry.checkedAt), userAccessTTL) {
+			delete(userAccess.checked, userID)
+		}
+	}
+	userAccess.Unlock()
+}
+
+// purgeUserData deletes a user's events from every sink and forgets what the
+// bot remembers about them
+func purgeUserData(userID string) error {
+	failed := []string{}
+
+	for _, sink := range eventSinks {
+		if purgeable, ok := sink.(purgeableSink); ok {
+			if err := purgeable.PurgeUser(userID); err != nil {
+				log.Printf("purgeUserData: Error: %v", err)
+				failed = append(failed, err.Error())
+			}
+		}
+	}
+
+	userAccess.Lock()
+	delete(userAccess.checked, userID)
+	userAccess.Unlock()
+
+	if _, err := removeJiraLink(userID); err != nil {
+		log.Printf("purgeUserData: Error: %v", err)
+		failed = append(failed, err.Error())
+	}
+	if err := removePendingJiraLinks(userID); err != nil {
+		log.Printf("purgeUserData: Error: %v", err)
+		failed = append(failed, err.Error())
+	}
+
+	if err := removeUserPreferences(userID); err != nil {
+		log.Printf("purgeUserData: Error: %v", err)
+		failed = append(failed, err.Error())
+	}
+
+	if err := forgetAnnouncements(func(id string, request announcement) bool { return request.User == userID }); err != nil {
+		log.Printf("purgeUserData: Error: %v", err)
+		failed = append(failed, err.Error())
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("purging %s failed: %s", userID, strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// handlePurgeCommand lets admins delete a user's data, like for a GDPR
+// request, or apply the retention right away
+func handlePurgeCommand(ctx context.Context, message slack.Msg, args []string) {
+	reply := func(text string) {
+		if err := postEphemeral(message.Channel, message.User, text); err != nil {
+			log.Printf("handlePurgeCommand: Error: %v", err)
+		}
+	}
+
+	if !isAdmin(message.User) {
+		reply("Only admins can purge data.")
+		return
+	}
+
+	switch {
+	case len(args) == 1 && strings.EqualFold(args[0], "expired"):
+		purgeExpired(time.Now())
+		recordEvent("purge", map[string]interface{}{"user": message.User, "expired": true})
+		reply(":wastebasket: Purged the events and cached content past their retention.")
+
+	case len(args) == 2 && strings.EqualFold(args[0], "user") && slackUserLink.MatchString(args[1]):
+		userID := slackUserLink.FindStringSubmatch(args[1])[1]
+
+		if err := purgeUserData(userID); err != nil {
+			reply(":warning: Some data couldn't be purged, see the logs. Run the command again once that is fixed.")
+			return
+		}
+
+		// Only the admin is recorded, so the purged user isn't stored again
+		recordEvent("purge", map[string]interface{}{"user": message.User})
+		reply(fmt.Sprintf(":wastebasket: Purged the events stored about <@%s>.", userID))
+
+	default:
+		reply(purgeUsage)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgeCaches(t *testing.T) {
+	now := time.Now()
+
+	cacheIssue("ABC-1", jiraIssue{Key: "ABC-1"}, now.Add(-2*time.Hour))
+	cacheIssue("ABC-2", jiraIssue{Key: "ABC-2"}, now.Add(-time.Minute))
+	defer forgetCachedIssue("ABC-2")
+
+	purgeCaches(now, time.Hour)
+
+	if _, ok := getCachedIssue("ABC-1", 24*time.Hour, now); ok {
+		t.Errorf("Expected the issue older than the retention to be purged")
+	}
+	if _, ok := getCachedIssue("ABC-2", 24*time.Hour, now); !ok {
+		t.Errorf("Expected the recent issue to stay cached")
+	}
+}
+
+func TestPurgeUserDataForgetsAnnouncements(t *testing.T) {
+	announcements.Lock()
+	announcements.scheduled["Q1"] = announcement{User: "U1"}
+	announcements.scheduled["Q2"] = announcement{User: "U2"}
+	announcements.Unlock()
+
+	if err := purgeUserData("U1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	announcements.Lock()
+	defer announcements.Unlock()
+
+	if _, ok := announcements.scheduled["Q1"]; ok {
+		t.Errorf("Expected the user's announcement to be forgotten")
+	}
+	if _, ok := announcements.scheduled["Q2"]; !ok {
+		t.Errorf("Expected announcements of others to stay")
+	}
+	delete(announcements.scheduled, "Q2")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a short link's issue key is remembered, or that it has none
+const shortLinkTTL = time.Hour
+
+// Short links resolved per message at most
+const maxShortLinksPerMessage = 5
+
+// HTTP client for short links. It stops at the first redirect into Jira, as
+// following that might only end on a login page.
+var shortLinkHTTPClient = &http.Client{
+	Timeout: 3 * time.Second,
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		if isJiraLink(request.URL.String()) || len(via) >= 10 {
+			return http.ErrUseLastResponse
+		}
+
+		return nil
+	},
+}
+
+type resolvedShortLink struct {
+	issueID    string
+	resolvedAt time.Time
+}
+
+// Issue keys of short links, by link
+var shortLinks = struct {
+	sync.Mutex
+	resolved map[string]resolvedShortLink
+	patterns map[string]*regexp.Regexp
+}{resolved: map[string]resolvedShortLink{}, patterns: map[string]*regexp.Regexp{}}
+
+// getShortLinkPattern returns the compiled SHORT_LINK_PATTERN, or nil if
+// short links aren't configured
+func getShortLinkPattern() *regexp.Regexp {
+	source := getConfig().ShortLinkPattern
+	if source == "" {
+		return nil
+	}
+
+	shortLinks.Lock()
+	defer shortLinks.Unlock()
+
+	if pattern, ok := shortLinks.patterns[source]; ok {
+		return pattern
+	}
+
+	// The config is validated at startup
+	pattern, err := regexp.Compile(source)
+	if err != nil {
+		log.Printf("getShortLinkPattern: Error: %v", err)
+	}
+	shortLinks.patterns[source] = pattern
+
+	return pattern
+}
+
+// cutShortLinks returns the short links in a message and the message without
+// them, so keys that happen to be part of a link aren't looked up as well
+func cutShortLinks(message string) ([]string, string) {
+	pattern := getShortLinkPattern()
+	if pattern == nil {
+		return nil, message
+	}
+
+	links := pattern.FindAllString(message, maxShortLinksPerMessage)
+
+	return links, pattern.ReplaceAllString(message, " ")
+}
+
+// resolveShortLinks returns the issue keys the links point to
+func resolveShortLinks(links []string) []string {
+	result := []string{}
+
+	for _, link := range links {
+		if issueID := resolveShortLink(link, time.Now()); issueID != "" {
+			result = append(result, issueID)
+		}
+	}
+
+	return result
+}
+
+// resolveShortLink follows a short link to Jira and returns the issue key it
+// points to, or "" if it doesn't point to an issue
+func resolveShortLink(link string, now time.Time) string {
+	shortLinks.Lock()
+	cached, ok := shortLinks.resolved[link]
+	shortLinks.Unlock()
+
+	if ok && now.Sub(cached.resolvedAt) < shortLinkTTL {
+		return cached.issueID
+	}
+
+	issueID, err := followShortLink(link)
+	if err != nil {
+		log.Printf("resolveShortLink: Error resolving %s: %v", link, err)
+	}
+
+	shortLinks.Lock()
+	for key, entry := range shortLinks.resolved {
+		if now.Sub(entry.resolvedAt) >= shortLinkTTL {
+			delete(shortLinks.resolved, key)
+		}
+	}
+	shortLinks.resolved[link] = resolvedShortLink{issueID: issueID, resolvedAt: now}
+	shortLinks.Unlock()
+
+	return issueID
+}
+
+func followShortLink(link string) (string, error) {
+	target := link
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+
+	response, err := shortLinkHTTPClient.Head(target)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+
+	// Stopped at the redirect into Jira, or ended up in Jira anyway
+	location := response.Request.URL
+	if redirect, err := response.Location(); err == nil {
+		location = redirect
+	}
+
+	if !isJiraLink(location.String()) {
+		return "", nil
+	}
+
+	if match := jiraURLIssuePattern.FindStringSubmatch(location.String()); match != nil {
+		return strings.ToUpper(match[1]), nil
+	}
+
+	return "", nil
+}
+
+// mergeIssueIDs adds keys not seen yet, up to the limit per message
+func mergeIssueIDs(issueIDs []string, more []string) []string {
+	seen := map[string]bool{}
+	for _, issueID := range issueIDs {
+		seen[issueID] = true
+	}
+
+	for _, issueID := range more {
+		if len(issueIDs) >= maxIssueIDsPerMessage {
+			break
+		}
+		if !seen[issueID] {
+			seen[issueID] = true
+			issueIDs = append(issueIDs, issueID)
+		}
+	}
+
+	return issueIDs
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestResolveShortLinks(t *testing.T) {
+	jira := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Jira behind SSO sends everyone to a login page
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+	defer jira.Close()
+
+	shortener := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/s/J-1234":
+			http.Redirect(w, r, jira.URL+"/browse/WEB-77", http.StatusFound)
+		case "/s/wiki":
+			http.Redirect(w, r, "https://wiki.example.com/", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer shortener.Close()
+
+	os.Setenv("JIRA_BASEURL", jira.URL)
+	os.Setenv("SHORT_LINK_PATTERN", regexp.QuoteMeta(shortener.URL)+`/s/[\w-]+`)
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("SHORT_LINK_PATTERN")
+	defer func() { shortLinks.resolved = map[string]resolvedShortLink{} }()
+
+	links, text := cutShortLinks("See <" + shortener.URL + "/s/J-1234> and <" + shortener.URL + "/s/wiki>, also ABC-1")
+	if len(links) != 2 {
+		t.Fatalf("Expected two short links, got %v", links)
+	}
+	if issueIDs := extractIssueIDs(text); !reflect.DeepEqual(issueIDs, []string{"ABC-1"}) {
+		t.Errorf("Expected keys in short links to be cut, got %v", issueIDs)
+	}
+
+	if issueIDs := resolveShortLinks(links); !reflect.DeepEqual(issueIDs, []string{"WEB-77"}) {
+		t.Errorf("Expected WEB-77, got %v", issueIDs)
+	}
+
+	// Resolved links are remembered
+	shortener.Close()
+	if issueID := resolveShortLink(links[0], time.Now()); issueID != "WEB-77" {
+		t.Errorf("Expected the cached key, got %q", issueID)
+	}
+}
+
+func TestMergeIssueIDs(t *testing.T) {
+	result := mergeIssueIDs([]string{"ABC-1", "ABC-2"}, []string{"ABC-2", "WEB-7"})
+
+	if !reflect.DeepEqual(result, []string{"ABC-1", "ABC-2", "WEB-7"}) {
+		t.Errorf("Unexpected keys %v", result)
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Slack's page where admins approve installing the app
+var slackAuthorizeURL = "https://slack.com/oauth/v2/authorize"
+
+// The bot scopes the app asks for when it is installed
+const slackInstallScopes = "channels:history,channels:read,chat:write,commands,files:read,files:write,groups:history,groups:read,im:history,im:write,reactions:write,users:read,users:read.email"
+
+// How long an install link works
+const slackInstallStateTTL = 10 * time.Minute
+
+// Channel, user and team IDs remembered before starting over. Events name
+// their workspace, so forgotten IDs are learned again with the next event.
+const maxSlackWorkspaceIDs = 100000
+
+// Key of the installations in the state store
+const slackInstallationsStateKey = "slack_installations"
+
+func init() {
+	registerStateKind(slackInstallationsStateKey, loadSlackInstallations)
+}
+
+// A workspace the app was installed to
+type slackInstallation struct {
+	TeamID      string    `json:"team_id"`
+	TeamName    string    `json:"team_name"`
+	BotToken    string    `json:"bot_token"`
+	BotUserID   string    `json:"bot_user_id"`
+	InstalledBy string    `json:"installed_by"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// Installations by team ID, which are saved in the state store, their
+// clients, and the workspaces of the channels and users events came from.
+// Slack IDs are unique across workspaces, so an ID is enough to tell which
+// workspace to answer in.
+var slackWorkspaces = struct {
+	sync.Mutex
+	installations map[string]*slackInstallation
+	clients       map[string]*slack.Client
+	teams         map[string]string
+	seen          map[string]bool
+}{
+	installations: map[string]*slackInstallation{},
+	clients:       map[string]*slack.Client{},
+	teams:         map[string]string{},
+	seen:          map[string]bool{},
+}
+
+// isMultiWorkspace reports whether the app is installed to workspaces
+// through OAuth, rather than running with the one SLACK_API_KEY
+func isMultiWorkspace() bool {
+	return getConfig().SlackClientID != ""
+}
+
+// rememberSlackWorkspace notes the workspace of the channels and users of an
+// event
+func rememberSlackWorkspace(teamID string, ids ...string) {
+	if teamID == "" || !isMultiWorkspace() {
+		return
+	}
+
+	slackWorkspaces.Lock()
+	defer slackWorkspaces.Unlock()
+
+	// Another replica may have installed the app to a new workspace
+	if !slackWorkspaces.seen[teamID] {
+		if _, ok := slackWorkspaces.installations[teamID]; !ok {
+			refreshSharedSlackInstallations()
+		}
+		if len(slackWorkspaces.seen) >= maxSlackWorkspaceIDs {
+			slackWorkspaces.seen = map[string]bool{}
+		}
+		slackWorkspaces.seen[teamID] = true
+	}
+
+	// The IDs of other workspaces go to the client of SLACK_API_KEY anyway
+	if _, ok := slackWorkspaces.installations[teamID]; !ok {
+		return
+	}
+
+	if len(slackWorkspaces.teams)+len(ids) > maxSlackWorkspaceIDs {
+		slackWorkspaces.teams = map[string]string{}
+	}
+	for _, id := range ids {
+		if id != "" {
+			slackWorkspaces.teams[id] = teamID
+		}
+	}
+}
+
+// getSlackWorkspace returns the team of a team, channel or user ID, or ""
+// for the workspace of SLACK_API_KEY
+func getSlackWorkspace(id string) string {
+	if !isMultiWorkspace() {
+		return ""
+	}
+
+	slackWorkspaces.Lock()
+	defer slackWorkspaces.Unlock()
+
+	if _, ok := slackWorkspaces.installations[id]; ok {
+		return id
+	}
+	if teamID, ok := slackWorkspaces.teams[id]; ok {
+		if _, installed := slackWorkspaces.installations[teamID]; installed {
+			return teamID
+		}
+	}
+
+	return ""
+}
+
+// getSlackAPIFor returns the client for the workspace of a team, channel or
+// user ID. IDs the bot hasn't seen an event of go to the workspace of
+// SLACK_API_KEY.
+func getSlackAPIFor(id string) *slack.Client {
+	teamID := getSlackWorkspace(id)
+	if teamID == "" {
+		return getSlackAPI()
+	}
+
+	slackWorkspaces.Lock()
+	defer slackWorkspaces.Unlock()
+
+	client, ok := slackWorkspaces.clients[teamID]
+	if !ok {
+		client = slack.New(
+			slackWorkspaces.installations[teamID].BotToken,
+			slack.OptionAppLevelToken(getConfig().SlackAppToken),
+		)
+		slackWorkspaces.clients[teamID] = client
+	}
+
+	return client
+}
+
+// newSlackInstallState ties an install to nothing but its expiry. It is
+// signed, so Slack can't be sent a forged callback.
+func newSlackInstallState(now time.Time) string {
+	payload := strconv.FormatInt(now.Add(slackInstallStateTTL).Unix(), 10)
+
+	return payload + "." + signSlackInstallState(payload)
+}
+
+func signSlackInstallState(payload string) string {
+	mac := hmac.New(sha256.New, []byte(getConfig().SlackClientSecret))
+	mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func checkSlackInstallState(state string, now time.Time) error {
+	parts := strings.Split(state, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signSlackInstallState(parts[0]))) {
+		return fmt.Errorf("invalid state %q", state)
+	}
+
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Unix() > expiry {
+		return fmt.Errorf("the install link expired")
+	}
+
+	return nil
+}
+
+func serveSlackInstall(addr string) {
+	log.Printf("serveSlackInstall: Listening on %s", addr)
+
+	if err := http.ListenAndServe(addr, newSlackInstallHandler()); err != nil {
+		log.Printf("serveSlackInstall: Error: %v", err)
+	}
+}
+
+func newSlackInstallHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slack/install", handleSlackInstall)
+	mux.HandleFunc("/slack/oauth/callback", handleSlackOAuthCallback)
+
+	return mux
+}
+
+// handleSlackInstall sends whoever installs the app to Slack to approve it
+func handleSlackInstall(w http.ResponseWriter, r *http.Request) {
+	config := getConfig()
+	query := url.Values{
+		"client_id":    {config.SlackClientID},
+		"scope":        {slackInstallScopes},
+		"redirect_uri": {config.SlackRedirectURL},
+		"state":        {newSlackInstallState(time.Now())},
+	}
+
+	http.Redirect(w, r, slackAuthorizeURL+"?"+query.Encode(), http.StatusFound)
+}
+
+// handleSlackOAuthCallback saves the bot token of a workspace once an admin
+// approved the app, if it is one of SLACK_ALLOWED_TEAMS
+func handleSlackOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if err := checkSlackInstallState(query.Get("state"), time.Now()); err != nil {
+		log.Printf("handleSlackOAuthCallback: %v", err)
+		http.Error(w, "This link is invalid or expired, start the installation again.", http.StatusBadRequest)
+		return
+	}
+	if reason := query.Get("error"); reason != "" {
+		http.Error(w, "Slack didn't install the app: "+reason, http.StatusForbidden)
+		return
+	}
+
+	config := getConfig()
+	response, err := slack.GetOAuthV2Response(http.DefaultClient, config.SlackClientID, config.SlackClientSecret, query.Get("code"), config.SlackRedirectURL)
+	if err != nil {
+		log.Printf("handleSlackOAuthCallback: Error: %v", err)
+		http.Error(w, "I couldn't finish the installation, try again.", http.StatusBadGateway)
+		return
+	}
+
+	if !isAllowedSlackTeam(response.Team.ID) {
+		log.Printf("handleSlackOAuthCallback: Refusing to install to %s (%s)", response.Team.Name, response.Team.ID)
+		recordEvent("install_refused", map[string]interface{}{"team": response.Team.ID, "user": response.AuthedUser.ID})
+		http.Error(w, "This workspace isn't allowed to install the bot. Ask its operators to add "+response.Team.ID+" to SLACK_ALLOWED_TEAMS.", http.StatusForbidden)
+		return
+	}
+
+	installation := slackInstallation{
+		TeamID:      response.Team.ID,
+		TeamName:    response.Team.Name,
+		BotToken:    response.AccessToken,
+		BotUserID:   response.BotUserID,
+		InstalledBy: response.AuthedUser.ID,
+		InstalledAt: time.Now().UTC(),
+	}
+	if err := saveSlackInstallation(installation); err != nil {
+		log.Printf("handleSlackOAuthCallback: Error: %v", err)
+		http.Error(w, "I couldn't save the installation, try again.", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("handleSlackOAuthCallback: Installed to %s (%s)", installation.TeamName, installation.TeamID)
+	recordEvent("install", map[string]interface{}{"team": installation.TeamID, "user": installation.InstalledBy})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<p>Installed to %s. Invite @%s to a channel to get started.</p>", html.EscapeString(installation.TeamName), html.EscapeString(getConfig().Username))
+}
+
+// isAllowedSlackTeam reports whether the app may be installed to a team
+func isAllowedSlackTeam(teamID string) bool {
+	return teamID != "" && containsString(getConfig().SlackAllowedTeams, teamID)
+}
+
+func saveSlackInstallation(installation slackInstallation) error {
+	defer lockSharedState(slackInstallationsStateKey)()
+	slackWorkspaces.Lock()
+	defer slackWorkspaces.Unlock()
+	refreshSharedSlackInstallations()
+
+	slackWorkspaces.installations[installation.TeamID] = &installation
+	delete(slackWorkspaces.clients, installation.TeamID)
+
+	return saveSlackInstallations()
+}
+
+// removeSlackInstallation forgets a workspace that uninstalled the app or
+// revoked its token
+func removeSlackInstallation(teamID string) error {
+	defer lockSharedState(slackInstallationsStateKey)()
+	slackWorkspaces.Lock()
+	defer slackWorkspaces.Unlock()
+	refreshSharedSlackInstallations()
+
+	if _, ok := slackWorkspaces.installations[teamID]; !ok {
+		return nil
+	}
+	delete(slackWorkspaces.installations, teamID)
+	delete(slackWorkspaces.clients, teamID)
+	for id, team := range slackWorkspaces.teams {
+		if team == teamID {
+			delete(slackWorkspaces.teams, id)
+		}
+	}
+
+	log.Printf("removeSlackInstallation: Uninstalled from %s", teamID)
+
+	return saveSlackInstallations()
+}
+
+// loadSlackInstallations restores the workspaces the app was installed to
+func loadSlackInstallations() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadSlackInstallations: Error: %v", err)
+		return
+	}
+
+	installations := map[string]*slackInstallation{}
+	if _, err := store.Load(slackInstallationsStateKey, &installations); err != nil {
+		log.Printf("loadSlackInstallations: Error: %v", err)
+		return
+	}
+
+	slackWorkspaces.Lock()
+	slackWorkspaces.installations = installations
+	slackWorkspaces.clients = map[string]*slack.Client{}
+	slackWorkspaces.Unlock()
+
+	log.Printf("loadSlackInstallations: Installed to %d workspaces", len(installations))
+}
+
+// refreshSharedSlackInstallations reads the installations again, as other
+// replicas may have changed them. The caller holds the lock of
+// slackWorkspaces.
+func refreshSharedSlackInstallations() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedSlackInstallations: Error: %v", err)
+		return
+	}
+
+	installations := map[string]*slackInstallation{}
+	if _, err := store.Load(slackInstallationsStateKey, &installations); err != nil {
+		log.Printf("refreshSharedSlackInstallations: Error: %v", err)
+		return
+	}
+
+	slackWorkspaces.installations = installations
+	slackWorkspaces.clients = map[string]*slack.Client{}
+}
+
+// saveSlackInstallations writes the installations to the state store. The
+// caller holds the lock of slackWorkspaces.
+func saveSlackInstallations() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(slackInstallationsStateKey, slackWorkspaces.installations)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlackInstallState(t *testing.T) {
+	os.Setenv("SLACK_CLIENT_SECRET", "secret")
+	defer os.Unsetenv("SLACK_CLIENT_SECRET")
+
+	now := time.Now()
+	state := newSlackInstallState(now)
+
+	if err := checkSlackInstallState(state, now.Add(time.Minute)); err != nil {
+		t.Errorf("Expected a fresh state to be accepted, got %v", err)
+	}
+	if err := checkSlackInstallState(state, now.Add(slackInstallStateTTL+time.Minute)); err == nil {
+		t.Error("Expected an expired state to be rejected")
+	}
+
+	forged := strings.SplitN(state, ".", 2)[0] + "0." + strings.SplitN(state, ".", 2)[1]
+	if err := checkSlackInstallState(forged, now); err == nil {
+		t.Error("Expected a forged state to be rejected")
+	}
+}
+
+func TestGetSlackWorkspace(t *testing.T) {
+	os.Setenv("SLACK_CLIENT_ID", "123.456")
+	defer os.Unsetenv("SLACK_CLIENT_ID")
+
+	slackWorkspaces.Lock()
+	slackWorkspaces.installations["T2"] = &slackInstallation{TeamID: "T2", BotToken: "xoxb-2"}
+	slackWorkspaces.Unlock()
+	defer func() {
+		slackWorkspaces.Lock()
+		delete(slackWorkspaces.installations, "T2")
+		delete(slackWorkspaces.clients, "T2")
+		delete(slackWorkspaces.teams, "C2")
+		delete(slackWorkspaces.teams, "U2")
+		delete(slackWorkspaces.teams, "C3")
+		slackWorkspaces.Unlock()
+	}()
+
+	rememberSlackWorkspace("T2", "C2", "U2")
+	rememberSlackWorkspace("T3", "C3")
+
+	for id, expected := range map[string]string{"T2": "T2", "C2": "T2", "U2": "T2", "C3": "", "C1": ""} {
+		if teamID := getSlackWorkspace(id); teamID != expected {
+			t.Errorf("Expected %s in workspace %q, got %q", id, expected, teamID)
+		}
+	}
+
+	slackWorkspaces.Lock()
+	_, remembered := slackWorkspaces.teams["C3"]
+	slackWorkspaces.Unlock()
+	if remembered {
+		t.Error("Expected the IDs of workspaces without an installation not to be remembered")
+	}
+
+	if getSlackAPIFor("C2") != getSlackAPIFor("U2") || getSlackAPIFor("C2") == getSlackAPI() {
+		t.Error("Expected one client for the installed workspace")
+	}
+	if getSlackAPIFor("C3") != getSlackAPI() {
+		t.Error("Expected unknown workspaces to use the default client")
+	}
+}
+
+func TestIsAllowedSlackTeam(t *testing.T) {
+	os.Setenv("SLACK_ALLOWED_TEAMS", "T1,T2")
+	defer os.Unsetenv("SLACK_ALLOWED_TEAMS")
+
+	for teamID, expected := range map[string]bool{"T1": true, "T2": true, "T3": false, "": false} {
+		if allowed := isAllowedSlackTeam(teamID); allowed != expected {
+			t.Errorf("Expected %q allowed to be %v, got %v", teamID, expected, allowed)
+		}
+	}
+}
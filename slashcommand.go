@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Slack accepts at most this many responses to one command
+const maxSlashResponses = 5
+
+const slashCommandHelp = "*Using /jira*\n" +
+	"> `/jira ABC-123` shows the issue to the channel\n" +
+	"> `/jira peek ABC-123` shows the issue only to you\n" +
+	"> `/jira search <JQL>` lists up to 20 matching issues, only to you\n" +
+	"> `/jira create [ABC] [summary]` opens a form to create an issue\n" +
+	"> `/jira help` shows this help\n" +
+	"Commands you'd give by mentioning me work too, like `/jira context ABC-123`, except `comment`, which needs the thread of an issue."
+
+// Mention commands that act on the thread they're given in. Slack doesn't
+// tell slash commands which thread they came from.
+var threadOnlyCommands = map[string]bool{
+	"comment": true,
+}
+
+// Handlers of the slash command's subcommands, by name. Issue keys and the
+// mention commands of botCommandHandlers are handled too.
+var slashCommandHandlers = map[string]func(command slack.SlashCommand, args []string){
+	"create": handleSlashCreate,
+	"help":   handleSlashHelp,
+	"peek":   handleSlashPeek,
+	"search": handleSlashSearch,
+}
+
+// handleSlackCommands receives slash commands over HTTP. The response comes
+// later through the command's response URL, as Jira may take longer than the
+// 3 seconds Slack waits.
+func handleSlackCommands(w http.ResponseWriter, r *http.Request) {
+	command, err := slack.SlashCommandParse(r)
+	if err != nil {
+		log.Printf("handleSlackCommands: Error parsing command: %v", err)
+		http.Error(w, "invalid command", http.StatusBadRequest)
+		return
+	}
+
+	go handleSlashCommand(command)
+}
+
+// handleSlashCommand runs "/jira ...", however the command reached the bot
+func handleSlashCommand(command slack.SlashCommand) {
+	rememberSlackWorkspace(command.TeamID, command.ChannelID, command.UserID)
+
+	fields := strings.Fields(command.Text)
+
+	name, args := "help", []string{}
+	if len(fields) > 0 {
+		name, args = strings.ToLower(fields[0]), fields[1:]
+	}
+
+	if _, ok := botCommandHandlers[name]; ok {
+		handleSlashBotCommand(command, name)
+		return
+	}
+
+	log.Printf("handleSlashCommand: Running %s", name)
+	recordEvent("command", map[string]interface{}{
+		"channel": command.ChannelID,
+		"user":    command.UserID,
+		"command": name,
+		"args":    args,
+		"slash":   true,
+	})
+
+	if handler, ok := slashCommandHandlers[name]; ok {
+		handler(command, args)
+		return
+	}
+
+	issueIDs := extractIssueIDs(command.Text)
+	if len(issueIDs) == 0 {
+		respondEphemeral(command, fmt.Sprintf("I don't know `%s`.\n%s", name, slashCommandHelp))
+		return
+	}
+
+	if window := activeMaintenance(getConfig().MaintenanceWindows, time.Now()); window != nil {
+		respondEphemeral(command, formatMaintenanceNotice(*window))
+		return
+	}
+
+	for i, issueID := range issueIDs {
+		if i == maxSlashResponses {
+			break
+		}
+		handleSlashLookup(command, issueID)
+	}
+}
+
+// handleSlashBotCommand runs a mention command given as "/jira <command>",
+// as if it had been said to the bot in the channel
+func handleSlashBotCommand(command slack.SlashCommand, name string) {
+	if threadOnlyCommands[name] {
+		respondEphemeral(command, fmt.Sprintf("`/jira %s` doesn't know which thread it's in. Reply in the thread of the issue with `@%s %s ...` instead.", name, getConfig().Username, name))
+		return
+	}
+
+	message, err := newSlashCommandMessage(command)
+	if err != nil {
+		log.Printf("handleSlashBotCommand: Error: %v", err)
+		respondEphemeral(command, ":warning: I couldn't run that, try again.")
+		return
+	}
+
+	// Like messages, commands give up on Jira once the timeout passed
+	ctx, cancel := context.WithTimeout(context.Background(), getConfig().MessageTimeout)
+	defer cancel()
+
+	if !handleBotCommand(ctx, message) {
+		respondEphemeral(command, fmt.Sprintf("I don't know `%s`.\n%s", name, slashCommandHelp))
+	}
+}
+
+// newSlashCommandMessage turns a slash command into the message mentioning
+// the bot it stands for, so mention commands read their arguments and text
+// alike. It has no timestamp, so replies go to the channel.
+func newSlashCommandMessage(command slack.SlashCommand) (slack.Msg, error) {
+	identity, err := getSlackIdentity(command.ChannelID)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	return slack.Msg{
+		Channel: command.ChannelID,
+		User:    command.UserID,
+		Team:    command.TeamID,
+		Text:    "<@" + identity.UserID + "> " + command.Text,
+	}, nil
+}
+
+func handleSlashHelp(command slack.SlashCommand, args []string) {
+	respondEphemeral(command, slashCommandHelp)
+}
+
+// handleSlashLookup shows an issue's card to the channel, as if someone had
+// mentioned the issue there
+func handleSlashLookup(command slack.SlashCommand, issueID string) {
+	issue, err := fetchJiraIssueFor(context.Background(), command.ChannelID, command.UserID, issueID)
+	if err != nil {
+		reportError(slack.Msg{Channel: command.ChannelID}, issueID, err, false)
+		respondEphemeral(command, describeError(getErrorKind(err), issueID))
+		return
+	}
+	if isCustomerViewChannel(command.ChannelID) {
+		issue = loadCustomerRequest(context.Background(), command.ChannelID, command.UserID, issue)
+	}
+
+	text, blocks := formatIssuePost(command.ChannelID, command.UserID, issueID, issue, getCohort(command.ChannelID, issueID))
+	if !isTrustedUser(command.UserID) {
+		text, blocks = formatRestrictedMessage(issue), nil
+	}
+
+	response := &slack.WebhookMessage{ResponseType: slack.ResponseTypeInChannel, Text: truncateText(text, maxMessageLength)}
+	if blocks != nil {
+		response.Blocks = &slack.Blocks{BlockSet: truncateBlocks(blocks)}
+	}
+	respondToSlashCommand(command, response)
+}
+
+// handleSlashPeek shows a compact card of each issue only to the user, never
+// to the channel
+func handleSlashPeek(command slack.SlashCommand, args []string) {
+	issueIDs := extractIssueIDs(strings.Join(args, " "))
+	if len(issueIDs) == 0 {
+		respondEphemeral(command, "Usage: `/jira peek ABC-123`")
+		return
+	}
+
+	lines := []string{}
+	for i, issueID := range issueIDs {
+		if i == maxSlashResponses {
+			break
+		}
+
+		issue, err := fetchJiraIssueFor(context.Background(), command.ChannelID, command.UserID, issueID)
+		if err != nil {
+			reportError(slack.Msg{Channel: command.ChannelID}, issueID, err, false)
+			lines = append(lines, describeError(getErrorKind(err), issueID))
+			continue
+		}
+
+		if !isTrustedUser(command.UserID) {
+			lines = append(lines, formatRestrictedMessage(issue))
+			continue
+		}
+		if getUserPreferences(command.UserID).AccessibleCards {
+			lines = append(lines, formatAccessibleMessage(issue, issueID))
+			continue
+		}
+		lines = append(lines, formatCompactCard(issue, issueID))
+	}
+
+	respondEphemeral(command, strings.Join(lines, "\n"))
+}
+
+// handleSlashSearch lists the issues matching a query to the user
+func handleSlashSearch(command slack.SlashCommand, args []string) {
+	jql := strings.TrimSpace(slackUnescaper.Replace(strings.Join(args, " ")))
+	if jql == "" {
+		respondEphemeral(command, "Usage: `/jira search <JQL>`, e.g. `/jira search project = ABC AND assignee = currentUser()`")
+		return
+	}
+
+	if err := validateJQL(jql); err != nil {
+		respondEphemeral(command, ":warning: "+err.Error())
+		return
+	}
+
+	jira, err := getJiraServiceFor(command.ChannelID, command.UserID)
+	if err != nil {
+		respondEphemeral(command, describeError(getErrorKind(err), "the search"))
+		return
+	}
+
+	result, err := searchJiraIssues(jira, jql)
+	if err != nil {
+		reportError(slack.Msg{Channel: command.ChannelID}, "a search", err, false)
+		respondEphemeral(command, describeJQLError(jql, err))
+		return
+	}
+
+	if len(result.Issues) == 0 {
+		respondEphemeral(command, "No issues match `"+jql+"`.")
+		return
+	}
+
+	lines := append([]string{fmt.Sprintf("*%d issues match* `%s`", result.Total, jql)}, formatSearchResult(jql, result)...)
+	respondEphemeral(command, strings.Join(lines, "\n"))
+}
+
+func respondEphemeral(command slack.SlashCommand, text string) {
+	respondToSlashCommand(command, &slack.WebhookMessage{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         truncateText(text, maxMessageLength),
+	})
+}
+
+func respondToSlashCommand(command slack.SlashCommand, response *slack.WebhookMessage) {
+	if err := slack.PostWebhook(command.ResponseURL, response); err != nil {
+		log.Printf("respondToSlashCommand: Error: %v", err)
+	}
+}
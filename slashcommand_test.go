@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestNewSlashCommandMessage(t *testing.T) {
+	slackIdentity.Lock()
+	slackIdentity.responses[""] = &slack.AuthTestResponse{UserID: "UBOT"}
+	slackIdentity.Unlock()
+	defer func() {
+		slackIdentity.Lock()
+		delete(slackIdentity.responses, "")
+		slackIdentity.Unlock()
+	}()
+
+	message, err := newSlashCommandMessage(slack.SlashCommand{ChannelID: "C1", UserID: "U1", Text: "context ABC-1\nplease"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	command, ok := parseBotCommand(message.Text, "UBOT")
+	if !ok || command.Name != "context" || len(command.Args) != 2 || command.Args[0] != "ABC-1" {
+		t.Errorf("Expected the command to read like a mention, got %+v", command)
+	}
+	if text := getCommandText(message.Text); text != "ABC-1\nplease" {
+		t.Errorf("Expected the command's text, got %q", text)
+	}
+	if message.Channel != "C1" || message.User != "U1" || getReplyThread(message) != "" {
+		t.Errorf("Expected a message in the channel, got %+v", message)
+	}
+}
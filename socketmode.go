@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// runSocketMode receives events through Slack's Socket Mode, which needs an
+// app-level token and the message event subscriptions of the app.
+func runSocketMode(api *slack.Client) {
+	client := socketmode.New(api)
+
+	go func() {
+		if err := client.Run(); err != nil {
+			log.Fatalf("runSocketMode: Connection failed: %v", err)
+		}
+	}()
+
+	for event := range client.Events {
+		switch event.Type {
+		case socketmode.EventTypeConnecting:
+			log.Print("runSocketMode: Connecting")
+		case socketmode.EventTypeConnected:
+			log.Print("runSocketMode: Now listening for events")
+			setConnectionStatus(transportSocketMode, true)
+		case socketmode.EventTypeConnectionError:
+			log.Printf("runSocketMode: Connection error: %v", event.Data)
+			setConnectionStatus(transportSocketMode, false)
+		case socketmode.EventTypeEventsAPI:
+			apiEvent, ok := event.Data.(slackevents.EventsAPIEvent)
+			if !ok {
+				continue
+			}
+
+			// Acknowledge right away, Slack retries events that take longer than 3 seconds
+			client.Ack(*event.Request)
+
+			handleEventsAPIEvent(apiEvent)
+			go handleHuddlePayload(event.Request.Payload)
+		case socketmode.EventTypeInteractive:
+			callback, ok := event.Data.(slack.InteractionCallback)
+			if !ok {
+				continue
+			}
+
+			client.Ack(*event.Request)
+
+			// Handlers call Jira, which mustn't hold up the events after this one
+			go handleInteraction(callback)
+		case socketmode.EventTypeSlashCommand:
+			command, ok := event.Data.(slack.SlashCommand)
+			if !ok {
+				continue
+			}
+
+			client.Ack(*event.Request)
+
+			go handleSlashCommand(command)
+		default:
+			// Ignore other events..
+		}
+	}
+}
+
+// handleEventsAPIEvent feeds Events API payloads into the same message
+// handling the RTM connection uses.
+func handleEventsAPIEvent(event slackevents.EventsAPIEvent) {
+	if event.Type != slackevents.CallbackEvent {
+		return
+	}
+	markEventReceived()
+
+	switch ev := event.InnerEvent.Data.(type) {
+	case *slackevents.MessageEvent:
+		message := messageFromEvent(ev)
+		message.Team = event.TeamID
+		dispatchMessage(message)
+	case *slackevents.FileSharedEvent:
+		rememberSlackWorkspace(event.TeamID, ev.ChannelID, ev.UserID)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), getConfig().MessageTimeout)
+			defer cancel()
+			handleFileShared(ctx, ev)
+		}()
+	case *slackevents.AppHomeOpenedEvent:
+		rememberSlackWorkspace(event.TeamID, ev.User)
+		if ev.Tab == "home" {
+			go publishAppHome(ev.User)
+		}
+	case *slackevents.AppUninstalledEvent, *slackevents.TokensRevokedEvent:
+		if isMultiWorkspace() {
+			if err := removeSlackInstallation(event.TeamID); err != nil {
+				log.Printf("handleEventsAPIEvent: Error: %v", err)
+			}
+		}
+	default:
+		// Ignore other events..
+	}
+}
+
+func messageFromEvent(event *slackevents.MessageEvent) slack.Msg {
+	return slack.Msg{
+		Type:            event.Type,
+		Channel:         event.Channel,
+		User:            event.User,
+		Text:            event.Text,
+		Timestamp:       event.TimeStamp,
+		ThreadTimestamp: event.ThreadTimeStamp,
+		Username:        event.Username,
+		BotID:           event.BotID,
+		SubType:         event.SubType,
+	}
+}
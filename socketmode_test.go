@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+func TestMessageFromEvent(t *testing.T) {
+	message := messageFromEvent(&slackevents.MessageEvent{
+		Type:            "message",
+		Channel:         "C1",
+		User:            "U1",
+		Text:            "ABC-123",
+		TimeStamp:       "1355517523.000005",
+		ThreadTimeStamp: "1355517520.000001",
+		SubType:         "bot_message",
+	})
+
+	if message.Channel != "C1" || message.Timestamp != "1355517523.000005" || message.ThreadTimestamp != "1355517520.000001" {
+		t.Errorf("Unexpected message %v", message)
+	}
+
+	if !shouldIgnoreMessage(message) {
+		t.Errorf("Expected bot message to be ignored")
+	}
+}
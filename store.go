@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Kinds of state stores, see STATE_STORE
+const (
+	stateStoreFile   = "file"
+	stateStoreSQLite = "sqlite"
+	stateStoreRedis  = "redis"
+)
+
+// A place the bot keeps state in across restarts. Values are saved as JSON
+// under a key per kind of state, like "watches".
+type stateStore interface {
+	// Load reads the value saved under the key and reports whether there is
+	// one
+	Load(key string, value interface{}) (bool, error)
+	Save(key string, value interface{}) error
+	Delete(key string) error
+	Close() error
+}
+
+// A kind of state kept in the state store, which backups carry
+type stateKind struct {
+	key string
+	// load reads the state from the store again, like after a restore
+	load func()
+}
+
+// The kinds of state backed up, each added by the feature keeping it
+var stateKinds []stateKind
+
+// registerStateKind adds a kind of state to backups. Features call it from
+// init for every key they save state under.
+func registerStateKind(key string, load func()) {
+	stateKinds = append(stateKinds, stateKind{key: key, load: load})
+}
+
+// Stores opened so far, by their configuration
+var stateStores = struct {
+	sync.Mutex
+	opened map[string]stateStore
+}{opened: map[string]stateStore{}}
+
+// getStateStore returns the configured store. Without one, state is kept in
+// memory and lost on restart.
+func getStateStore() (stateStore, error) {
+	config := getConfig()
+
+	kind := config.StateStore
+	if kind == "" && config.DataDir != "" {
+		kind = stateStoreFile
+	}
+
+	location := config.DataDir
+	if kind == stateStoreRedis {
+		location = config.RedisURL
+	}
+
+	stateStores.Lock()
+	defer stateStores.Unlock()
+
+	id := kind + " " + location
+	if store, ok := stateStores.opened[id]; ok {
+		return store, nil
+	}
+
+	var store stateStore
+	var err error
+	switch kind {
+	case "":
+		store = newMemoryStore()
+	case stateStoreFile:
+		store = newFileStore(location)
+	case stateStoreSQLite:
+		store, err = openSQLiteStore(filepath.Join(location, "jira-bot.db"))
+	case stateStoreRedis:
+		store, err = openRedisStore(location)
+	default:
+		err = fmt.Errorf("unknown state store %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stateStores.opened[id] = store
+
+	return store, nil
+}
+
+// isStatePersistent reports whether state survives restarts
+func isStatePersistent() bool {
+	config := getConfig()
+
+	return config.StateStore != "" || config.DataDir != ""
+}
+
+// memoryStore keeps state until the bot stops
+type memoryStore struct {
+	sync.Mutex
+	values map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{values: map[string][]byte{}}
+}
+
+func (s *memoryStore) Load(key string, value interface{}) (bool, error) {
+	s.Lock()
+	data, ok := s.values[key]
+	s.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(data, value)
+}
+
+func (s *memoryStore) Save(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.values[key] = data
+	s.Unlock()
+
+	return nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	s.Lock()
+	delete(s.values, key)
+	s.Unlock()
+
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// fileStore keeps each key in a JSON file of its own in a directory
+type fileStore struct {
+	dir string
+}
+
+func newFileStore(dir string) *fileStore {
+	return &fileStore{dir: dir}
+}
+
+func (s *fileStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+func (s *fileStore) Load(key string, value interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("%s: %v", s.path(key), err)
+	}
+
+	return true, nil
+}
+
+func (s *fileStore) Save(key string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return err
+	}
+
+	// Written next to the file first, so a crash can't leave half of it
+	path := s.path(key)
+	if err := ioutil.WriteFile(path+".tmp", data, 0640); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func (s *fileStore) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
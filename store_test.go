@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testStateStore(t *testing.T, store stateStore) {
+	var value map[string]int
+	if ok, err := store.Load("missing", &value); ok || err != nil {
+		t.Fatalf("Expected no value for a missing key, got %v, %v", ok, err)
+	}
+
+	if err := store.Save("counts", map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if ok, err := store.Load("counts", &value); !ok || err != nil || value["a"] != 1 {
+		t.Fatalf("Expected the saved value, got %v, %v, %v", value, ok, err)
+	}
+
+	if err := store.Delete("counts"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if ok, _ := store.Load("counts", &value); ok {
+		t.Fatal("Expected no value after deleting it")
+	}
+	if err := store.Delete("counts"); err != nil {
+		t.Fatalf("Expected deleting a missing key to work, got %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStateStore(t, newMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "data")
+	defer os.RemoveAll(dir)
+
+	testStateStore(t, newFileStore(filepath.Join(dir, "state")))
+}
+
+func TestGetStateStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "data")
+	defer os.RemoveAll(dir)
+
+	if isStatePersistent() {
+		t.Fatal("Expected state to be lost on restarts without a store")
+	}
+
+	os.Setenv("DATA_DIR", dir)
+	defer os.Unsetenv("DATA_DIR")
+
+	store, err := getStateStore()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, ok := store.(*fileStore); !ok || !isStatePersistent() {
+		t.Fatalf("Expected a file store with DATA_DIR, got %T", store)
+	}
+	if again, _ := getStateStore(); again != store {
+		t.Fatal("Expected the store to be opened once")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// How long the Slack user list is reused for finding users by @name
+const targetUsersTTL = 10 * time.Minute
+
+// Notification targets already resolved to a Slack channel ID
+var resolvedTargets = struct {
+	sync.Mutex
+	channels map[string]string
+}{channels: map[string]string{}}
+
+// The Slack users @names are looked up in, as listing them takes a while in
+// large workspaces
+var targetUsers = struct {
+	sync.Mutex
+	users   []slack.User
+	fetched time.Time
+}{}
+
+// resolveNotificationTarget turns a configured notification target into a
+// channel ID to post to. Targets can be channel IDs, user emails or @names;
+// users are sent a direct message. A comma separated set of users shares a
+// group direct message.
+func resolveNotificationTarget(target string) (string, error) {
+	resolvedTargets.Lock()
+	channel, ok := resolvedTargets.channels[target]
+	resolvedTargets.Unlock()
+
+	if ok {
+		return channel, nil
+	}
+
+	// Asking Slack happens outside the lock, so a slow lookup doesn't hold
+	// up alerts to targets resolved before
+	channel, err := lookupNotificationTarget(target)
+	if err != nil {
+		return "", err
+	}
+
+	resolvedTargets.Lock()
+	resolvedTargets.channels[target] = channel
+	resolvedTargets.Unlock()
+
+	return channel, nil
+}
+
+func lookupNotificationTarget(target string) (string, error) {
+	if strings.Contains(target, ",") {
+		return openGroupTarget(parseList(target))
+	}
+
+	userID, err := lookupTargetUser(target)
+	if err != nil || userID == "" {
+		return target, err
+	}
+
+	im, _, _, err := getSlackAPI().OpenConversation(&slack.OpenConversationParameters{
+		Users: []string{userID},
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not open a direct message with %s: %v", target, err)
+	}
+
+	return im.ID, nil
+}
+
+// openGroupTarget opens the group direct message with a set of users. Slack
+// hands back the existing conversation if there already is one.
+func openGroupTarget(targets []string) (string, error) {
+	for _, target := range targets {
+		if !strings.Contains(target, "@") {
+			return "", fmt.Errorf("%s is not a user, group targets can only hold users", target)
+		}
+	}
+
+	userIDs := []string{}
+	for _, target := range targets {
+		userID, err := lookupTargetUser(target)
+		if err != nil {
+			return "", err
+		}
+
+		userIDs = append(userIDs, userID)
+	}
+
+	channel, _, _, err := getSlackAPI().OpenConversation(&slack.OpenConversationParameters{
+		Users: userIDs,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not open a group message with %s: %v", strings.Join(targets, ", "), err)
+	}
+
+	return channel.ID, nil
+}
+
+// lookupTargetUser returns the Slack user a target names, or an empty ID if
+// the target is a channel.
+func lookupTargetUser(target string) (string, error) {
+	api := getSlackAPI()
+
+	switch {
+	case strings.Contains(target, "@") && !strings.HasPrefix(target, "@"):
+		user, err := api.GetUserByEmail(target)
+		if err != nil {
+			return "", fmt.Errorf("no Slack user with email %s: %v", target, err)
+		}
+		return user.ID, nil
+
+	case strings.HasPrefix(target, "@"):
+		name := strings.TrimPrefix(target, "@")
+
+		users, err := getTargetUsers(time.Now())
+		if err != nil {
+			return "", fmt.Errorf("could not list Slack users to find %s: %v", target, err)
+		}
+		for _, user := range users {
+			if !user.Deleted && (user.Name == name || user.Profile.DisplayName == name) {
+				return user.ID, nil
+			}
+		}
+		return "", fmt.Errorf("no Slack user named %s", target)
+	}
+
+	return "", nil
+}
+
+// getTargetUsers lists the Slack users, reusing the list for a while
+func getTargetUsers(now time.Time) ([]slack.User, error) {
+	targetUsers.Lock()
+	users, fetched := targetUsers.users, targetUsers.fetched
+	targetUsers.Unlock()
+
+	if users != nil && now.Sub(fetched) < targetUsersTTL {
+		return users, nil
+	}
+
+	users, err := getSlackAPI().GetUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	targetUsers.Lock()
+	targetUsers.users, targetUsers.fetched = users, now
+	targetUsers.Unlock()
+
+	return users, nil
+}
+
+// getNotificationTargets lists the configured targets the bot posts to
+func getNotificationTargets(config BotConfig) []string {
+	targets := []string{}
+	if config.OpsChannel != "" {
+		targets = append(targets, config.OpsChannel)
+	}
+	for _, rule := range config.JiraWebhookRules {
+		if rule.Channel != "" {
+			targets = append(targets, rule.Channel)
+		}
+	}
+
+	return targets
+}
+
+// resolveNotificationTargets resolves every configured target at startup, so
+// typos show up right away instead of when the first alert is due.
+func resolveNotificationTargets() {
+	for _, target := range getNotificationTargets(getConfig()) {
+		if _, err := resolveNotificationTarget(target); err != nil {
+			log.Printf("resolveNotificationTargets: Error: %v", err)
+		}
+	}
+}
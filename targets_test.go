@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestResolveNotificationTargetKeepsChannelIDs(t *testing.T) {
+	channel, err := resolveNotificationTarget("C024BE91L")
+
+	if err != nil || channel != "C024BE91L" {
+		t.Errorf("Expected C024BE91L, got %v (%v)", channel, err)
+	}
+}
+
+func TestResolveNotificationTargetRejectsChannelsInGroups(t *testing.T) {
+	if _, err := resolveNotificationTarget("jane@example.com,C024BE91L"); err == nil {
+		t.Errorf("Expected an error for a channel in a group target")
+	}
+}
+
+func TestGetNotificationTargets(t *testing.T) {
+	config := BotConfig{
+		OpsChannel:       "@ops",
+		JiraWebhookRules: []WebhookRule{{Channel: "C024BE91L"}, {Channel: "jane@example.com"}},
+	}
+
+	targets := getNotificationTargets(config)
+	if len(targets) != 3 || targets[0] != "@ops" || targets[2] != "jane@example.com" {
+		t.Errorf("Expected the ops channel and every webhook channel, got %v", targets)
+	}
+}
+
+func TestGetTargetUsersReusesList(t *testing.T) {
+	defer func() { targetUsers.users = nil }()
+
+	now := time.Now()
+	targetUsers.users = []slack.User{{ID: "U1", Name: "jane"}}
+	targetUsers.fetched = now
+
+	if users, err := getTargetUsers(now.Add(time.Minute)); err != nil || len(users) != 1 || users[0].ID != "U1" {
+		t.Errorf("Expected the cached users, got %v (%v)", users, err)
+	}
+}
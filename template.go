@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Data the message template is executed with. The issue is embedded, so
+// templates can use {{.Key}} or {{.Fields.Summary}} directly.
+type issueTemplateData struct {
+	jiraIssue
+	URL       string
+	MobileURL string
+
+	// Every field of the issue, fetched when a template first needs one
+	fields map[string]interface{}
+}
+
+// Field returns any field of the issue by its ID, like
+// {{.Field "labels"}} or {{.Field "customfield_10016"}} for story points.
+func (d *issueTemplateData) Field(id string) (interface{}, error) {
+	if d.fields == nil {
+		var issue struct {
+			Fields map[string]interface{} `json:"fields"`
+		}
+		if err := getBot().jira.GetIssueFields(context.Background(), d.Key, "", &issue); err != nil {
+			return nil, err
+		}
+		d.fields = issue.Fields
+	}
+
+	return d.fields[id], nil
+}
+
+// Functions available to message templates
+var messageTemplateFuncs = template.FuncMap{
+	"displayName": getDisplayName,
+	"join":        joinTemplateValues,
+	"date": func(t time.Time) string {
+		return fmt.Sprintf("<!date^%d^{date} at {time}|%s>", t.Unix(), t.Format(time.RFC1123))
+	},
+}
+
+// Message templates by their source, parsed once
+var messageTemplates = struct {
+	sync.Mutex
+	parsed map[string]*template.Template
+}{parsed: map[string]*template.Template{}}
+
+func parseMessageTemplate(source string) (*template.Template, error) {
+	return template.New("message").Funcs(messageTemplateFuncs).Option("missingkey=zero").Parse(source)
+}
+
+// getMessageTemplate returns the parsed template, or nil if the source is
+// empty and issues use the default format
+func getMessageTemplate(source string) *template.Template {
+	if source == "" {
+		return nil
+	}
+
+	messageTemplates.Lock()
+	defer messageTemplates.Unlock()
+
+	if parsed, ok := messageTemplates.parsed[source]; ok {
+		return parsed
+	}
+
+	// validateConfig already rejected invalid templates at startup
+	parsed, err := parseMessageTemplate(source)
+	if err != nil {
+		return nil
+	}
+	messageTemplates.parsed[source] = parsed
+
+	return parsed
+}
+
+func formatTemplateMessage(tmpl *template.Template, issue jiraIssue) (string, error) {
+	var message bytes.Buffer
+
+	data := &issueTemplateData{jiraIssue: issue, URL: getJiraURL(issue.Key), MobileURL: getJiraMobileURL(issue.Key)}
+	if err := tmpl.Execute(&message, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(message.String()), nil
+}
+
+// joinTemplateValues joins lists like labels or components, whose items are
+// strings or objects with a name
+func joinTemplateValues(value interface{}, separator string) string {
+	switch list := value.(type) {
+	case []string:
+		return strings.Join(list, separator)
+	case []interface{}:
+		items := []string{}
+		for _, item := range list {
+			if object, ok := item.(map[string]interface{}); ok {
+				item = object["name"]
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, separator)
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprint(value)
+}
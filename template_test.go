@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestFormatTemplateMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/ABC-123" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"fields": {"labels": ["checkout", "p1"], "customfield_10016": 5, "components": [{"name": "Web"}]}}`)
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	issue := decodeIssue(t, `{
+		"key": "ABC-123",
+		"fields": {"summary": "Printer on fire", "status": {"name": "Open"}}
+	}`)
+
+	tmpl, err := parseMessageTemplate(
+		`<{{.URL}}|{{.Key}}> {{.Fields.Summary}} ({{displayName .Fields.Assignee}})` +
+			` {{.Field "customfield_10016"}} points, labels: {{join (.Field "labels") ", "}}, components: {{join (.Field "components") ", "}}`,
+	)
+	if err != nil {
+		t.Fatalf("Expected the template to parse, got %v", err)
+	}
+
+	message, err := formatTemplateMessage(tmpl, issue)
+	if err != nil {
+		t.Fatalf("Expected the template to render, got %v", err)
+	}
+
+	expected := "<" + server.URL + "/browse/ABC-123|ABC-123> Printer on fire (Unassigned) 5 points, labels: checkout, p1, components: Web"
+	if message != expected {
+		t.Errorf("Unexpected message %q", message)
+	}
+}
+
+func TestValidateConfigRejectsBrokenTemplates(t *testing.T) {
+	config := BotConfig{
+		SlackAPIKey:     "xoxb-1",
+		JiraBaseURL:     "https://example.atlassian.net",
+		ClickHouseTable: "jira_bot_events",
+		MessageTemplate: "{{.Key",
+	}
+
+	if problems := validateConfig(config); len(problems) != 1 {
+		t.Errorf("Expected the template to be rejected, got %v", problems)
+	}
+}
+
+func TestCardProfiles(t *testing.T) {
+	os.Setenv("CARD_PROFILES", "C1=formal, C2=Compact")
+	os.Setenv("MESSAGE_TEMPLATE", "{{.Key}}")
+	defer os.Unsetenv("CARD_PROFILES")
+	defer os.Unsetenv("MESSAGE_TEMPLATE")
+
+	issue := decodeIssue(t, `{
+		"key": "ABC-123",
+		"fields": {"summary": "Printer on fire", "status": {"name": "Open"}, "created": "2026-10-01T09:30:00.000+0000"}
+	}`)
+
+	for name, source := range cardProfiles {
+		tmpl, err := parseMessageTemplate(source)
+		if err != nil {
+			t.Fatalf("Expected the %s profile to parse, got %v", name, err)
+		}
+		if _, err := formatTemplateMessage(tmpl, issue); err != nil {
+			t.Errorf("Expected the %s profile to render, got %v", name, err)
+		}
+	}
+
+	for channel, expected := range map[string]string{"C1": cardProfiles["formal"], "C2": cardProfiles["compact"], "C3": "{{.Key}}"} {
+		if source := getCardTemplate(channel, cohortStable); source != expected {
+			t.Errorf("Expected the template of %s to be %q, got %q", channel, expected, source)
+		}
+	}
+
+	config := BotConfig{SlackAPIKey: "xoxb-1", JiraBaseURL: "https://example.atlassian.net", ClickHouseTable: "jira_bot_events", CardProfiles: map[string]string{"C1": "loud"}}
+	if problems := validateConfig(config); len(problems) != 1 {
+		t.Errorf("Expected the unknown profile to be rejected, got %v", problems)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Action ID of the transition buttons, followed by a dot and the transition
+// ID to keep them unique within their block
+const actionTransitionIssue = "transition_issue"
+
+// Action ID of the transition buttons offered during a change freeze, which
+// move the issue without asking again
+const actionConfirmTransition = "confirm_transition"
+
+// Slack allows this many elements in an actions block
+const maxTransitionButtons = 25
+
+// A workflow transition Jira offers for an issue
+type jiraTransition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	To   struct {
+		Name string `json:"name"`
+	} `json:"to"`
+}
+
+// getJiraTransitions lists the transitions the bot's Jira user may make on the
+// issue in its current status
+func getJiraTransitions(ctx context.Context, jira JiraService, issueKey string) ([]jiraTransition, error) {
+	return jira.GetTransitions(ctx, issueKey)
+}
+
+// transitionJiraIssue moves the issue through a transition by ID
+func transitionJiraIssue(ctx context.Context, jira JiraService, issueKey string, transitionID string) error {
+	if err := checkWritable(); err != nil {
+		return err
+	}
+	if transitionID == "" {
+		return fmt.Errorf("no transition picked for %s", issueKey)
+	}
+
+	err := jira.TransitionIssue(ctx, issueKey, transitionID)
+	if err == nil {
+		forgetCachedIssue(issueKey)
+	}
+
+	return err
+}
+
+// findJiraTransition picks a transition by its name or the status it leads
+// to, ignoring case
+func findJiraTransition(transitions []jiraTransition, name string) *jiraTransition {
+	for i := range transitions {
+		if strings.EqualFold(transitions[i].Name, name) {
+			return &transitions[i]
+		}
+	}
+	for i := range transitions {
+		if strings.EqualFold(transitions[i].To.Name, name) {
+			return &transitions[i]
+		}
+	}
+
+	return nil
+}
+
+// handleTransitionCommand answers `@JiraBot transition ABC-123 "In Review"`
+// by moving the issue, or with buttons for the transitions it allows if no
+// status or an unknown one is given
+func handleTransitionCommand(ctx context.Context, message slack.Msg, args []string) {
+	thread := getReplyThread(message)
+
+	issueIDs := extractIssueIDs(strings.Join(args, " "))
+	if len(args) == 0 || len(issueIDs) != 1 || !strings.EqualFold(args[0], issueIDs[0]) {
+		if err := postText(message.Channel, thread, "Usage: `transition ABC-123 \"In Review\"`"); err != nil {
+			log.Printf("handleTransitionCommand: Error: %v", err)
+		}
+		return
+	}
+	issueKey := issueIDs[0]
+	name := strings.Trim(strings.Join(args[1:], " "), "\"“”' ")
+
+	if err := checkWritable(); err != nil {
+		postEphemeral(message.Channel, message.User, describeCardActionError(err, issueKey))
+		return
+	}
+	if err := checkUserAccess(message.User); err != nil {
+		postEphemeral(message.Channel, message.User, describeCardActionError(err, issueKey))
+		return
+	}
+
+	jira, err := getJiraServiceFor(message.Channel, message.User)
+	if err != nil {
+		reportError(message, issueKey, err, false)
+		return
+	}
+
+	transitions, err := getJiraTransitions(ctx, jira, issueKey)
+	if err != nil {
+		reportError(message, issueKey, err, false)
+		return
+	}
+
+	// During a change freeze the user confirms the transition with a button
+	project := getProjectKey(issueKey)
+	freeze := activeFreeze(getFreezes(project), project, time.Now())
+
+	transition := findJiraTransition(transitions, name)
+	if name != "" && transition != nil && freeze == nil {
+		if err := transitionJiraIssue(ctx, jira, issueKey, transition.ID); err != nil {
+			reportError(message, issueKey, err, false)
+			return
+		}
+
+		recordTransition(message.Channel, message.User, issueKey, transition.To.Name)
+		if err := postText(message.Channel, thread, formatTransitionConfirmation(message.User, issueKey, transition.To.Name)); err != nil {
+			log.Printf("handleTransitionCommand: Error: %v", err)
+		}
+		return
+	}
+
+	text := fmt.Sprintf("Where should %s go?", issueKey)
+	if name != "" {
+		text = fmt.Sprintf("%s can't go to %q from here. Where should it go?", issueKey, name)
+	}
+	if len(transitions) == 0 {
+		text = fmt.Sprintf("%s can't move anywhere from here.", issueKey)
+	}
+	if freeze != nil && len(transitions) > 0 {
+		text = formatFreezeWarning(issueKey, *freeze) + " " + text
+		if name != "" && transition != nil {
+			text = formatFreezeWarning(issueKey, *freeze) + fmt.Sprintf(" Move %s to *%s* anyway?", issueKey, transition.To.Name)
+			transitions = []jiraTransition{*transition}
+		}
+	}
+
+	if err := postBlocks(message.Channel, thread, text, formatTransitionBlocks(text, issueKey, transitions, freeze != nil)); err != nil {
+		log.Printf("handleTransitionCommand: Error: %v", err)
+	}
+}
+
+// formatTransitionBlocks offers a button per transition. Buttons offered
+// during a change freeze are the confirmation to move the issue anyway.
+func formatTransitionBlocks(text string, issueKey string, transitions []jiraTransition, frozen bool) []slack.Block {
+	blocks := []slack.Block{slack.NewSectionBlock(newMarkdownText(text), nil, nil)}
+
+	buttons := []slack.BlockElement{}
+	for i, transition := range transitions {
+		if i == maxTransitionButtons {
+			break
+		}
+
+		label := transition.To.Name
+		if !strings.EqualFold(transition.Name, transition.To.Name) {
+			label = transition.Name + " → " + transition.To.Name
+		}
+
+		button := slack.NewButtonBlockElement(
+			actionTransitionIssue+"."+transition.ID,
+			strings.Join([]string{issueKey, transition.ID, transition.To.Name}, " "),
+			newPlainText(truncateText(label, 75)),
+		)
+		if frozen {
+			button.ActionID = actionConfirmTransition + "." + transition.ID
+			button = button.WithStyle(slack.StyleDanger)
+		}
+		buttons = append(buttons, button)
+	}
+	if len(buttons) > 0 {
+		blocks = append(blocks, slack.NewActionBlock("", buttons...))
+	}
+
+	return blocks
+}
+
+// handleTransitionButton moves the issue through the transition a user
+// picked and turns the buttons into the confirmation. During a change freeze
+// the buttons ask the user to confirm first.
+func handleTransitionButton(callback slack.InteractionCallback, action *slack.BlockAction) {
+	fields := strings.SplitN(action.Value, " ", 3)
+	if len(fields) != 3 {
+		log.Printf("handleTransitionButton: Unexpected value %q", action.Value)
+		return
+	}
+	issueKey, transitionID, status := fields[0], fields[1], fields[2]
+
+	if err := checkUserAccess(callback.User.ID); err != nil {
+		replyToCardAction(callback, issueKey, err, "", false)
+		return
+	}
+
+	project := getProjectKey(issueKey)
+	freeze := activeFreeze(getFreezes(project), project, time.Now())
+	if freeze != nil && !strings.HasPrefix(action.ActionID, actionConfirmTransition+".") {
+		transition := jiraTransition{ID: transitionID}
+		transition.To.Name = status
+
+		text := formatFreezeWarning(issueKey, *freeze) + fmt.Sprintf(" Move %s to *%s* anyway?", issueKey, status)
+		if _, _, _, err := getSlackAPIFor(callback.Channel.ID).UpdateMessage(
+			callback.Channel.ID,
+			callback.Message.Timestamp,
+			slack.MsgOptionText(text, false),
+			slack.MsgOptionBlocks(formatTransitionBlocks(text, issueKey, []jiraTransition{transition}, true)...),
+		); err != nil {
+			log.Printf("handleTransitionButton: Error: %v", err)
+		}
+		return
+	}
+
+	jira, err := getJiraServiceFor(callback.Channel.ID, callback.User.ID)
+	if err == nil {
+		err = transitionJiraIssue(context.Background(), jira, issueKey, transitionID)
+	}
+	if err != nil {
+		replyToCardAction(callback, issueKey, err, "", false)
+		return
+	}
+
+	recordTransition(callback.Channel.ID, callback.User.ID, issueKey, status)
+
+	text := formatTransitionConfirmation(callback.User.ID, issueKey, status)
+	if _, _, _, err := getSlackAPIFor(callback.Channel.ID).UpdateMessage(
+		callback.Channel.ID,
+		callback.Message.Timestamp,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(),
+	); err != nil {
+		log.Printf("handleTransitionButton: Error: %v", err)
+	}
+}
+
+// formatFreezeWarning tells that the issue's project is in a change freeze
+func formatFreezeWarning(issueKey string, freeze FreezeWindow) string {
+	return fmt.Sprintf(":no_entry: *Change freeze* in effect for %s until %s.", getProjectKey(issueKey), freeze.End.Format(freezeDateLayout))
+}
+
+func formatTransitionConfirmation(user string, issueKey string, status string) string {
+	return fmt.Sprintf(":arrow_right: <@%s> moved <%s|%s> to *%s*.", user, getJiraURL(issueKey), issueKey, status)
+}
+
+func recordTransition(channel string, user string, issueKey string, status string) {
+	log.Printf("recordTransition: %s moved %s to %s", user, issueKey, status)
+	recordEvent("transition", map[string]interface{}{
+		"channel": channel,
+		"user":    user,
+		"issue":   issueKey,
+		"status":  status,
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func newTestTransition(id string, name string, status string) jiraTransition {
+	transition := jiraTransition{ID: id, Name: name}
+	transition.To.Name = status
+
+	return transition
+}
+
+func TestFindJiraTransition(t *testing.T) {
+	transitions := []jiraTransition{
+		newTestTransition("11", "Start progress", "In Progress"),
+		newTestTransition("21", "Review", "In Review"),
+	}
+
+	if transition := findJiraTransition(transitions, "in review"); transition == nil || transition.ID != "21" {
+		t.Errorf("Expected to find the transition by status, got %v", transition)
+	}
+	if transition := findJiraTransition(transitions, "Start Progress"); transition == nil || transition.ID != "11" {
+		t.Errorf("Expected to find the transition by name, got %v", transition)
+	}
+	if transition := findJiraTransition(transitions, "Done"); transition != nil {
+		t.Errorf("Expected no transition, got %v", transition)
+	}
+}
+
+func TestFormatTransitionBlocks(t *testing.T) {
+	transitions := []jiraTransition{
+		newTestTransition("11", "Start progress", "In Progress"),
+		newTestTransition("31", "Done", "Done"),
+	}
+
+	blocks := formatTransitionBlocks("Where should ABC-1 go?", "ABC-1", transitions, false)
+	if len(blocks) != 2 {
+		t.Fatalf("Expected a section and buttons, got %d blocks", len(blocks))
+	}
+
+	buttons := blocks[1].(*slack.ActionBlock).Elements.ElementSet
+	first := buttons[0].(*slack.ButtonBlockElement)
+	if first.ActionID != "transition_issue.11" || first.Value != "ABC-1 11 In Progress" || first.Text.Text != "Start progress → In Progress" {
+		t.Errorf("Unexpected button %+v", first)
+	}
+	if second := buttons[1].(*slack.ButtonBlockElement); second.Text.Text != "Done" {
+		t.Errorf("Expected transitions named after their status to show once, got %q", second.Text.Text)
+	}
+}
+
+func TestFormatTransitionBlocksDuringFreeze(t *testing.T) {
+	transitions := []jiraTransition{newTestTransition("31", "Done", "Done")}
+
+	blocks := formatTransitionBlocks("Move ABC-1 anyway?", "ABC-1", transitions, true)
+
+	button := blocks[1].(*slack.ActionBlock).Elements.ElementSet[0].(*slack.ButtonBlockElement)
+	if button.ActionID != "confirm_transition.31" || button.Style != slack.StyleDanger {
+		t.Errorf("Expected a button confirming the transition, got %+v", button)
+	}
+}
+
+func TestFormatFreezeWarning(t *testing.T) {
+	freezes, _ := parseFreezes("2026-12-20..2027-01-03=ABC")
+	freeze := freezes[0]
+
+	expected := ":no_entry: *Change freeze* in effect for ABC until 2027-01-03."
+	if text := formatFreezeWarning("ABC-1", freeze); text != expected {
+		t.Errorf("Expected %q, got %q", expected, text)
+	}
+}
+
+func TestTransitionJiraIssue(t *testing.T) {
+	var body struct {
+		Transition struct {
+			ID string `json:"id"`
+		} `json:"transition"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/rest/api/2/issue/ABC-1/transitions" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	os.Setenv("JIRA_DEPLOYMENT", "server")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("JIRA_DEPLOYMENT")
+
+	if err := transitionJiraIssue(context.Background(), newRESTJiraService(), "ABC-1", "21"); err != nil || body.Transition.ID != "21" {
+		t.Errorf("Expected transition 21, got %q and %v", body.Transition.ID, err)
+	}
+
+	os.Setenv("READ_ONLY", "true")
+	defer os.Unsetenv("READ_ONLY")
+
+	if err := transitionJiraIssue(context.Background(), newRESTJiraService(), "ABC-1", "21"); err != errReadOnly {
+		t.Errorf("Expected read-only mode to block the transition, got %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Translation providers
+const (
+	translationProviderDeepL  = "deepl"
+	translationProviderGoogle = "google"
+)
+
+// Action ID of the button showing the untranslated issue
+const actionShowOriginal = "show_original"
+
+// Marks cards without a button to show the original, like those of templates
+const translatedNote = "\n> _(machine translated)_"
+
+// Longest description sent for translation, as cards only show the start
+const maxTranslatedDescriptionLength = 1000
+
+// Most translations kept before the cache starts over
+const maxCachedTranslations = 1000
+
+var translationHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Translator translates texts into a language, given as a code like "de".
+// Texts already in the language come back as they are.
+type Translator interface {
+	Translate(ctx context.Context, texts []string, language string) ([]string, error)
+}
+
+// Translations by language and text, so a card mentioned again doesn't cost
+// another request
+var translations = struct {
+	sync.Mutex
+	cached map[string]string
+}{cached: map[string]string{}}
+
+// getChannelLanguage returns the language cards in a channel are translated
+// into, or "" to leave them as they are
+func getChannelLanguage(channel string) string {
+	config := getConfig()
+	if config.TranslationProvider == "" {
+		return ""
+	}
+
+	return config.ChannelLanguages[channel]
+}
+
+// newTranslator returns the configured provider, or nil without one
+func newTranslator(config BotConfig) Translator {
+	switch config.TranslationProvider {
+	case translationProviderDeepL:
+		baseURL := "https://api.deepl.com"
+		// Keys of DeepL's free plan only work with the free API
+		if strings.HasSuffix(config.TranslationAPIKey, ":fx") {
+			baseURL = "https://api-free.deepl.com"
+		}
+		return &deepLTranslator{baseURL: baseURL, apiKey: config.TranslationAPIKey}
+	case translationProviderGoogle:
+		return &googleTranslator{baseURL: "https://translation.googleapis.com", apiKey: config.TranslationAPIKey}
+	}
+
+	// A nil *deepLTranslator would make a non-nil Translator
+	return nil
+}
+
+// translateIssue returns the issue with its summary and description in the
+// channel's language, and whether anything was translated. The cached issue
+// is left alone. Without a translation the issue comes back unchanged.
+func translateIssue(channel string, issue jiraIssue) (jiraIssue, bool) {
+	translator := getBot().translator
+	language := getChannelLanguage(channel)
+	if language == "" || translator == nil || issue.Fields == nil {
+		return issue, false
+	}
+
+	texts := []string{issue.Fields.Summary, truncateText(string(issue.Fields.Description), maxTranslatedDescriptionLength)}
+	translated, err := translateTexts(translator, texts, language)
+	if err != nil {
+		log.Printf("translateIssue: Error translating %s: %v", issue.Key, err)
+		return issue, false
+	}
+	if translated[0] == texts[0] && translated[1] == texts[1] {
+		return issue, false
+	}
+
+	fields := *issue.Fields
+	fields.Summary = translated[0]
+	fields.Description = jiraText(translated[1])
+	issue.Fields = &fields
+
+	return issue, true
+}
+
+// translateTexts translates the texts not translated before, leaving empty
+// ones out
+func translateTexts(translator Translator, texts []string, language string) ([]string, error) {
+	result := make([]string, len(texts))
+	missing := []string{}
+
+	translations.Lock()
+	for i, text := range texts {
+		translated, ok := translations.cached[language+"\x00"+text]
+		if text == "" {
+			translated, ok = "", true
+		}
+		result[i] = translated
+		if !ok {
+			missing = append(missing, text)
+		}
+	}
+	translations.Unlock()
+
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), translationHTTPClient.Timeout)
+	defer cancel()
+	translated, err := translator.Translate(ctx, missing, language)
+	if err != nil {
+		return nil, err
+	}
+	if len(translated) != len(missing) {
+		return nil, fmt.Errorf("got %d translations for %d texts", len(translated), len(missing))
+	}
+
+	translations.Lock()
+	defer translations.Unlock()
+	if len(translations.cached)+len(missing) > maxCachedTranslations {
+		translations.cached = map[string]string{}
+	}
+	for i, text := range missing {
+		translations.cached[language+"\x00"+text] = translated[i]
+	}
+	for i, text := range texts {
+		if text != "" {
+			result[i] = translations.cached[language+"\x00"+text]
+		}
+	}
+
+	return result, nil
+}
+
+// newShowOriginalButton offers the untranslated issue on a translated card
+func newShowOriginalButton(issueKey string) *slack.ButtonBlockElement {
+	return slack.NewButtonBlockElement(actionShowOriginal, issueKey, newPlainText("Show original"))
+}
+
+// addShowOriginalButton adds the button to the card's actions
+func addShowOriginalButton(blocks []slack.Block, issueKey string) []slack.Block {
+	for _, block := range blocks {
+		if actions, ok := block.(*slack.ActionBlock); ok && actions.Elements != nil {
+			actions.Elements.ElementSet = append(actions.Elements.ElementSet, newShowOriginalButton(issueKey))
+			return blocks
+		}
+	}
+
+	return append(blocks, slack.NewActionBlock("", newShowOriginalButton(issueKey)))
+}
+
+// handleShowOriginal shows whoever clicked the untranslated summary and
+// description of the issue
+func handleShowOriginal(callback slack.InteractionCallback, action *slack.BlockAction) {
+	issueKey := action.Value
+
+	issue, err := fetchJiraIssueFor(context.Background(), callback.Channel.ID, callback.User.ID, issueKey)
+	if err != nil {
+		log.Printf("handleShowOriginal: Error: %v", err)
+		if err := postEphemeral(callback.Channel.ID, callback.User.ID, describeCardActionError(err, issueKey)); err != nil {
+			log.Printf("handleShowOriginal: Error: %v", err)
+		}
+		return
+	}
+
+	text := fmt.Sprintf("*<%s|%s>* %s", getJiraURL(issue.Key), issue.Key, issue.Fields.Summary)
+	if description := strings.TrimSpace(string(issue.Fields.Description)); description != "" {
+		text += "\n" + truncateText(description, maxTranslatedDescriptionLength)
+	}
+
+	if err := postEphemeral(callback.Channel.ID, callback.User.ID, text); err != nil {
+		log.Printf("handleShowOriginal: Error: %v", err)
+	}
+}
+
+// parseChannelLanguages reads languages in the form "C123=de,C456=fr"
+func parseChannelLanguages(value string) map[string]string {
+	languages := map[string]string{}
+
+	for _, entry := range parseList(value) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			log.Printf("parseChannelLanguages: Ignoring %q without a language", entry)
+			continue
+		}
+
+		languages[strings.TrimSpace(parts[0])] = strings.ToLower(strings.TrimSpace(parts[1]))
+	}
+
+	return languages
+}
+
+// deepLTranslator translates with the DeepL API
+type deepLTranslator struct {
+	baseURL string
+	apiKey  string
+}
+
+func (t *deepLTranslator) Translate(ctx context.Context, texts []string, language string) ([]string, error) {
+	form := url.Values{"target_lang": {strings.ToUpper(language)}, "text": texts}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", t.baseURL+"/v2/translate", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "DeepL-Auth-Key "+t.apiKey)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response struct {
+		Translations []struct {
+			DetectedSourceLanguage string `json:"detected_source_language"`
+			Text                   string `json:"text"`
+		} `json:"translations"`
+	}
+	if err := doTranslationRequest(request, &response); err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for i, translation := range response.Translations {
+		text := translation.Text
+		if strings.EqualFold(translation.DetectedSourceLanguage, language) && i < len(texts) {
+			text = texts[i]
+		}
+		result = append(result, text)
+	}
+
+	return result, nil
+}
+
+// googleTranslator translates with the Google Cloud Translation API
+type googleTranslator struct {
+	baseURL string
+	apiKey  string
+}
+
+func (t *googleTranslator) Translate(ctx context.Context, texts []string, language string) ([]string, error) {
+	body, err := json.Marshal(map[string]interface{}{"q": texts, "target": language, "format": "text"})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", t.baseURL+"/language/translate/v2?key="+url.QueryEscape(t.apiKey), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	var response struct {
+		Data struct {
+			Translations []struct {
+				DetectedSourceLanguage string `json:"detectedSourceLanguage"`
+				TranslatedText         string `json:"translatedText"`
+			} `json:"translations"`
+		} `json:"data"`
+	}
+	if err := doTranslationRequest(request, &response); err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for i, translation := range response.Data.Translations {
+		text := translation.TranslatedText
+		if strings.EqualFold(translation.DetectedSourceLanguage, language) && i < len(texts) {
+			text = texts[i]
+		}
+		result = append(result, text)
+	}
+
+	return result, nil
+}
+
+func doTranslationRequest(request *http.Request, result interface{}) error {
+	response, err := translationHTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("translation failed with status %d", response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// Translates by shouting, and counts the texts it was asked for
+type shoutingTranslator struct {
+	texts int
+}
+
+func (t *shoutingTranslator) Translate(ctx context.Context, texts []string, language string) ([]string, error) {
+	t.texts += len(texts)
+
+	result := []string{}
+	for _, text := range texts {
+		result = append(result, strings.ToUpper(text))
+	}
+
+	return result, nil
+}
+
+func TestTranslateIssue(t *testing.T) {
+	os.Setenv("TRANSLATION_PROVIDER", "deepl")
+	os.Setenv("CHANNEL_LANGUAGES", "C1=de")
+	defer os.Unsetenv("TRANSLATION_PROVIDER")
+	defer os.Unsetenv("CHANNEL_LANGUAGES")
+
+	translator := &shoutingTranslator{}
+	setBot(&jiraBot{translator: translator})
+	defer setBot(nil)
+
+	issue := decodeIssue(t, `{
+		"key": "ABC-123",
+		"fields": {"summary": "Printer on fire", "description": "Smoke everywhere", "status": {"name": "Open"}}
+	}`)
+
+	translated, ok := translateIssue("C1", issue)
+	if !ok || translated.Fields.Summary != "PRINTER ON FIRE" || translated.Fields.Description != "SMOKE EVERYWHERE" {
+		t.Errorf("Expected the summary and description to be translated, got %+v", translated.Fields)
+	}
+	if issue.Fields.Summary != "Printer on fire" {
+		t.Error("Expected the original issue to be left alone")
+	}
+
+	translateIssue("C1", issue)
+	if translator.texts != 2 {
+		t.Errorf("Expected translations to be reused, translated %d texts", translator.texts)
+	}
+
+	if _, ok := translateIssue("C2", issue); ok {
+		t.Error("Expected channels without a language to be left alone")
+	}
+
+	blocks := addShowOriginalButton(formatMessageBlocks(translated, "ABC-123"), "ABC-123")
+	actions := blocks[len(blocks)-1].(*slack.ActionBlock)
+	if button, ok := actions.Elements.ElementSet[len(actions.Elements.ElementSet)-1].(*slack.ButtonBlockElement); !ok || button.ActionID != actionShowOriginal {
+		t.Error("Expected the card to offer the original")
+	}
+}
+
+func TestDeepLTranslator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "DeepL-Auth-Key key:fx" || r.FormValue("target_lang") != "DE" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"translations": [{"detected_source_language": "EN", "text": "Drucker brennt"}, {"detected_source_language": "DE", "text": "Rauch überall"}]}`))
+	}))
+	defer server.Close()
+
+	translator := &deepLTranslator{baseURL: server.URL, apiKey: "key:fx"}
+	result, err := translator.Translate(context.Background(), []string{"Printer on fire", "Rauch überall"}, "de")
+	if err != nil || len(result) != 2 || result[0] != "Drucker brennt" || result[1] != "Rauch überall" {
+		t.Errorf("Expected the translations, got %v, %v", result, err)
+	}
+}
+
+func TestGoogleTranslator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Q      []string `json:"q"`
+			Target string   `json:"target"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Query().Get("key") != "key" || body.Target != "fr" || len(body.Q) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data": {"translations": [{"detectedSourceLanguage": "en", "translatedText": "Imprimante en feu"}]}}`))
+	}))
+	defer server.Close()
+
+	translator := &googleTranslator{baseURL: server.URL, apiKey: "key"}
+	result, err := translator.Translate(context.Background(), []string{"Printer on fire"}, "fr")
+	if err != nil || len(result) != 1 || result[0] != "Imprimante en feu" {
+		t.Errorf("Expected the translation, got %v, %v", result, err)
+	}
+
+	translator.apiKey = "wrong"
+	if _, err := translator.Translate(context.Background(), []string{"Printer on fire"}, "fr"); err == nil {
+		t.Error("Expected a rejected request to fail")
+	}
+}
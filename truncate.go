@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+// Longest text posted in one message. Slack truncates text after 40000
+// characters and recommends staying below 4000.
+const maxMessageLength = 4000
+
+// Slack rejects section fields and header texts longer than these
+const (
+	maxBlockFieldLength = 2000
+	maxHeaderTextLength = 150
+)
+
+// truncateText shortens text to at most limit characters, marking the cut. A
+// limit below one leaves nothing.
+func truncateText(text string, limit int) string {
+	if limit < 1 {
+		return ""
+	}
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+
+	runes := []rune(text)
+
+	return string(runes[:limit-1]) + "…"
+}
+
+// truncateBlocks shortens the texts of the blocks to what Slack accepts, in
+// place, as issue summaries and descriptions can be of any length
+func truncateBlocks(blocks []slack.Block) []slack.Block {
+	for _, block := range blocks {
+		switch block := block.(type) {
+		case *slack.SectionBlock:
+			truncateTextObject(block.Text, maxBlockTextLength)
+			for _, field := range block.Fields {
+				truncateTextObject(field, maxBlockFieldLength)
+			}
+		case *slack.ContextBlock:
+			for _, element := range block.ContextElements.Elements {
+				if text, ok := element.(*slack.TextBlockObject); ok {
+					truncateTextObject(text, maxBlockTextLength)
+				}
+			}
+		case *slack.HeaderBlock:
+			truncateTextObject(block.Text, maxHeaderTextLength)
+		}
+	}
+
+	return blocks
+}
+
+func truncateTextObject(text *slack.TextBlockObject, limit int) {
+	if text != nil {
+		text.Text = truncateText(text.Text, limit)
+	}
+}
+
+// splitMessage breaks text into parts of at most limit characters, cutting
+// between lines where possible. Lines that don't fit on their own are
+// truncated.
+func splitMessage(text string, limit int) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+
+	parts := []string{}
+	current := ""
+
+	for _, line := range strings.Split(text, "\n") {
+		line = truncateText(line, limit)
+
+		if current != "" && utf8.RuneCountInString(current)+1+utf8.RuneCountInString(line) > limit {
+			parts = append(parts, current)
+			current = ""
+		}
+
+		if current == "" {
+			current = line
+		} else {
+			current += "\n" + line
+		}
+	}
+
+	return append(parts, current)
+}
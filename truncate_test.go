@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+func TestTruncateText(t *testing.T) {
+	if result := truncateText("short", 10); result != "short" {
+		t.Errorf("Expected short text to be kept, got %v", result)
+	}
+
+	if result := truncateText("äöüäöüäöü", 5); result != "äöüä…" {
+		t.Errorf("Expected äöüä…, got %v", result)
+	}
+
+	for _, limit := range []int{0, -1} {
+		if result := truncateText("text", limit); result != "" {
+			t.Errorf("Expected nothing with limit %d, got %v", limit, result)
+		}
+	}
+	if result := truncateText("text", 1); result != "…" {
+		t.Errorf("Expected …, got %v", result)
+	}
+}
+
+func TestTruncateBlocks(t *testing.T) {
+	long := strings.Repeat("a", 5000)
+	blocks := truncateBlocks([]slack.Block{
+		slack.NewSectionBlock(newMarkdownText(long), []*slack.TextBlockObject{newMarkdownText(long)}, nil),
+		slack.NewContextBlock("", newMarkdownText(long)),
+		slack.NewHeaderBlock(newPlainText(long)),
+	})
+
+	section := blocks[0].(*slack.SectionBlock)
+	if length := utf8.RuneCountInString(section.Text.Text); length != maxBlockTextLength {
+		t.Errorf("Expected the section text cut to %d, got %d", maxBlockTextLength, length)
+	}
+	if length := utf8.RuneCountInString(section.Fields[0].Text); length != maxBlockFieldLength {
+		t.Errorf("Expected the field cut to %d, got %d", maxBlockFieldLength, length)
+	}
+	if length := utf8.RuneCountInString(blocks[1].(*slack.ContextBlock).ContextElements.Elements[0].(*slack.TextBlockObject).Text); length != maxBlockTextLength {
+		t.Errorf("Expected the context text cut to %d, got %d", maxBlockTextLength, length)
+	}
+	if length := utf8.RuneCountInString(blocks[2].(*slack.HeaderBlock).Text.Text); length != maxHeaderTextLength {
+		t.Errorf("Expected the header cut to %d, got %d", maxHeaderTextLength, length)
+	}
+}
+
+func TestSplitMessageAtLines(t *testing.T) {
+	result := splitMessage("aaaa\nbbbb\ncccc", 9)
+
+	if !reflect.DeepEqual(result, []string{"aaaa\nbbbb", "cccc"}) {
+		t.Errorf("Unexpected parts %#v", result)
+	}
+}
+
+func TestSplitMessageTruncatesLongLines(t *testing.T) {
+	result := splitMessage("a\n"+strings.Repeat("b", 20), 10)
+
+	if !reflect.DeepEqual(result, []string{"a", "bbbbbbbbb…"}) {
+		t.Errorf("Unexpected parts %#v", result)
+	}
+}
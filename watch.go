@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Issues a channel can follow at most
+const maxWatchesPerChannel = 100
+
+const watchUsage = "Usage: `watch ABC-123` posts here when the issue's status, assignee or resolution changes, " +
+	"`unwatch ABC-123` stops that and `watch` alone lists the issues this channel follows."
+
+// What a watch compares to notice changes
+type watchedState struct {
+	Status     string `json:"status"`
+	Assignee   string `json:"assignee"`
+	Resolution string `json:"resolution"`
+}
+
+// The channels following an issue and how they last saw it
+type issueWatch struct {
+	Channels []string     `json:"channels"`
+	State    watchedState `json:"state"`
+}
+
+// Issues followed by channels, by issue key. They are saved in the state
+// store so they survive restarts.
+var watches = struct {
+	sync.Mutex
+	issues map[string]*issueWatch
+}{issues: map[string]*issueWatch{}}
+
+// The fields of an issue a watch needs
+type watchedIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary string `json:"summary"`
+		Status  struct {
+			Name string `json:"name"`
+		} `json:"status"`
+		Assignee *struct {
+			DisplayName string `json:"displayName"`
+		} `json:"assignee"`
+		Resolution *struct {
+			Name string `json:"name"`
+		} `json:"resolution"`
+	} `json:"fields"`
+}
+
+func (issue watchedIssue) state() watchedState {
+	state := watchedState{Status: issue.Fields.Status.Name, Assignee: "Unassigned", Resolution: "Unresolved"}
+	if issue.Fields.Assignee != nil {
+		state.Assignee = issue.Fields.Assignee.DisplayName
+	}
+	if issue.Fields.Resolution != nil {
+		state.Resolution = issue.Fields.Resolution.Name
+	}
+
+	return state
+}
+
+func fetchWatchedIssue(ctx context.Context, issueKey string) (watchedIssue, error) {
+	var issue watchedIssue
+	err := getBot().jira.GetIssueFields(ctx, issueKey, "summary,status,assignee,resolution", &issue)
+
+	return issue, err
+}
+
+// handleWatchCommand subscribes the channel to "@JiraBot watch ABC-123" or
+// lists its subscriptions
+func handleWatchCommand(ctx context.Context, message slack.Msg, args []string) {
+	thread := getReplyThread(message)
+	reply := func(text string) {
+		if err := postText(message.Channel, thread, text); err != nil {
+			log.Printf("handleWatchCommand: Error: %v", err)
+		}
+	}
+
+	issueIDs := extractIssueIDs(strings.Join(args, " "))
+	if len(args) == 0 {
+		reply(formatChannelWatches(message.Channel))
+		return
+	}
+	if len(issueIDs) == 0 {
+		reply(watchUsage)
+		return
+	}
+
+	if err := checkUserAccess(message.User); err != nil {
+		postEphemeral(message.Channel, message.User, describeCardActionError(err, issueIDs[0]))
+		return
+	}
+
+	watched := []string{}
+	for _, issueID := range issueIDs {
+		// The channel only hears about issues the user may see
+		if _, err := fetchJiraIssueFor(ctx, message.Channel, message.User, issueID); err != nil {
+			reportError(message, issueID, err, false)
+			continue
+		}
+
+		issue, err := fetchWatchedIssue(ctx, issueID)
+		if err != nil {
+			reportError(message, issueID, err, false)
+			continue
+		}
+
+		if err := addWatch(issue.Key, message.Channel, issue.state()); err != nil {
+			reply(":warning: " + err.Error())
+			break
+		}
+		watched = append(watched, issue.Key)
+	}
+
+	if len(watched) == 0 {
+		return
+	}
+
+	recordEvent("watch", map[string]interface{}{
+		"channel": message.Channel,
+		"user":    message.User,
+		"issues":  watched,
+	})
+	reply(fmt.Sprintf(":eyes: This channel follows %s now. I'll post here when the status, assignee or resolution changes.", strings.Join(watched, ", ")))
+}
+
+// handleUnwatchCommand ends the channel's subscription to issues
+func handleUnwatchCommand(ctx context.Context, message slack.Msg, args []string) {
+	thread := getReplyThread(message)
+
+	issueIDs := extractIssueIDs(strings.Join(args, " "))
+	if len(issueIDs) == 0 {
+		if err := postText(message.Channel, thread, watchUsage); err != nil {
+			log.Printf("handleUnwatchCommand: Error: %v", err)
+		}
+		return
+	}
+
+	removed := []string{}
+	for _, issueID := range issueIDs {
+		if removeWatch(resolveIssueAlias(issueID), message.Channel) {
+			removed = append(removed, issueID)
+		}
+	}
+
+	text := "This channel doesn't follow " + strings.Join(issueIDs, ", ") + "."
+	if len(removed) > 0 {
+		recordEvent("watch", map[string]interface{}{
+			"channel":   message.Channel,
+			"user":      message.User,
+			"issues":    removed,
+			"unwatched": true,
+		})
+		text = ":no_bell: This channel stopped following " + strings.Join(removed, ", ") + "."
+	}
+
+	if err := postText(message.Channel, thread, text); err != nil {
+		log.Printf("handleUnwatchCommand: Error: %v", err)
+	}
+}
+
+// addWatch subscribes a channel to an issue, remembering the issue as it is
+// now if the channel is the first to follow it
+func addWatch(issueKey string, channel string, state watchedState) error {
+	defer lockSharedState(watchesStateKey)()
+	watches.Lock()
+	defer watches.Unlock()
+	refreshSharedWatches()
+
+	count := 0
+	for _, watch := range watches.issues {
+		if containsString(watch.Channels, channel) {
+			count++
+		}
+	}
+
+	watch, ok := watches.issues[issueKey]
+	if ok && containsString(watch.Channels, channel) {
+		return nil
+	}
+	if count >= maxWatchesPerChannel {
+		return fmt.Errorf("a channel can follow at most %d issues", maxWatchesPerChannel)
+	}
+	if !ok {
+		watch = &issueWatch{State: state}
+		watches.issues[issueKey] = watch
+	}
+
+	watch.Channels = append(watch.Channels, channel)
+
+	return saveWatches()
+}
+
+// removeWatch unsubscribes a channel and reports whether it was subscribed
+func removeWatch(issueKey string, channel string) bool {
+	defer lockSharedState(watchesStateKey)()
+	watches.Lock()
+	defer watches.Unlock()
+	refreshSharedWatches()
+
+	watch, ok := watches.issues[issueKey]
+	if !ok || !containsString(watch.Channels, channel) {
+		return false
+	}
+
+	channels := []string{}
+	for _, c := range watch.Channels {
+		if c != channel {
+			channels = append(channels, c)
+		}
+	}
+	watch.Channels = channels
+
+	if len(channels) == 0 {
+		delete(watches.issues, issueKey)
+	}
+
+	if err := saveWatches(); err != nil {
+		log.Printf("removeWatch: Error: %v", err)
+	}
+
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatChannelWatches(channel string) string {
+	watches.Lock()
+	defer watches.Unlock()
+	refreshSharedWatches()
+
+	issueKeys := []string{}
+	for issueKey, watch := range watches.issues {
+		if containsString(watch.Channels, channel) {
+			issueKeys = append(issueKeys, issueKey)
+		}
+	}
+	sort.Strings(issueKeys)
+
+	if len(issueKeys) == 0 {
+		return "This channel doesn't follow any issues. " + watchUsage
+	}
+
+	lines := []string{"*Issues this channel follows*"}
+	for _, issueKey := range issueKeys {
+		lines = append(lines, fmt.Sprintf("> <%s|%s> %s", getJiraURL(issueKey), issueKey, watches.issues[issueKey].State.Status))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// isWatched reports whether any channel follows the issue
+func isWatched(issueKey string) bool {
+	watches.Lock()
+	defer watches.Unlock()
+
+	_, ok := watches.issues[issueKey]
+
+	return ok
+}
+
+// runWatchPolling checks the followed issues. Of several replicas, each
+// checks its share of them.
+func runWatchPolling(interval time.Duration) {
+	for range time.Tick(interval) {
+		// Changes made during maintenance show up with the next poll after it
+		if activeMaintenance(getConfig().MaintenanceWindows, time.Now()) != nil {
+			continue
+		}
+
+		watches.Lock()
+		refreshSharedWatches()
+		issueKeys := []string{}
+		for issueKey := range watches.issues {
+			if ownsKey(issueKey) {
+				issueKeys = append(issueKeys, issueKey)
+			}
+		}
+		watches.Unlock()
+
+		if isJiraBudgetTight(getConfig().JiraAPIBudget, time.Now()) {
+			checkWatchedIssueBatch(issueKeys)
+			continue
+		}
+
+		for _, issueKey := range issueKeys {
+			checkWatchedIssue(issueKey)
+		}
+	}
+}
+
+// checkWatchedIssueBatch checks the watched issues with as few searches as
+// possible, while the Jira API budget is tight. Issues the searches miss,
+// like those that moved or were deleted, are still checked one by one.
+func checkWatchedIssueBatch(issueKeys []string) {
+	found, err := searchIssueBatch(issueKeys, "summary,status,assignee,resolution")
+	if err != nil {
+		log.Printf("checkWatchedIssueBatch: Error: %v", err)
+	}
+
+	for _, issueKey := range issueKeys {
+		raw, ok := found[strings.ToUpper(issueKey)]
+		if !ok {
+			checkWatchedIssue(issueKey)
+			continue
+		}
+
+		var issue watchedIssue
+		if err := json.Unmarshal(raw, &issue); err != nil {
+			log.Printf("checkWatchedIssueBatch: Error reading %s: %v", issueKey, err)
+			continue
+		}
+		applyWatchedIssue(issueKey, issue)
+	}
+}
+
+// checkWatchedIssue tells the channels following an issue what changed since
+// they last saw it
+func checkWatchedIssue(issueKey string) {
+	issue, err := fetchWatchedIssue(context.Background(), issueKey)
+	if err != nil {
+		if getErrorKind(err) == errorKindNotFound {
+			dropWatchedIssue(issueKey)
+			return
+		}
+		log.Printf("checkWatchedIssue: Error fetching %s: %v", issueKey, err)
+		return
+	}
+
+	applyWatchedIssue(issueKey, issue)
+}
+
+// applyWatchedIssue records the state Jira reported for a watched issue, and
+// posts what changed to the channels following it
+func applyWatchedIssue(issueKey string, issue watchedIssue) {
+	unlock := lockSharedState(watchesStateKey)
+	watches.Lock()
+	refreshSharedWatches()
+	watch, ok := watches.issues[issueKey]
+	if !ok || watch.State == issue.state() {
+		watches.Unlock()
+		unlock()
+		return
+	}
+	previous := watch.State
+	watch.State = issue.state()
+	channels := append([]string{}, watch.Channels...)
+	if err := saveWatches(); err != nil {
+		log.Printf("applyWatchedIssue: Error: %v", err)
+	}
+	watches.Unlock()
+	unlock()
+
+	text := formatWatchedChanges(issueKey, issue.Fields.Summary, previous, issue.state())
+	for _, channel := range channels {
+		if err := postText(channel, "", text); err != nil {
+			log.Printf("applyWatchedIssue: Error notifying %s: %v", channel, err)
+		}
+	}
+}
+
+// dropWatchedIssue ends the watches of an issue Jira doesn't have anymore
+func dropWatchedIssue(issueKey string) {
+	unlock := lockSharedState(watchesStateKey)
+	watches.Lock()
+	refreshSharedWatches()
+	watch, ok := watches.issues[issueKey]
+	delete(watches.issues, issueKey)
+	if err := saveWatches(); err != nil {
+		log.Printf("dropWatchedIssue: Error: %v", err)
+	}
+	watches.Unlock()
+	unlock()
+
+	if !ok {
+		return
+	}
+
+	for _, channel := range watch.Channels {
+		if err := postText(channel, "", fmt.Sprintf(":no_bell: I can't find %s in Jira anymore, so this channel stopped following it.", issueKey)); err != nil {
+			log.Printf("dropWatchedIssue: Error notifying %s: %v", channel, err)
+		}
+	}
+}
+
+func formatWatchedChanges(issueKey string, summary string, previous watchedState, current watchedState) string {
+	lines := []string{fmt.Sprintf(":bell: *<%s|%s>* %s", getJiraURL(issueKey), issueKey, summary)}
+
+	for _, change := range []struct{ name, from, to string }{
+		{"Status", previous.Status, current.Status},
+		{"Assignee", previous.Assignee, current.Assignee},
+		{"Resolution", previous.Resolution, current.Resolution},
+	} {
+		if change.from != change.to {
+			lines = append(lines, fmt.Sprintf("> *%s:* %s → %s", change.name, change.from, change.to))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Key of the watches in the state store
+const watchesStateKey = "watches"
+
+func init() {
+	registerStateKind(watchesStateKey, loadWatches)
+}
+
+// loadWatches restores the watches saved before the last restart
+func loadWatches() {
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("loadWatches: Error: %v", err)
+		return
+	}
+
+	issues := map[string]*issueWatch{}
+	if ok, err := store.Load(watchesStateKey, &issues); err != nil || !ok {
+		if err != nil {
+			log.Printf("loadWatches: Error: %v", err)
+		}
+		return
+	}
+
+	watches.Lock()
+	watches.issues = issues
+	watches.Unlock()
+
+	log.Printf("loadWatches: Channels follow %d issues", len(issues))
+}
+
+// refreshSharedWatches reads the watches again, as other replicas may have
+// changed them. The caller holds the lock of watches.
+func refreshSharedWatches() {
+	if !isClusterEnabled() {
+		return
+	}
+
+	store, err := getStateStore()
+	if err != nil {
+		log.Printf("refreshSharedWatches: Error: %v", err)
+		return
+	}
+
+	issues := map[string]*issueWatch{}
+	if _, err := store.Load(watchesStateKey, &issues); err != nil {
+		log.Printf("refreshSharedWatches: Error: %v", err)
+		return
+	}
+
+	watches.issues = issues
+}
+
+// saveWatches writes the watches to the state store. The caller holds the
+// lock of watches.
+func saveWatches() error {
+	store, err := getStateStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(watchesStateKey, watches.issues)
+}
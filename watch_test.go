@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWatchesSurviveRestarts(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "data")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DATA_DIR", dir)
+	defer os.Unsetenv("DATA_DIR")
+
+	state := watchedState{Status: "Open", Assignee: "Unassigned", Resolution: "Unresolved"}
+	if err := addWatch("ABC-1", "C1", state); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	addWatch("ABC-1", "C2", watchedState{Status: "Done"})
+	addWatch("ABC-1", "C1", state)
+
+	// As after a restart
+	watches.Lock()
+	watches.issues = map[string]*issueWatch{}
+	watches.Unlock()
+	loadWatches()
+
+	watches.Lock()
+	watch := watches.issues["ABC-1"]
+	watches.Unlock()
+
+	if watch == nil || !reflect.DeepEqual(watch.Channels, []string{"C1", "C2"}) || watch.State != state {
+		t.Fatalf("Expected both channels and the first state, got %+v", watch)
+	}
+
+	if !removeWatch("ABC-1", "C1") || removeWatch("ABC-1", "C1") {
+		t.Errorf("Expected C1 to be removed once")
+	}
+	removeWatch("ABC-1", "C2")
+
+	if isWatched("ABC-1") {
+		t.Errorf("Expected the issue to be dropped without channels")
+	}
+}
+
+func TestWatchLimitPerChannel(t *testing.T) {
+	defer func() {
+		watches.Lock()
+		watches.issues = map[string]*issueWatch{}
+		watches.Unlock()
+	}()
+
+	for i := 0; i < maxWatchesPerChannel; i++ {
+		watches.issues[fmt.Sprintf("ABC-%d", i)] = &issueWatch{Channels: []string{"C1"}}
+	}
+
+	if err := addWatch("XYZ-1", "C1", watchedState{}); err == nil {
+		t.Errorf("Expected the limit to be enforced")
+	}
+	if isWatched("XYZ-1") {
+		t.Errorf("Expected no watch to be left behind")
+	}
+}
+
+func TestWatchedIssueState(t *testing.T) {
+	var issue watchedIssue
+	json.Unmarshal([]byte(`{"key": "ABC-1", "fields": {"status": {"name": "Done"}, "assignee": {"displayName": "Jane Doe"}, "resolution": {"name": "Fixed"}}}`), &issue)
+
+	if state := issue.state(); state != (watchedState{Status: "Done", Assignee: "Jane Doe", Resolution: "Fixed"}) {
+		t.Errorf("Unexpected state %+v", state)
+	}
+
+	json.Unmarshal([]byte(`{"key": "ABC-1", "fields": {"status": {"name": "Open"}, "assignee": null, "resolution": null}}`), &issue)
+
+	if state := issue.state(); state != (watchedState{Status: "Open", Assignee: "Unassigned", Resolution: "Unresolved"}) {
+		t.Errorf("Unexpected state %+v", state)
+	}
+}
+
+func TestFormatWatchedChanges(t *testing.T) {
+	os.Setenv("JIRA_BASEURL", "https://jira.example.com")
+	defer os.Unsetenv("JIRA_BASEURL")
+
+	text := formatWatchedChanges("ABC-1", "Printer on fire",
+		watchedState{Status: "Open", Assignee: "Jane Doe", Resolution: "Unresolved"},
+		watchedState{Status: "Done", Assignee: "Jane Doe", Resolution: "Fixed"})
+
+	expected := ":bell: *<https://jira.example.com/browse/ABC-1|ABC-1>* Printer on fire\n> *Status:* Open → Done\n> *Resolution:* Unresolved → Fixed"
+	if text != expected {
+		t.Errorf("Unexpected message %q", text)
+	}
+}
+
+func TestCheckWatchedIssueBatchFallsBackForMissingIssues(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/search") {
+			w.Write([]byte(`{"issues": [{"key": "ABC-1", "fields": {"summary": "Printer on fire", "status": {"name": "Done"}}}]}`))
+			return
+		}
+		w.Write([]byte(`{"key": "ABC-2", "fields": {"summary": "Moved", "status": {"name": "Done"}}}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer setBot(nil)
+	defer func() {
+		watches.Lock()
+		watches.issues = map[string]*issueWatch{}
+		watches.Unlock()
+	}()
+
+	watches.issues["ABC-1"] = &issueWatch{State: watchedState{Status: "Open", Assignee: "Unassigned", Resolution: "Unresolved"}}
+	watches.issues["ABC-2"] = &issueWatch{State: watchedState{Status: "Open", Assignee: "Unassigned", Resolution: "Unresolved"}}
+
+	checkWatchedIssueBatch([]string{"ABC-1", "ABC-2"})
+
+	if len(requests) != 2 || !strings.HasSuffix(requests[0], "/search") || !strings.HasSuffix(requests[1], "/issue/ABC-2") {
+		t.Errorf("Expected one search and one fetch of the missing issue, got %v", requests)
+	}
+	for _, issueKey := range []string{"ABC-1", "ABC-2"} {
+		if status := watches.issues[issueKey].State.Status; status != "Done" {
+			t.Errorf("Expected %s to be updated, got %q", issueKey, status)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Messages waiting for a worker before the event loop waits for room
+const messageQueueLength = 64
+
+// Queues of the workers handling messages, see startMessageWorkers
+var messageWorkers = struct {
+	sync.Mutex
+	queues []chan slack.Msg
+}{}
+
+// startMessageWorkers starts the workers handling messages, so a slow Jira
+// call only holds up the messages of one channel. Messages of a channel
+// always go to the same worker, which keeps their cards in order.
+func startMessageWorkers(count int, timeout time.Duration) {
+	messageWorkers.Lock()
+	defer messageWorkers.Unlock()
+
+	for i := len(messageWorkers.queues); i < count; i++ {
+		queue := make(chan slack.Msg, messageQueueLength)
+		messageWorkers.queues = append(messageWorkers.queues, queue)
+		go runMessageWorker(queue, timeout)
+	}
+
+	log.Printf("startMessageWorkers: %d workers handle messages", len(messageWorkers.queues))
+}
+
+func runMessageWorker(queue chan slack.Msg, timeout time.Duration) {
+	for message := range queue {
+		handleMessageWithTimeout(message, timeout)
+	}
+}
+
+// handleMessageWithTimeout handles a message, giving up on its Jira requests
+// once the timeout passed. A panic only loses the message, not the worker.
+func handleMessageWithTimeout(message slack.Msg, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	defer func() {
+		if e := recover(); e != nil {
+			log.Printf("handleMessageWithTimeout: Recovered from a panic handling %s in %s: %v", message.Timestamp, message.Channel, e)
+		}
+	}()
+
+	start := time.Now()
+	handleIncomingMessage(ctx, message)
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("handleMessageWithTimeout: Gave up on %s in %s after %v", message.Timestamp, message.Channel, time.Since(start))
+	}
+}
+
+// submitMessage hands a message to the worker of its channel. Without
+// workers, like in tests, the message is handled right away.
+func submitMessage(message slack.Msg) {
+	messageWorkers.Lock()
+	queues := messageWorkers.queues
+	messageWorkers.Unlock()
+
+	if len(queues) == 0 {
+		handleMessageWithTimeout(message, getConfig().MessageTimeout)
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(message.Channel))
+	queue := queues[h.Sum32()%uint32(len(queues))]
+
+	select {
+	case queue <- message:
+	default:
+		// Workers give up on messages after the timeout, so this can't
+		// wait forever
+		log.Printf("submitMessage: The queue for %s is full, waiting", message.Channel)
+		queue <- message
+	}
+}
+
+// getMessageQueueDepth returns the messages waiting for a worker
+func getMessageQueueDepth() int {
+	messageWorkers.Lock()
+	defer messageWorkers.Unlock()
+
+	depth := 0
+	for _, queue := range messageWorkers.queues {
+		depth += len(queue)
+	}
+
+	return depth
+}
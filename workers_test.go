@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestHandleMessageWithTimeout(t *testing.T) {
+	requests := make(chan bool, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- true
+		// A hung Jira
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	os.Setenv("JIRA_BASEURL", server.URL)
+	// The shared fetch of HUNG-1 outlives the message, but not its timeout
+	os.Setenv("MESSAGE_TIMEOUT", "200ms")
+	defer os.Unsetenv("JIRA_BASEURL")
+	defer os.Unsetenv("MESSAGE_TIMEOUT")
+	defer setBot(nil)
+
+	done := make(chan bool)
+	go func() {
+		handleMessageWithTimeout(slack.Msg{Channel: "C1", User: "U1", Text: "Look at HUNG-1 and HUNG-2"}, 100*time.Millisecond)
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the message to be given up on after the timeout")
+	}
+	if len(requests) != 1 {
+		t.Errorf("Expected the second issue to be skipped once out of time, got %d requests", len(requests))
+	}
+}
+
+func TestSubmitMessageWithoutWorkers(t *testing.T) {
+	messageWorkers.Lock()
+	queues := messageWorkers.queues
+	messageWorkers.queues = nil
+	messageWorkers.Unlock()
+	defer func() {
+		messageWorkers.Lock()
+		messageWorkers.queues = queues
+		messageWorkers.Unlock()
+	}()
+
+	// Handled right away, a bot message is ignored without calling anyone
+	submitMessage(slack.Msg{Channel: "C1", SubType: "bot_message", Text: "ABC-1"})
+
+	if getMessageQueueDepth() != 0 {
+		t.Error("Expected no messages to wait without workers")
+	}
+}